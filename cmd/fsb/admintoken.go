@@ -0,0 +1,38 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var adminTokenCmd = &cobra.Command{
+	Use:                "admin-token <metrics|cache|workers|full>",
+	Short:              "Generate a scoped admin token and its ADMIN_TOKENS entry.",
+	Example:            "fsb admin-token metrics",
+	Args:               cobra.ExactArgs(1),
+	DisableSuggestions: false,
+	Run:                runAdminToken,
+}
+
+func runAdminToken(cmd *cobra.Command, args []string) {
+	role := args[0]
+	switch role {
+	case config.AdminRoleMetrics, config.AdminRoleCache, config.AdminRoleWorkers, config.AdminRoleFull:
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown role %q, use metrics, cache, workers or full\n", role)
+		os.Exit(1)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to generate token:", err)
+		os.Exit(1)
+	}
+	token := hex.EncodeToString(secret)
+	fmt.Printf("Token (give it to the client, it is not stored): %s\n", token)
+	fmt.Printf("ADMIN_TOKENS entry: %s:%s\n", role, config.HashAdminToken(token))
+}
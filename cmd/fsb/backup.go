@@ -0,0 +1,67 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/internal/backup"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Work with the encrypted backups posted to BACKUP_CHANNEL_ID.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var backupDecryptCmd = &cobra.Command{
+	Use:                "decrypt <file>",
+	Short:              "Decrypt a backup downloaded from Telegram into a .tar.gz of the session files and redacted config.",
+	Example:            "BACKUP_PASSPHRASE=... fsb backup decrypt fsb-backup-20260101-000000.tar.gz.enc -o backup.tar.gz",
+	Args:               cobra.ExactArgs(1),
+	DisableSuggestions: false,
+	Run:                runBackupDecrypt,
+}
+
+func init() {
+	backupDecryptCmd.Flags().StringP("out", "o", "", "Output file, defaults to the input without .enc")
+	backupDecryptCmd.Flags().String("passphrase", "", "Backup passphrase, defaults to BACKUP_PASSPHRASE")
+	backupCmd.AddCommand(backupDecryptCmd)
+}
+
+func runBackupDecrypt(cmd *cobra.Command, args []string) {
+	passphrase, _ := cmd.Flags().GetString("passphrase")
+	if passphrase == "" {
+		passphrase = os.Getenv("BACKUP_PASSPHRASE")
+	}
+	if passphrase == "" {
+		fmt.Fprintln(os.Stderr, "Set BACKUP_PASSPHRASE or pass --passphrase")
+		os.Exit(1)
+	}
+	out, _ := cmd.Flags().GetString("out")
+	if out == "" {
+		out = strings.TrimSuffix(args[0], ".enc")
+		if out == args[0] {
+			out += ".tar.gz"
+		}
+	}
+
+	sealed, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	data, err := backup.Decrypt(sealed, passphrase)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to decrypt %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(out, data, 0o600); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to write archive:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Decrypted %s to %s\n", args[0], out)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/utils"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+)
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Export or import the database.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var dbExportCmd = &cobra.Command{
+	Use:                "export",
+	Short:              "Write a portable dump of the database (stats, progress, tombstones, trash).",
+	Example:            "fsb db export -o fsb-dump.json\nfsb db export --format sqlite -o fsb-backup.db",
+	DisableSuggestions: false,
+	Run:                runDBExport,
+}
+
+var dbImportCmd = &cobra.Command{
+	Use:                "import <file>",
+	Short:              "Load a JSON or SQLite dump into the database. Stop the bot first.",
+	Args:               cobra.ExactArgs(1),
+	DisableSuggestions: false,
+	Run:                runDBImport,
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{dbExportCmd, dbImportCmd} {
+		cmd.Flags().String("db", "", "Database file to use instead of DATABASE_PATH")
+	}
+	dbExportCmd.Flags().StringP("out", "o", "-", "Output file, - for stdout (JSON only)")
+	dbExportCmd.Flags().String("format", "json", "Dump format: json or sqlite")
+	dbImportCmd.Flags().Bool("replace", false, "Empty the tables before importing instead of merging rows")
+	dbCmd.AddCommand(dbExportCmd)
+	dbCmd.AddCommand(dbImportCmd)
+}
+
+// openCommandDB opens the database named by --db, or DATABASE_PATH.
+func openCommandDB(cmd *cobra.Command) (*gorm.DB, string) {
+	path, _ := cmd.Flags().GetString("db")
+	if path == "" {
+		utils.InitLogger(false, "error")
+		config.Load(utils.Logger, cmd)
+		path = config.ValueOf.DatabasePath
+	}
+	db, err := database.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open database %s: %v\n", path, err)
+		os.Exit(1)
+	}
+	return db, path
+}
+
+func runDBExport(cmd *cobra.Command, args []string) {
+	out, _ := cmd.Flags().GetString("out")
+	format, _ := cmd.Flags().GetString("format")
+	db, path := openCommandDB(cmd)
+
+	switch format {
+	case "sqlite":
+		if out == "-" {
+			fmt.Fprintln(os.Stderr, "The sqlite format needs an output file (-o)")
+			os.Exit(1)
+		}
+		if err := database.Snapshot(db, out); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to export database:", err)
+			os.Exit(1)
+		}
+	case "json":
+		dump, err := database.Export(db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to export database:", err)
+			os.Exit(1)
+		}
+		data, err := json.MarshalIndent(dump, "", "  ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to encode dump:", err)
+			os.Exit(1)
+		}
+		if out == "-" {
+			os.Stdout.Write(append(data, '\n'))
+			return
+		}
+		if err := os.WriteFile(out, data, 0o600); err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to write dump:", err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown format %q, use json or sqlite\n", format)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Exported %s to %s\n", path, out)
+}
+
+func runDBImport(cmd *cobra.Command, args []string) {
+	replace, _ := cmd.Flags().GetBool("replace")
+	dump, err := readDump(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %v\n", args[0], err)
+		os.Exit(1)
+	}
+	db, path := openCommandDB(cmd)
+	counts, err := database.Import(db, dump, replace)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Import failed, nothing was changed:", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%-24s %d rows\n", name, counts[name])
+	}
+	fmt.Printf("Imported %s into %s\n", args[0], path)
+}
+
+// readDump loads a JSON dump, or exports one from a SQLite file.
+func readDump(path string) (*database.Dump, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, sqliteHeader) {
+		var dump database.Dump
+		if err := json.Unmarshal(data, &dump); err != nil {
+			return nil, fmt.Errorf("neither a SQLite file nor a JSON dump: %w", err)
+		}
+		return &dump, nil
+	}
+
+	// Work on a copy, opening the file migrates it to this build's schema
+	tmp, err := os.CreateTemp("", "fsb-import-*.db")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := os.WriteFile(tmp.Name(), data, 0o600); err != nil {
+		return nil, err
+	}
+	src, err := database.Open(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if sqlDB, err := src.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	return database.Export(src)
+}
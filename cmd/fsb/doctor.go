@@ -0,0 +1,217 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const doctorTimeout = 15 * time.Second
+
+var doctorCmd = &cobra.Command{
+	Use:                "doctor",
+	Short:              "Check the config, bot tokens, channel access, ports and session files.",
+	Example:            "fsb doctor --config fsb.yaml",
+	Args:               cobra.NoArgs,
+	DisableSuggestions: false,
+	Run:                runDoctor,
+}
+
+func init() {
+	doctorCmd.Flags().Bool("json", false, "Print the report as JSON")
+	doctorCmd.Flags().StringP("config", "c", "", "YAML or TOML config file; env vars override it")
+}
+
+// doctorCheck is one line of the fsb doctor report.
+type doctorCheck struct {
+	Check  string `json:"check"`
+	Status string `json:"status"` // ok, warn or fail
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+type doctorReport []doctorCheck
+
+func (r *doctorReport) add(check, status, detail, fix string) {
+	*r = append(*r, doctorCheck{Check: check, Status: status, Detail: detail, Fix: fix})
+}
+
+// doctorBot is a token that passed getMe.
+type doctorBot struct {
+	username string
+	token    string
+	main     bool
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	// Config errors are fatal and printed by the logger
+	utils.InitLogger(false, "error")
+	config.Load(utils.Logger, cmd)
+
+	report := doctorReport{}
+	checkDoctorConfig(&report)
+	bots := checkDoctorTokens(&report)
+	checkDoctorChannels(&report, bots)
+	checkDoctorPort(&report, "PORT", config.ValueOf.Port)
+	checkDoctorPort(&report, "STATUS_PORT", config.ValueOf.StatusPort)
+	checkDoctorSessions(&report)
+
+	failed := 0
+	for _, check := range report {
+		if check.Status == "fail" {
+			failed++
+		}
+	}
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, check := range report {
+			fmt.Printf("[%s] %s: %s\n", strings.ToUpper(check.Status), check.Check, check.Detail)
+			if check.Fix != "" {
+				fmt.Printf("    fix: %s\n", check.Fix)
+			}
+		}
+		if failed == 0 {
+			fmt.Println("No problems found.")
+		} else {
+			fmt.Printf("%d problems found.\n", failed)
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func checkDoctorConfig(report *doctorReport) {
+	c := config.ValueOf
+	report.add("config", "ok", "loaded, links start with "+c.LinkBase(), "")
+	if strings.Contains(c.LinkBase(), "localhost") || strings.Contains(c.LinkBase(), "127.0.0.1") {
+		report.add("host", "warn", "links point at this machine only", "set HOST or PUBLIC_URL to the address users reach the server on")
+	}
+	if c.MediaChannelID == 0 && c.MediaChannelInvite == "" {
+		report.add("media channel", "warn", "MEDIA_CHANNEL_ID is not set, /direct won't work", "set MEDIA_CHANNEL_ID to the channel your files are in")
+	}
+	if c.StreamAllowLegacyHMAC && c.StreamSecret == "" {
+		report.add("stream secret", "fail", "STREAM_ALLOW_LEGACY_HMAC is on without STREAM_SECRET", "set STREAM_SECRET or turn STREAM_ALLOW_LEGACY_HMAC off")
+	}
+}
+
+// checkDoctorTokens calls getMe with every token and returns the bots that
+// answered.
+func checkDoctorTokens(report *doctorReport) []doctorBot {
+	tokens := append([]string{config.ValueOf.BotToken}, config.ValueOf.MultiTokens...)
+	var bots []doctorBot
+	for i, token := range tokens {
+		name := "BOT_TOKEN"
+		if i > 0 {
+			botID, _, _ := strings.Cut(token, ":")
+			name = "worker " + botID
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+		username, err := bot.ValidateBotToken(ctx, token)
+		cancel()
+		switch {
+		case errors.Is(err, bot.ErrInvalidBotToken):
+			report.add(name, "fail", err.Error(), "get a new token from @BotFather")
+		case err != nil:
+			report.add(name, "warn", "could not reach Telegram: "+err.Error(), "check the server's connection to api.telegram.org")
+		default:
+			report.add(name, "ok", "logged in as @"+username, "")
+			bots = append(bots, doctorBot{username: username, token: token, main: i == 0})
+		}
+	}
+	return bots
+}
+
+// checkDoctorChannels checks that every bot administers every source channel,
+// and that the main bot may post to LOG_CHANNEL.
+func checkDoctorChannels(report *doctorReport, bots []doctorBot) {
+	provisioned := config.ValueOf.ProvisionWorkers
+	for _, channelID := range config.ValueOf.SourceChannels() {
+		if channelID == 0 {
+			continue
+		}
+		check := "channel " + strconv.FormatInt(channelID, 10)
+		for _, b := range bots {
+			ctx, cancel := context.WithTimeout(context.Background(), doctorTimeout)
+			member, err := bot.CheckChannelMembership(ctx, b.token, channelID)
+			cancel()
+			switch {
+			case err != nil:
+				report.add(check, "fail", fmt.Sprintf("@%s can't see it: %s", b.username, err), fmt.Sprintf("add @%s to the channel as an admin", b.username))
+			case !member.IsAdmin() && provisioned && !b.main:
+				report.add(check, "warn", fmt.Sprintf("@%s is %s, not an admin", b.username, member.Status), "PROVISION_WORKERS promotes it at startup if the main bot or USER_SESSION may add admins")
+			case !member.IsAdmin():
+				report.add(check, "fail", fmt.Sprintf("@%s is %s, not an admin", b.username, member.Status), fmt.Sprintf("make @%s an admin of the channel", b.username))
+			case b.main && channelID == config.ValueOf.LogChannelID && !member.CanPostMessages && member.Status != "creator":
+				report.add(check, "fail", fmt.Sprintf("@%s can't post to LOG_CHANNEL", b.username), "give it the Post Messages admin right")
+			default:
+				report.add(check, "ok", fmt.Sprintf("@%s is an admin", b.username), "")
+			}
+		}
+	}
+}
+
+func checkDoctorPort(report *doctorReport, name string, port int) {
+	network, address := config.ListenAddr(port)
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		report.add(name, "warn", fmt.Sprintf("can't listen on %s: %s", address, err), "stop whatever uses the port, unless it is fsb itself, or pick another "+name)
+		return
+	}
+	listener.Close()
+	report.add(name, "ok", "port "+strconv.Itoa(port)+" is free", "")
+}
+
+// checkDoctorSessions checks that session files can be written and aren't
+// open to other users: they hold the bots' auth keys.
+func checkDoctorSessions(report *doctorReport) {
+	if !config.ValueOf.UseSessionFile {
+		report.add("session files", "ok", "USE_SESSION_FILE is off", "")
+		return
+	}
+	files, err := bot.ListSessionFiles()
+	if err != nil {
+		report.add("session files", "fail", err.Error(), "")
+		return
+	}
+	for _, dir := range []string{".", filepath.Dir(bot.WorkerSessionPath(1))} {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			probe, err := os.CreateTemp(dir, ".fsb-doctor-*")
+			if err != nil {
+				report.add("session files", "fail", fmt.Sprintf("can't write to %s: %s", dir, err), "give the user running fsb write access to "+dir)
+				continue
+			}
+			probe.Close()
+			os.Remove(probe.Name())
+		}
+	}
+	loose := 0
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			report.add("session files", "fail", err.Error(), "")
+			continue
+		}
+		if info.Mode().Perm()&0o077 != 0 {
+			loose++
+			report.add("session files", "warn", fmt.Sprintf("%s is open to other users (%s)", filepath.Clean(file), info.Mode().Perm()), "chmod 600 "+filepath.Clean(file))
+		}
+	}
+	if loose == 0 {
+		report.add("session files", "ok", fmt.Sprintf("%d found, `fsb workers doctor` checks they are still authorized", len(files)), "")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/janitor"
+	"EverythingSuckz/fsb/internal/routes"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runEdge serves an instance without Telegram credentials: requests are
+// proxied to EDGE_ORIGIN_URL and thumbnails are cached locally.
+func runEdge(log *zap.Logger) {
+	mainLogger := log.Named("Main")
+	router := newBaseRouter(log)
+	if err := routes.LoadEdge(log, router, config.ValueOf.EdgeOriginURL); err != nil {
+		log.Panic("Failed to load edge routes", zap.Error(err))
+	}
+	janitor.Recover(log)
+	janitor.Start(log, time.Duration(config.ValueOf.JanitorIntervalMinutes)*time.Minute)
+
+	mainLogger.Info("Edge server started", zap.Int("port", config.ValueOf.Port), zap.String("origin", config.ValueOf.EdgeOriginURL))
+	mainLogger.Info("File Stream Bot", zap.String("version", versionString))
+	if err := serveMain(mainLogger, routes.WithBasePath(router)); err != nil {
+		mainLogger.Sugar().Fatalln(err)
+	}
+}
@@ -26,6 +26,13 @@ func init() {
 	config.SetFlagsFromConfig(runCmd)
 	rootCmd.AddCommand(runCmd)
 	rootCmd.AddCommand(sessionCmd)
+	rootCmd.AddCommand(workersCmd)
+	rootCmd.AddCommand(dbCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(checkUpdateCmd)
+	rootCmd.AddCommand(adminTokenCmd)
+	rootCmd.AddCommand(signCmd)
+	rootCmd.AddCommand(doctorCmd)
 	rootCmd.SetVersionTemplate(fmt.Sprintf(`Telegram File Stream Bot version %s`, versionString))
 }
 
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/cluster"
+	"EverythingSuckz/fsb/internal/routes"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// runRedirectFront serves an instance without Telegram credentials that
+// redirects every request to the least loaded of REDIRECT_REPLICAS.
+func runRedirectFront(log *zap.Logger) {
+	mainLogger := log.Named("Main")
+	replicas, err := cluster.ParseReplicas(config.ValueOf.RedirectReplicas)
+	if err != nil {
+		log.Panic("Invalid REDIRECT_REPLICAS", zap.Error(err))
+	}
+	balancer := cluster.NewBalancer(log, replicas)
+	balancer.Start(time.Duration(config.ValueOf.RedirectPollSeconds) * time.Second)
+
+	router := newBaseRouter(log)
+	routes.LoadRedirect(log, router, balancer)
+
+	mainLogger.Info("Redirect front started", zap.Int("port", config.ValueOf.Port), zap.Int("replicas", len(replicas)))
+	mainLogger.Info("File Stream Bot", zap.String("version", versionString))
+	if err := serveMain(mainLogger, routes.WithBasePath(router)); err != nil {
+		mainLogger.Sugar().Fatalln(err)
+	}
+}
@@ -2,13 +2,31 @@ package main
 
 import (
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/backup"
+	"EverythingSuckz/fsb/internal/blocklist"
 	"EverythingSuckz/fsb/internal/bot"
 	"EverythingSuckz/fsb/internal/cache"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/dyndns"
+	"EverythingSuckz/fsb/internal/flags"
+	"EverythingSuckz/fsb/internal/invites"
+	"EverythingSuckz/fsb/internal/janitor"
+	"EverythingSuckz/fsb/internal/publicip"
+	"EverythingSuckz/fsb/internal/retention"
 	"EverythingSuckz/fsb/internal/routes"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/trash"
 	"EverythingSuckz/fsb/internal/types"
+	"EverythingSuckz/fsb/internal/updatecheck"
+	"EverythingSuckz/fsb/internal/upload"
 	"EverythingSuckz/fsb/internal/utils"
-	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -36,9 +54,24 @@ func runApp(cmd *cobra.Command, args []string) {
 
 	// Re-initialize logger with actual config values
 	utils.InitLogger(config.ValueOf.Dev, config.ValueOf.LogLevel)
+	utils.SetLogLevels(config.ValueOf.LogLevels)
+	config.OnReload(func(changed []string) {
+		if slices.Contains(changed, "LOG_LEVELS") {
+			utils.SetLogLevels(config.Live().LogLevels)
+		}
+	})
 	log = utils.Logger
 	mainLogger = log.Named("Main")
 
+	if config.ValueOf.IsEdge() {
+		runEdge(log)
+		return
+	}
+	if config.ValueOf.IsRedirectFront() {
+		runRedirectFront(log)
+		return
+	}
+
 	// Create main router for file streaming
 	router := getRouter(log)
 
@@ -49,54 +82,177 @@ func runApp(cmd *cobra.Command, args []string) {
 	if err != nil {
 		log.Panic("Failed to start main bot", zap.Error(err))
 	}
-	cache.InitCache(log)
+	if err := cache.InitCache(log); err != nil {
+		log.Panic("Failed to initialize cache", zap.Error(err))
+	}
+	if err := utils.InitChunkCache(log); err != nil {
+		log.Panic("Failed to initialize chunk cache", zap.Error(err))
+	}
+	if err := database.Init(log); err != nil {
+		log.Panic("Failed to initialize database", zap.Error(err))
+	}
+	stats.StartBandwidthFlusher(log)
+	stats.StartHistoryPruner(log, config.ValueOf.RequestHistoryDays)
+	retention.Load(log)
+	flags.Load(log)
+	trash.Start(log)
+	blocklist.Load(log)
+	invites.Load(log)
+	janitor.Recover(log)
+	janitor.Start(log, time.Duration(config.ValueOf.JanitorIntervalMinutes)*time.Minute)
 	workers, err := bot.StartWorkers(log)
 	if err != nil {
 		log.Panic("Failed to start workers", zap.Error(err))
 		return
 	}
 	workers.AddDefaultClient(mainBot, mainBot.Self)
+	upload.Resume()
 	bot.StartUserBot(log)
+	bot.ResolveInviteChannels(log)
+	bot.ProvisionWorkers(log)
+	bot.StartPingMonitor(log)
+	bot.StartCapacityWebhook(log)
+	bot.WarmUpPeers(log)
+	bot.StartAccessChecks(log)
+	bot.StartLogDigest(log)
+	bot.StartRetention(log)
+	backup.Start(log)
+	bot.StartPublicIPNotifier(log)
+	bot.StartUpdateNotifier(log)
+	updatecheck.Start(log, versionString)
+	dyndns.Start(log)
+	publicip.Start(log)
+	go reloadOnSIGHUP(log)
+	go checkPublicPort(log.Named("PublicIP"))
+	if config.ValueOf.CacheSnapshotFile != "" {
+		onShutdown(func() { saveCacheSnapshot(log) })
+	}
+	go exitOnSignal(log)
 
 	mainLogger.Info("Server started", zap.Int("mainPort", config.ValueOf.Port), zap.Int("statusPort", config.ValueOf.StatusPort))
 	mainLogger.Info("File Stream Bot", zap.String("version", versionString))
-	mainLogger.Sugar().Infof("Main server is running at %s", config.ValueOf.Host)
-	mainLogger.Sugar().Infof("Status server is running at http://0.0.0.0:%d/status", config.ValueOf.StatusPort)
+	mainLogger.Sugar().Infof("Main server is running at %s", config.ValueOf.LinkBase())
+	_, statusAddr := config.ListenAddr(config.ValueOf.StatusPort)
+	mainLogger.Sugar().Infof("Status server is listening on %s (/status)", statusAddr)
 
 	// Start status server in a goroutine
 	go func() {
 		statusLogger := log.Named("StatusServer")
 		statusLogger.Info("Starting status server", zap.Int("port", config.ValueOf.StatusPort))
-		err := statusRouter.Run(fmt.Sprintf(":%d", config.ValueOf.StatusPort))
+		err := serveStatus(statusLogger, statusRouter)
 		if err != nil {
 			statusLogger.Sugar().Fatalln("Failed to start status server:", err)
 		}
 	}()
 
 	// Start main server (blocking)
-	err = router.Run(fmt.Sprintf(":%d", config.ValueOf.Port))
+	err = serveMain(mainLogger, routes.WithBasePath(router))
 	if err != nil {
 		mainLogger.Sugar().Fatalln(err)
 	}
 }
 
+// reloadOnSIGHUP reloads the config on every SIGHUP, without dropping
+// streams or logging the bots in again.
+func reloadOnSIGHUP(log *zap.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if _, err := config.Reload(log); err != nil {
+			log.Named("Config").Error("Failed to reload config", zap.Error(err))
+		}
+	}
+}
+
+// shutdownHooks run in order on SIGINT or SIGTERM, before the process exits.
+var shutdownHooks []func()
+
+// onShutdown registers fn to run on SIGINT or SIGTERM. It must be called
+// before exitOnSignal starts.
+func onShutdown(fn func()) {
+	shutdownHooks = append(shutdownHooks, fn)
+}
+
+// exitOnSignal waits for SIGINT or SIGTERM, runs the shutdown hooks and
+// exits with 128+signal, the status the signal would have left, so
+// supervisors still see how the process ended.
+func exitOnSignal(log *zap.Logger) {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	sig := <-stop
+	log.Info("Shutting down", zap.String("signal", sig.String()))
+	for _, hook := range shutdownHooks {
+		hook()
+	}
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	os.Exit(code)
+}
+
+// saveCacheSnapshot snapshots the metadata cache, so the next start doesn't
+// refetch it all from Telegram.
+func saveCacheSnapshot(log *zap.Logger) {
+	if err := cache.SaveSnapshot(log); err != nil {
+		log.Named("cache").Error("Failed to save cache snapshot", zap.Error(err))
+	}
+}
+
+// portListening is closed once a server listens on PORT.
+var (
+	portListening     = make(chan struct{})
+	portListeningOnce sync.Once
+)
+
+// checkPublicPort warns when PORT can't be reached on the public IP found
+// with USE_PUBLIC_IP. It waits for the main server to listen, as nothing
+// answers on PORT before.
+func checkPublicPort(log *zap.Logger) {
+	ip := config.ValueOf.PublicIP()
+	if ip == "" {
+		return
+	}
+	<-portListening
+	if !config.PortReachable(ip, config.ValueOf.Port) {
+		log.Warn("PORT is not reachable on the public IP, it may be blocked by a firewall",
+			zap.String("ip", ip),
+			zap.Int("port", config.ValueOf.Port))
+	}
+}
+
+// serve runs handler on port, honouring BIND_IPV6.
+func serve(handler http.Handler, port int) error {
+	network, address := config.ListenAddr(port)
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	if port == config.ValueOf.Port {
+		portListeningOnce.Do(func() { close(portListening) })
+	}
+	return http.Serve(listener, handler)
+}
+
 func getRouter(log *zap.Logger) *gin.Engine {
+	router := newBaseRouter(log)
+	routes.Load(log, router)
+	return router
+}
+
+// newBaseRouter creates the main engine with its middlewares and the root route.
+func newBaseRouter(log *zap.Logger) *gin.Engine {
 	if config.ValueOf.Dev {
 		gin.SetMode(gin.DebugMode)
 	} else {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Disable GIN default logger if log level is error or warn
-	var router *gin.Engine
-	if config.ValueOf.LogLevel == "error" || config.ValueOf.LogLevel == "warn" {
-		router = gin.New()
-		router.Use(gin.Recovery())
-		router.Use(gin.ErrorLogger())
-	} else {
-		router = gin.Default()
-		router.Use(gin.ErrorLogger())
-	}
+	// Requests are logged by routes.AccessLog, which follows LOG_LEVEL
+	router := gin.New()
+	setTrustedProxies(log, router)
+	router.Use(routes.RequestID, routes.AccessLog(log), gin.Recovery())
+	router.Use(gin.ErrorLogger())
 
 	router.GET("/", func(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, types.RootResponse{
@@ -106,10 +262,19 @@ func getRouter(log *zap.Logger) *gin.Engine {
 			Version: versionString,
 		})
 	})
-	routes.Load(log, router)
 	return router
 }
 
+// setTrustedProxies makes ClientIP read X-Forwarded-For only from
+// TRUSTED_PROXIES. Without it the header is ignored, otherwise any client
+// could pick the IP that rate limits, bans and logs see.
+func setTrustedProxies(log *zap.Logger, router *gin.Engine) {
+	if err := router.SetTrustedProxies(config.ValueOf.TrustedProxies); err != nil {
+		log.Warn("Ignoring TRUSTED_PROXIES, expected IPs or CIDRs", zap.Error(err))
+		router.SetTrustedProxies(nil)
+	}
+}
+
 func getStatusRouter(log *zap.Logger) *gin.Engine {
 	if config.ValueOf.Dev {
 		gin.SetMode(gin.DebugMode)
@@ -118,13 +283,9 @@ func getStatusRouter(log *zap.Logger) *gin.Engine {
 	}
 
 	// Create a minimal router for status only
-	var router *gin.Engine
-	if config.ValueOf.LogLevel == "error" || config.ValueOf.LogLevel == "warn" {
-		router = gin.New()
-		router.Use(gin.Recovery())
-	} else {
-		router = gin.Default()
-	}
+	router := gin.New()
+	setTrustedProxies(log, router)
+	router.Use(routes.RequestID, routes.AccessLog(log), gin.Recovery())
 
 	// Only load the status route
 	routes.LoadStatusOnly(log, router)
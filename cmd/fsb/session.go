@@ -19,6 +19,7 @@ func init() {
 	sessionCmd.Flags().StringP("login-type", "T", "qr", "The login type to use. Can be either 'qr' or 'phone'")
 	sessionCmd.Flags().Int32P("api-id", "I", 0, "The API ID to use for the session (required).")
 	sessionCmd.Flags().StringP("api-hash", "H", "", "The API hash to use for the session (required).")
+	sessionCmd.Flags().StringP("phone", "P", "", "Phone number to log in with when the login type is 'phone', asked for when not given.")
 	sessionCmd.MarkFlagRequired("api-id")
 	sessionCmd.MarkFlagRequired("api-hash")
 }
@@ -30,12 +31,11 @@ func generateSession(cmd *cobra.Command, args []string) {
 	if loginType == "qr" {
 		qrlogin.GenerateQRSession(int(apiId), apiHash)
 	} else if loginType == "phone" {
-		generatePhoneSession()
+		phone, _ := cmd.Flags().GetString("phone")
+		if err := qrlogin.GeneratePhoneSession(int(apiId), apiHash, phone); err != nil {
+			fmt.Println("Error while logging in:", err)
+		}
 	} else {
 		fmt.Println("Invalid login type. Please use either 'qr' or 'phone'")
 	}
 }
-
-func generatePhoneSession() {
-	fmt.Println("Phone session is not implemented yet.")
-}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/streamauth"
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:                "sign",
+	Short:              "Print a /direct link signed with STREAM_SECRET, for clients on legacy signed links.",
+	Example:            "fsb sign --message-id 123 --expires 1h",
+	Args:               cobra.NoArgs,
+	DisableSuggestions: false,
+	Run:                runSign,
+}
+
+func init() {
+	signCmd.Flags().Int("message-id", 0, "ID of the message in MEDIA_CHANNEL_ID")
+	signCmd.Flags().Duration("expires", time.Hour, "How long the link stays valid")
+	signCmd.Flags().String("host", "", "Server host to put in the link, defaults to the configured one")
+	signCmd.Flags().StringP("config", "c", "", "YAML or TOML config file; env vars override it")
+	signCmd.MarkFlagRequired("message-id")
+}
+
+func runSign(cmd *cobra.Command, args []string) {
+	utils.InitLogger(false, "error")
+	config.Load(utils.Logger, cmd)
+
+	messageID, _ := cmd.Flags().GetInt("message-id")
+	expires, _ := cmd.Flags().GetDuration("expires")
+	if messageID <= 0 {
+		fmt.Fprintln(os.Stderr, "--message-id must be a positive message ID")
+		os.Exit(1)
+	}
+	if expires <= 0 {
+		fmt.Fprintln(os.Stderr, "--expires must be positive, e.g. 30m or 24h")
+		os.Exit(1)
+	}
+	if config.ValueOf.StreamSecret == "" {
+		fmt.Fprintln(os.Stderr, "STREAM_SECRET is not set")
+		os.Exit(1)
+	}
+	if !config.ValueOf.StreamAllowLegacyHMAC {
+		fmt.Fprintln(os.Stderr, "Warning: STREAM_ALLOW_LEGACY_HMAC is off, the server rejects signed links")
+	}
+
+	expiresAt := time.Now().Add(expires)
+	sig := streamauth.SignLegacyHMAC(config.ValueOf.StreamSecret, messageID, expiresAt)
+	// The signature covers the message ID, which the server decodes from
+	// opaque IDs before checking it
+	id := opaqueid.ID(config.ValueOf.MediaChannelID, messageID)
+	fmt.Printf("%s/direct/%s?exp=%d&sig=%s\n", config.ValueOf.LinkBase(), id, expiresAt.Unix(), sig)
+}
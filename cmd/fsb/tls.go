@@ -0,0 +1,164 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certCheckInterval is how often TLS_CERT and TLS_KEY are checked for a
+// renewed certificate.
+const certCheckInterval = time.Minute
+
+var (
+	tlsOnce    sync.Once
+	tlsConfig  *tls.Config
+	acmeClient *autocert.Manager
+)
+
+// loadTLSConfig sets up the certificates of the servers once, nil when TLS
+// is off.
+func loadTLSConfig(log *zap.Logger) *tls.Config {
+	tlsOnce.Do(func() {
+		if !config.ValueOf.TLSEnabled() {
+			return
+		}
+		log = log.Named("TLS")
+		if config.ValueOf.TLSAutocert {
+			if err := os.MkdirAll(config.ValueOf.TLSAutocertDir, 0o700); err != nil {
+				log.Fatal("Failed to create TLS_AUTOCERT_DIR", zap.Error(err))
+			}
+			acmeClient = &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				Cache:      autocert.DirCache(config.ValueOf.TLSAutocertDir),
+				HostPolicy: autocert.HostWhitelist(config.ValueOf.TLSAutocertDomains...),
+				Email:      config.ValueOf.TLSAutocertEmail,
+			}
+			tlsConfig = acmeClient.TLSConfig()
+			return
+		}
+		certs, err := newCertReloader(log, config.ValueOf.TLSCert, config.ValueOf.TLSKey)
+		if err != nil {
+			log.Fatal("Failed to load TLS_CERT and TLS_KEY", zap.Error(err))
+		}
+		tlsConfig = &tls.Config{GetCertificate: certs.getCertificate}
+	})
+	return tlsConfig
+}
+
+// serveMain runs handler on PORT, or on TLS_PORT when TLS is on. PORT then
+// redirects to HTTPS and answers the HTTP challenges of Let's Encrypt.
+func serveMain(log *zap.Logger, handler http.Handler) error {
+	cfg := loadTLSConfig(log)
+	if cfg == nil {
+		return serve(handler, config.ValueOf.Port)
+	}
+	go func() {
+		var redirect http.Handler = http.HandlerFunc(redirectToHTTPS)
+		if acmeClient != nil {
+			redirect = acmeClient.HTTPHandler(redirect)
+		}
+		if err := serve(redirect, config.ValueOf.Port); err != nil {
+			log.Sugar().Fatalln("Failed to start HTTPS redirect:", err)
+		}
+	}()
+	return serveTLS(handler, config.ValueOf.TLSPort, cfg)
+}
+
+// serveStatus runs the status server on STATUS_PORT, over HTTPS when TLS is on.
+func serveStatus(log *zap.Logger, handler http.Handler) error {
+	if cfg := loadTLSConfig(log); cfg != nil {
+		return serveTLS(handler, config.ValueOf.StatusPort, cfg)
+	}
+	return serve(handler, config.ValueOf.StatusPort)
+}
+
+// serveTLS runs handler on port with cfg, honouring BIND_IPV6.
+func serveTLS(handler http.Handler, port int, cfg *tls.Config) error {
+	network, address := config.ListenAddr(port)
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: handler, TLSConfig: cfg}
+	// The certificate comes from cfg
+	return server.ServeTLS(listener, "", "")
+}
+
+func redirectToHTTPS(w http.ResponseWriter, r *http.Request) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	if port := config.ValueOf.TLSPort; port != 443 {
+		host = net.JoinHostPort(host, strconv.Itoa(port))
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+}
+
+// certReloader serves TLS_CERT and picks up renewals, e.g. by certbot,
+// without a restart.
+type certReloader struct {
+	log               *zap.Logger
+	certFile, keyFile string
+	mu                sync.Mutex
+	cert              *tls.Certificate
+	certMod, keyMod   time.Time
+	lastCheck         time.Time
+}
+
+func newCertReloader(log *zap.Logger, certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{log: log, certFile: certFile, keyFile: keyFile}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.lastCheck) >= certCheckInterval {
+		// A failed reload keeps the previous certificate
+		if err := c.reload(); err != nil {
+			c.log.Warn("Failed to reload TLS certificate", zap.Error(err))
+		}
+	}
+	return c.cert, nil
+}
+
+// reload reads the certificate again when either file changed. c.mu must be
+// held, except from newCertReloader.
+func (c *certReloader) reload() error {
+	c.lastCheck = time.Now()
+	certInfo, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(c.keyFile)
+	if err != nil {
+		return err
+	}
+	if certInfo.ModTime().Equal(c.certMod) && keyInfo.ModTime().Equal(c.keyMod) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.certFile, err)
+	}
+	if c.cert != nil {
+		c.log.Info("Reloaded renewed TLS certificate")
+	}
+	c.cert = &cert
+	c.certMod, c.keyMod = certInfo.ModTime(), keyInfo.ModTime()
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/updatecheck"
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var checkUpdateCmd = &cobra.Command{
+	Use:                "check-update",
+	Short:              "Check GitHub for a newer release and list its breaking changes.",
+	DisableSuggestions: false,
+	Run:                runCheckUpdate,
+}
+
+func init() {
+	checkUpdateCmd.Flags().String("repo", "", "GitHub repository to check, defaults to UPDATE_CHECK_REPO")
+}
+
+func runCheckUpdate(cmd *cobra.Command, args []string) {
+	repo, _ := cmd.Flags().GetString("repo")
+	if repo == "" {
+		repo = os.Getenv("UPDATE_CHECK_REPO")
+	}
+	if repo == "" {
+		repo = config.ValueOf.UpdateCheckRepo
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	status, err := updatecheck.Check(ctx, repo, versionString)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to check for updates:", err)
+		os.Exit(1)
+	}
+	if !status.UpdateAvailable {
+		fmt.Printf("fsb %s is up to date\n", versionString)
+		return
+	}
+	fmt.Printf("fsb %s is available, running %s\n", status.Latest, versionString)
+	for _, r := range status.Releases {
+		fmt.Printf("\n%s (%s)\n", r.Version, r.URL)
+		for _, note := range r.Breaking {
+			fmt.Printf("  BREAKING: %s\n", note)
+		}
+	}
+	if status.Breaking {
+		fmt.Println("\nThis update contains breaking changes, read the release notes before upgrading.")
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var workersCmd = &cobra.Command{
+	Use:   "workers",
+	Short: "Manage worker bot sessions.",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var workersDoctorCmd = &cobra.Command{
+	Use:                "doctor",
+	Short:              "Check every session file and optionally remove broken ones.",
+	DisableSuggestions: false,
+	Run:                runWorkersDoctor,
+}
+
+func init() {
+	workersDoctorCmd.Flags().Bool("json", false, "Print the report as JSON")
+	workersDoctorCmd.Flags().Bool("fix", false, "Offer to delete broken sessions so they are rebuilt on next start")
+	workersDoctorCmd.Flags().BoolP("yes", "y", false, "Delete broken sessions without asking (implies --fix)")
+	workersCmd.AddCommand(workersDoctorCmd)
+}
+
+func runWorkersDoctor(cmd *cobra.Command, args []string) {
+	utils.InitLogger(false, "error")
+	config.Load(utils.Logger, cmd)
+
+	asJSON, _ := cmd.Flags().GetBool("json")
+	fix, _ := cmd.Flags().GetBool("fix")
+	yes, _ := cmd.Flags().GetBool("yes")
+	fix = fix || yes
+
+	files, err := bot.ListSessionFiles()
+	if err != nil {
+		fmt.Println("Failed to list session files:", err)
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Println("No session files found.")
+		return
+	}
+
+	report := make([]bot.SessionHealth, 0, len(files))
+	for _, file := range files {
+		report = append(report, bot.InspectSessionFile(context.Background(), file, int(config.ValueOf.ApiID), config.ValueOf.ApiHash))
+	}
+
+	if asJSON {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		printSessionReport(report)
+	}
+
+	if !fix {
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for _, health := range report {
+		if health.Healthy() {
+			continue
+		}
+		if !yes {
+			fmt.Printf("Delete broken session %s (%s)? [y/N]: ", health.Path, health.Error)
+			answer, _ := reader.ReadString('\n')
+			if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+				continue
+			}
+		}
+		if err := os.Remove(health.Path); err != nil {
+			fmt.Printf("Failed to delete %s: %s\n", health.Path, err)
+			continue
+		}
+		fmt.Printf("Deleted %s, it will be rebuilt from the bot token on next start\n", health.Path)
+	}
+}
+
+func printSessionReport(report []bot.SessionHealth) {
+	for _, health := range report {
+		status := "OK"
+		if !health.Healthy() {
+			status = "BROKEN"
+		}
+		lastUsed := "unknown"
+		if !health.LastUsed.IsZero() {
+			lastUsed = health.LastUsed.Format(time.RFC3339)
+		}
+		fmt.Printf("[%s] %s\n", status, health.Path)
+		fmt.Printf("    dc: %d (%s)\n", health.DC, health.Addr)
+		fmt.Printf("    last used: %s\n", lastUsed)
+		if health.Username != "" {
+			fmt.Printf("    account: @%s (%d)\n", health.Username, health.UserID)
+		}
+		if health.Error != "" {
+			fmt.Printf("    error: %s\n", health.Error)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+)
+
+// Roles of admin tokens. Every role can read; the others add the operations
+// named after them, and full allows everything.
+const (
+	AdminRoleMetrics = "metrics"
+	AdminRoleCache   = "cache"
+	AdminRoleWorkers = "workers"
+	AdminRoleFull    = "full"
+)
+
+var adminRoles = map[string]bool{
+	AdminRoleMetrics: true,
+	AdminRoleCache:   true,
+	AdminRoleWorkers: true,
+	AdminRoleFull:    true,
+}
+
+// HashAdminToken is how a token is written in ADMIN_TOKENS.
+func HashAdminToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// AdminEnabled reports whether any admin token is configured.
+func (c *config) AdminEnabled() bool {
+	return c.AdminToken != "" || len(c.adminTokens) > 0
+}
+
+// AdminRole returns the role of an admin token, or "" for unknown tokens.
+// ADMIN_TOKEN is compared as is and has the full role.
+func (c *config) AdminRole(token string) string {
+	if token == "" {
+		return ""
+	}
+	if c.AdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(c.AdminToken)) == 1 {
+		return AdminRoleFull
+	}
+	return c.adminTokens[HashAdminToken(token)]
+}
+
+// AdminRoleAllows reports whether role may do what needs requires.
+func AdminRoleAllows(role, needs string) bool {
+	switch {
+	case role == "":
+		return false
+	case role == AdminRoleFull, needs == AdminRoleMetrics:
+		return true
+	}
+	return role == needs
+}
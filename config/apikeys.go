@@ -0,0 +1,50 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// APIKeysEnabled reports whether any API key is configured.
+func (c *config) APIKeysEnabled() bool {
+	return len(c.apiKeys) > 0
+}
+
+// APIKeyLabel returns the label of an API key, or "" for unknown keys. Keys
+// are looked up by hash so the comparison doesn't leak their bytes.
+func (c *config) APIKeyLabel(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return c.apiKeys[hex.EncodeToString(sum[:])]
+}
+
+// loadAPIKeys parses API_KEYS, given as <label>:<key> or just <key>. Keys
+// without a label are named by their position.
+func (c *config) loadAPIKeys(log *zap.Logger) {
+	c.apiKeys = make(map[string]string)
+	for i, entry := range c.APIKeys {
+		entry = strings.TrimSpace(entry)
+		label, key, found := strings.Cut(entry, ":")
+		if !found {
+			label, key = "key"+strconv.Itoa(i+1), entry
+		}
+		if key == "" || label == "" {
+			log.Sugar().Warnf("Ignoring API_KEYS entry #%d, expected <label>:<key> or <key>", i+1)
+			continue
+		}
+		if len(key) < 16 {
+			log.Sugar().Warnf("API key %q is shorter than 16 characters", label)
+		}
+		sum := sha256.Sum256([]byte(key))
+		c.apiKeys[hex.EncodeToString(sum[:])] = label
+	}
+	if len(c.apiKeys) > 0 {
+		log.Sugar().Infof("API key authentication enabled with %d keys", len(c.apiKeys))
+	}
+}
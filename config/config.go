@@ -1,15 +1,19 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"io"
 	"net"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
@@ -30,16 +34,79 @@ const (
 	defaultHashLength                int    = 6
 	defaultUseSessionFile            bool   = true
 	defaultUsePublicIP               bool   = false
+	defaultBindIPv6                  bool   = false
 	defaultFirebaseProjectID         string = "mediatg-16cbb"
 	defaultFirebaseCertsURL          string = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+	defaultFirebaseCertsGraceMinutes int    = 1440
 	defaultStreamSessionTTLSeconds   int    = 28800
+	defaultStreamSessionMaxSeconds   int    = 86400
 	defaultStreamSessionCleanupSecs  int    = 60
 	defaultStreamSessionCookieName   string = "fsb_stream_session"
 	defaultStreamSessionCookieSec    bool   = true
 	defaultStreamSessionCookieDomain string = ""
+	defaultStreamSessionCookieSite   string = "lax"
+	defaultAuthMaxFailures           int    = 10
+	defaultAuthFailureWindowSeconds  int    = 300
+	defaultAuthBanSeconds            int    = 900
 	defaultDirectRaceWorkers         int    = 2
+	defaultRobotsTxt                 string = "disallow"
+	defaultNoIndex                   bool   = true
+	defaultBrandName                 string = "FileStreamBot"
+	defaultTLSPort                   int    = 8443
+	defaultWebAppInitDataMaxAge      int    = 86400
+	defaultPremiumDays               int    = 30
+	defaultPremiumLimitMultiplier    int    = 2
+	defaultTLSAutocertDir            string = "./certs"
+	defaultBrandColor                string = "#667eea"
+	defaultBrandAccentColor          string = "#764ba2"
+	defaultLogDigest                 string = ""
+	defaultLogDigestTopFiles         int    = 5
+	defaultDatabasePath              string = "fsb.db"
+	defaultRequestHistoryDays        int    = 30
+	defaultAbuseAction               string = "off"
+	defaultAbuseWindowSeconds        int    = 600
+	defaultAbuseMaxNotFound          int    = 30
+	defaultAbuseMaxSequential        int    = 20
+	defaultAbuseMaxFiles             int    = 200
+	defaultAbusePenaltySeconds       int    = 3600
+	defaultAbuseThrottlePerMinute    int    = 6
+	defaultJanitorIntervalMinutes    int    = 60
+	defaultImageCacheMaxAgeHours     int    = 168
+	defaultMinFreeDiskMB             int    = 512
+	defaultChunkCacheDir             string = "./chunks"
+	defaultImageStore                string = "local"
+	defaultRedirectPollSeconds       int    = 5
+	defaultTranscodeDir              string = "./transcodes"
+	defaultTranscodeMinRequests      int    = 5
+	defaultTranscodeWorkers          int    = 1
+	defaultTranscodeMaxAgeHours      int    = 168
+	defaultFFmpegPath                string = "ffmpeg"
+	defaultAudioMaxJobs              int    = 4
+	defaultHLSSegmentSeconds         int    = 6
+	defaultHLSMaxJobs                int    = 8
+	defaultUploadProgressSeconds     int    = 5
+	defaultUploadDir                 string = "./uploads"
+	defaultUploadMaxSizeMB           int64  = 2000
+	defaultUploadExpiryHours         int    = 24
+	defaultFFprobePath               string = "ffprobe"
+	defaultRetentionCheckHours       int    = 6
+	defaultTrashDays                 int    = 7
+	defaultBackupIntervalHours       int    = 24
+	defaultUpdateCheckRepo           string = "EverythingSuckz/TG-FileStreamBot"
+	defaultTGBudgetRPS               int    = 30
+	defaultTGBudgetBurst             int    = 15
+	defaultWorkerPingSeconds         int    = 60
+	defaultWorkerUnhealthyAfter      int    = 3
+	defaultBalancerShadowStrategy    string = "two_choices"
+	defaultCacheBackend              string = "memory"
+	defaultCacheSnapshotMB           int    = 16
+	defaultCapacityHighPercent       int    = 80
+	defaultCapacityLowPercent        int    = 40
 )
 
+// PremiumFeatures are the features PREMIUM_ONLY can keep to premium users.
+var PremiumFeatures = []string{"zip", "playlist", "hls", "audio"}
+
 var ValueOf = &config{
 	ApiID:                       defaultAPIID,
 	LogChannelID:                defaultLogChannelID,
@@ -52,14 +119,74 @@ var ValueOf = &config{
 	HashLength:                  defaultHashLength,
 	UseSessionFile:              defaultUseSessionFile,
 	UsePublicIP:                 defaultUsePublicIP,
-	FirebaseProjectID:           defaultFirebaseProjectID,
+	BindIPv6:                    defaultBindIPv6,
+	FirebaseProjectIDs:          []string{defaultFirebaseProjectID},
 	FirebaseCertsURL:            defaultFirebaseCertsURL,
+	FirebaseCertsGraceMinutes:   defaultFirebaseCertsGraceMinutes,
 	StreamSessionTTLSeconds:     defaultStreamSessionTTLSeconds,
+	StreamSessionMaxSeconds:     defaultStreamSessionMaxSeconds,
 	StreamSessionCleanupSeconds: defaultStreamSessionCleanupSecs,
 	StreamSessionCookieName:     defaultStreamSessionCookieName,
 	StreamSessionCookieSecure:   defaultStreamSessionCookieSec,
 	StreamSessionCookieDomain:   defaultStreamSessionCookieDomain,
+	StreamSessionCookieSameSite: defaultStreamSessionCookieSite,
+	AuthMaxFailures:             defaultAuthMaxFailures,
+	AuthFailureWindowSeconds:    defaultAuthFailureWindowSeconds,
+	AuthBanSeconds:              defaultAuthBanSeconds,
 	DirectRaceWorkers:           defaultDirectRaceWorkers,
+	RobotsTxt:                   defaultRobotsTxt,
+	NoIndex:                     defaultNoIndex,
+	BrandName:                   defaultBrandName,
+	TLSPort:                     defaultTLSPort,
+	WebAppInitDataMaxAgeSeconds: defaultWebAppInitDataMaxAge,
+	PremiumDays:                 defaultPremiumDays,
+	PremiumLimitMultiplier:      defaultPremiumLimitMultiplier,
+	TLSAutocertDir:              defaultTLSAutocertDir,
+	BrandColor:                  defaultBrandColor,
+	BrandAccentColor:            defaultBrandAccentColor,
+	LogDigest:                   defaultLogDigest,
+	LogDigestTopFiles:           defaultLogDigestTopFiles,
+	DatabasePath:                defaultDatabasePath,
+	AbuseAction:                 defaultAbuseAction,
+	AbuseWindowSeconds:          defaultAbuseWindowSeconds,
+	AbuseMaxNotFound:            defaultAbuseMaxNotFound,
+	AbuseMaxSequential:          defaultAbuseMaxSequential,
+	AbuseMaxFiles:               defaultAbuseMaxFiles,
+	AbusePenaltySeconds:         defaultAbusePenaltySeconds,
+	AbuseThrottlePerMinute:      defaultAbuseThrottlePerMinute,
+	RequestHistoryDays:          defaultRequestHistoryDays,
+	JanitorIntervalMinutes:      defaultJanitorIntervalMinutes,
+	ImageCacheMaxAgeHours:       defaultImageCacheMaxAgeHours,
+	MinFreeDiskMB:               defaultMinFreeDiskMB,
+	ChunkCacheDir:               defaultChunkCacheDir,
+	ImageStore:                  defaultImageStore,
+	RedirectPollSeconds:         defaultRedirectPollSeconds,
+	TranscodeDir:                defaultTranscodeDir,
+	TranscodeMinRequests:        defaultTranscodeMinRequests,
+	TranscodeWorkers:            defaultTranscodeWorkers,
+	TranscodeMaxAgeHours:        defaultTranscodeMaxAgeHours,
+	FFmpegPath:                  defaultFFmpegPath,
+	AudioMaxJobs:                defaultAudioMaxJobs,
+	HLSSegmentSeconds:           defaultHLSSegmentSeconds,
+	HLSMaxJobs:                  defaultHLSMaxJobs,
+	UploadProgressSeconds:       defaultUploadProgressSeconds,
+	UploadDir:                   defaultUploadDir,
+	UploadMaxSizeMB:             defaultUploadMaxSizeMB,
+	UploadExpiryHours:           defaultUploadExpiryHours,
+	FFprobePath:                 defaultFFprobePath,
+	RetentionCheckHours:         defaultRetentionCheckHours,
+	TrashDays:                   defaultTrashDays,
+	BackupIntervalHours:         defaultBackupIntervalHours,
+	UpdateCheckRepo:             defaultUpdateCheckRepo,
+	TGBudgetRPS:                 defaultTGBudgetRPS,
+	TGBudgetBurst:               defaultTGBudgetBurst,
+	WorkerPingSeconds:           defaultWorkerPingSeconds,
+	WorkerUnhealthyAfter:        defaultWorkerUnhealthyAfter,
+	BalancerShadowStrategy:      defaultBalancerShadowStrategy,
+	CacheBackend:                defaultCacheBackend,
+	CacheSnapshotMB:             defaultCacheSnapshotMB,
+	CapacityHighPercent:         defaultCapacityHighPercent,
+	CapacityLowPercent:          defaultCapacityLowPercent,
 }
 
 type allowedUsers []int64
@@ -80,13 +207,15 @@ func (au *allowedUsers) Decode(value string) error {
 }
 
 type config struct {
-	ApiID                     int32        `envconfig:"API_ID" required:"true"`
-	ApiHash                   string       `envconfig:"API_HASH" required:"true"`
-	BotToken                  string       `envconfig:"BOT_TOKEN" required:"true"`
-	LogChannelID              int64        `envconfig:"LOG_CHANNEL" required:"true"`
+	ApiID                     int32        `envconfig:"API_ID"`      // required unless EDGE_ORIGIN_URL is set
+	ApiHash                   string       `envconfig:"API_HASH"`    // required unless EDGE_ORIGIN_URL is set
+	BotToken                  string       `envconfig:"BOT_TOKEN"`   // required unless EDGE_ORIGIN_URL is set
+	LogChannelID              int64        `envconfig:"LOG_CHANNEL"` // required unless EDGE_ORIGIN_URL is set
 	MediaChannelID            int64        `envconfig:"MEDIA_CHANNEL_ID"`
+	MediaChannels             []string     `envconfig:"MEDIA_CHANNELS"` // more channels for /direct/<alias>/<id>, as alias:channel ID[:public]
 	Dev                       bool         `envconfig:"DEV" default:"false"`
 	LogLevel                  string       `envconfig:"LOG_LEVEL" default:"info"`
+	LogLevels                 []string     `envconfig:"LOG_LEVELS"` // <logger>=<level> overrides of LOG_LEVEL, e.g. Workers=debug
 	Port                      int          `envconfig:"PORT" default:"8080"`
 	StatusPort                int          `envconfig:"STATUS_PORT" default:"9090"`
 	Host                      string       `envconfig:"HOST" default:""`
@@ -94,22 +223,221 @@ type config struct {
 	UseSessionFile            bool         `envconfig:"USE_SESSION_FILE" default:"true"`
 	UserSession               string       `envconfig:"USER_SESSION"`
 	UsePublicIP               bool         `envconfig:"USE_PUBLIC_IP" default:"false"`
+	BindIPv6                  bool         `envconfig:"BIND_IPV6" default:"false"` // listen on [::] and prefer IPv6 when detecting HOST
 	AllowedUsers              allowedUsers `envconfig:"ALLOWED_USERS"`
+	AdminUsers                allowedUsers `envconfig:"ADMIN_USERS"` // may create invite codes with /invite
 	WorkerStartTimeoutSeconds int          `envconfig:"WORKER_START_TIMEOUT_SECONDS" default:"120"`
 	// Firebase one-time auth configuration (exchange Firebase ID token to short-lived stream session token)
-	FirebaseProjectID           string   `envconfig:"FIREBASE_PROJECT_ID" default:"mediatg-16cbb"`
+	FirebaseProjectIDs          []string `envconfig:"FIREBASE_PROJECT_ID" default:"mediatg-16cbb"` // comma-separated for multi-app setups
 	FirebaseCertsURL            string   `envconfig:"FIREBASE_CERTS_URL" default:"https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"`
+	FirebaseCertsGraceMinutes   int      `envconfig:"FIREBASE_CERTS_GRACE_MINUTES" default:"1440"` // serve expired certs this long while refreshing
+	AppCheckProjectNumbers      []string `envconfig:"FIREBASE_APP_CHECK_PROJECT_NUMBERS"`          // set to require App Check tokens on exchange
+	AppCheckAppIDs              []string `envconfig:"FIREBASE_APP_CHECK_APP_IDS"`
+	AppCheckJWKSURL             string   `envconfig:"FIREBASE_APP_CHECK_JWKS_URL" default:"https://firebaseappcheck.googleapis.com/v1/jwks"`
+	PassthroughClaims           []string `envconfig:"FIREBASE_PASSTHROUGH_CLAIMS" default:"roles,role"` // custom claims kept on the session
+	ClaimsSigningSecret         string   `envconfig:"CLAIMS_SIGNING_SECRET"`                            // set to send X-Fsb-Claims downstream
+	ClaimsTTLSeconds            int      `envconfig:"CLAIMS_TTL_SECONDS" default:"300"`
 	StreamSessionTTLSeconds     int      `envconfig:"STREAM_SESSION_TTL_SECONDS" default:"28800"` // 8h
+	StreamSessionMaxSeconds     int      `envconfig:"STREAM_SESSION_MAX_SECONDS" default:"86400"` // renewals never keep a session past this age
 	StreamSessionCleanupSeconds int      `envconfig:"STREAM_SESSION_CLEANUP_SECONDS" default:"60"`
 	StreamSessionCookieName     string   `envconfig:"STREAM_SESSION_COOKIE_NAME" default:"fsb_stream_session"`
 	StreamSessionCookieSecure   bool     `envconfig:"STREAM_SESSION_COOKIE_SECURE" default:"true"`
 	StreamSessionCookieDomain   string   `envconfig:"STREAM_SESSION_COOKIE_DOMAIN" default:""`
+	StreamSessionCookieSameSite string   `envconfig:"STREAM_SESSION_COOKIE_SAMESITE" default:"lax"` // lax, strict or none (forces Secure)
+	StreamSecret                string   `envconfig:"STREAM_SECRET"`                                // secret of legacy HMAC signed links
+	StreamAllowLegacyHMAC       bool     `envconfig:"STREAM_ALLOW_LEGACY_HMAC" default:"false"`
+	AuthMaxFailures             int      `envconfig:"AUTH_MAX_FAILURES" default:"10"`            // failed exchanges or signatures per IP before a ban; 0 disables bans
+	AuthFailureWindowSeconds    int      `envconfig:"AUTH_FAILURE_WINDOW_SECONDS" default:"300"` // failures older than this are forgotten
+	AuthBanSeconds              int      `envconfig:"AUTH_BAN_SECONDS" default:"900"`
+	RateLimitPerMinute          int      `envconfig:"RATE_LIMIT_PER_MINUTE" default:"0"`  // media requests per user or IP; 0 disables it
+	RateLimitBurst              int      `envconfig:"RATE_LIMIT_BURST" default:"0"`       // requests allowed at once; defaults to RATE_LIMIT_PER_MINUTE
+	MaxStreamsPerClient         int      `envconfig:"MAX_STREAMS_PER_CLIENT" default:"0"` // concurrent streams per user or IP; 0 disables it
+	AbuseAction                 string   `envconfig:"ABUSE_ACTION" default:"off"`         // off, log, throttle or ban
+	AbuseWindowSeconds          int      `envconfig:"ABUSE_WINDOW_SECONDS" default:"600"`
+	AbuseMaxNotFound            int      `envconfig:"ABUSE_MAX_NOT_FOUND" default:"30"`      // 404s and 410s per window; 0 disables the check
+	AbuseMaxSequential          int      `envconfig:"ABUSE_MAX_SEQUENTIAL" default:"20"`     // consecutive message IDs in a row; 0 disables the check
+	AbuseMaxFiles               int      `envconfig:"ABUSE_MAX_FILES" default:"200"`         // distinct files per window; 0 disables the check
+	AbusePenaltySeconds         int      `envconfig:"ABUSE_PENALTY_SECONDS" default:"3600"`  // how long offenders are throttled or banned
+	AbuseThrottlePerMinute      int      `envconfig:"ABUSE_THROTTLE_PER_MINUTE" default:"6"` // media requests a throttled offender may make
 	DirectRaceWorkers           int      `envconfig:"DIRECT_RACE_WORKERS" default:"2"`
+	LogDigest                   string   `envconfig:"LOG_DIGEST" default:""` // "", "hourly" or "daily"
+	LogDigestTopFiles           int      `envconfig:"LOG_DIGEST_TOP_FILES" default:"5"`
+	DatabasePath                string   `envconfig:"DATABASE_PATH" default:"fsb.db"`
+	RequestHistoryDays          int      `envconfig:"REQUEST_HISTORY_DAYS" default:"30"`       // /analytics records are kept this long; 0 keeps them forever
+	JanitorIntervalMinutes      int      `envconfig:"JANITOR_INTERVAL_MINUTES" default:"60"`   // 0 disables cleanup
+	ImageCacheMaxAgeHours       int      `envconfig:"IMAGE_CACHE_MAX_AGE_HOURS" default:"168"` // 0 keeps images forever
+	MinFreeDiskMB               int      `envconfig:"MIN_FREE_DISK_MB" default:"512"`          // cache writes are skipped below this floor
+	ChunkCacheMB                int      `envconfig:"CHUNK_CACHE_MB" default:"0"`              // on-disk cache of file chunks; 0 disables it
+	ChunkCacheDir               string   `envconfig:"CHUNK_CACHE_DIR" default:"./chunks"`      // least recently used chunks are evicted first
+	ImageStore                  string   `envconfig:"IMAGE_STORE" default:"local"`             // "local" or "s3"
+	S3Endpoint                  string   `envconfig:"S3_ENDPOINT"`
+	S3Region                    string   `envconfig:"S3_REGION" default:"us-east-1"`
+	S3Bucket                    string   `envconfig:"S3_BUCKET"`
+	S3AccessKeyID               string   `envconfig:"S3_ACCESS_KEY_ID"`
+	S3SecretAccessKey           string   `envconfig:"S3_SECRET_ACCESS_KEY"`
+	S3Prefix                    string   `envconfig:"S3_PREFIX"`
+	S3PathStyle                 bool     `envconfig:"S3_PATH_STYLE" default:"false"`
+	CacheBackend                string   `envconfig:"CACHE_BACKEND" default:"memory"` // "memory" or "redis"
+	RedisURL                    string   `envconfig:"REDIS_URL"`                      // redis://[user:password@]host[:port][/db]
+	CacheSnapshotFile           string   `envconfig:"CACHE_SNAPSHOT_FILE"`            // memory cache entries saved on shutdown and loaded on start; empty disables it
+	CacheSnapshotMB             int      `envconfig:"CACHE_SNAPSHOT_MB" default:"16"` // most recently read entries first, up to this size
+	EdgeOriginURL               string   `envconfig:"EDGE_ORIGIN_URL"`                // set to run as a credential-less edge in front of this origin
+	RedirectReplicas            []string `envconfig:"REDIRECT_REPLICAS"`              // set to run as a 307 front for these replicas
+	RedirectPollSeconds         int      `envconfig:"REDIRECT_POLL_SECONDS" default:"5"`
+	PublicIPProviders           []string `envconfig:"PUBLIC_IP_PROVIDERS" default:"https://api64.ipify.org,https://icanhazip.com,https://ifconfig.me/ip"`
+	PublicIPCheckMinutes        int      `envconfig:"PUBLIC_IP_CHECK_MINUTES" default:"0"` // 0 disables re-checks
+	PublicIPNotify              bool     `envconfig:"PUBLIC_IP_NOTIFY" default:"false"`    // post the new link to LOG_CHANNEL
+	DDNSProvider                string   `envconfig:"DDNS_PROVIDER"`                       // "", "cloudflare" or "dyndns"
+	DDNSRecordName              string   `envconfig:"DDNS_RECORD_NAME"`                    // defaults to the domain in HOST
+	DDNSUpdateURL               string   `envconfig:"DDNS_UPDATE_URL" default:"https://members.dyndns.org/nic/update"`
+	DDNSUsername                string   `envconfig:"DDNS_USERNAME"`
+	DDNSPassword                string   `envconfig:"DDNS_PASSWORD"`
+	CloudflareAPIToken          string   `envconfig:"CLOUDFLARE_API_TOKEN"`
+	CloudflareZoneID            string   `envconfig:"CLOUDFLARE_ZONE_ID"`
+	BasePath                    string   `envconfig:"BASE_PATH"`                               // e.g. /fsb when served under a shared domain path
+	PublicURL                   string   `envconfig:"PUBLIC_URL"`                              // public base of links, overrides HOST and BASE_PATH
+	TrustForwardedHeaders       bool     `envconfig:"TRUST_FORWARDED_HEADERS" default:"false"` // honour X-Forwarded-Proto/Host from a reverse proxy
+	TrustedProxies              []string `envconfig:"TRUSTED_PROXIES"`                         // IPs or CIDRs whose X-Forwarded-For gives the client IP
+	RegionHosts                 []string `envconfig:"REGION_HOSTS"`                            // <region>:<public base URL> pairs links may point to
+	RegionPolicy                string   `envconfig:"REGION_POLICY" default:"hint"`            // hint or geoip
+	RegionCountries             []string `envconfig:"REGION_COUNTRIES"`                        // <country code>:<region> pairs for REGION_POLICY=geoip
+	RegionCountryHeader         string   `envconfig:"REGION_COUNTRY_HEADER" default:"CF-IPCountry"`
+	RobotsTxt                   string   `envconfig:"ROBOTS_TXT" default:"disallow"`        // disallow, allow or off
+	NoIndex                     bool     `envconfig:"NOINDEX" default:"true"`               // send X-Robots-Tag: noindex on every response
+	LogoFile                    string   `envconfig:"LOGO_FILE"`                            // replaces the built-in /static/logo.svg
+	FaviconFile                 string   `envconfig:"FAVICON_FILE"`                         // replaces the built-in /favicon.ico
+	BrandName                   string   `envconfig:"BRAND_NAME" default:"FileStreamBot"`   // shown in page titles and headings
+	BrandColor                  string   `envconfig:"BRAND_COLOR" default:"#667eea"`        // primary color of the HTML pages, #rgb or #rrggbb
+	BrandAccentColor            string   `envconfig:"BRAND_ACCENT_COLOR" default:"#764ba2"` // second color of the gradients
+	BrandLogoURL                string   `envconfig:"BRAND_LOGO_URL"`                       // defaults to /static/logo.svg
+	Lang                        string   `envconfig:"LANG"`                                 // language of the bot and HTML pages, e.g. pt-BR; English when unknown
+	TLSCert                     string   `envconfig:"TLS_CERT"`                             // PEM certificate chain, reloaded when it changes
+	TLSKey                      string   `envconfig:"TLS_KEY"`                              // PEM private key of TLS_CERT
+	TLSPort                     int      `envconfig:"TLS_PORT" default:"8443"`              // HTTPS port when TLS is on; PORT then redirects to it
+	TLSAutocert                 bool     `envconfig:"TLS_AUTOCERT" default:"false"`         // get certificates from Let's Encrypt
+	TLSAutocertDomains          []string `envconfig:"TLS_AUTOCERT_DOMAINS"`                 // defaults to the domain in HOST
+	TLSAutocertEmail            string   `envconfig:"TLS_AUTOCERT_EMAIL"`                   // contact for expiry notices
+	TLSAutocertDir              string   `envconfig:"TLS_AUTOCERT_DIR" default:"./certs"`   // certificates and the ACME account key
+	TranscodeRenditions         []int    `envconfig:"TRANSCODE_RENDITIONS"`                 // e.g. 480,720; empty disables transcoding
+	TranscodeDir                string   `envconfig:"TRANSCODE_DIR" default:"./transcodes"`
+	TranscodeMinRequests        int      `envconfig:"TRANSCODE_MIN_REQUESTS" default:"5"` // plays before a file is transcoded
+	TranscodeWorkers            int      `envconfig:"TRANSCODE_WORKERS" default:"1"`
+	TranscodeMaxAgeHours        int      `envconfig:"TRANSCODE_MAX_AGE_HOURS" default:"168"` // 0 keeps renditions forever
+	FFmpegPath                  string   `envconfig:"FFMPEG_PATH" default:"ffmpeg"`
+	AudioMaxJobs                int      `envconfig:"AUDIO_MAX_JOBS" default:"4"`          // concurrent /audio extractions
+	HLSSegmentSeconds           int      `envconfig:"HLS_SEGMENT_SECONDS" default:"6"`     // target length of /hls segments
+	HLSMaxJobs                  int      `envconfig:"HLS_MAX_JOBS" default:"8"`            // concurrent /hls segment remuxes
+	UploadProgressSeconds       int      `envconfig:"UPLOAD_PROGRESS_SECONDS" default:"5"` // 0 disables upload status messages
+	UploadEnabled               bool     `envconfig:"UPLOAD_ENABLED" default:"false"`      // tus resumable uploads on /upload/tus/
+	UploadAllowedUIDs           []string `envconfig:"UPLOAD_ALLOWED_UIDS"`                 // empty allows any signed-in user
+	UploadDir                   string   `envconfig:"UPLOAD_DIR" default:"./uploads"`
+	UploadMaxSizeMB             int64    `envconfig:"UPLOAD_MAX_SIZE_MB" default:"2000"`
+	UploadExpiryHours           int      `envconfig:"UPLOAD_EXPIRY_HOURS" default:"24"` // unfinished uploads are removed after this
+	UploadPostProcess           []string `envconfig:"UPLOAD_POST_PROCESS"`              // steps run on finished uploads, in order
+	UploadWebhookURL            string   `envconfig:"UPLOAD_WEBHOOK_URL"`
+	UploadWebhookSecret         string   `envconfig:"UPLOAD_WEBHOOK_SECRET"` // signs webhook bodies with HMAC-SHA256
+	FFprobePath                 string   `envconfig:"FFPROBE_PATH" default:"ffprobe"`
+	RetentionDays               int      `envconfig:"RETENTION_DAYS" default:"0"` // delete channel messages older than this; 0 keeps them
+	RetentionChannelDays        []string `envconfig:"RETENTION_CHANNEL_DAYS"`     // per-channel overrides, e.g. -100123:7
+	RetentionCheckHours         int      `envconfig:"RETENTION_CHECK_HOURS" default:"6"`
+	AdminToken                  string   `envconfig:"ADMIN_TOKEN"`                                      // bearer token of the /admin API with the full role
+	AdminTokens                 []string `envconfig:"ADMIN_TOKENS"`                                     // scoped tokens as <role>:<sha256 hex of the token>
+	IDObfuscationKey            string   `envconfig:"ID_OBFUSCATION_KEY"`                               // links carry encrypted IDs instead of message IDs
+	IDObfuscationOnly           bool     `envconfig:"ID_OBFUSCATION_ONLY" default:"false"`              // refuse numeric message IDs in media URLs
+	APIKeys                     []string `envconfig:"API_KEYS"`                                         // <label>:<key> pairs accepted by the media routes, for server-to-server use
+	WebAppEnabled               bool     `envconfig:"WEBAPP_ENABLED" default:"false"`                   // /webapp API for a Telegram mini app of the main bot
+	WebAppInitDataMaxAgeSeconds int      `envconfig:"WEBAPP_INIT_DATA_MAX_AGE_SECONDS" default:"86400"` // 0 accepts init data of any age
+	WebAppOrigin                string   `envconfig:"WEBAPP_ORIGIN"`                                    // origin of the mini app when it is hosted elsewhere, for CORS
+	PremiumDays                 int      `envconfig:"PREMIUM_DAYS" default:"30"`                        // length of a premium purchase; 0 never expires
+	PremiumStarsPrice           int      `envconfig:"PREMIUM_STARS_PRICE" default:"0"`                  // price of /premium in Telegram Stars; 0 disables it
+	StripeWebhookSecret         string   `envconfig:"STRIPE_WEBHOOK_SECRET"`                            // signing secret of the /payments/stripe endpoint
+	PremiumLimitMultiplier      int      `envconfig:"PREMIUM_LIMIT_MULTIPLIER" default:"2"`             // premium users get the rate limits and MAX_STREAM_RATE times this; 0 lifts them
+	PremiumOnly                 []string `envconfig:"PREMIUM_ONLY"`                                     // features only premium users may use, among PremiumFeatures
+	TrashChannelID              int64    `envconfig:"TRASH_CHANNEL_ID"`                                 // deleted files are kept here for TRASH_DAYS
+	TrashDays                   int      `envconfig:"TRASH_DAYS" default:"7"`
+	BackupPassphrase            string   `envconfig:"BACKUP_PASSPHRASE"`                  // encrypts backups; empty disables them
+	BackupChannelID             int64    `envconfig:"BACKUP_CHANNEL_ID"`                  // defaults to LOG_CHANNEL
+	BackupIntervalHours         int      `envconfig:"BACKUP_INTERVAL_HOURS" default:"24"` // 0 only backs up on demand
+	UpdateCheckHours            int      `envconfig:"UPDATE_CHECK_HOURS" default:"0"`     // check GitHub for new releases; 0 disables it
+	UpdateCheckRepo             string   `envconfig:"UPDATE_CHECK_REPO" default:"EverythingSuckz/TG-FileStreamBot"`
+	FeatureFlags                []string `envconfig:"FEATURE_FLAGS"`                      // e.g. stream_prefetch=off,balancer_two_choices=10%
+	FileStatsHeaders            bool     `envconfig:"FILE_STATS_HEADERS" default:"false"` // X-FSB-Views on HEAD for admin-token holders
+	FallbackURL                 string   `envconfig:"FALLBACK_URL"`                       // sent with 503s; {id} is replaced by the message ID
+	TGBudgetRPS                 int      `envconfig:"TG_BUDGET_RPS" default:"30"`         // Telegram API calls per second, per worker
+	TGBudgetBurst               int      `envconfig:"TG_BUDGET_BURST" default:"15"`
+	BulkMaxMbps                 int      `envconfig:"BULK_MAX_MBPS" default:"0"`              // shared by all bulk downloads; 0 is unlimited
+	BulkMaxActivePerWorker      int      `envconfig:"BULK_MAX_ACTIVE_PER_WORKER" default:"0"` // bulk downloads are refused past this; 0 is unlimited
+	MaxStreamRate               float64  `envconfig:"MAX_STREAM_RATE" default:"0"`            // megabytes per second for each download; 0 is unlimited
+	WorkerPingSeconds           int      `envconfig:"WORKER_PING_SECONDS" default:"60"`       // 0 disables DC pings
+	WorkerUnhealthyAfter        int      `envconfig:"WORKER_UNHEALTHY_AFTER" default:"3"`     // failed pings in a row before a worker is restarted; 0 disables it
+	BalancerShadowPercent       int      `envconfig:"BALANCER_SHADOW_PERCENT" default:"0"`    // share of worker picks replayed through the shadow strategy
+	BalancerShadowStrategy      string   `envconfig:"BALANCER_SHADOW_STRATEGY" default:"two_choices"`
+	WorkerLabels                []string `envconfig:"WORKER_LABELS"`                           // <bot ID or @username>:<light|stream> pairs, see WorkerClass
+	PlaylistMaxMessages         int      `envconfig:"PLAYLIST_MAX_MESSAGES" default:"1000"`    // widest from..to range of /playlist
+	DisablePlaylist             bool     `envconfig:"DISABLE_PLAYLIST" default:"false"`        // skip registering /playlist
+	ZipMaxFiles                 int      `envconfig:"ZIP_MAX_FILES" default:"100"`             // files one /zip archive may hold
+	DisableZip                  bool     `envconfig:"DISABLE_ZIP" default:"false"`             // skip registering /zip
+	DisableStream               bool     `envconfig:"DISABLE_STREAM" default:"false"`          // skip registering /stream
+	DisableDirect               bool     `envconfig:"DISABLE_DIRECT" default:"false"`          // skip registering /direct and the channel aliases
+	DisableThumb                bool     `envconfig:"DISABLE_THUMB" default:"false"`           // skip registering /thumb
+	DisableHLS                  bool     `envconfig:"DISABLE_HLS" default:"false"`             // skip registering /hls
+	DisableAudio                bool     `envconfig:"DISABLE_AUDIO" default:"false"`           // skip registering /audio
+	DisableUpload               bool     `envconfig:"DISABLE_UPLOAD" default:"false"`          // skip registering /upload and resumable uploads
+	DisableProgress             bool     `envconfig:"DISABLE_PROGRESS" default:"false"`        // skip registering /api/me/progress
+	DisableAnalytics            bool     `envconfig:"DISABLE_ANALYTICS" default:"false"`       // skip registering the playback and open beacons
+	DisableStatus               bool     `envconfig:"DISABLE_STATUS" default:"false"`          // skip registering /status on both servers
+	DisableStatusHTML           bool     `envconfig:"DISABLE_STATUS_HTML" default:"false"`     // /status answers JSON only
+	DisableStatic               bool     `envconfig:"DISABLE_STATIC" default:"false"`          // skip registering /static and /favicon.ico
+	MediaChannelInvite          string   `envconfig:"MEDIA_CHANNEL_INVITE"`                    // invite link the userbot joins MEDIA_CHANNEL_ID through
+	ProvisionWorkers            bool     `envconfig:"PROVISION_WORKERS" default:"true"`        // make the workers admins of the source channels at startup
+	AccessCheckMinutes          int      `envconfig:"ACCESS_CHECK_MINUTES" default:"30"`       // how often every worker reads each source channel; 0 disables
+	AccessLog                   bool     `envconfig:"ACCESS_LOG" default:"true"`               // one structured log line per request, at info level
+	FaststartCheck              bool     `envconfig:"FASTSTART_CHECK" default:"false"`         // find where MP4s keep their moov and send X-FSB-Faststart
+	MoovPrefetch                bool     `envconfig:"MOOV_PREFETCH" default:"false"`           // fetch the tail moov of non-faststart MP4s into the chunk cache on playback start
+	FileCacheTTLSeconds         int      `envconfig:"FILE_CACHE_TTL_SECONDS" default:"3600"`   // how long file metadata stays cached
+	DirectCacheTTLSeconds       int      `envconfig:"DIRECT_CACHE_TTL_SECONDS" default:"240"`  // same for /direct, well within the ~60 min a file reference lasts
+	CapacityMbps                int      `envconfig:"CAPACITY_MBPS" default:"0"`               // bandwidth this instance can serve, for /status/capacity; 0 is unknown
+	CapacityStreamsPerWorker    int      `envconfig:"CAPACITY_STREAMS_PER_WORKER" default:"0"` // active requests a worker handles comfortably; 0 is unknown
+	CapacityHighPercent         int      `envconfig:"CAPACITY_HIGH_PERCENT" default:"80"`      // utilization that fires the scale_up webhook
+	CapacityLowPercent          int      `envconfig:"CAPACITY_LOW_PERCENT" default:"40"`       // utilization that fires scale_down after scale_up
+	CapacityQueueHigh           int      `envconfig:"CAPACITY_QUEUE_HIGH" default:"0"`         // Telegram calls waiting for budget that fire scale_up; 0 ignores the queue
+	CapacityWebhookURL          string   `envconfig:"CAPACITY_WEBHOOK_URL"`
+	CapacityWebhookSecret       string   `envconfig:"CAPACITY_WEBHOOK_SECRET"` // signs webhook bodies with HMAC-SHA256
 	MultiTokens                 []string `ignored:"true"`
+
+	hostMu           sync.RWMutex
+	hostFromPublicIP bool
+	retentionDays    map[int64]int
+	adminTokens      map[string]string // sha256 hex -> role
+	apiKeys          map[string]string // sha256 hex -> label
+	mediaChannels    map[string]MediaChannel
+	mediaInvites     map[string]mediaInvite // MEDIA_CHANNELS given by invite link, until resolved
+	regions          []Region
+	regionCountries  map[string]string // country code -> region
+	workerClasses    map[string]string // bot ID or lowercase username -> class
+	publicIP         string
+	configFile       string          // given with --config, read again on reload
+	pinnedEnv        map[string]bool // env vars set outside of fsb.env and the config file
 }
 
 var botTokenRegex = regexp.MustCompile(`MULTI\_TOKEN\d+=(.*)`)
 
+var channelAliasRegex = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var brandColorRegex = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// MediaChannel is a channel of MEDIA_CHANNELS.
+type MediaChannel struct {
+	ID     int64
+	Public bool // streamed without credentials
+}
+
+// mediaInvite is a MEDIA_CHANNELS entry given by invite link.
+type mediaInvite struct {
+	link   string
+	public bool
+}
+
 func (c *config) loadFromEnvFile(log *zap.Logger) {
 	envPath := filepath.Clean("fsb.env")
 	log.Sugar().Infof("Trying to load ENV vars from %s", envPath)
@@ -138,53 +466,59 @@ func SetFlagsFromConfig(cmd *cobra.Command) {
 	cmd.Flags().Bool("use-session-file", ValueOf.UseSessionFile, "Use session files")
 	cmd.Flags().String("user-session", ValueOf.UserSession, "Pyrogram user session")
 	cmd.Flags().Bool("use-public-ip", ValueOf.UsePublicIP, "Use public IP instead of local IP")
+	cmd.Flags().Bool("bind-ipv6", ValueOf.BindIPv6, "Listen on IPv6 and prefer it when detecting the host IP")
 	cmd.Flags().String("multi-token-txt-file", "", "Multi token txt file (Not implemented)")
+	cmd.Flags().StringP("config", "c", "", "YAML or TOML config file; env vars override it")
 }
 
 func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
 	if cmd.Flags().Changed("api-id") {
 		apiID, _ := cmd.Flags().GetInt32("api-id")
-		os.Setenv("API_ID", strconv.Itoa(int(apiID)))
+		c.setFlagEnv("API_ID", strconv.Itoa(int(apiID)))
 	}
 	if cmd.Flags().Changed("api-hash") {
 		apiHash, _ := cmd.Flags().GetString("api-hash")
-		os.Setenv("API_HASH", apiHash)
+		c.setFlagEnv("API_HASH", apiHash)
 	}
 	if cmd.Flags().Changed("bot-token") {
 		botToken, _ := cmd.Flags().GetString("bot-token")
-		os.Setenv("BOT_TOKEN", botToken)
+		c.setFlagEnv("BOT_TOKEN", botToken)
 	}
 	if cmd.Flags().Changed("log-channel") {
 		logChannelID, _ := cmd.Flags().GetString("log-channel")
-		os.Setenv("LOG_CHANNEL", logChannelID)
+		c.setFlagEnv("LOG_CHANNEL", logChannelID)
 	}
 	if cmd.Flags().Changed("dev") {
 		dev, _ := cmd.Flags().GetBool("dev")
-		os.Setenv("DEV", strconv.FormatBool(dev))
+		c.setFlagEnv("DEV", strconv.FormatBool(dev))
 	}
 	if cmd.Flags().Changed("port") {
 		port, _ := cmd.Flags().GetInt("port")
-		os.Setenv("PORT", strconv.Itoa(port))
+		c.setFlagEnv("PORT", strconv.Itoa(port))
 	}
 	if cmd.Flags().Changed("host") {
 		host, _ := cmd.Flags().GetString("host")
-		os.Setenv("HOST", host)
+		c.setFlagEnv("HOST", host)
 	}
 	if cmd.Flags().Changed("hash-length") {
 		hashLength, _ := cmd.Flags().GetInt("hash-length")
-		os.Setenv("HASH_LENGTH", strconv.Itoa(hashLength))
+		c.setFlagEnv("HASH_LENGTH", strconv.Itoa(hashLength))
 	}
 	if cmd.Flags().Changed("use-session-file") {
 		useSessionFile, _ := cmd.Flags().GetBool("use-session-file")
-		os.Setenv("USE_SESSION_FILE", strconv.FormatBool(useSessionFile))
+		c.setFlagEnv("USE_SESSION_FILE", strconv.FormatBool(useSessionFile))
 	}
 	if cmd.Flags().Changed("user-session") {
 		userSession, _ := cmd.Flags().GetString("user-session")
-		os.Setenv("USER_SESSION", userSession)
+		c.setFlagEnv("USER_SESSION", userSession)
 	}
 	if cmd.Flags().Changed("use-public-ip") {
 		usePublicIP, _ := cmd.Flags().GetBool("use-public-ip")
-		os.Setenv("USE_PUBLIC_IP", strconv.FormatBool(usePublicIP))
+		c.setFlagEnv("USE_PUBLIC_IP", strconv.FormatBool(usePublicIP))
+	}
+	if cmd.Flags().Changed("bind-ipv6") {
+		bindIPv6, _ := cmd.Flags().GetBool("bind-ipv6")
+		c.setFlagEnv("BIND_IPV6", strconv.FormatBool(bindIPv6))
 	}
 
 	multiTokens, _ := cmd.Flags().GetString("multi-token-txt-file")
@@ -193,6 +527,13 @@ func (c *config) loadConfigFromArgs(log *zap.Logger, cmd *cobra.Command) {
 	}
 }
 
+// setFlagEnv sets the env var of a flag given on the command line, which
+// later reloads of fsb.env and the config file leave alone.
+func (c *config) setFlagEnv(name, value string) {
+	os.Setenv(name, value)
+	c.pinnedEnv[name] = true
+}
+
 func (c *config) loadMultiTokensFromEnv() {
 	c.MultiTokens = c.MultiTokens[:0]
 	for _, env := range os.Environ() {
@@ -212,22 +553,39 @@ func (c *config) loadMultiTokensFromEnv() {
 }
 
 func (c *config) setupEnvVars(log *zap.Logger, cmd *cobra.Command) {
+	c.pinnedEnv = make(map[string]bool)
+	for _, name := range environNames() {
+		c.pinnedEnv[name] = true
+	}
 	c.loadFromEnvFile(log)
 	c.loadConfigFromArgs(log, cmd)
+	if path, _ := cmd.Flags().GetString("config"); path != "" {
+		c.configFile = path
+		c.loadFromConfigFile(log, path)
+	}
 	err := envconfig.Process("", c)
 	if err != nil {
 		log.Fatal("Error while parsing env variables", zap.Error(err))
 	}
+	if c.NeedsTelegram() {
+		if err := c.checkTelegramCredentials(); err != nil {
+			log.Fatal("Error while parsing env variables", zap.Error(err))
+		}
+	}
 	c.loadMultiTokensFromEnv()
 
 	var ipBlocked bool
-	ip, err := getIP(c.UsePublicIP)
+	ip, err := getIP(c.UsePublicIP, c.BindIPv6)
 	if err != nil {
 		log.Error("Error while getting IP", zap.Error(err))
 		ipBlocked = true
 	}
+	if c.UsePublicIP && !ipBlocked {
+		c.publicIP = ip
+	}
 	if c.Host == "" {
-		c.Host = "http://" + ip + ":" + strconv.Itoa(c.Port)
+		c.Host = c.hostFor(ip)
+		c.hostFromPublicIP = c.UsePublicIP && !ipBlocked
 		if c.UsePublicIP {
 			if ipBlocked {
 				log.Sugar().Warn("Can't get public IP, using local IP")
@@ -240,18 +598,218 @@ func (c *config) setupEnvVars(log *zap.Logger, cmd *cobra.Command) {
 	}
 }
 
+// checkTelegramCredentials enforces the variables every non-edge instance needs.
+func (c *config) checkTelegramCredentials() error {
+	var missing []string
+	if c.ApiID == 0 {
+		missing = append(missing, "API_ID")
+	}
+	if c.ApiHash == "" {
+		missing = append(missing, "API_HASH")
+	}
+	if c.BotToken == "" {
+		missing = append(missing, "BOT_TOKEN")
+	}
+	if c.LogChannelID == 0 {
+		missing = append(missing, "LOG_CHANNEL")
+	}
+	if len(missing) > 0 {
+		return errors.New("required key(s) " + strings.Join(missing, ", ") + " missing value")
+	}
+	return nil
+}
+
+// IsEdge reports whether this instance proxies to an origin instead of talking to Telegram.
+func (c *config) IsEdge() bool {
+	return c.EdgeOriginURL != ""
+}
+
+// IsRedirectFront reports whether this instance only redirects clients to replicas.
+func (c *config) IsRedirectFront() bool {
+	return len(c.RedirectReplicas) > 0
+}
+
+// RetentionDaysFor is how many days messages of channelID are kept, 0 meaning
+// forever. RETENTION_CHANNEL_DAYS overrides RETENTION_DAYS.
+func (c *config) RetentionDaysFor(channelID int64) int {
+	if days, ok := c.retentionDays[channelID]; ok {
+		return days
+	}
+	return c.RetentionDays
+}
+
+// MediaChannelFor resolves a MEDIA_CHANNELS alias.
+func (c *config) MediaChannelFor(alias string) (MediaChannel, bool) {
+	channel, ok := c.mediaChannels[strings.ToLower(alias)]
+	return channel, ok
+}
+
+// MediaChannelAlias is the MEDIA_CHANNELS alias of channelID.
+func (c *config) MediaChannelAlias(channelID int64) (string, bool) {
+	for alias, channel := range c.mediaChannels {
+		if channel.ID == channelID {
+			return alias, true
+		}
+	}
+	return "", false
+}
+
+// SourceChannels lists LOG_CHANNEL, MEDIA_CHANNEL_ID and the MEDIA_CHANNELS,
+// the channels workers stream from, once each.
+func (c *config) SourceChannels() []int64 {
+	channels := []int64{c.LogChannelID}
+	seen := map[int64]bool{c.LogChannelID: true}
+	if c.MediaChannelID != 0 && !seen[c.MediaChannelID] {
+		channels = append(channels, c.MediaChannelID)
+		seen[c.MediaChannelID] = true
+	}
+	var extra []int64
+	for _, channel := range c.mediaChannels {
+		if !seen[channel.ID] {
+			extra = append(extra, channel.ID)
+			seen[channel.ID] = true
+		}
+	}
+	sort.Slice(extra, func(i, j int) bool { return extra[i] < extra[j] })
+	return append(channels, extra...)
+}
+
+// IsInviteLink reports whether channel is a t.me/+<hash> or
+// t.me/joinchat/<hash> invite link rather than a channel ID.
+func IsInviteLink(channel string) bool {
+	channel = strings.TrimPrefix(strings.TrimPrefix(channel, "https://"), "http://")
+	return strings.HasPrefix(channel, "t.me/+") || strings.HasPrefix(channel, "t.me/joinchat/") ||
+		strings.HasPrefix(channel, "telegram.me/+") || strings.HasPrefix(channel, "telegram.me/joinchat/")
+}
+
+// MediaChannelInvites lists the MEDIA_CHANNELS given by invite link that
+// aren't resolved yet, by alias.
+func (c *config) MediaChannelInvites() map[string]string {
+	pending := make(map[string]string, len(c.mediaInvites))
+	for alias, invite := range c.mediaInvites {
+		pending[alias] = invite.link
+	}
+	return pending
+}
+
+// ResolveMediaChannel sets the ID of a MEDIA_CHANNELS entry given by invite
+// link. It runs at startup, before requests are served.
+func (c *config) ResolveMediaChannel(alias string, channelID int64) {
+	invite, ok := c.mediaInvites[alias]
+	if !ok {
+		return
+	}
+	c.mediaChannels[alias] = MediaChannel{ID: channelID, Public: invite.public}
+	delete(c.mediaInvites, alias)
+}
+
+// NeedsTelegram is false for instances that never talk to Telegram themselves.
+func (c *config) NeedsTelegram() bool {
+	return !c.IsEdge() && !c.IsRedirectFront()
+}
+
+// checkLimits fixes the auth, rate limit, abuse and cache settings and parses
+// API_KEYS. These can change on reload, so Reload runs it too.
+func (c *config) checkLimits(log *zap.Logger) {
+	if c.AuthFailureWindowSeconds < 1 {
+		c.AuthFailureWindowSeconds = defaultAuthFailureWindowSeconds
+	}
+	if c.AuthBanSeconds < 1 {
+		c.AuthBanSeconds = defaultAuthBanSeconds
+	}
+	if c.RateLimitBurst < 1 {
+		c.RateLimitBurst = c.RateLimitPerMinute
+	}
+	c.AbuseAction = strings.ToLower(strings.TrimSpace(c.AbuseAction))
+	switch c.AbuseAction {
+	case "off", "log", "throttle", "ban":
+	case "":
+		c.AbuseAction = defaultAbuseAction
+	default:
+		log.Sugar().Warnf("ABUSE_ACTION must be 'off', 'log', 'throttle' or 'ban', got %q; disabling abuse detection", c.AbuseAction)
+		c.AbuseAction = defaultAbuseAction
+	}
+	if c.AbuseWindowSeconds < 1 {
+		c.AbuseWindowSeconds = defaultAbuseWindowSeconds
+	}
+	if c.AbusePenaltySeconds < 1 {
+		c.AbusePenaltySeconds = defaultAbusePenaltySeconds
+	}
+	if c.AbuseThrottlePerMinute < 1 {
+		c.AbuseThrottlePerMinute = defaultAbuseThrottlePerMinute
+	}
+	// The caches treat 0 as no expiry, which would keep file references
+	// past their lifetime
+	if c.FileCacheTTLSeconds < 1 {
+		c.FileCacheTTLSeconds = 1
+	}
+	if c.DirectCacheTTLSeconds < 1 {
+		c.DirectCacheTTLSeconds = 1
+	}
+	c.loadAPIKeys(log)
+}
+
 func Load(log *zap.Logger, cmd *cobra.Command) {
 	log = log.Named("Config")
 	defer log.Info("Loaded config")
 	ValueOf.setupEnvVars(log, cmd)
+	ValueOf.BasePath = normalizeBasePath(ValueOf.BasePath)
+	ValueOf.PublicURL = strings.TrimRight(strings.TrimSpace(ValueOf.PublicURL), "/")
+	ValueOf.loadTLS(log)
+	ValueOf.loadRegions(log)
+	if ValueOf.BasePath != "" {
+		log.Sugar().Infof("Serving routes under BASE_PATH %s", ValueOf.BasePath)
+	}
+	if ValueOf.IsEdge() {
+		ValueOf.EdgeOriginURL = strings.TrimRight(strings.TrimSpace(ValueOf.EdgeOriginURL), "/")
+		log.Sugar().Infof("Edge mode enabled, proxying to origin %s", ValueOf.EdgeOriginURL)
+		return
+	}
+	if ValueOf.IsRedirectFront() {
+		if ValueOf.RedirectPollSeconds < 1 {
+			ValueOf.RedirectPollSeconds = defaultRedirectPollSeconds
+		}
+		log.Sugar().Infof("Redirect mode enabled for %d replicas", len(ValueOf.RedirectReplicas))
+		return
+	}
 	ValueOf.LogChannelID = int64(stripInt(log, int(ValueOf.LogChannelID)))
 	// Process MEDIA_CHANNEL_ID: convert positive channel ID to the format Telegram expects
 	if ValueOf.MediaChannelID != 0 {
 		ValueOf.MediaChannelID = int64(stripInt(log, int(ValueOf.MediaChannelID)))
 		log.Sugar().Infof("MEDIA_CHANNEL_ID configured: %d", ValueOf.MediaChannelID)
+	} else if ValueOf.MediaChannelInvite != "" {
+		log.Sugar().Info("MEDIA_CHANNEL_ID will be resolved from MEDIA_CHANNEL_INVITE")
 	} else {
 		log.Sugar().Warn("MEDIA_CHANNEL_ID not set. The /direct/:message_id route will not work.")
 	}
+	ValueOf.mediaChannels = make(map[string]MediaChannel)
+	ValueOf.mediaInvites = make(map[string]mediaInvite)
+	for _, entry := range ValueOf.MediaChannels {
+		alias, rest, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		// Invite links have a colon of their own, so :public is cut off the end
+		channel, public := strings.CutSuffix(rest, ":public")
+		alias = strings.ToLower(alias)
+		if !channelAliasRegex.MatchString(alias) {
+			log.Sugar().Warnf("Ignoring MEDIA_CHANNELS entry %q, expected <alias>:<channel ID or invite link>[:public]", entry)
+			continue
+		}
+		if IsInviteLink(channel) {
+			ValueOf.mediaInvites[alias] = mediaInvite{link: channel, public: public}
+			continue
+		}
+		channelID, err := strconv.Atoi(channel)
+		if err != nil {
+			log.Sugar().Warnf("Ignoring MEDIA_CHANNELS entry %q, expected <alias>:<channel ID or invite link>[:public]", entry)
+			continue
+		}
+		ValueOf.mediaChannels[alias] = MediaChannel{ID: int64(stripInt(log, channelID)), Public: public}
+	}
+	if len(ValueOf.mediaChannels) > 0 {
+		log.Sugar().Infof("MEDIA_CHANNELS configured: %d aliased channels", len(ValueOf.mediaChannels))
+	}
+	if len(ValueOf.mediaInvites) > 0 {
+		log.Sugar().Infof("MEDIA_CHANNELS configured: %d channels to resolve from invite links", len(ValueOf.mediaInvites))
+	}
 	if ValueOf.HashLength == 0 {
 		log.Sugar().Info("HASH_LENGTH can't be 0, defaulting to 6")
 		ValueOf.HashLength = 6
@@ -264,25 +822,162 @@ func Load(log *zap.Logger, cmd *cobra.Command) {
 		log.Sugar().Info("HASH_LENGTH can't be less than 5, defaulting to 6")
 		ValueOf.HashLength = 6
 	}
+	ValueOf.checkLimits(log)
+	if ValueOf.PremiumLimitMultiplier < 0 {
+		log.Sugar().Warn("PREMIUM_LIMIT_MULTIPLIER can't be negative, defaulting to 2")
+		ValueOf.PremiumLimitMultiplier = defaultPremiumLimitMultiplier
+	}
+	premiumOnly := make([]string, 0, len(ValueOf.PremiumOnly))
+	for _, entry := range ValueOf.PremiumOnly {
+		feature := strings.ToLower(strings.TrimSpace(entry))
+		if !slices.Contains(PremiumFeatures, feature) {
+			log.Sugar().Warnf("Ignoring PREMIUM_ONLY entry %q, expected one of %s", entry, strings.Join(PremiumFeatures, ", "))
+			continue
+		}
+		premiumOnly = append(premiumOnly, feature)
+	}
+	ValueOf.PremiumOnly = premiumOnly
 	if ValueOf.DirectRaceWorkers < 1 {
 		log.Sugar().Warn("DIRECT_RACE_WORKERS must be >= 1, defaulting to 1")
 		ValueOf.DirectRaceWorkers = 1
 	}
-	if ValueOf.FirebaseProjectID != "" {
-		log.Sugar().Infof("Firebase stream auth enabled for project: %s", ValueOf.FirebaseProjectID)
+	ValueOf.RobotsTxt = strings.ToLower(strings.TrimSpace(ValueOf.RobotsTxt))
+	switch ValueOf.RobotsTxt {
+	case "disallow", "allow", "off":
+	default:
+		log.Sugar().Warnf("ROBOTS_TXT must be 'disallow', 'allow' or 'off', got %q; defaulting to disallow", ValueOf.RobotsTxt)
+		ValueOf.RobotsTxt = defaultRobotsTxt
+	}
+	ValueOf.BrandName = strings.TrimSpace(ValueOf.BrandName)
+	if ValueOf.BrandName == "" {
+		ValueOf.BrandName = defaultBrandName
+	}
+	// The colors end up in a stylesheet, only plain hex colors are let through
+	if !brandColorRegex.MatchString(ValueOf.BrandColor) {
+		log.Sugar().Warnf("BRAND_COLOR must be a hex color like #667eea, got %q; using the default", ValueOf.BrandColor)
+		ValueOf.BrandColor = defaultBrandColor
+	}
+	if !brandColorRegex.MatchString(ValueOf.BrandAccentColor) {
+		log.Sugar().Warnf("BRAND_ACCENT_COLOR must be a hex color like #764ba2, got %q; using the default", ValueOf.BrandAccentColor)
+		ValueOf.BrandAccentColor = defaultBrandAccentColor
+	}
+	ValueOf.LogDigest = strings.ToLower(strings.TrimSpace(ValueOf.LogDigest))
+	switch ValueOf.LogDigest {
+	case "", "off", "hourly", "daily":
+	default:
+		log.Sugar().Warnf("LOG_DIGEST must be 'hourly' or 'daily', got %q; disabling digest", ValueOf.LogDigest)
+		ValueOf.LogDigest = ""
+	}
+	projectIDs := ValueOf.FirebaseProjectIDs[:0]
+	for _, projectID := range ValueOf.FirebaseProjectIDs {
+		if projectID = strings.TrimSpace(projectID); projectID != "" {
+			projectIDs = append(projectIDs, projectID)
+		}
+	}
+	ValueOf.FirebaseProjectIDs = projectIDs
+	if len(ValueOf.FirebaseProjectIDs) > 0 {
+		log.Sugar().Infof("Firebase stream auth enabled for projects: %s", strings.Join(ValueOf.FirebaseProjectIDs, ", "))
 	}
-	if ValueOf.FirebaseProjectID == "" {
+	if len(ValueOf.FirebaseProjectIDs) == 0 {
 		log.Sugar().Warn("FIREBASE_PROJECT_ID not set. /direct route will reject requests.")
 	}
+	uploadUIDs := ValueOf.UploadAllowedUIDs[:0]
+	for _, uid := range ValueOf.UploadAllowedUIDs {
+		if uid = strings.TrimSpace(uid); uid != "" {
+			uploadUIDs = append(uploadUIDs, uid)
+		}
+	}
+	ValueOf.UploadAllowedUIDs = uploadUIDs
+	postProcess := ValueOf.UploadPostProcess[:0]
+	for _, step := range ValueOf.UploadPostProcess {
+		if step = strings.ToLower(strings.TrimSpace(step)); step != "" {
+			postProcess = append(postProcess, step)
+		}
+	}
+	ValueOf.UploadPostProcess = postProcess
+	ValueOf.retentionDays = make(map[int64]int)
+	for _, override := range ValueOf.RetentionChannelDays {
+		channel, days, _ := strings.Cut(strings.TrimSpace(override), ":")
+		channelID, err1 := strconv.Atoi(channel)
+		n, err2 := strconv.Atoi(days)
+		if err1 != nil || err2 != nil || n < 0 {
+			log.Sugar().Warnf("Ignoring RETENTION_CHANNEL_DAYS entry %q, expected <channel ID>:<days>", override)
+			continue
+		}
+		ValueOf.retentionDays[int64(stripInt(log, channelID))] = n
+	}
+	ValueOf.loadWorkerClasses(log)
+	if ValueOf.CacheSnapshotMB < 1 {
+		ValueOf.CacheSnapshotMB = defaultCacheSnapshotMB
+	}
+	if ValueOf.CapacityHighPercent < 1 || ValueOf.CapacityHighPercent > 100 {
+		log.Sugar().Warnf("CAPACITY_HIGH_PERCENT must be between 1 and 100, defaulting to %d", defaultCapacityHighPercent)
+		ValueOf.CapacityHighPercent = defaultCapacityHighPercent
+	}
+	if ValueOf.CapacityLowPercent < 0 || ValueOf.CapacityLowPercent >= ValueOf.CapacityHighPercent {
+		low := min(defaultCapacityLowPercent, ValueOf.CapacityHighPercent/2)
+		log.Sugar().Warnf("CAPACITY_LOW_PERCENT must be below CAPACITY_HIGH_PERCENT, defaulting to %d", low)
+		ValueOf.CapacityLowPercent = low
+	}
+	ValueOf.adminTokens = make(map[string]string)
+	for _, entry := range ValueOf.AdminTokens {
+		role, hash, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		hash = strings.ToLower(hash)
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 || !adminRoles[role] {
+			log.Sugar().Warnf("Ignoring ADMIN_TOKENS entry %q, expected <role>:<sha256 hex>", entry)
+			continue
+		}
+		ValueOf.adminTokens[hash] = role
+	}
+	if ValueOf.RetentionCheckHours < 1 {
+		ValueOf.RetentionCheckHours = defaultRetentionCheckHours
+	}
+	if ValueOf.TrashChannelID != 0 {
+		ValueOf.TrashChannelID = int64(stripInt(log, int(ValueOf.TrashChannelID)))
+	}
+	if ValueOf.TrashDays < 1 {
+		ValueOf.TrashDays = defaultTrashDays
+	}
+	if ValueOf.BackupChannelID != 0 {
+		ValueOf.BackupChannelID = int64(stripInt(log, int(ValueOf.BackupChannelID)))
+	} else {
+		ValueOf.BackupChannelID = ValueOf.LogChannelID
+	}
+	if ValueOf.BackupIntervalHours < 0 {
+		ValueOf.BackupIntervalHours = 0
+	}
+	if ValueOf.TGBudgetRPS <= 0 {
+		ValueOf.TGBudgetRPS = defaultTGBudgetRPS
+	}
+	if ValueOf.TGBudgetBurst < 1 {
+		ValueOf.TGBudgetBurst = defaultTGBudgetBurst
+	}
+	if ValueOf.UploadEnabled && ValueOf.MediaChannelID == 0 && ValueOf.MediaChannelInvite == "" {
+		log.Sugar().Warn("UPLOAD_ENABLED needs MEDIA_CHANNEL_ID, disabling uploads")
+		ValueOf.UploadEnabled = false
+	}
+	if ValueOf.UploadMaxSizeMB < 1 || ValueOf.UploadMaxSizeMB > defaultUploadMaxSizeMB {
+		log.Sugar().Warnf("UPLOAD_MAX_SIZE_MB must be between 1 and %d, defaulting to %d", defaultUploadMaxSizeMB, defaultUploadMaxSizeMB)
+		ValueOf.UploadMaxSizeMB = defaultUploadMaxSizeMB
+	}
+}
+
+// normalizeBasePath turns "fsb/", "/fsb" or "/fsb/" into "/fsb" and "/" into "".
+func normalizeBasePath(path string) string {
+	path = strings.Trim(strings.TrimSpace(path), "/")
+	if path == "" {
+		return ""
+	}
+	return "/" + path
 }
 
-func getIP(public bool) (string, error) {
+func getIP(public, preferIPv6 bool) (string, error) {
 	var ip string
 	var err error
 	if public {
-		ip, err = GetPublicIP()
+		ip, err = FetchPublicIP(ValueOf.PublicIPProviders, preferIPv6)
 	} else {
-		ip, err = getInternalIP()
+		ip, err = getInternalIP(preferIPv6)
 	}
 	if ip == "" {
 		ip = "localhost"
@@ -294,34 +989,30 @@ func getIP(public bool) (string, error) {
 }
 
 // https://stackoverflow.com/a/23558495/15807350
-func getInternalIP() (string, error) {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return "", errors.New("no internet connection")
-	}
-	defer conn.Close()
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String(), nil
-}
-
-func GetPublicIP() (string, error) {
-	resp, err := http.Get("https://api.ipify.org?format=text")
-	if err != nil {
-		return "", err
+// The UDP "dial" sends nothing; it only asks the kernel which local address
+// routes to a public resolver. Both families are tried, preferred one first.
+func getInternalIP(preferIPv6 bool) (string, error) {
+	probes := [][2]string{{"udp4", "8.8.8.8:80"}, {"udp6", "[2001:4860:4860::8888]:80"}}
+	if preferIPv6 {
+		probes[0], probes[1] = probes[1], probes[0]
 	}
-	defer resp.Body.Close()
-	ip, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", err
-	}
-	if !checkIfIpAccessible(string(ip)) {
-		return string(ip), errors.New("PORT is blocked by firewall")
+	for _, probe := range probes {
+		conn, err := net.Dial(probe[0], probe[1])
+		if err != nil {
+			continue
+		}
+		localAddr := conn.LocalAddr().(*net.UDPAddr)
+		conn.Close()
+		return localAddr.IP.String(), nil
 	}
-	return string(ip), nil
+	return "", errors.New("no internet connection")
 }
 
-func checkIfIpAccessible(ip string) bool {
-	conn, err := net.Dial("tcp", ip+":80")
+// PortReachable reports whether ip accepts connections on port, e.g. to
+// tell whether a firewall blocks PORT on the public IP. It only means
+// something once a server listens on port.
+func PortReachable(ip string, port int) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(ip, strconv.Itoa(port)), 5*time.Second)
 	if err != nil {
 		return false
 	}
@@ -329,6 +1020,17 @@ func checkIfIpAccessible(ip string) bool {
 	return true
 }
 
+// ListenAddr is the address the HTTP servers bind to for port: all IPv6
+// (and, on dual-stack hosts, IPv4) interfaces with BIND_IPV6, otherwise the
+// Go default of every interface. BIND_IPV6 keeps the "tcp" network, as Go
+// makes "tcp6" listeners IPv6-only and IPv4 clients would be refused.
+func ListenAddr(port int) (network, address string) {
+	if ValueOf.BindIPv6 {
+		return "tcp", net.JoinHostPort("::", strconv.Itoa(port))
+	}
+	return "tcp", ":" + strconv.Itoa(port)
+}
+
 func stripInt(log *zap.Logger, a int) int {
 	strA := strconv.Itoa(abs(a))
 	lastDigits := strings.Replace(strA, "100", "", 1)
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+// pairSettings are the list settings a config file may also give as a map,
+// with the separator that joins each key to its value.
+var pairSettings = map[string]string{
+	"MEDIA_CHANNELS":         ":",
+	"RETENTION_CHANNEL_DAYS": ":",
+	"API_KEYS":               ":",
+	"FEATURE_FLAGS":          "=",
+}
+
+// loadFromConfigFile reads the YAML or TOML file given with --config. Keys
+// are the env var names, in any case, and nested sections join theirs with
+// an underscore, so firebase: {project_id: x} is FIREBASE_PROJECT_ID. Lists
+// are comma-joined, multi_tokens becomes MULTI_TOKEN1, MULTI_TOKEN2, ... and
+// media_channels may map aliases to a channel ID, an invite link or
+// {channel: ..., public: true}. Env vars, fsb.env and flags win over the file.
+func (c *config) loadFromConfigFile(log *zap.Logger, path string) {
+	log.Sugar().Infof("Loading config file %s", path)
+	settings, err := readConfigFile(path)
+	if err != nil {
+		log.Fatal("Error while reading the config file", zap.String("path", path), zap.Error(err))
+	}
+	known := envconfigNames()
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !known[name] && !botTokenRegex.MatchString(name+"=") {
+			log.Sugar().Warnf("Unknown setting %s in the config file", name)
+		}
+		if _, set := os.LookupEnv(name); set {
+			continue
+		}
+		os.Setenv(name, settings[name])
+	}
+}
+
+// readConfigFile decodes path, picking the format by its extension, and
+// returns the settings it holds as env vars.
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return nil, fmt.Errorf("unknown config file format %q, expected .yaml, .yml or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string)
+	if err := flattenSettings(settings, "", doc); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+func flattenSettings(settings map[string]string, prefix string, section map[string]any) error {
+	for key, value := range section {
+		name := settingName(prefix, key)
+		if value == nil {
+			continue
+		}
+		switch {
+		case name == "MULTI_TOKENS":
+			tokens, ok := value.([]any)
+			if !ok {
+				return fmt.Errorf("%s must be a list", key)
+			}
+			for i, token := range tokens {
+				settings["MULTI_TOKEN"+strconv.Itoa(i+1)] = settingString(token)
+			}
+		case name == "MEDIA_CHANNELS":
+			if channels, ok := value.(map[string]any); ok {
+				entries, err := mediaChannelEntries(channels)
+				if err != nil {
+					return err
+				}
+				settings[name] = strings.Join(entries, ",")
+				continue
+			}
+			fallthrough
+		default:
+			switch value := value.(type) {
+			case map[string]any:
+				if sep, ok := pairSettings[name]; ok {
+					settings[name] = strings.Join(pairEntries(value, sep), ",")
+				} else if err := flattenSettings(settings, name, value); err != nil {
+					return err
+				}
+			case []any:
+				items := make([]string, 0, len(value))
+				for _, item := range value {
+					if _, ok := item.(map[string]any); ok {
+						return fmt.Errorf("%s must be a list of values", key)
+					}
+					items = append(items, settingString(item))
+				}
+				settings[name] = strings.Join(items, ",")
+			default:
+				settings[name] = settingString(value)
+			}
+		}
+	}
+	return nil
+}
+
+// mediaChannelEntries turns the media_channels map into MEDIA_CHANNELS
+// entries, <alias>:<channel ID or invite link>[:public].
+func mediaChannelEntries(channels map[string]any) ([]string, error) {
+	entries := make([]string, 0, len(channels))
+	for alias, value := range channels {
+		public := false
+		if channel, ok := value.(map[string]any); ok {
+			value = channel["channel"]
+			if value == nil {
+				return nil, fmt.Errorf("media_channels.%s needs a channel", alias)
+			}
+			public, _ = channel["public"].(bool)
+		}
+		entry := alias + ":" + settingString(value)
+		if public {
+			entry += ":public"
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return entries, nil
+}
+
+func pairEntries(pairs map[string]any, sep string) []string {
+	entries := make([]string, 0, len(pairs))
+	for key, value := range pairs {
+		entries = append(entries, key+sep+settingString(value))
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+func settingName(prefix, key string) string {
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(key))
+	if prefix != "" {
+		name = prefix + "_" + name
+	}
+	return name
+}
+
+// settingString formats a scalar the way envconfig parses it back. Floats are
+// written without an exponent, which envconfig's integers wouldn't accept.
+func settingString(value any) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// envconfigNames lists the env vars the config struct reads.
+func envconfigNames() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get("envconfig"); name != "" {
+			names[name] = true
+		}
+	}
+	return names
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const publicIPTimeout = 5 * time.Second
+
+// FetchPublicIP asks each provider in order for this host's public address
+// and returns the first valid answer. Connections are forced to IPv4, or to
+// IPv6 when preferIPv6 is set, so dual-stack providers report that family.
+func FetchPublicIP(providers []string, preferIPv6 bool) (string, error) {
+	network := "tcp4"
+	if preferIPv6 {
+		network = "tcp6"
+	}
+	dialer := &net.Dialer{Timeout: publicIPTimeout}
+	client := &http.Client{
+		Timeout: publicIPTimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+
+	var errs []error
+	for _, provider := range providers {
+		provider = strings.TrimSpace(provider)
+		if provider == "" {
+			continue
+		}
+		ip, err := fetchPublicIPFrom(client, provider)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", provider, err))
+			continue
+		}
+		return ip, nil
+	}
+	if len(errs) == 0 {
+		return "", errors.New("no public IP providers configured")
+	}
+	return "", errors.Join(errs...)
+}
+
+func fetchPublicIPFrom(client *http.Client, provider string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, provider, nil)
+	if err != nil {
+		return "", err
+	}
+	// Some providers return an HTML page unless asked for plain text
+	req.Header.Set("Accept", "text/plain")
+	req.Header.Set("User-Agent", "curl/8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("invalid public IP response %q", ip)
+	}
+	return ip, nil
+}
+
+// GetHost returns HOST. Use it instead of reading Host directly: it changes
+// at runtime when PUBLIC_IP_CHECK_MINUTES detects a new public IP.
+func (c *config) GetHost() string {
+	c.hostMu.RLock()
+	defer c.hostMu.RUnlock()
+	return c.Host
+}
+
+// LinkBase is the prefix of generated links: PUBLIC_URL when set, otherwise
+// HOST followed by BASE_PATH, unless HOST already ends with it.
+func (c *config) LinkBase() string {
+	if c.PublicURL != "" {
+		return c.PublicURL
+	}
+	host := strings.TrimRight(c.GetHost(), "/")
+	if c.BasePath == "" || strings.HasSuffix(host, c.BasePath) {
+		return host
+	}
+	return host + c.BasePath
+}
+
+// UpdatePublicIP records ip as the current public IP and points HOST at it
+// when HOST was derived from the public IP.
+// It returns the new host and whether it changed.
+func (c *config) UpdatePublicIP(ip string) (string, bool) {
+	c.hostMu.Lock()
+	defer c.hostMu.Unlock()
+	c.publicIP = ip
+	if !c.hostFromPublicIP {
+		return c.Host, false
+	}
+	host := c.hostFor(ip)
+	if host == c.Host {
+		return c.Host, false
+	}
+	c.Host = host
+	return host, true
+}
+
+// PublicIP returns the public IP detected at startup with USE_PUBLIC_IP, if any.
+func (c *config) PublicIP() string {
+	c.hostMu.RLock()
+	defer c.hostMu.RUnlock()
+	return c.publicIP
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+const redacted = "<redacted>"
+
+// secretEnv lists credentials that don't follow the naming patterns checked
+// by isSecretEnv.
+var secretEnv = map[string]bool{
+	"API_HASH":           true,
+	"USER_SESSION":       true,
+	"S3_ACCESS_KEY_ID":   true,
+	"ID_OBFUSCATION_KEY": true,
+	"API_KEYS":           true,
+}
+
+func isSecretEnv(name string) bool {
+	return secretEnv[name] ||
+		strings.HasSuffix(name, "_TOKEN") ||
+		strings.Contains(name, "SECRET") ||
+		strings.Contains(name, "PASSWORD") ||
+		strings.Contains(name, "PASSPHRASE")
+}
+
+// RedactedEnv renders the effective configuration as an env file with every
+// credential replaced by a placeholder, for backups and bug reports.
+func (c *config) RedactedEnv() string {
+	var sb strings.Builder
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("envconfig")
+		if name == "" || !t.Field(i).IsExported() {
+			continue
+		}
+		value := formatEnvValue(v.Field(i))
+		switch {
+		case value == "":
+		case isSecretEnv(name):
+			value = redacted
+		case strings.HasSuffix(name, "_URL"):
+			value = redactURL(value)
+		}
+		fmt.Fprintf(&sb, "%s=%s\n", name, value)
+	}
+	for i := range c.MultiTokens {
+		fmt.Fprintf(&sb, "MULTI_TOKEN%d=%s\n", i+1, redacted)
+	}
+	return sb.String()
+}
+
+func formatEnvValue(v reflect.Value) string {
+	if v.Kind() != reflect.Slice {
+		return fmt.Sprint(v.Interface())
+	}
+	items := make([]string, v.Len())
+	for i := range items {
+		items[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(items, ",")
+}
+
+// redactURL hides the credentials update URLs tend to carry in the userinfo
+// or the query string.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	if u.User != nil {
+		u.User = url.User(redacted)
+	}
+	if u.RawQuery != "" {
+		query := u.Query()
+		for key := range query {
+			query.Set(key, redacted)
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
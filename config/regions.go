@@ -0,0 +1,84 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	RegionPolicyHint  = "hint"  // ?region= or X-FSB-Region picks the host
+	RegionPolicyGeoIP = "geoip" // the country of REGION_COUNTRY_HEADER does, unless hinted
+)
+
+// Region is a public host generated links may point to.
+type Region struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// Regions returns the REGION_HOSTS in the order they were given.
+func (c *config) Regions() []Region {
+	return c.regions
+}
+
+// RegionURL returns the base URL of a region.
+func (c *config) RegionURL(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, region := range c.regions {
+		if region.Name == name {
+			return region.URL, true
+		}
+	}
+	return "", false
+}
+
+// RegionForCountry returns the region REGION_COUNTRIES assigns to an ISO
+// country code, or "" for countries it doesn't list.
+func (c *config) RegionForCountry(country string) string {
+	return c.regionCountries[strings.ToUpper(strings.TrimSpace(country))]
+}
+
+// loadRegions parses REGION_HOSTS and REGION_COUNTRIES.
+func (c *config) loadRegions(log *zap.Logger) {
+	c.regions = nil
+	for _, entry := range c.RegionHosts {
+		name, base, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		name = strings.ToLower(name)
+		base = strings.TrimRight(strings.TrimSpace(base), "/")
+		u, err := url.Parse(base)
+		if !channelAliasRegex.MatchString(name) || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Sugar().Warnf("Ignoring REGION_HOSTS entry %q, expected <region>:<http(s) base URL>", entry)
+			continue
+		}
+		if _, dup := c.RegionURL(name); dup {
+			log.Sugar().Warnf("Ignoring REGION_HOSTS entry %q, region %s is listed twice", entry, name)
+			continue
+		}
+		c.regions = append(c.regions, Region{Name: name, URL: base})
+	}
+
+	c.regionCountries = make(map[string]string)
+	for _, entry := range c.RegionCountries {
+		country, region, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		country = strings.ToUpper(country)
+		region = strings.ToLower(region)
+		if _, ok := c.RegionURL(region); !ok || len(country) != 2 {
+			log.Sugar().Warnf("Ignoring REGION_COUNTRIES entry %q, expected <country code>:<region of REGION_HOSTS>", entry)
+			continue
+		}
+		c.regionCountries[country] = region
+	}
+
+	c.RegionPolicy = strings.ToLower(strings.TrimSpace(c.RegionPolicy))
+	switch c.RegionPolicy {
+	case RegionPolicyHint, RegionPolicyGeoIP:
+	default:
+		log.Sugar().Warnf("REGION_POLICY must be 'hint' or 'geoip', got %q; using hint", c.RegionPolicy)
+		c.RegionPolicy = RegionPolicyHint
+	}
+	if len(c.regions) > 0 {
+		log.Sugar().Infof("Advertising %d regions in links, picked by %s", len(c.regions), c.RegionPolicy)
+	}
+}
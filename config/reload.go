@@ -0,0 +1,185 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/joho/godotenv"
+	"github.com/kelseyhightower/envconfig"
+	"go.uber.org/zap"
+)
+
+// MultiTokensSetting names MULTI_TOKEN1, MULTI_TOKEN2, ... among the settings
+// a reload changed.
+const MultiTokensSetting = "MULTI_TOKEN*"
+
+// reloadable are the settings Reload applies to the running process. They
+// are read on every request or have a hook that applies them. The others
+// are used once at startup, to open listeners or log the bots in, and need
+// a restart.
+var reloadable = map[string]bool{
+	"ALLOWED_USERS":               true,
+	"ADMIN_USERS":                 true,
+	"STREAM_SECRET":               true,
+	"STREAM_SESSION_TTL_SECONDS":  true,
+	"API_KEYS":                    true,
+	"AUTH_MAX_FAILURES":           true,
+	"AUTH_FAILURE_WINDOW_SECONDS": true,
+	"AUTH_BAN_SECONDS":            true,
+	"RATE_LIMIT_PER_MINUTE":       true,
+	"RATE_LIMIT_BURST":            true,
+	"MAX_STREAMS_PER_CLIENT":      true,
+	"ABUSE_ACTION":                true,
+	"ABUSE_WINDOW_SECONDS":        true,
+	"ABUSE_MAX_NOT_FOUND":         true,
+	"ABUSE_MAX_SEQUENTIAL":        true,
+	"ABUSE_MAX_FILES":             true,
+	"ABUSE_PENALTY_SECONDS":       true,
+	"ABUSE_THROTTLE_PER_MINUTE":   true,
+	"FILE_CACHE_TTL_SECONDS":      true,
+	"DIRECT_CACHE_TTL_SECONDS":    true,
+	"ACCESS_LOG":                  true,
+	"FASTSTART_CHECK":             true,
+	"MOOV_PREFETCH":               true,
+	"LOG_LEVELS":                  true,
+}
+
+var (
+	reloadMu    sync.Mutex
+	reloadHooks []func(changed []string)
+	live        atomic.Pointer[config]
+)
+
+// Live returns the settings as of the last reload. Code running alongside
+// requests reads the reloadable settings through it: Reload swaps in a new
+// set instead of writing to ValueOf, which is read without a lock. Only the
+// settings are kept, state such as the detected host stays on ValueOf.
+func Live() *config {
+	if c := live.Load(); c != nil {
+		return c
+	}
+	return ValueOf
+}
+
+// OnReload registers fn to run after a reload changed some settings, for
+// the ones kept outside of ValueOf, e.g. by a service built at startup.
+func OnReload(fn func(changed []string)) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	reloadHooks = append(reloadHooks, fn)
+}
+
+// Reload reads fsb.env and the --config file again and applies the
+// reloadable settings that changed, which it returns. Env vars set outside
+// of those files and flags keep winning. Nothing is applied when the new
+// settings don't parse.
+func Reload(log *zap.Logger) ([]string, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+	log = log.Named("Config")
+	if err := ValueOf.reloadEnv(); err != nil {
+		return nil, err
+	}
+	fresh := &config{}
+	if err := envconfig.Process("", fresh); err != nil {
+		return nil, err
+	}
+	fresh.checkLimits(log)
+	fresh.loadMultiTokensFromEnv()
+
+	// next starts as a copy of the current settings and takes the
+	// reloadable ones that changed from fresh
+	c, next := Live(), &config{}
+	var changed []string
+	current, updated, parsed := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem(), reflect.ValueOf(fresh).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		field := current.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Tag.Get("envconfig")
+		if !reloadable[name] || reflect.DeepEqual(current.Field(i).Interface(), parsed.Field(i).Interface()) {
+			updated.Field(i).Set(current.Field(i))
+			continue
+		}
+		updated.Field(i).Set(parsed.Field(i))
+		changed = append(changed, name)
+	}
+	next.apiKeys = c.apiKeys
+	if slices.Contains(changed, "API_KEYS") {
+		next.apiKeys = fresh.apiKeys
+	}
+	if !sameTokens(c.MultiTokens, fresh.MultiTokens) {
+		next.MultiTokens = fresh.MultiTokens
+		changed = append(changed, MultiTokensSetting)
+	}
+	sort.Strings(changed)
+	if len(changed) > 0 {
+		live.Store(next)
+		for _, hook := range reloadHooks {
+			hook(changed)
+		}
+	}
+	log.Info("Config reloaded", zap.Strings("changed", changed))
+	return changed, nil
+}
+
+// reloadEnv sets the env vars of fsb.env and the config file to their current
+// values, and unsets those no longer in either.
+func (c *config) reloadEnv() error {
+	settings := make(map[string]string)
+	if c.configFile != "" {
+		fromFile, err := readConfigFile(c.configFile)
+		if err != nil {
+			return err
+		}
+		settings = fromFile
+	}
+	fromEnvFile, err := godotenv.Read(filepath.Clean("fsb.env"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for name, value := range fromEnvFile {
+		settings[name] = value
+	}
+
+	known := envconfigNames()
+	for _, name := range environNames() {
+		_, kept := settings[name]
+		if !kept && !c.pinnedEnv[name] && (known[name] || strings.HasPrefix(name, "MULTI_TOKEN")) {
+			os.Unsetenv(name)
+		}
+	}
+	for name, value := range settings {
+		if !c.pinnedEnv[name] {
+			os.Setenv(name, value)
+		}
+	}
+	return nil
+}
+
+// sameTokens compares two token lists regardless of order, which follows the
+// environment's.
+func sameTokens(a, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	sort.Strings(a)
+	sort.Strings(b)
+	return slices.Equal(a, b)
+}
+
+// environNames lists the env vars that are set.
+func environNames() []string {
+	env := os.Environ()
+	names := make([]string, 0, len(env))
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		names = append(names, name)
+	}
+	return names
+}
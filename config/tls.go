@@ -0,0 +1,66 @@
+package config
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TLSEnabled reports whether the servers terminate HTTPS themselves, with
+// TLS_CERT/TLS_KEY or TLS_AUTOCERT.
+func (c *config) TLSEnabled() bool {
+	return c.TLSCert != "" || c.TLSAutocert
+}
+
+// hostFor is the HOST derived from ip when HOST is not set.
+func (c *config) hostFor(ip string) string {
+	if c.TLSEnabled() {
+		if c.TLSPort == 443 {
+			return "https://" + ip
+		}
+		return "https://" + net.JoinHostPort(ip, strconv.Itoa(c.TLSPort))
+	}
+	return "http://" + net.JoinHostPort(ip, strconv.Itoa(c.Port))
+}
+
+// loadTLS checks the TLS settings. Autocert needs domain names, they are
+// taken from HOST when TLS_AUTOCERT_DOMAINS is not set.
+func (c *config) loadTLS(log *zap.Logger) {
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		log.Fatal("TLS_CERT and TLS_KEY must be set together")
+	}
+	if c.TLSCert != "" && c.TLSAutocert {
+		log.Sugar().Warn("TLS_CERT is set, ignoring TLS_AUTOCERT")
+		c.TLSAutocert = false
+	}
+	if !c.TLSEnabled() {
+		return
+	}
+	if c.TLSPort == c.Port || c.TLSPort == c.StatusPort {
+		log.Sugar().Fatalf("TLS_PORT %d must differ from PORT and STATUS_PORT", c.TLSPort)
+	}
+	if !c.TLSAutocert {
+		log.Sugar().Infof("Serving HTTPS on port %d, PORT %d redirects to it", c.TLSPort, c.Port)
+		return
+	}
+
+	domains := c.TLSAutocertDomains[:0]
+	for _, d := range c.TLSAutocertDomains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	if len(domains) == 0 {
+		if u, err := url.Parse(c.Host); err == nil && u.Hostname() != "" && net.ParseIP(u.Hostname()) == nil {
+			domains = append(domains, strings.ToLower(u.Hostname()))
+		}
+	}
+	if len(domains) == 0 {
+		log.Fatal("TLS_AUTOCERT needs a domain name in HOST or TLS_AUTOCERT_DOMAINS")
+	}
+	c.TLSAutocertDomains = domains
+	log.Sugar().Infof("Serving HTTPS on port %d with Let's Encrypt certificates for %s", c.TLSPort, strings.Join(domains, ", "))
+}
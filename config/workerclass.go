@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	WorkerClassLight  = "light"  // serves thumbnails and metadata lookups first
+	WorkerClassStream = "stream" // kept for streaming bytes
+)
+
+// WorkerClass returns the class WORKER_LABELS gives a bot, by ID or
+// username, or "" for unlabelled bots, which serve every kind of request.
+func (c *config) WorkerClass(botID int64, username string) string {
+	if class, ok := c.workerClasses[strconv.FormatInt(botID, 10)]; ok {
+		return class
+	}
+	return c.workerClasses[strings.ToLower(username)]
+}
+
+// WorkerClassesEnabled reports whether any worker is labelled.
+func (c *config) WorkerClassesEnabled() bool {
+	return len(c.workerClasses) > 0
+}
+
+// loadWorkerClasses parses WORKER_LABELS. Bot IDs are the part of a token
+// before the colon.
+func (c *config) loadWorkerClasses(log *zap.Logger) {
+	c.workerClasses = make(map[string]string)
+	for _, entry := range c.WorkerLabels {
+		bot, class, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		bot = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(bot), "@"))
+		class = strings.ToLower(strings.TrimSpace(class))
+		if bot == "" || (class != WorkerClassLight && class != WorkerClassStream) {
+			log.Sugar().Warnf("Ignoring WORKER_LABELS entry %q, expected <bot ID or @username>:<light|stream>", entry)
+			continue
+		}
+		c.workerClasses[bot] = class
+	}
+	if len(c.workerClasses) > 0 {
+		log.Sugar().Infof("WORKER_LABELS configured: %d labelled workers", len(c.workerClasses))
+	}
+}
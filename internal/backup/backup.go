@@ -0,0 +1,240 @@
+// Package backup packs the session files and a redacted config snapshot into
+// an encrypted archive and posts it to a private Telegram channel, so a
+// multi-worker deployment can be rebuilt from Telegram alone.
+package backup
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Magic starts every backup file, ahead of the salt and nonce.
+	Magic = "FSBBAK1\n"
+
+	saltSize         = 16
+	pbkdf2Iterations = 600000
+	configEntryName  = "config.redacted.env"
+)
+
+var (
+	ErrDisabled        = errors.New("BACKUP_PASSPHRASE not configured")
+	ErrNotBackup       = errors.New("not an fsb backup file")
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted backup")
+)
+
+var (
+	runMu sync.Mutex
+	log   = zap.NewNop()
+)
+
+// Result describes a backup posted to BACKUP_CHANNEL_ID.
+type Result struct {
+	MessageID    int       `json:"message_id"`
+	ChannelID    int64     `json:"channel_id"`
+	SessionFiles int       `json:"session_files"`
+	Size         int       `json:"size"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Enabled reports whether backups can be taken.
+func Enabled() bool {
+	return config.ValueOf.BackupPassphrase != "" && config.ValueOf.BackupChannelID != 0
+}
+
+// Start takes a backup every BACKUP_INTERVAL_HOURS. It must run after the main
+// bot has started.
+func Start(l *zap.Logger) {
+	log = l.Named("Backup")
+	if !Enabled() || config.ValueOf.BackupIntervalHours == 0 {
+		return
+	}
+	interval := time.Duration(config.ValueOf.BackupIntervalHours) * time.Hour
+	log.Info("Scheduled backups enabled",
+		zap.Int64("channelID", config.ValueOf.BackupChannelID),
+		zap.Duration("interval", interval))
+	go func() {
+		for {
+			time.Sleep(interval)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			res, err := Run(ctx)
+			cancel()
+			if err != nil {
+				log.Error("Scheduled backup failed", zap.Error(err))
+				continue
+			}
+			log.Info("Backup posted",
+				zap.Int("messageID", res.MessageID),
+				zap.Int("sessionFiles", res.SessionFiles),
+				zap.Int("size", res.Size))
+		}
+	}()
+}
+
+// Run builds, encrypts and uploads a backup. Concurrent calls are serialized.
+func Run(ctx context.Context) (*Result, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	runMu.Lock()
+	defer runMu.Unlock()
+
+	files, err := bot.ListSessionFiles()
+	if err != nil {
+		return nil, err
+	}
+	archive, err := pack(files, config.Live().RedactedEnv())
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := Encrypt(archive, config.ValueOf.BackupPassphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	tmp, err := os.CreateTemp("", "fsb-backup-*.bin")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(sealed)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("fsb-backup-%s.tar.gz.enc", now.Format("20060102-150405"))
+	caption := fmt.Sprintf("fsb backup, %s\n%d session file(s) and the redacted config.\nDecrypt with: fsb backup decrypt %s",
+		now.Format(time.RFC3339), len(files), name)
+	channelID := config.ValueOf.BackupChannelID
+	messageID, err := bot.UploadToChannel(ctx, channelID, tmp.Name(), name, "application/octet-stream", caption, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		MessageID:    messageID,
+		ChannelID:    channelID,
+		SessionFiles: len(files),
+		Size:         len(sealed),
+		CreatedAt:    now,
+	}, nil
+}
+
+// pack writes files, under their base names, and the config snapshot into a
+// gzipped tarball.
+func pack(files []string, env string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte, modTime time.Time) error {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o600,
+			Size:    int64(len(data)),
+			ModTime: modTime,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		modTime := time.Now()
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		if err := add(filepath.Base(path), data, modTime); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(configEntryName, []byte(env), time.Now()); err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals data with AES-256-GCM under a key derived from passphrase.
+// The output is Magic, the salt, the nonce and the ciphertext.
+func Encrypt(data []byte, passphrase string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(Magic)+len(salt)+len(nonce)+len(data)+aead.Overhead())
+	out = append(out, Magic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, data, []byte(Magic)), nil
+}
+
+// Decrypt opens a file written by Encrypt.
+func Decrypt(sealed []byte, passphrase string) ([]byte, error) {
+	rest, ok := bytes.CutPrefix(sealed, []byte(Magic))
+	if !ok || len(rest) < saltSize {
+		return nil, ErrNotBackup
+	}
+	aead, err := newAEAD(passphrase, rest[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	rest = rest[saltSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrNotBackup
+	}
+	data, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], []byte(Magic))
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return data, nil
+}
@@ -0,0 +1,152 @@
+// Package blocklist revokes links without deleting their Telegram messages:
+// blocked message IDs and /stream hashes answer 403.
+package blocklist
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotFound       = errors.New("blocklist entry not found")
+	ErrAlreadyBlocked = errors.New("already blocked")
+	ErrNoDatabase     = errors.New("database not initialized")
+)
+
+// Entry blocks either a message of a channel or a /stream hash.
+type Entry struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ChannelID int64     `gorm:"index:idx_blocklist_message" json:"channel_id,omitempty"`
+	MessageID int       `gorm:"index:idx_blocklist_message" json:"message_id,omitempty"`
+	Hash      string    `gorm:"index" json:"hash,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (Entry) TableName() string { return "blocklist" }
+
+func init() {
+	database.RegisterModel(&Entry{})
+}
+
+type messageKey struct {
+	channelID int64
+	messageID int
+}
+
+// Links are checked on every request, so the entries are kept in memory.
+var (
+	mu       sync.RWMutex
+	messages = make(map[messageKey]Entry)
+	hashes   = make(map[string]Entry)
+)
+
+// Load reads the blocklist. It must run after database.Init.
+func Load(log *zap.Logger) {
+	if database.DB == nil {
+		return
+	}
+	var rows []Entry
+	if err := database.DB.Find(&rows).Error; err != nil {
+		log.Named("Blocklist").Error("Failed to load blocklist", zap.Error(err))
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, row := range rows {
+		remember(row)
+	}
+}
+
+// remember adds an entry to the in-memory sets. mu must be held.
+func remember(e Entry) {
+	if e.Hash != "" {
+		hashes[e.Hash] = e
+	} else {
+		messages[messageKey{e.ChannelID, e.MessageID}] = e
+	}
+}
+
+// MessageBlocked reports whether links to a message of channelID are revoked.
+func MessageBlocked(channelID int64, messageID int) (Entry, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := messages[messageKey{channelID, messageID}]
+	return e, ok
+}
+
+// HashBlocked reports whether /stream links with hash are revoked.
+func HashBlocked(hash string) (Entry, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := hashes[hash]
+	return e, ok
+}
+
+// BlockMessage revokes the links to a message of channelID.
+func BlockMessage(channelID int64, messageID int, reason string) (*Entry, error) {
+	if _, ok := MessageBlocked(channelID, messageID); ok {
+		return nil, ErrAlreadyBlocked
+	}
+	return add(Entry{ChannelID: channelID, MessageID: messageID, Reason: reason})
+}
+
+// BlockHash revokes the /stream links with hash.
+func BlockHash(hash, reason string) (*Entry, error) {
+	if _, ok := HashBlocked(hash); ok {
+		return nil, ErrAlreadyBlocked
+	}
+	return add(Entry{Hash: hash, Reason: reason})
+}
+
+func add(e Entry) (*Entry, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	e.CreatedAt = time.Now()
+	if err := database.DB.Create(&e).Error; err != nil {
+		return nil, err
+	}
+	mu.Lock()
+	remember(e)
+	mu.Unlock()
+	return &e, nil
+}
+
+// Unblock restores the links of entry id.
+func Unblock(id uint) error {
+	if database.DB == nil {
+		return ErrNoDatabase
+	}
+	var e Entry
+	if err := database.DB.Limit(1).Find(&e, id).Error; err != nil {
+		return err
+	}
+	if e.ID == 0 {
+		return ErrNotFound
+	}
+	if err := database.DB.Delete(&e).Error; err != nil {
+		return err
+	}
+	mu.Lock()
+	if e.Hash != "" {
+		delete(hashes, e.Hash)
+	} else {
+		delete(messages, messageKey{e.ChannelID, e.MessageID})
+	}
+	mu.Unlock()
+	return nil
+}
+
+// List returns every entry, newest first.
+func List() ([]Entry, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	entries := []Entry{}
+	return entries, database.DB.Order("id DESC").Find(&entries).Error
+}
@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// ChannelAccess is what a worker last saw of a channel.
+type ChannelAccess struct {
+	ChannelID int64
+	Readable  bool
+	CheckedAt time.Time
+	Error     string // why the channel isn't readable
+}
+
+// RecordChannelAccess notes what reading channelID told about the worker's
+// access. Errors other than a missing membership say nothing about it and are
+// ignored. It returns true when the worker just lost access.
+func (w *Worker) RecordChannelAccess(channelID int64, err error) bool {
+	access := ChannelAccess{ChannelID: channelID, Readable: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		if !utils.IsNoChannelAccess(err) {
+			return false
+		}
+		access.Error = err.Error()
+	}
+	previous, seen := w.access.Swap(channelID, access)
+	return !access.Readable && (!seen || previous.(ChannelAccess).Readable)
+}
+
+// ChannelAccess lists what the worker last saw of each channel, by ID.
+func (w *Worker) ChannelAccess() []ChannelAccess {
+	var list []ChannelAccess
+	w.access.Range(func(_, value any) bool {
+		list = append(list, value.(ChannelAccess))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].ChannelID < list[j].ChannelID })
+	return list
+}
+
+// LockedChannels lists the channels the worker can't read.
+func (w *Worker) LockedChannels() []int64 {
+	var ids []int64
+	for _, access := range w.ChannelAccess() {
+		if !access.Readable {
+			ids = append(ids, access.ChannelID)
+		}
+	}
+	return ids
+}
+
+// StartAccessChecks has every worker read a recent message of each source
+// channel every ACCESS_CHECK_MINUTES, so a worker that lost its admin rights
+// shows up on /status and in LOG_CHANNEL before users hit it.
+func StartAccessChecks(l *zap.Logger) {
+	if config.ValueOf.AccessCheckMinutes <= 0 {
+		return
+	}
+	log := l.Named("AccessCheck")
+	interval := time.Duration(config.ValueOf.AccessCheckMinutes) * time.Minute
+	go func() {
+		for {
+			time.Sleep(interval)
+			checkChannelAccess(log)
+		}
+	}()
+}
+
+func checkChannelAccess(log *zap.Logger) {
+	workers := Snapshot()
+
+	for _, channelID := range config.ValueOf.SourceChannels() {
+		probe := &tg.InputMessageID{ID: max(stats.LatestMessageID(channelID), 1)}
+		var locked []*Worker
+		for _, w := range workers {
+			if w.Draining() {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), peerWarmUpTimeout)
+			channel, err := utils.GetChannelPeer(ctx, w.Client.API(), w.Client.PeerStorage, channelID)
+			if err == nil {
+				_, err = w.Client.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+					Channel: channel,
+					ID:      []tg.InputMessageClass{probe},
+				})
+			}
+			cancel()
+			if err != nil && !utils.IsNoChannelAccess(err) {
+				log.Warn("Access check failed",
+					zap.Int("workerID", w.ID),
+					zap.Int64("channelID", channelID),
+					zap.Error(err))
+			}
+			if w.RecordChannelAccess(channelID, err) {
+				locked = append(locked, w)
+			}
+		}
+		if len(locked) > 0 {
+			reportLockedWorkers(log, channelID, locked)
+		}
+	}
+}
+
+// reportLockedWorkers warns, in the logs and LOG_CHANNEL, about workers that
+// can't read channelID, whose requests then fail with no_channel_access.
+func reportLockedWorkers(log *zap.Logger, channelID int64, locked []*Worker) {
+	names := make([]string, 0, len(locked))
+	for _, w := range locked {
+		names = append(names, "@"+w.Self.Username)
+	}
+	log.Error("Workers can't read a source channel, make them admins of it",
+		zap.Int64("channelID", channelID),
+		zap.Strings("workers", names))
+	text := fmt.Sprintf("⚠️ %s can't read channel %d. Make them admins of it; with PROVISION_WORKERS that happens at startup when the main bot, or the USER_SESSION account, may add admins.",
+		strings.Join(names, ", "), channelID)
+	if err := postToLogChannel(text); err != nil {
+		log.Warn("Failed to report workers without channel access", zap.Error(err))
+	}
+}
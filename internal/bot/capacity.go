@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/webhook"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	capacityCheckInterval  = 15 * time.Second
+	capacityWebhookTimeout = 10 * time.Second
+)
+
+const (
+	PressureLow    = "low"    // at or below CAPACITY_LOW_PERCENT
+	PressureNormal = "normal" // between the thresholds
+	PressureHigh   = "high"   // at or above CAPACITY_HIGH_PERCENT, or CAPACITY_QUEUE_HIGH reached
+)
+
+// Capacity is how busy the instance is against what it can serve, for
+// autoscalers deciding to add replicas or worker tokens.
+type Capacity struct {
+	BytesPerSecond         int64   `json:"bytes_per_second"`
+	CapacityBytesPerSecond int64   `json:"capacity_bytes_per_second,omitempty"` // CAPACITY_MBPS, omitted when unset
+	HeadroomBytesPerSecond *int64  `json:"headroom_bytes_per_second,omitempty"` // omitted without CAPACITY_MBPS
+	ActiveRequests         int32   `json:"active_requests"`
+	StreamSlots            int     `json:"stream_slots,omitempty"`     // serving workers times CAPACITY_STREAMS_PER_WORKER
+	HeadroomStreams        *int    `json:"headroom_streams,omitempty"` // omitted without CAPACITY_STREAMS_PER_WORKER
+	QueueDepth             int64   `json:"queue_depth"`                // Telegram calls waiting for a worker's request budget
+	Workers                int     `json:"workers"`
+	ServingWorkers         int     `json:"serving_workers"`
+	Utilization            float64 `json:"utilization"` // highest share of bandwidth or stream slots in use, 0 when neither is configured
+	Pressure               string  `json:"pressure"`
+}
+
+// CurrentCapacity measures the instance's load against CAPACITY_MBPS and
+// CAPACITY_STREAMS_PER_WORKER.
+func CurrentCapacity() Capacity {
+	c := config.ValueOf
+	capacity := Capacity{BytesPerSecond: stats.Throughput()}
+
+	Workers.mut.Lock()
+	capacity.Workers = len(Workers.Bots)
+	capacity.ServingWorkers = len(servingWorkers())
+	for _, worker := range Workers.Bots {
+		capacity.ActiveRequests += worker.GetActiveRequests()
+		capacity.QueueDepth += worker.BudgetQueued()
+	}
+	Workers.mut.Unlock()
+
+	if c.CapacityMbps > 0 {
+		capacity.CapacityBytesPerSecond = int64(c.CapacityMbps) * 1000 * 1000 / 8
+		headroom := max(capacity.CapacityBytesPerSecond-capacity.BytesPerSecond, 0)
+		capacity.HeadroomBytesPerSecond = &headroom
+		capacity.Utilization = float64(capacity.BytesPerSecond) / float64(capacity.CapacityBytesPerSecond)
+	}
+	if c.CapacityStreamsPerWorker > 0 {
+		capacity.StreamSlots = capacity.ServingWorkers * c.CapacityStreamsPerWorker
+		headroom := max(capacity.StreamSlots-int(capacity.ActiveRequests), 0)
+		capacity.HeadroomStreams = &headroom
+		if capacity.StreamSlots == 0 {
+			capacity.Utilization = 1
+		} else {
+			capacity.Utilization = max(capacity.Utilization, float64(capacity.ActiveRequests)/float64(capacity.StreamSlots))
+		}
+	}
+
+	percent := capacity.Utilization * 100
+	switch {
+	case percent >= float64(c.CapacityHighPercent), c.CapacityQueueHigh > 0 && capacity.QueueDepth >= int64(c.CapacityQueueHigh):
+		capacity.Pressure = PressureHigh
+	case percent <= float64(c.CapacityLowPercent):
+		capacity.Pressure = PressureLow
+	default:
+		capacity.Pressure = PressureNormal
+	}
+	return capacity
+}
+
+// StartCapacityWebhook posts to CAPACITY_WEBHOOK_URL when the pressure turns
+// high (capacity.scale_up) and again once it falls back to low
+// (capacity.scale_down), so a flapping load between the thresholds doesn't
+// fire it. A failed post is retried on the next check.
+func StartCapacityWebhook(l *zap.Logger) {
+	log := l.Named("Capacity")
+	if config.ValueOf.CapacityWebhookURL == "" {
+		return
+	}
+	if config.ValueOf.CapacityMbps <= 0 && config.ValueOf.CapacityStreamsPerWorker <= 0 && config.ValueOf.CapacityQueueHigh <= 0 {
+		log.Warn("CAPACITY_WEBHOOK_URL is set without CAPACITY_MBPS, CAPACITY_STREAMS_PER_WORKER or CAPACITY_QUEUE_HIGH, it will never fire")
+		return
+	}
+	go func() {
+		scaledUp := false
+		for {
+			time.Sleep(capacityCheckInterval)
+			capacity := CurrentCapacity()
+			event := ""
+			switch {
+			case !scaledUp && capacity.Pressure == PressureHigh:
+				event = "capacity.scale_up"
+			case scaledUp && capacity.Pressure == PressureLow:
+				event = "capacity.scale_down"
+			default:
+				continue
+			}
+			if err := postCapacityWebhook(event, capacity); err != nil {
+				log.Warn("Failed to post capacity webhook", zap.String("event", event), zap.Error(err))
+				continue
+			}
+			scaledUp = !scaledUp
+			log.Info("Posted capacity webhook", zap.String("event", event), zap.Float64("utilization", capacity.Utilization), zap.Int64("queueDepth", capacity.QueueDepth))
+		}
+	}()
+}
+
+func postCapacityWebhook(event string, capacity Capacity) error {
+	body, err := json.Marshal(map[string]any{
+		"event":    event,
+		"instance": config.ValueOf.LinkBase(),
+		"time":     time.Now().UTC().Format(time.RFC3339),
+		"capacity": capacity,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), capacityWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.ValueOf.CapacityWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := config.ValueOf.CapacityWebhookSecret; secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
+	"math/rand"
+
+	"github.com/gotd/td/tg"
+)
+
+// CopyChannelMessage copies message messageID of channel from into channel to
+// with the main bot, without a forward header, and returns the new message ID.
+func CopyChannelMessage(ctx context.Context, from, to int64, messageID int) (int, error) {
+	if Bot == nil {
+		return 0, errors.New("main bot not started")
+	}
+	fromPeer, err := utils.GetChannelPeer(ctx, Bot.API(), Bot.PeerStorage, from)
+	if err != nil {
+		return 0, err
+	}
+	toPeer, err := utils.GetChannelPeer(ctx, Bot.API(), Bot.PeerStorage, to)
+	if err != nil {
+		return 0, err
+	}
+	updates, err := Bot.API().MessagesForwardMessages(ctx, &tg.MessagesForwardMessagesRequest{
+		FromPeer:   &tg.InputPeerChannel{ChannelID: fromPeer.ChannelID, AccessHash: fromPeer.AccessHash},
+		ToPeer:     &tg.InputPeerChannel{ChannelID: toPeer.ChannelID, AccessHash: toPeer.AccessHash},
+		ID:         []int{messageID},
+		RandomID:   []int64{rand.Int63()},
+		DropAuthor: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+	newID := sentMessageID(updates)
+	if newID == 0 {
+		return 0, errors.New("telegram did not return the new message ID")
+	}
+	return newID, nil
+}
+
+// DeleteChannelMessages deletes messages of channelID with the main bot.
+func DeleteChannelMessages(ctx context.Context, channelID int64, messageIDs ...int) error {
+	if Bot == nil {
+		return errors.New("main bot not started")
+	}
+	channel, err := utils.GetChannelPeer(ctx, Bot.API(), Bot.PeerStorage, channelID)
+	if err != nil {
+		return err
+	}
+	_, err = Bot.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: messageIDs})
+	return err
+}
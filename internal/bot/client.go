@@ -2,6 +2,7 @@ package bot
 
 import (
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/budget"
 	"EverythingSuckz/fsb/internal/commands"
 	"context"
 	"time"
@@ -11,10 +12,15 @@ import (
 	"github.com/celestix/gotgproto"
 	"github.com/celestix/gotgproto/sessionMaker"
 	"github.com/glebarez/sqlite"
+	"github.com/gotd/td/telegram"
 )
 
 var Bot *gotgproto.Client
 
+// mainBudget is the request budget of the main bot, which also serves as the
+// first worker.
+var mainBudget *budget.Bucket
+
 func StartClient(log *zap.Logger) (*gotgproto.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
@@ -22,6 +28,7 @@ func StartClient(log *zap.Logger) (*gotgproto.Client, error) {
 		client *gotgproto.Client
 		err    error
 	})
+	mainBudget = newWorkerBudget()
 	go func(ctx context.Context) {
 		client, err := gotgproto.NewClient(
 			int(config.ValueOf.ApiID),
@@ -29,9 +36,10 @@ func StartClient(log *zap.Logger) (*gotgproto.Client, error) {
 			gotgproto.ClientTypeBot(config.ValueOf.BotToken),
 			&gotgproto.ClientOpts{
 				Session: sessionMaker.SqlSession(
-					sqlite.Open("fsb.session"),
+					sqlite.Open(mainSessionFile),
 				),
 				DisableCopyright: true,
+				Middlewares:      []telegram.Middleware{budget.Middleware(mainBudget)},
 			},
 		)
 		resultChan <- struct {
@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const digestSendTimeout = 30 * time.Second
+
+// StartLogDigest periodically posts a summary of the streamed files to
+// LOG_CHANNEL when LOG_DIGEST is set to "hourly" or "daily".
+func StartLogDigest(l *zap.Logger) {
+	log := l.Named("LogDigest")
+	interval := config.ValueOf.LogDigest
+	if interval == "" || interval == "off" {
+		return
+	}
+	if Bot == nil {
+		log.Warn("Main bot not started, log digest disabled")
+		return
+	}
+	log.Info("Log channel digest enabled", zap.String("interval", interval))
+
+	go func() {
+		for {
+			next := nextDigestTime(time.Now(), interval)
+			time.Sleep(time.Until(next))
+
+			summary := stats.Snapshot(config.ValueOf.LogDigestTopFiles, true)
+			if summary.Requests == 0 {
+				log.Debug("No traffic since last digest, skipping")
+				continue
+			}
+			if err := postDigest(summary, interval); err != nil {
+				log.Error("Failed to post log digest", zap.Error(err))
+			}
+		}
+	}()
+}
+
+func nextDigestTime(now time.Time, interval string) time.Time {
+	if interval == "daily" {
+		year, month, day := now.Date()
+		return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+	}
+	return now.Truncate(time.Hour).Add(time.Hour)
+}
+
+func postDigest(summary stats.Summary, interval string) error {
+	return postToLogChannel(formatDigest(summary, interval))
+}
+
+// NotifyAdmins posts an alert to LOG_CHANNEL with the main bot.
+func NotifyAdmins(text string) error {
+	if Bot == nil {
+		return errors.New("main bot not started")
+	}
+	return postToLogChannel(text)
+}
+
+// postToLogChannel sends a plain text message to LOG_CHANNEL with the main bot.
+func postToLogChannel(text string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), digestSendTimeout)
+	defer cancel()
+	_, _, err := sendToLogChannel(ctx, text)
+	return err
+}
+
+// sendToLogChannel posts text to LOG_CHANNEL and returns where it landed so
+// the message can be edited later.
+func sendToLogChannel(ctx context.Context, text string) (tg.InputPeerClass, int, error) {
+	channel, err := utils.GetLogChannelPeer(ctx, Bot.API(), Bot.PeerStorage)
+	if err != nil {
+		return nil, 0, err
+	}
+	peer := &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash}
+	updates, err := Bot.API().MessagesSendMessage(ctx, &tg.MessagesSendMessageRequest{
+		Peer:      peer,
+		Message:   text,
+		RandomID:  rand.Int63(),
+		NoWebpage: true,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return peer, sentMessageID(updates), nil
+}
+
+// sentMessageID digs the ID of a freshly sent message out of the updates
+// Telegram answers with. It returns 0 when none is found.
+func sentMessageID(updates tg.UpdatesClass) int {
+	var list []tg.UpdateClass
+	switch u := updates.(type) {
+	case *tg.UpdateShortSentMessage:
+		return u.ID
+	case *tg.Updates:
+		list = u.Updates
+	case *tg.UpdatesCombined:
+		list = u.Updates
+	}
+	for _, update := range list {
+		switch u := update.(type) {
+		case *tg.UpdateMessageID:
+			return u.ID
+		case *tg.UpdateNewChannelMessage:
+			return u.Message.GetID()
+		}
+	}
+	return 0
+}
+
+func formatDigest(summary stats.Summary, interval string) string {
+	var sb strings.Builder
+	title := "Hourly"
+	if interval == "daily" {
+		title = "Daily"
+	}
+	fmt.Fprintf(&sb, "📊 %s stream digest\n", title)
+	fmt.Fprintf(&sb, "%s → %s\n\n", summary.From.Format("2006-01-02 15:04"), summary.To.Format("2006-01-02 15:04"))
+	fmt.Fprintf(&sb, "Requests: %d\n", summary.Requests)
+	fmt.Fprintf(&sb, "Errors: %d\n", summary.Errors)
+	fmt.Fprintf(&sb, "Bandwidth: %s\n", utils.FormatFileSize(summary.Bytes))
+	fmt.Fprintf(&sb, "Unique users: %d\n", summary.UniqueUsers)
+
+	if len(summary.TopFiles) > 0 {
+		sb.WriteString("\nTop files:\n")
+		for i, file := range summary.TopFiles {
+			name := file.FileName
+			if name == "" {
+				name = fmt.Sprintf("message %d", file.MessageID)
+			}
+			fmt.Fprintf(&sb, "%d. %s — %d requests, %s\n", i+1, name, file.Requests, utils.FormatFileSize(file.Bytes))
+		}
+	}
+	return sb.String()
+}
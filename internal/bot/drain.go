@@ -0,0 +1,162 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	drainPollInterval = time.Second
+	// drainTimeout bounds the wait for long streams; whatever is still
+	// running afterwards is cut off.
+	drainTimeout  = 6 * time.Hour
+	logOutTimeout = 30 * time.Second
+)
+
+var (
+	ErrUnknownWorker   = errors.New("unknown worker")
+	ErrPinnedWorker    = errors.New("the main bot and the default worker can't be drained")
+	ErrAlreadyDraining = errors.New("worker is already draining")
+	ErrDuplicateWorker = errors.New("a worker already runs this bot")
+)
+
+// Draining reports whether the worker stopped taking new requests.
+func (w *Worker) Draining() bool {
+	return atomic.LoadInt32(&w.draining) == 1
+}
+
+// DrainWorker stops routing new requests to worker id. In the background it
+// waits for the worker's active requests, logs it out and removes it, so its
+// bot token can be rotated without dropping streams.
+func DrainWorker(l *zap.Logger, id int) (*Worker, error) {
+	Workers.mut.Lock()
+	var worker *Worker
+	for _, w := range Workers.Bots {
+		if w.ID == id {
+			worker = w
+		}
+	}
+	switch {
+	case worker == nil:
+		Workers.mut.Unlock()
+		return nil, ErrUnknownWorker
+	case worker.Client == Bot || worker == Workers.Bots[0]:
+		// Uploads, channel management and thumbnails are tied to these
+		Workers.mut.Unlock()
+		return nil, ErrPinnedWorker
+	case !atomic.CompareAndSwapInt32(&worker.draining, 0, 1):
+		Workers.mut.Unlock()
+		return nil, ErrAlreadyDraining
+	}
+	Workers.mut.Unlock()
+
+	go finishDrain(l.Named("Drain"), worker)
+	return worker, nil
+}
+
+func finishDrain(log *zap.Logger, worker *Worker) {
+	log = log.With(zap.Int("workerID", worker.ID), zap.String("username", worker.Self.Username))
+	log.Info("Draining worker", zap.Int32("activeRequests", worker.GetActiveRequests()))
+	deadline := time.Now().Add(drainTimeout)
+	for worker.GetActiveRequests() > 0 && time.Now().Before(deadline) {
+		time.Sleep(drainPollInterval)
+	}
+	if active := worker.GetActiveRequests(); active > 0 {
+		log.Warn("Drain timed out, cutting off remaining requests", zap.Int32("activeRequests", active))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), logOutTimeout)
+	if _, err := worker.Client.API().AuthLogOut(ctx); err != nil {
+		log.Warn("Failed to log out worker", zap.Error(err))
+	}
+	cancel()
+	worker.Client.Stop()
+
+	Workers.mut.Lock()
+	remaining := make([]*Worker, 0, len(Workers.Bots))
+	for _, w := range Workers.Bots {
+		if w != worker {
+			remaining = append(remaining, w)
+		}
+	}
+	Workers.Bots = remaining
+	Workers.mut.Unlock()
+
+	if config.ValueOf.UseSessionFile {
+		// The session was logged out, a later start must log in again
+		if err := os.Remove(WorkerSessionPath(worker.ID)); err != nil && !os.IsNotExist(err) {
+			log.Warn("Failed to remove worker session file", zap.Error(err))
+		}
+	}
+	log.Info("Worker drained and removed")
+	text := fmt.Sprintf("🔌 Worker #%d (@%s) drained and logged out. Remove its token from MULTI_TOKEN* before the next restart.",
+		worker.ID, worker.Self.Username)
+	if err := postToLogChannel(text); err != nil {
+		log.Warn("Failed to report drained worker", zap.Error(err))
+	}
+}
+
+// AddWorker starts a worker for token at runtime, e.g. to replace a drained
+// one. Tokens of bots already running and tokens the Bot API rejects are
+// refused before connecting.
+func AddWorker(ctx context.Context, token string) (*Worker, error) {
+	if runningBot(token) {
+		return nil, ErrDuplicateWorker
+	}
+	if _, err := ValidateBotToken(ctx, token); errors.Is(err, ErrInvalidBotToken) {
+		return nil, err
+	}
+	type result struct {
+		worker *Worker
+		err    error
+	}
+	// Unbuffered: a start finishing after the caller gave up finds no
+	// receiver and is stopped instead of joining the pool
+	done := make(chan result)
+	go func() {
+		worker, err := Workers.start(token)
+		select {
+		case done <- result{worker, err}:
+		case <-ctx.Done():
+			if worker != nil {
+				worker.Client.Stop()
+			}
+		}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		Workers.register(res.worker)
+		return res.worker, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("worker did not start: %w", ctx.Err())
+	}
+}
+
+// runningBot reports whether a worker, draining or not, runs the bot of token.
+func runningBot(token string) bool {
+	botID, _, _ := strings.Cut(token, ":")
+	id, err := strconv.ParseInt(botID, 10, 64)
+	if err != nil {
+		return false
+	}
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+	for _, w := range Workers.Bots {
+		if w.Self.ID == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/celestix/gotgproto"
+	"go.uber.org/zap"
+)
+
+const (
+	restartBackoffMin = 10 * time.Second
+	restartBackoffMax = 10 * time.Minute
+)
+
+var errWorkerRemoved = errors.New("worker was removed")
+
+// Healthy reports whether the worker answers its DC pings. Unhealthy workers
+// get no new requests.
+func (w *Worker) Healthy() bool {
+	return atomic.LoadInt32(&w.unhealthy) == 0
+}
+
+// recordPing updates the worker's health with the outcome of a ping. After
+// WORKER_UNHEALTHY_AFTER failures in a row the worker is taken out of
+// rotation and restarted in the background.
+func (w *Worker) recordPing(log *zap.Logger, err error) {
+	log = log.With(zap.Int("workerID", w.ID))
+	if err == nil {
+		atomic.StoreInt32(&w.failedPings, 0)
+		if atomic.CompareAndSwapInt32(&w.unhealthy, 1, 0) {
+			log.Info("Worker is healthy again")
+		}
+		return
+	}
+	failed := atomic.AddInt32(&w.failedPings, 1)
+	limit := config.ValueOf.WorkerUnhealthyAfter
+	if limit <= 0 || int(failed) < limit {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&w.unhealthy, 0, 1) {
+		log.Warn("Worker marked unhealthy, no new requests are routed to it", zap.Int32("failedPings", failed))
+		go restartWorker(log, w)
+	}
+}
+
+// restartWorker reconnects an unhealthy worker with exponential backoff,
+// until it recovers on its own, is restarted or is removed. The main bot
+// has no token of its own here and only recovers through its pings.
+func restartWorker(log *zap.Logger, w *Worker) {
+	if w.token == "" {
+		return
+	}
+	backoff := restartBackoffMin
+	for {
+		time.Sleep(backoff)
+		if w.Healthy() || w.Draining() {
+			return
+		}
+		err := restartClient(w)
+		if err == nil || errors.Is(err, errWorkerRemoved) {
+			return
+		}
+		backoff = min(backoff*2, restartBackoffMax)
+		log.Warn("Failed to restart worker", zap.Duration("retryIn", backoff), zap.Error(err))
+	}
+}
+
+// restartClient replaces w in Workers.Bots by a worker with the same ID,
+// token and session on a fresh connection.
+func restartClient(w *Worker) error {
+	w.Client.Stop()
+	timeout := time.Duration(config.ValueOf.WorkerStartTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	type result struct {
+		client *gotgproto.Client
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		client, err := startWorker(Workers.log, w.token, w.ID, w.budget)
+		done <- result{client, err}
+	}()
+	var client *gotgproto.Client
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return res.err
+		}
+		client = res.client
+	case <-time.After(timeout):
+		go func() {
+			// Don't leave a late connection running next to the next attempt
+			if res := <-done; res.client != nil {
+				res.client.Stop()
+			}
+		}()
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+
+	replacement := &Worker{
+		ID:     w.ID,
+		Client: client,
+		Self:   client.Self,
+		log:    w.log,
+		budget: w.budget,
+		token:  w.token,
+	}
+	replacement.metrics.StartTime = time.Now()
+	Workers.mut.Lock()
+	found := false
+	bots := make([]*Worker, 0, len(Workers.Bots))
+	for _, b := range Workers.Bots {
+		if b == w && !w.Draining() {
+			b, found = replacement, true
+		}
+		bots = append(bots, b)
+	}
+	Workers.Bots = bots
+	Workers.mut.Unlock()
+	if !found {
+		client.Stop()
+		return errWorkerRemoved
+	}
+	Workers.log.Info("Worker restarted", zap.Int("workerID", w.ID), zap.String("username", client.Self.Username))
+	return nil
+}
+
+// PoolReadiness summarizes the workers for the readiness probe.
+type PoolReadiness struct {
+	Total     int  `json:"total"`
+	Serving   int  `json:"serving"`   // neither draining nor unhealthy
+	Reachable bool `json:"reachable"` // a serving worker answered its last DC ping
+}
+
+// Readiness reports how many workers take requests and whether Telegram
+// answers them. Without WORKER_PING_SECONDS any serving worker counts as
+// reaching Telegram.
+func Readiness() PoolReadiness {
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+	serving := servingWorkers()
+	readiness := PoolReadiness{Total: len(Workers.Bots), Serving: len(serving)}
+	for _, worker := range serving {
+		if config.ValueOf.WorkerPingSeconds <= 0 || worker.Ping() > 0 {
+			readiness.Reachable = true
+			break
+		}
+	}
+	return readiness
+}
@@ -0,0 +1,85 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// InviteChannel is the channel an invite link leads to, kept so later starts
+// don't have to join again, and keep working once the link is revoked.
+type InviteChannel struct {
+	Hash       string    `gorm:"primaryKey" json:"hash"`
+	ChannelID  int64     `json:"channel_id"`
+	Title      string    `json:"title"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+func (InviteChannel) TableName() string { return "invite_channels" }
+
+func init() {
+	database.RegisterModel(&InviteChannel{})
+}
+
+var errNoUserSession = errors.New("USER_SESSION is needed to join through an invite link")
+
+// ResolveInviteChannels finds the IDs of MEDIA_CHANNEL_INVITE, when
+// MEDIA_CHANNEL_ID isn't set, and of the MEDIA_CHANNELS given by invite link.
+// Links seen before resolve from the database; new ones are joined by the
+// userbot. It must run after StartUserBot and before the workers are
+// provisioned.
+func ResolveInviteChannels(l *zap.Logger) {
+	log := l.Named("InviteLinks")
+	if config.ValueOf.MediaChannelID == 0 && config.ValueOf.MediaChannelInvite != "" {
+		channelID, err := resolveInviteChannel(log, config.ValueOf.MediaChannelInvite)
+		if err != nil {
+			log.Error("Failed to resolve MEDIA_CHANNEL_INVITE", zap.Error(err))
+		} else {
+			config.ValueOf.MediaChannelID = channelID
+			log.Info("MEDIA_CHANNEL_ID resolved from its invite link", zap.Int64("channelID", channelID))
+		}
+	}
+	for alias, link := range config.ValueOf.MediaChannelInvites() {
+		channelID, err := resolveInviteChannel(log, link)
+		if err != nil {
+			log.Error("Failed to resolve MEDIA_CHANNELS invite link", zap.String("alias", alias), zap.Error(err))
+			continue
+		}
+		config.ValueOf.ResolveMediaChannel(alias, channelID)
+		log.Info("MEDIA_CHANNELS entry resolved from its invite link",
+			zap.String("alias", alias),
+			zap.Int64("channelID", channelID))
+	}
+}
+
+func resolveInviteChannel(log *zap.Logger, link string) (int64, error) {
+	hash := inviteHash(link)
+	if database.DB != nil {
+		var known []InviteChannel
+		database.DB.Limit(1).Find(&known, "hash = ?", hash)
+		if len(known) == 1 {
+			return known[0].ChannelID, nil
+		}
+	}
+	if UserBot.client == nil {
+		return 0, errNoUserSession
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+	defer cancel()
+	channel, err := joinByInvite(ctx, log, UserBot.client, link)
+	if err != nil {
+		return 0, err
+	}
+	if database.DB != nil {
+		row := InviteChannel{Hash: hash, ChannelID: channel.ID, Title: channel.Title, ResolvedAt: time.Now()}
+		if err := database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&row).Error; err != nil {
+			log.Warn("Failed to store invite link", zap.Error(err))
+		}
+	}
+	return channel.ID, nil
+}
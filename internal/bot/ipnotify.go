@@ -0,0 +1,28 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/publicip"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// StartPublicIPNotifier posts the new link base to LOG_CHANNEL whenever the
+// public IP watcher sees a change, when PUBLIC_IP_NOTIFY is enabled.
+func StartPublicIPNotifier(l *zap.Logger) {
+	log := l.Named("PublicIPNotify")
+	if !config.ValueOf.PublicIPNotify || config.ValueOf.PublicIPCheckMinutes <= 0 {
+		return
+	}
+	if Bot == nil {
+		log.Warn("Main bot not started, public IP notifications disabled")
+		return
+	}
+	publicip.OnChange(func(oldIP, newIP, host string) {
+		text := fmt.Sprintf("🌐 Public IP changed: %s → %s\nLinks are now served from %s", oldIP, newIP, host)
+		if err := postToLogChannel(text); err != nil {
+			log.Error("Failed to post public IP change", zap.Error(err))
+		}
+	})
+}
@@ -1,22 +1,26 @@
 package bot
 
 import (
-	"time"
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/budget"
 
 	"github.com/gotd/contrib/middleware/floodwait"
-	"github.com/gotd/contrib/middleware/ratelimit"
 	"github.com/gotd/td/telegram"
 	"go.uber.org/zap"
-	"golang.org/x/time/rate"
 )
 
-func GetFloodMiddleware(log *zap.Logger) []telegram.Middleware {
+// GetFloodMiddleware retries flood waits and makes every call draw from the
+// worker's request budget.
+func GetFloodMiddleware(log *zap.Logger, bucket *budget.Bucket) []telegram.Middleware {
 	waiter := floodwait.NewSimpleWaiter().WithMaxRetries(10)
-	// Allow higher throughput: 30 req/s sustained with bursts up to 15
-	// Previous: 10 req/s with burst of 5 — too restrictive under concurrency
-	ratelimiter := ratelimit.New(rate.Every(time.Millisecond*33), 15)
 	return []telegram.Middleware{
 		waiter,
-		ratelimiter,
+		budget.Middleware(bucket),
 	}
 }
+
+// newWorkerBudget returns a full bucket sized by TG_BUDGET_RPS and
+// TG_BUDGET_BURST.
+func newWorkerBudget() *budget.Bucket {
+	return budget.NewBucket(float64(config.ValueOf.TGBudgetRPS), config.ValueOf.TGBudgetBurst)
+}
@@ -0,0 +1,59 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const pingTimeout = 10 * time.Second
+
+// DC returns the Telegram data center the worker is connected to, or 0
+// before the client received its config.
+func (w *Worker) DC() int {
+	return w.Client.Config().ThisDC
+}
+
+// Ping returns the last measured round trip to the worker's DC, or 0 when
+// it was not measured yet or the last ping failed.
+func (w *Worker) Ping() time.Duration {
+	return time.Duration(atomic.LoadInt64(&w.pingNanos))
+}
+
+func (w *Worker) measurePing() error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	start := time.Now()
+	if err := w.Client.Ping(ctx); err != nil {
+		atomic.StoreInt64(&w.pingNanos, 0)
+		return err
+	}
+	atomic.StoreInt64(&w.pingNanos, int64(time.Since(start)))
+	return nil
+}
+
+// StartPingMonitor measures every worker's round trip to its DC every
+// WORKER_PING_SECONDS, for /status and the health checks. A non-positive
+// interval disables it.
+func StartPingMonitor(l *zap.Logger) {
+	log := l.Named("Ping")
+	interval := time.Duration(config.ValueOf.WorkerPingSeconds) * time.Second
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		for {
+			for _, worker := range Snapshot() {
+				err := worker.measurePing()
+				if err != nil {
+					log.Warn("Failed to ping worker DC", zap.Int("workerID", worker.ID), zap.Error(err))
+				}
+				worker.recordPing(log, err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// ProgressReporter keeps a status message in LOG_CHANNEL up to date while a
+// long running upload job moves bytes into Telegram. A nil reporter (the
+// feature is off or the status message couldn't be posted) ignores calls,
+// so jobs can use it unconditionally.
+type ProgressReporter struct {
+	log     *zap.Logger
+	title   string
+	total   int64
+	started time.Time
+	every   time.Duration
+	peer    tg.InputPeerClass
+	msgID   int
+
+	done    atomic.Int64
+	editing atomic.Bool
+
+	mu       sync.Mutex
+	lastEdit time.Time
+	closed   bool
+}
+
+// NewProgressReporter posts the initial status of a job named title that
+// will move total bytes (0 when unknown). It returns nil when
+// UPLOAD_PROGRESS_SECONDS is 0 or the main bot isn't running.
+func NewProgressReporter(l *zap.Logger, title string, total int64) *ProgressReporter {
+	interval := config.ValueOf.UploadProgressSeconds
+	if interval <= 0 || Bot == nil {
+		return nil
+	}
+	p := &ProgressReporter{
+		log:     l.Named("UploadProgress"),
+		title:   title,
+		total:   total,
+		started: time.Now(),
+		every:   time.Duration(interval) * time.Second,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), digestSendTimeout)
+	defer cancel()
+	peer, msgID, err := sendToLogChannel(ctx, p.render("⏳ Starting", 0))
+	if err != nil || msgID == 0 {
+		p.log.Warn("Failed to post upload status", zap.String("title", title), zap.Error(err))
+		return nil
+	}
+	p.peer = peer
+	p.msgID = msgID
+	p.lastEdit = time.Now()
+	return p
+}
+
+// Update records that done bytes have been transferred so far. The status
+// message is edited in the background at most once per interval, so this is
+// cheap enough to call for every chunk.
+func (p *ProgressReporter) Update(done int64) {
+	if p == nil {
+		return
+	}
+	p.done.Store(done)
+	p.mu.Lock()
+	due := !p.closed && time.Since(p.lastEdit) >= p.every
+	if due {
+		p.lastEdit = time.Now()
+	}
+	p.mu.Unlock()
+	if !due || !p.editing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer p.editing.Store(false)
+		p.mu.Lock()
+		closed := p.closed
+		p.mu.Unlock()
+		if !closed {
+			p.edit(p.render("⏳ Uploading", done))
+		}
+	}()
+}
+
+// Finish marks the job as done and posts a separate message with link, so
+// the result shows up as a fresh notification.
+func (p *ProgressReporter) Finish(link string) {
+	if p == nil || !p.close() {
+		return
+	}
+	done := p.done.Load()
+	if p.total > 0 {
+		done = p.total
+	}
+	p.edit(p.render("✅ Done", done))
+	text := fmt.Sprintf("✅ %s is ready\n%s", p.title, link)
+	if err := postToLogChannel(text); err != nil {
+		p.log.Warn("Failed to post upload result", zap.String("title", p.title), zap.Error(err))
+	}
+}
+
+// Fail marks the job as failed with err.
+func (p *ProgressReporter) Fail(err error) {
+	if p == nil || !p.close() {
+		return
+	}
+	p.edit(p.render("❌ Failed", p.done.Load()) + "\n" + err.Error())
+}
+
+// close stops further progress edits and waits for one in flight, so it
+// can't overwrite the final status.
+func (p *ProgressReporter) close() bool {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return false
+	}
+	p.closed = true
+	p.mu.Unlock()
+	for p.editing.Load() {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+func (p *ProgressReporter) edit(text string) {
+	ctx, cancel := context.WithTimeout(context.Background(), digestSendTimeout)
+	defer cancel()
+	_, err := Bot.API().MessagesEditMessage(ctx, &tg.MessagesEditMessageRequest{
+		Peer:      p.peer,
+		ID:        p.msgID,
+		Message:   text,
+		NoWebpage: true,
+	})
+	// Telegram rejects edits that don't change the text; that's not a failure
+	if err != nil && !strings.Contains(err.Error(), "MESSAGE_NOT_MODIFIED") {
+		p.log.Warn("Failed to edit upload status", zap.String("title", p.title), zap.Error(err))
+	}
+}
+
+func (p *ProgressReporter) render(state string, done int64) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: %s\n", state, p.title)
+	elapsed := time.Since(p.started).Seconds()
+	var speed float64
+	if elapsed > 0 {
+		speed = float64(done) / elapsed
+	}
+	if p.total > 0 {
+		percent := float64(done) * 100 / float64(p.total)
+		fmt.Fprintf(&sb, "%.1f%% — %s / %s\n", percent, utils.FormatFileSize(done), utils.FormatFileSize(p.total))
+	} else {
+		fmt.Fprintf(&sb, "%s\n", utils.FormatFileSize(done))
+	}
+	fmt.Fprintf(&sb, "Speed: %s/s", utils.FormatFileSize(int64(speed)))
+	if p.total > done && speed > 0 {
+		eta := float64(p.total-done) / speed
+		fmt.Fprintf(&sb, " — ETA %s", utils.TimeFormat(uint64(eta)))
+	}
+	return sb.String()
+}
@@ -0,0 +1,185 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/celestix/gotgproto"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const provisionTimeout = time.Minute
+
+// ProvisionWorkers makes every worker an admin of the channels it streams
+// from, so a multi-worker deployment doesn't need each bot added by hand. The
+// userbot does it when USER_SESSION is set, joining MEDIA_CHANNEL_ID through
+// MEDIA_CHANNEL_INVITE first; otherwise the main bot, which then needs the
+// right to add admins.
+func ProvisionWorkers(l *zap.Logger) {
+	if !config.ValueOf.ProvisionWorkers || Bot == nil {
+		return
+	}
+	log := l.Named("Provision")
+	client, by := Bot, "main bot"
+	if UserBot.client != nil {
+		client, by = UserBot.client, "userbot"
+	}
+
+	workers := Snapshot()
+
+	for _, channelID := range config.ValueOf.SourceChannels() {
+		ctx, cancel := context.WithTimeout(context.Background(), provisionTimeout)
+		promoted, err := provisionChannel(ctx, log, client, channelID, workers)
+		cancel()
+		if err != nil {
+			log.Warn("Failed to provision workers",
+				zap.Int64("channelID", channelID),
+				zap.String("by", by),
+				zap.Error(err))
+			continue
+		}
+		log.Info("Workers provisioned",
+			zap.Int64("channelID", channelID),
+			zap.String("by", by),
+			zap.Int("promoted", promoted))
+	}
+}
+
+// provisionChannel promotes the workers that aren't admins of channelID yet
+// and returns how many it promoted.
+func provisionChannel(ctx context.Context, log *zap.Logger, client *gotgproto.Client, channelID int64, workers []*Worker) (int, error) {
+	var channel *tg.InputChannel
+	invite := config.ValueOf.MediaChannelInvite
+	if client != Bot && channelID == config.ValueOf.MediaChannelID && invite != "" {
+		joined, err := joinByInvite(ctx, log, client, invite)
+		if err != nil {
+			return 0, fmt.Errorf("failed to join through the invite link: %w", err)
+		}
+		if joined.ID != channelID {
+			return 0, fmt.Errorf("the invite link is for channel %d", joined.ID)
+		}
+		channel = joined.AsInput()
+	} else {
+		var err error
+		if channel, err = utils.GetChannelPeer(ctx, client.API(), client.PeerStorage, channelID); err != nil {
+			return 0, err
+		}
+	}
+
+	admins, err := client.API().ChannelsGetParticipants(ctx, &tg.ChannelsGetParticipantsRequest{
+		Channel: channel,
+		Filter:  &tg.ChannelParticipantsAdmins{},
+		Limit:   100,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get admins: %w", err)
+	}
+	isAdmin := map[int64]bool{client.Self.ID: true}
+	if participants, ok := admins.(*tg.ChannelsChannelParticipants); ok {
+		for _, p := range participants.Participants {
+			switch p := p.(type) {
+			case *tg.ChannelParticipantAdmin:
+				isAdmin[p.UserID] = true
+			case *tg.ChannelParticipantCreator:
+				isAdmin[p.UserID] = true
+			}
+		}
+	}
+
+	promoted := 0
+	for _, w := range workers {
+		if isAdmin[w.Self.ID] {
+			continue
+		}
+		if err := promoteWorker(ctx, client, channel, w); err != nil {
+			log.Warn("Failed to make worker an admin",
+				zap.Int64("channelID", channelID),
+				zap.Int("workerID", w.ID),
+				zap.String("username", w.Self.Username),
+				zap.Error(err))
+			continue
+		}
+		log.Info("Made worker an admin",
+			zap.Int64("channelID", channelID),
+			zap.Int("workerID", w.ID),
+			zap.String("username", w.Self.Username))
+		promoted++
+	}
+	return promoted, nil
+}
+
+// promoteWorker makes w an admin of channel. Workers only read, but bots
+// can't see a broadcast channel's messages without being admins.
+func promoteWorker(ctx context.Context, client *gotgproto.Client, channel *tg.InputChannel, w *Worker) error {
+	resolved, err := client.API().ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{Username: w.Self.Username})
+	if err != nil {
+		return err
+	}
+	var user *tg.User
+	for _, u := range resolved.Users {
+		if u, ok := u.(*tg.User); ok && u.ID == w.Self.ID {
+			user = u
+		}
+	}
+	if user == nil {
+		return errors.New("username resolved to another account")
+	}
+	_, err = client.API().ChannelsEditAdmin(ctx, &tg.ChannelsEditAdminRequest{
+		Channel: channel,
+		UserID:  user.AsInput(),
+		AdminRights: tg.ChatAdminRights{
+			PostMessages: true,
+		},
+		Rank: "admin",
+	})
+	return err
+}
+
+// joinByInvite joins the chat of an invite link, unless the account already
+// is a member, and returns it. Bots can't follow invite links.
+func joinByInvite(ctx context.Context, log *zap.Logger, client *gotgproto.Client, invite string) (*tg.Channel, error) {
+	hash := inviteHash(invite)
+	checked, err := client.API().MessagesCheckChatInvite(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	var chats []tg.ChatClass
+	if already, ok := checked.(*tg.ChatInviteAlready); ok {
+		chats = []tg.ChatClass{already.Chat}
+	} else {
+		updates, err := client.API().MessagesImportChatInvite(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		switch updates := updates.(type) {
+		case *tg.Updates:
+			chats = updates.Chats
+		case *tg.UpdatesCombined:
+			chats = updates.Chats
+		}
+		log.Info("Joined a channel through its invite link")
+	}
+	for _, chat := range chats {
+		if channel, ok := chat.(*tg.Channel); ok {
+			return channel, nil
+		}
+	}
+	return nil, errors.New("the invite link isn't for a channel")
+}
+
+// inviteHash is the hash of t.me/+<hash>, t.me/joinchat/<hash> and
+// tg://join?invite=<hash> links; anything else is taken as the bare hash.
+func inviteHash(invite string) string {
+	invite = strings.TrimSpace(invite)
+	if _, hash, ok := strings.Cut(invite, "invite="); ok {
+		return hash
+	}
+	invite = invite[strings.LastIndex(invite, "/")+1:]
+	return strings.TrimPrefix(invite, "+")
+}
@@ -0,0 +1,60 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"os"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// reloadWorkers follows the MULTI_TOKEN* settings of a config reload: bots of
+// new tokens are started and workers whose token is gone are drained, so
+// their streams finish first.
+func reloadWorkers(changed []string) {
+	if !slices.Contains(changed, config.MultiTokensSetting) {
+		return
+	}
+	log := Workers.log.Named("Reload")
+	tokens := slices.Clone(config.Live().MultiTokens)
+
+	Workers.mut.Lock()
+	var removed []*Worker
+	for _, w := range Workers.Bots {
+		if w.token != "" && !w.Draining() && !slices.Contains(tokens, w.token) {
+			removed = append(removed, w)
+		}
+	}
+	Workers.mut.Unlock()
+	for _, w := range removed {
+		if _, err := DrainWorker(log, w.ID); err != nil {
+			log.Warn("Failed to drain worker of a removed token", zap.Int("workerID", w.ID), zap.Error(err))
+		}
+	}
+
+	timeout := time.Duration(config.ValueOf.WorkerStartTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 120 * time.Second
+	}
+	go func() {
+		if config.ValueOf.UseSessionFile {
+			// StartWorkers only creates it when there were tokens at startup
+			_ = os.MkdirAll(workerSessionDir, os.ModePerm)
+		}
+		for _, token := range tokens {
+			if runningBot(token) {
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			worker, err := AddWorker(ctx, token)
+			cancel()
+			if err != nil {
+				log.Error("Failed to start worker of a new token", zap.String("token", maskToken(token)), zap.Error(err))
+				continue
+			}
+			log.Info("Worker of a new token started", zap.Int("workerID", worker.ID), zap.String("username", worker.Self.Username))
+		}
+	}()
+}
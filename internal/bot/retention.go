@@ -0,0 +1,188 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/retention"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	// retentionBatch is how many message IDs are fetched, and deleted, at once
+	retentionBatch = 100
+	// retentionMaxEmptyBatches ends a scan after this many batches without a
+	// single message, as bots can't ask where a channel ends
+	retentionMaxEmptyBatches = 20
+	retentionBatchDelay      = time.Second
+	retentionRunTimeout      = time.Hour
+)
+
+// retentionResult is what one run removed from a channel.
+type retentionResult struct {
+	channelID int64
+	days      int
+	messages  int
+	bytes     int64
+}
+
+// StartRetention periodically deletes the messages of LOG_CHANNEL and
+// MEDIA_CHANNEL_ID that are older than their retention policy, tombstones
+// their links and reports the reclaimed storage to LOG_CHANNEL.
+func StartRetention(l *zap.Logger) {
+	log := l.Named("Retention")
+	channels := []int64{config.ValueOf.LogChannelID}
+	if config.ValueOf.MediaChannelID != 0 && config.ValueOf.MediaChannelID != config.ValueOf.LogChannelID {
+		channels = append(channels, config.ValueOf.MediaChannelID)
+	}
+	channels = slices.DeleteFunc(channels, func(channelID int64) bool {
+		return config.ValueOf.RetentionDaysFor(channelID) <= 0
+	})
+	if len(channels) == 0 {
+		return
+	}
+	if Bot == nil {
+		log.Warn("Main bot not started, retention disabled")
+		return
+	}
+	interval := time.Duration(config.ValueOf.RetentionCheckHours) * time.Hour
+	log.Info("Retention enabled", zap.Int64s("channels", channels), zap.Duration("interval", interval))
+
+	go func() {
+		for {
+			var results []retentionResult
+			for _, channelID := range channels {
+				result, err := sweepChannel(log, channelID)
+				if err != nil {
+					log.Error("Retention run failed", zap.Int64("channelID", channelID), zap.Error(err))
+				}
+				if result.messages > 0 {
+					results = append(results, result)
+				}
+			}
+			if len(results) > 0 {
+				if err := postToLogChannel(formatRetention(results)); err != nil {
+					log.Warn("Failed to post retention report", zap.Error(err))
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// sweepChannel deletes the expired messages of channelID, resuming after the
+// last message the previous run went through. Message IDs grow with time, so
+// the scan stops at the first message that is still within the policy.
+func sweepChannel(log *zap.Logger, channelID int64) (retentionResult, error) {
+	days := config.ValueOf.RetentionDaysFor(channelID)
+	result := retentionResult{channelID: channelID, days: days}
+	ctx, cancel := context.WithTimeout(context.Background(), retentionRunTimeout)
+	defer cancel()
+	channel, err := utils.GetChannelPeer(ctx, Bot.API(), Bot.PeerStorage, channelID)
+	if err != nil {
+		return result, err
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	scanned := retention.LastScanned(channelID)
+	next := scanned + 1
+	for empty := 0; empty < retentionMaxEmptyBatches; {
+		ids := make([]tg.InputMessageClass, 0, retentionBatch)
+		for id := next; id < next+retentionBatch; id++ {
+			ids = append(ids, &tg.InputMessageID{ID: id})
+		}
+		next += retentionBatch
+		res, err := Bot.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{Channel: channel, ID: ids})
+		if err != nil {
+			return result, err
+		}
+		modified, ok := res.AsModified()
+		if !ok {
+			return result, fmt.Errorf("unexpected response %T", res)
+		}
+		messages := modified.GetMessages()
+		slices.SortFunc(messages, func(a, b tg.MessageClass) int { return a.GetID() - b.GetID() })
+
+		var expired []int
+		var tombstones []retention.Tombstone
+		last, found, live := scanned, false, false
+		now := time.Now()
+		for _, message := range messages {
+			var date int
+			tombstone := retention.Tombstone{ChannelID: channelID, MessageID: message.GetID(), DeletedAt: now}
+			switch m := message.(type) {
+			case *tg.Message:
+				date = m.Date
+				if file, err := utils.FileFromMedia(m.Media); err == nil {
+					tombstone.FileName = file.FileName
+					tombstone.Size = file.FileSize
+				}
+			case *tg.MessageService:
+				date = m.Date
+			default:
+				last = message.GetID()
+				continue
+			}
+			found = true
+			if !time.Unix(int64(date), 0).Before(cutoff) {
+				live = true
+				break
+			}
+			tombstone.PostedAt = time.Unix(int64(date), 0)
+			expired = append(expired, message.GetID())
+			tombstones = append(tombstones, tombstone)
+			last = message.GetID()
+		}
+
+		if len(expired) > 0 {
+			if _, err := Bot.API().ChannelsDeleteMessages(ctx, &tg.ChannelsDeleteMessagesRequest{Channel: channel, ID: expired}); err != nil {
+				return result, fmt.Errorf("delete messages: %w", err)
+			}
+			if err := retention.Record(tombstones); err != nil {
+				log.Error("Failed to record tombstones", zap.Int64("channelID", channelID), zap.Error(err))
+			}
+			result.messages += len(tombstones)
+			for _, t := range tombstones {
+				result.bytes += t.Size
+			}
+		}
+		// Runs of empty IDs are only skipped for good once a message follows
+		// them; they may just be the end of the channel.
+		if found {
+			scanned = last
+			empty = 0
+			if err := retention.SetLastScanned(channelID, scanned); err != nil {
+				return result, err
+			}
+		} else {
+			empty++
+		}
+		if live {
+			break
+		}
+		time.Sleep(retentionBatchDelay)
+	}
+	if result.messages > 0 {
+		log.Info("Deleted expired messages",
+			zap.Int64("channelID", channelID),
+			zap.Int("messages", result.messages),
+			zap.Int64("bytes", result.bytes))
+	}
+	return result, nil
+}
+
+func formatRetention(results []retentionResult) string {
+	var sb strings.Builder
+	sb.WriteString("🧹 Retention cleanup\n")
+	for _, r := range results {
+		fmt.Fprintf(&sb, "\nChannel %d (%d days): %d messages, %s reclaimed",
+			r.channelID, r.days, r.messages, utils.FormatFileSize(r.bytes))
+	}
+	return sb.String()
+}
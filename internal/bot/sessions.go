@@ -0,0 +1,144 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/celestix/gotgproto/storage"
+	"github.com/glebarez/sqlite"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+)
+
+const (
+	workerSessionDir   = "sessions"
+	mainSessionFile    = "fsb.session"
+	sessionAuthTimeout = 30 * time.Second
+)
+
+// SessionHealth describes the state of a single on-disk session file.
+type SessionHealth struct {
+	Path       string    `json:"path"`
+	DC         int       `json:"dc"`
+	Addr       string    `json:"addr"`
+	HasAuthKey bool      `json:"has_auth_key"`
+	LastUsed   time.Time `json:"last_used"`
+	Authorized bool      `json:"authorized"`
+	Username   string    `json:"username,omitempty"`
+	UserID     int64     `json:"user_id,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Healthy reports whether the session could be loaded and is still authorized.
+func (h SessionHealth) Healthy() bool {
+	return h.Error == "" && h.Authorized
+}
+
+// storedSession mirrors the JSON envelope gotd writes into the session table.
+type storedSession struct {
+	Version int
+	Data    session.Data
+}
+
+// WorkerSessionPath returns the session file used by the worker with the given ID.
+func WorkerSessionPath(id int) string {
+	return filepath.Join(workerSessionDir, fmt.Sprintf("worker-%d.session", id))
+}
+
+// ListSessionFiles returns the main bot session and every worker session found on disk.
+func ListSessionFiles() ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(workerSessionDir, "worker-*.session"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	if _, err := os.Stat(mainSessionFile); err == nil {
+		files = append([]string{mainSessionFile}, files...)
+	}
+	return files, nil
+}
+
+// InspectSessionFile opens a session file, decodes the stored MTProto session
+// and, when it holds an auth key, connects to Telegram to confirm the
+// authorization is still valid.
+func InspectSessionFile(ctx context.Context, path string, apiID int, apiHash string) SessionHealth {
+	health := SessionHealth{Path: path}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	health.LastUsed = info.ModTime()
+
+	data, err := readSessionData(path)
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if data == nil {
+		health.Error = "session is empty"
+		return health
+	}
+
+	var stored storedSession
+	if err := json.Unmarshal(data, &stored); err != nil {
+		health.Error = fmt.Sprintf("invalid session data: %v", err)
+		return health
+	}
+	health.DC = stored.Data.DC
+	health.Addr = stored.Data.Addr
+	health.HasAuthKey = len(stored.Data.AuthKey) > 0
+	if !health.HasAuthKey {
+		health.Error = "session has no auth key"
+		return health
+	}
+
+	memory := &session.StorageMemory{}
+	if err := memory.StoreSession(ctx, data); err != nil {
+		health.Error = err.Error()
+		return health
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sessionAuthTimeout)
+	defer cancel()
+
+	client := telegram.NewClient(apiID, apiHash, telegram.Options{SessionStorage: memory})
+	err = client.Run(ctx, func(ctx context.Context) error {
+		status, err := client.Auth().Status(ctx)
+		if err != nil {
+			return err
+		}
+		health.Authorized = status.Authorized
+		if status.User != nil {
+			health.Username = status.User.Username
+			health.UserID = status.User.ID
+		}
+		return nil
+	})
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	if !health.Authorized {
+		health.Error = "session is no longer authorized"
+	}
+	return health
+}
+
+func readSessionData(path string) ([]byte, error) {
+	peerStorage := storage.NewPeerStorage(sqlite.Open(path), false)
+	if db, err := peerStorage.SqlSession.DB(); err == nil {
+		defer db.Close()
+	}
+	stored := peerStorage.GetSession()
+	if stored == nil || len(stored.Data) == 0 {
+		return nil, nil
+	}
+	return stored.Data, nil
+}
@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Balancer strategies, as named in BALANCER_SHADOW_STRATEGY.
+const (
+	strategyLeastLoaded = "least_loaded"
+	strategyTwoChoices  = "two_choices"
+	strategyRandom      = "random"
+)
+
+// balancerStrategies pick one of a non-empty list of workers.
+var balancerStrategies = map[string]func([]*Worker) *Worker{
+	strategyLeastLoaded: leastLoadedWorker,
+	strategyTwoChoices:  pickOfTwoWorkers,
+	strategyRandom: func(workers []*Worker) *Worker {
+		return workers[rand.Intn(len(workers))]
+	},
+}
+
+// ShadowReport compares the workers picked for real with the ones the shadow
+// strategy would have picked for the same decisions.
+type ShadowReport struct {
+	Strategy     string           `json:"strategy"`
+	Percent      int              `json:"percent"`
+	Since        time.Time        `json:"since"`
+	Decisions    int64            `json:"decisions"`
+	Agreed       int64            `json:"agreed"`
+	LiveActive   float64          `json:"live_active_avg"`   // active requests of the served worker when picked
+	ShadowActive float64          `json:"shadow_active_avg"` // same, for the shadow pick
+	Live         map[string]int64 `json:"live_strategies"`   // decisions per strategy actually used
+	LivePicks    map[int]int64    `json:"live_picks"`        // decisions per worker ID
+	ShadowPicks  map[int]int64    `json:"shadow_picks"`
+}
+
+var shadow = struct {
+	mu           sync.Mutex
+	since        time.Time
+	decisions    int64
+	agreed       int64
+	liveActive   int64
+	shadowActive int64
+	live         map[string]int64
+	livePicks    map[int]int64
+	shadowPicks  map[int]int64
+}{
+	since:       time.Now(),
+	live:        make(map[string]int64),
+	livePicks:   make(map[int]int64),
+	shadowPicks: make(map[int]int64),
+}
+
+// recordShadowPick replays BALANCER_SHADOW_PERCENT of the decisions through
+// the shadow strategy, over the same candidates. Nothing is served from its
+// pick. Workers.mut must be held so both strategies see the same loads.
+func recordShadowPick(liveStrategy string, live *Worker, candidates []*Worker) {
+	percent := config.ValueOf.BalancerShadowPercent
+	pick := balancerStrategies[config.ValueOf.BalancerShadowStrategy]
+	if live == nil || percent <= 0 || pick == nil || rand.Intn(100) >= percent {
+		return
+	}
+	candidate := pick(candidates)
+
+	shadow.mu.Lock()
+	defer shadow.mu.Unlock()
+	shadow.decisions++
+	if candidate == live {
+		shadow.agreed++
+	}
+	shadow.liveActive += int64(live.GetActiveRequests())
+	shadow.shadowActive += int64(candidate.GetActiveRequests())
+	shadow.live[liveStrategy]++
+	shadow.livePicks[live.ID]++
+	shadow.shadowPicks[candidate.ID]++
+}
+
+// GetShadowReport returns what shadow mode recorded since the start.
+func GetShadowReport() ShadowReport {
+	shadow.mu.Lock()
+	defer shadow.mu.Unlock()
+	report := ShadowReport{
+		Strategy:    config.ValueOf.BalancerShadowStrategy,
+		Percent:     config.ValueOf.BalancerShadowPercent,
+		Since:       shadow.since,
+		Decisions:   shadow.decisions,
+		Agreed:      shadow.agreed,
+		Live:        make(map[string]int64, len(shadow.live)),
+		LivePicks:   make(map[int]int64, len(shadow.livePicks)),
+		ShadowPicks: make(map[int]int64, len(shadow.shadowPicks)),
+	}
+	if shadow.decisions > 0 {
+		report.LiveActive = float64(shadow.liveActive) / float64(shadow.decisions)
+		report.ShadowActive = float64(shadow.shadowActive) / float64(shadow.decisions)
+	}
+	for k, v := range shadow.live {
+		report.Live[k] = v
+	}
+	for k, v := range shadow.livePicks {
+		report.LivePicks[k] = v
+	}
+	for k, v := range shadow.shadowPicks {
+		report.ShadowPicks[k] = v
+	}
+	return report
+}
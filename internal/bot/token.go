@@ -0,0 +1,121 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const botAPIValidateTimeout = 10 * time.Second
+
+var botTokenFormat = regexp.MustCompile(`^\d{5,}:[A-Za-z0-9_-]{30,}$`)
+
+// ErrInvalidBotToken is returned when a token is malformed or rejected by the Bot API.
+var ErrInvalidBotToken = errors.New("invalid bot token")
+
+var botAPIClient = &http.Client{Timeout: botAPIValidateTimeout}
+
+type botAPIGetMeResponse struct {
+	Ok          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Result      struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"result"`
+}
+
+// maskToken keeps the bot ID part of a token and hides the secret.
+func maskToken(token string) string {
+	if len(token) <= 10 {
+		return "***"
+	}
+	return token[:10] + "..."
+}
+
+// ValidateBotToken checks the token format and calls getMe over the HTTP Bot
+// API, which answers in milliseconds, before the much heavier MTProto client is
+// started. Only definitive rejections are wrapped in ErrInvalidBotToken; if the
+// Bot API itself is unreachable the error is returned unwrapped so callers can
+// decide to go ahead with the MTProto login anyway.
+func ValidateBotToken(ctx context.Context, token string) (string, error) {
+	if !botTokenFormat.MatchString(token) {
+		return "", fmt.Errorf("%w: malformed token", ErrInvalidBotToken)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.telegram.org/bot"+token+"/getMe", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := botAPIClient.Do(req)
+	if err != nil {
+		// Don't leak the token through the URL in the error message.
+		return "", fmt.Errorf("bot api unreachable")
+	}
+	defer resp.Body.Close()
+
+	var body botAPIGetMeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode getMe response: %w", err)
+	}
+	if !body.Ok {
+		if body.ErrorCode == http.StatusUnauthorized || body.ErrorCode == http.StatusNotFound {
+			return "", fmt.Errorf("%w: %s", ErrInvalidBotToken, body.Description)
+		}
+		return "", fmt.Errorf("getMe failed: %s", body.Description)
+	}
+	return body.Result.Username, nil
+}
+
+// ChannelMembership is a bot's standing in a channel, as getChatMember
+// reports it.
+type ChannelMembership struct {
+	Status          string `json:"status"` // creator, administrator, member, left or kicked
+	CanPostMessages bool   `json:"can_post_messages"`
+	CanPromote      bool   `json:"can_promote_members"`
+}
+
+// IsAdmin reports whether the bot can read the channel: bots only see the
+// messages of channels they administer.
+func (m ChannelMembership) IsAdmin() bool {
+	return m.Status == "administrator" || m.Status == "creator"
+}
+
+// CheckChannelMembership asks the Bot API how the bot of token stands in
+// channelID, without starting an MTProto client.
+func CheckChannelMembership(ctx context.Context, token string, channelID int64) (ChannelMembership, error) {
+	botID, _, _ := strings.Cut(token, ":")
+	query := url.Values{
+		"chat_id": {"-100" + strconv.FormatInt(channelID, 10)},
+		"user_id": {botID},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://api.telegram.org/bot"+token+"/getChatMember?"+query.Encode(), nil)
+	if err != nil {
+		return ChannelMembership{}, err
+	}
+	resp, err := botAPIClient.Do(req)
+	if err != nil {
+		return ChannelMembership{}, fmt.Errorf("bot api unreachable")
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Ok          bool              `json:"ok"`
+		Description string            `json:"description"`
+		Result      ChannelMembership `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return ChannelMembership{}, fmt.Errorf("decode getChatMember response: %w", err)
+	}
+	if !body.Ok {
+		return ChannelMembership{}, errors.New(body.Description)
+	}
+	return body.Result, nil
+}
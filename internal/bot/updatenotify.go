@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/updatecheck"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const maxUpdateMessageRunes = 4000
+
+// StartUpdateNotifier posts to LOG_CHANNEL when the update check finds a new
+// release, with the breaking changes of every release in between.
+func StartUpdateNotifier(l *zap.Logger) {
+	log := l.Named("UpdateNotify")
+	if config.ValueOf.UpdateCheckHours <= 0 {
+		return
+	}
+	if Bot == nil {
+		log.Warn("Main bot not started, update notifications disabled")
+		return
+	}
+	updatecheck.OnNewVersion(func(status updatecheck.Status) {
+		if err := postToLogChannel(formatUpdate(status)); err != nil {
+			log.Error("Failed to post update notification", zap.Error(err))
+		}
+	})
+}
+
+func formatUpdate(status updatecheck.Status) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "⬆️ New version available: %s (running %s)", status.Latest, status.Current)
+	if status.Breaking {
+		sb.WriteString("\n⚠️ Contains breaking changes, read the notes before upgrading.")
+	}
+	for _, r := range status.Releases {
+		fmt.Fprintf(&sb, "\n\n%s: %s", r.Version, r.URL)
+		for _, note := range r.Breaking {
+			fmt.Fprintf(&sb, "\n• %s", note)
+		}
+	}
+	// Long release notes must not push the message over Telegram's limit
+	text := []rune(sb.String())
+	if len(text) > maxUpdateMessageRunes {
+		return string(text[:maxUpdateMessageRunes-1]) + "…"
+	}
+	return string(text)
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
+	"math/rand"
+	"os"
+
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+)
+
+// uploadProgress adapts a ProgressReporter to the gotd uploader.
+type uploadProgress struct {
+	reporter *ProgressReporter
+}
+
+func (u uploadProgress) Chunk(_ context.Context, state uploader.ProgressState) error {
+	u.reporter.Update(state.Uploaded)
+	return nil
+}
+
+// UploadToMediaChannel uploads the file at path to MEDIA_CHANNEL_ID as a
+// document named name with the main bot and returns the new message ID, which
+// is what /direct and /thumb take. Progress goes to reporter, which may be nil.
+func UploadToMediaChannel(ctx context.Context, path, name, mimeType string, reporter *ProgressReporter) (int, error) {
+	if config.ValueOf.MediaChannelID == 0 {
+		return 0, errors.New("MEDIA_CHANNEL_ID not configured")
+	}
+	return UploadToChannel(ctx, config.ValueOf.MediaChannelID, path, name, mimeType, "", reporter)
+}
+
+// UploadToChannel uploads the file at path to channelID as a document named
+// name, with an optional caption, and returns the new message ID.
+func UploadToChannel(ctx context.Context, channelID int64, path, name, mimeType, caption string, reporter *ProgressReporter) (int, error) {
+	if Bot == nil {
+		return 0, errors.New("main bot not started")
+	}
+	channel, err := utils.GetChannelPeer(ctx, Bot.API(), Bot.PeerStorage, channelID)
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	up := uploader.NewUploader(Bot.API()).WithThreads(4)
+	if reporter != nil {
+		up = up.WithProgress(uploadProgress{reporter})
+	}
+	file, err := up.Upload(ctx, uploader.NewUpload(name, f, info.Size()))
+	if err != nil {
+		return 0, err
+	}
+
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	updates, err := Bot.API().MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+		Peer: &tg.InputPeerChannel{ChannelID: channel.ChannelID, AccessHash: channel.AccessHash},
+		Media: &tg.InputMediaUploadedDocument{
+			File:       file,
+			MimeType:   mimeType,
+			Attributes: []tg.DocumentAttributeClass{&tg.DocumentAttributeFilename{FileName: name}},
+		},
+		Message:  caption,
+		RandomID: rand.Int63(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	messageID := sentMessageID(updates)
+	if messageID == 0 {
+		return 0, errors.New("telegram did not return the new message ID")
+	}
+	return messageID, nil
+}
@@ -0,0 +1,80 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const peerWarmUpTimeout = 15 * time.Second
+
+// WarmUpPeers resolves the LOG_CHANNEL and media channel peers on every worker
+// right after startup so they land in each worker's PeerStorage before the
+// first user request, instead of paying the resolution latency lazily.
+// Workers that aren't members of a channel are reported, see
+// reportLockedWorkers.
+func WarmUpPeers(l *zap.Logger) {
+	log := l.Named("PeerWarmUp")
+
+	channels := config.ValueOf.SourceChannels()
+
+	workers := Snapshot()
+
+	if len(workers) == 0 {
+		log.Warn("No workers to warm up")
+		return
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	var failedMu sync.Mutex
+	failed := 0
+	locked := make(map[int64][]*Worker)
+
+	for _, worker := range workers {
+		wg.Add(1)
+		go func(w *Worker) {
+			defer wg.Done()
+			for _, channelID := range channels {
+				ctx, cancel := context.WithTimeout(context.Background(), peerWarmUpTimeout)
+				_, err := utils.GetChannelPeer(ctx, w.Client.API(), w.Client.PeerStorage, channelID)
+				cancel()
+				if w.RecordChannelAccess(channelID, err) {
+					failedMu.Lock()
+					locked[channelID] = append(locked[channelID], w)
+					failedMu.Unlock()
+				}
+				if err != nil {
+					log.Warn("Failed to resolve channel peer",
+						zap.Int("workerID", w.ID),
+						zap.String("workerUsername", w.Self.Username),
+						zap.Int64("channelID", channelID),
+						zap.Error(err))
+					failedMu.Lock()
+					failed++
+					failedMu.Unlock()
+					continue
+				}
+				log.Debug("Channel peer resolved",
+					zap.Int("workerID", w.ID),
+					zap.Int64("channelID", channelID))
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	log.Info("Peer storage warmed up",
+		zap.Int("workers", len(workers)),
+		zap.Int("channels", len(channels)),
+		zap.Int("failed", failed),
+		zap.Duration("took", time.Since(start)))
+	for _, channelID := range channels {
+		if len(locked[channelID]) > 0 {
+			reportLockedWorkers(log, channelID, locked[channelID])
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package bot
+
+import (
+	"EverythingSuckz/fsb/config"
+)
+
+// Class returns the worker's WORKER_LABELS class, "" when unlabelled.
+func (w *Worker) Class() string {
+	if w.Self == nil {
+		return ""
+	}
+	return config.ValueOf.WorkerClass(w.Self.ID, w.Self.Username)
+}
+
+// streamingWorkers leaves the light workers out of workers, so their
+// requests don't take streaming capacity, unless no other worker is left.
+func streamingWorkers(workers []*Worker) []*Worker {
+	if !config.ValueOf.WorkerClassesEnabled() {
+		return workers
+	}
+	streaming := make([]*Worker, 0, len(workers))
+	for _, worker := range workers {
+		if worker.Class() != config.WorkerClassLight {
+			streaming = append(streaming, worker)
+		}
+	}
+	if len(streaming) == 0 {
+		return workers
+	}
+	return streaming
+}
+
+// GetNextLightWorker selects a worker for thumbnails and metadata lookups:
+// the least loaded light worker, then unlabelled ones. Stream workers are
+// only used when nothing else is serving.
+func GetNextLightWorker() *Worker {
+	if !config.ValueOf.WorkerClassesEnabled() {
+		return GetNextWorker()
+	}
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+
+	serving := servingWorkers()
+	if len(serving) == 0 {
+		Workers.log.Error("No workers available")
+		return nil
+	}
+	var light, unlabelled []*Worker
+	for _, worker := range serving {
+		switch worker.Class() {
+		case config.WorkerClassLight:
+			light = append(light, worker)
+		case "":
+			unlabelled = append(unlabelled, worker)
+		}
+	}
+	for _, candidates := range [][]*Worker{light, unlabelled, serving} {
+		if len(candidates) > 0 {
+			return leastLoadedWorker(candidates)
+		}
+	}
+	return nil
+}
@@ -2,8 +2,12 @@ package bot
 
 import (
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/budget"
+	"EverythingSuckz/fsb/internal/flags"
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"sync"
@@ -36,6 +40,40 @@ type Worker struct {
 	metricsMutex sync.RWMutex
 	last5Times   []int64 // Circular buffer for last 5 response times
 	last5Mutex   sync.Mutex
+	budget       *budget.Bucket
+	pingNanos    int64 // last round trip to the DC, see StartPingMonitor
+	draining     int32 // set by DrainWorker, no new requests are routed here
+	unhealthy    int32 // set after WORKER_UNHEALTHY_AFTER failed pings, see recordPing
+	failedPings  int32
+	access       sync.Map // channel ID to ChannelAccess, see RecordChannelAccess
+	token        string   // empty for the main bot, which is never restarted
+}
+
+// BudgetWaits returns how many Telegram calls of each priority had to wait
+// for the worker's request budget.
+func (w *Worker) BudgetWaits() map[string]int64 {
+	if w.budget == nil {
+		return nil
+	}
+	return w.budget.Waited()
+}
+
+// BudgetQueued returns how many Telegram calls of the worker are waiting for
+// its request budget right now.
+func (w *Worker) BudgetQueued() int64 {
+	if w.budget == nil {
+		return 0
+	}
+	return w.budget.Queued()
+}
+
+// FloodWaitRemaining returns how long Telegram still makes the worker wait
+// after a FLOOD_WAIT, 0 when it may be called.
+func (w *Worker) FloodWaitRemaining() time.Duration {
+	if w.budget == nil {
+		return 0
+	}
+	return max(time.Until(w.budget.FloodWaitUntil()), 0)
 }
 
 func (w *Worker) String() string {
@@ -150,6 +188,7 @@ func (w *BotWorkers) AddDefaultClient(client *gotgproto.Client, self *tg.User) {
 		ID:     w.starting,
 		Self:   self,
 		log:    w.log,
+		budget: mainBudget,
 	}
 	worker.metrics.StartTime = time.Now()
 	w.Bots = append(w.Bots, worker)
@@ -163,24 +202,48 @@ func (w *BotWorkers) incStarting() {
 }
 
 func (w *BotWorkers) Add(token string) (err error) {
+	_, err = w.add(token)
+	return err
+}
+
+func (w *BotWorkers) add(token string) (*Worker, error) {
+	worker, err := w.start(token)
+	if err != nil {
+		return nil, err
+	}
+	w.register(worker)
+	return worker, nil
+}
+
+// start logs the bot of token in as a new worker without routing requests
+// to it yet.
+func (w *BotWorkers) start(token string) (*Worker, error) {
 	w.incStarting()
 	var botID int = w.starting
-	client, err := startWorker(w.log, token, botID)
+	bucket := newWorkerBudget()
+	client, err := startWorker(w.log, token, botID, bucket)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// Extract bot ID from token for logging (first part before :)
-	tokenPrefix := token[:10] + "..."
-	w.log.Sugar().Infof("Worker #%d loaded: @%s (token: %s)", botID, client.Self.Username, tokenPrefix)
+	w.log.Sugar().Infof("Worker #%d loaded: @%s (token: %s)", botID, client.Self.Username, maskToken(token))
 	worker := &Worker{
 		Client: client,
 		ID:     botID,
 		Self:   client.Self,
 		log:    w.log,
+		budget: bucket,
+		token:  token,
 	}
 	worker.metrics.StartTime = time.Now()
+	return worker, nil
+}
+
+// register adds a started worker to the pool.
+func (w *BotWorkers) register(worker *Worker) {
+	w.mut.Lock()
 	w.Bots = append(w.Bots, worker)
-	return nil
+	w.mut.Unlock()
 }
 
 // GetNextWorker selects the best available worker using intelligent load balancing
@@ -190,18 +253,52 @@ func GetNextWorker() *Worker {
 	Workers.mut.Lock()
 	defer Workers.mut.Unlock()
 
-	if len(Workers.Bots) == 0 {
+	candidates := streamingWorkers(servingWorkers())
+	if len(candidates) == 0 {
 		Workers.log.Error("No workers available")
 		return nil
 	}
+	strategy := strategyLeastLoaded
+	if len(candidates) > 2 && flags.Enabled(flags.BalancerTwoChoices) {
+		strategy = strategyTwoChoices
+	}
+	selectedWorker := balancerStrategies[strategy](candidates)
+	recordShadowPick(strategy, selectedWorker, candidates)
+	return selectedWorker
+}
+
+// servingWorkers returns the workers that take new requests, leaving out the
+// draining and unhealthy ones, and the ones Telegram flood-waits unless all
+// of them are. Workers.mut must be held.
+func servingWorkers() []*Worker {
+	serving := make([]*Worker, 0, len(Workers.Bots))
+	for _, worker := range Workers.Bots {
+		if !worker.Draining() && worker.Healthy() {
+			serving = append(serving, worker)
+		}
+	}
+	available := make([]*Worker, 0, len(serving))
+	for _, worker := range serving {
+		if worker.FloodWaitRemaining() == 0 {
+			available = append(available, worker)
+		}
+	}
+	if len(available) == 0 {
+		// Waiting out the flood beats refusing the request
+		return serving
+	}
+	return available
+}
 
+// leastLoadedWorker scans workers for the lowest score.
+func leastLoadedWorker(workers []*Worker) *Worker {
 	// Calculate score for each worker (lower is better)
 	// Score = (activeRequests * 1000) + (totalRequests / 10)
 	// This gives priority to immediate availability while considering long-term usage
 	var selectedWorker *Worker
 	minScore := float64(999999999)
 
-	for _, worker := range Workers.Bots {
+	for _, worker := range workers {
 		activeReqs := float64(worker.GetActiveRequests())
 		totalReqs := float64(atomic.LoadInt64(&worker.metrics.TotalRequests))
 
@@ -225,6 +322,56 @@ func GetNextWorker() *Worker {
 	return selectedWorker
 }
 
+// GetNextBulkWorker selects a worker for a bulk download. Workers already
+// busy with BULK_MAX_ACTIVE_PER_WORKER requests are skipped and nil is
+// returned when all of them are, so bulk downloads are turned away before
+// playback suffers.
+func GetNextBulkWorker() *Worker {
+	limit := config.ValueOf.BulkMaxActivePerWorker
+	if limit <= 0 {
+		return GetNextWorker()
+	}
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+
+	var selectedWorker *Worker
+	minScore := float64(999999999)
+	for _, worker := range streamingWorkers(servingWorkers()) {
+		activeReqs := worker.GetActiveRequests()
+		if int(activeReqs) >= limit {
+			continue
+		}
+		score := float64(activeReqs)*10000 + float64(atomic.LoadInt64(&worker.metrics.TotalRequests))
+		if score < minScore {
+			minScore = score
+			selectedWorker = worker
+		}
+	}
+	return selectedWorker
+}
+
+// pickOfTwoWorkers compares two random workers and keeps the less loaded one,
+// which spreads bursts without every request piling onto the same minimum.
+func pickOfTwoWorkers(workers []*Worker) *Worker {
+	if len(workers) < 2 {
+		return workers[0]
+	}
+	i := rand.Intn(len(workers))
+	j := rand.Intn(len(workers) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := workers[i], workers[j]
+	score := func(w *Worker) float64 {
+		return float64(w.GetActiveRequests())*10000 + float64(atomic.LoadInt64(&w.metrics.TotalRequests))
+	}
+	if score(b) < score(a) {
+		a = b
+	}
+	Workers.log.Sugar().Debugf("Selected worker %d out of two (active: %d)", a.ID, a.GetActiveRequests())
+	return a
+}
+
 // GetNextWorkerExcluding selects the least loaded worker excluding the specified worker IDs
 // This is useful for retry logic when a worker fails or times out
 // Uses the same scoring algorithm as GetNextWorker
@@ -240,7 +387,7 @@ func GetNextWorkerExcluding(excludeIDs []int) *Worker {
 	var selectedWorker *Worker
 	minScore := float64(999999999)
 
-	for _, worker := range Workers.Bots {
+	for _, worker := range streamingWorkers(servingWorkers()) {
 		// Skip excluded workers
 		excluded := false
 		for _, excludeID := range excludeIDs {
@@ -274,6 +421,14 @@ func GetNextWorkerExcluding(excludeIDs []int) *Worker {
 	return selectedWorker
 }
 
+// Snapshot returns a copy of the worker list, safe to range over while
+// workers are drained, added or restarted.
+func Snapshot() []*Worker {
+	Workers.mut.Lock()
+	defer Workers.mut.Unlock()
+	return append([]*Worker{}, Workers.Bots...)
+}
+
 // GetDefaultWorker returns the default/main bot (first bot in the list)
 // This should be used for operations that require channel access
 func GetDefaultWorker() *Worker {
@@ -288,6 +443,17 @@ func GetDefaultWorker() *Worker {
 
 func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 	Workers.Init(log)
+	config.OnReload(reloadWorkers)
+	if percent := config.ValueOf.BalancerShadowPercent; percent > 0 {
+		if _, ok := balancerStrategies[config.ValueOf.BalancerShadowStrategy]; ok {
+			Workers.log.Info("Balancer shadow mode enabled",
+				zap.String("strategy", config.ValueOf.BalancerShadowStrategy),
+				zap.Int("percent", percent))
+		} else {
+			Workers.log.Warn("Unknown BALANCER_SHADOW_STRATEGY, shadow mode disabled",
+				zap.String("strategy", config.ValueOf.BalancerShadowStrategy))
+		}
+	}
 
 	if len(config.ValueOf.MultiTokens) == 0 {
 		Workers.log.Sugar().Info("No worker bot tokens provided, skipping worker initialization")
@@ -296,7 +462,7 @@ func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 	Workers.log.Sugar().Info("Starting")
 	if config.ValueOf.UseSessionFile {
 		Workers.log.Sugar().Info("Using session file for workers")
-		newpath := filepath.Join(".", "sessions")
+		newpath := filepath.Join(".", workerSessionDir)
 		if err := os.MkdirAll(newpath, os.ModePerm); err != nil {
 			Workers.log.Error("Failed to create sessions directory", zap.Error(err))
 			return nil, err
@@ -351,11 +517,8 @@ func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 		return results
 	}
 
-	// Initial attempt: all workers
-	allIndices := make([]int, totalBots)
-	for i := range allIndices {
-		allIndices[i] = i
-	}
+	// Initial attempt: all workers whose token passed validation
+	allIndices := validateWorkerTokens(config.ValueOf.MultiTokens)
 
 	var successfulStarts int32
 	failedIndices := allIndices
@@ -397,12 +560,63 @@ func StartWorkers(log *zap.Logger) (*BotWorkers, error) {
 	return Workers, nil
 }
 
-func startWorker(l *zap.Logger, botToken string, index int) (*gotgproto.Client, error) {
+// validateWorkerTokens checks every token against the Bot API before any
+// MTProto client is started and returns the indices worth connecting. Tokens
+// that are malformed or revoked are reported right away with their index
+// instead of timing out later; tokens that couldn't be checked are kept.
+func validateWorkerTokens(tokens []string) []int {
+	const maxConcurrent = 10
+
+	valid := make([]bool, len(tokens))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrent)
+	for i, token := range tokens {
+		wg.Add(1)
+		go func(i int, token string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), botAPIValidateTimeout)
+			defer cancel()
+			username, err := ValidateBotToken(ctx, token)
+			switch {
+			case err == nil:
+				Workers.log.Debug("Worker token validated",
+					zap.Int("index", i),
+					zap.String("username", username))
+				valid[i] = true
+			case errors.Is(err, ErrInvalidBotToken):
+				Workers.log.Error("Skipping worker with invalid token",
+					zap.Int("index", i),
+					zap.String("token", maskToken(token)),
+					zap.Error(err))
+			default:
+				Workers.log.Warn("Could not validate worker token, trying to connect anyway",
+					zap.Int("index", i),
+					zap.String("token", maskToken(token)),
+					zap.Error(err))
+				valid[i] = true
+			}
+		}(i, token)
+	}
+	wg.Wait()
+
+	indices := make([]int, 0, len(tokens))
+	for i, ok := range valid {
+		if ok {
+			indices = append(indices, i)
+		}
+	}
+	return indices
+}
+
+func startWorker(l *zap.Logger, botToken string, index int, bucket *budget.Bucket) (*gotgproto.Client, error) {
 	log := l.Named("Worker").Sugar()
 	log.Infof("Starting worker with index - %d", index)
 	var sessionType sessionMaker.SessionConstructor
 	if config.ValueOf.UseSessionFile {
-		sessionType = sessionMaker.SqlSession(sqlite.Open(fmt.Sprintf("sessions/worker-%d.session", index)))
+		sessionType = sessionMaker.SqlSession(sqlite.Open(WorkerSessionPath(index)))
 	} else {
 		sessionType = sessionMaker.SimpleSession()
 	}
@@ -413,7 +627,7 @@ func startWorker(l *zap.Logger, botToken string, index int) (*gotgproto.Client,
 		&gotgproto.ClientOpts{
 			Session:          sessionType,
 			DisableCopyright: true,
-			Middlewares:      GetFloodMiddleware(log.Desugar()),
+			Middlewares:      GetFloodMiddleware(log.Desugar(), bucket),
 		},
 	)
 	if err != nil {
@@ -0,0 +1,162 @@
+// Package budget shares each worker's Telegram API request rate between
+// live streams, thumbnails and background jobs. Every call draws from the
+// worker's token bucket, and lower priorities leave a reserve untouched so
+// background work can't starve viewers.
+package budget
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// Priority orders the consumers of a worker's budget.
+type Priority int
+
+const (
+	Stream   Priority = iota // chunks and metadata for live viewers
+	Thumb                    // thumbnails
+	Backfill                 // transcodes, post-processing and other background work
+)
+
+// reserve is the share of the bucket each priority must leave for the ones
+// above it.
+var reserve = [...]float64{
+	Stream:   0,
+	Thumb:    0.25,
+	Backfill: 0.5,
+}
+
+func (p Priority) String() string {
+	switch p {
+	case Thumb:
+		return "thumb"
+	case Backfill:
+		return "backfill"
+	}
+	return "stream"
+}
+
+type priorityKey struct{}
+
+// WithPriority tags the Telegram calls made with ctx.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority ctx was tagged with, Stream by default.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return Stream
+}
+
+// Bucket is a token bucket refilled at rate tokens per second up to burst.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	waited [len(reserve)]int64
+	queued int64 // calls waiting for a token right now
+	// floodUntil is when the last FLOOD_WAIT Telegram sent ends, in unix
+	// nanoseconds
+	floodUntil int64
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(rate float64, burst int) *Bucket {
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Wait blocks until a token is available to priority p, or ctx is done.
+func (b *Bucket) Wait(ctx context.Context, p Priority) error {
+	// A bucket too small for the reserve treats every priority alike
+	floor := math.Min(reserve[p]*b.burst, b.burst-1)
+	counted := false
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+		if b.tokens-1 >= floor {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((floor + 1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if !counted {
+			atomic.AddInt64(&b.waited[p], 1)
+			atomic.AddInt64(&b.queued, 1)
+			defer atomic.AddInt64(&b.queued, -1)
+			counted = true
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Waited returns how many calls of each priority had to wait for a token.
+func (b *Bucket) Waited() map[string]int64 {
+	out := make(map[string]int64, len(reserve))
+	for p := range reserve {
+		out[Priority(p).String()] = atomic.LoadInt64(&b.waited[p])
+	}
+	return out
+}
+
+// Queued returns how many calls are waiting for a token right now.
+func (b *Bucket) Queued() int64 {
+	return atomic.LoadInt64(&b.queued)
+}
+
+// FloodWaitUntil returns when the last FLOOD_WAIT of the client ends; it is
+// in the past once the client may call Telegram again.
+func (b *Bucket) FloodWaitUntil() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&b.floodUntil))
+}
+
+// noteFloodWait moves the end of the flood wait to d from now, unless an
+// earlier error already set it later.
+func (b *Bucket) noteFloodWait(d time.Duration) {
+	until := time.Now().Add(d).UnixNano()
+	for {
+		current := atomic.LoadInt64(&b.floodUntil)
+		if current >= until || atomic.CompareAndSwapInt64(&b.floodUntil, current, until) {
+			return
+		}
+	}
+}
+
+// Middleware makes every call of a client draw from b at the priority of
+// its context, and records the flood waits Telegram answers with.
+func Middleware(b *Bucket) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			if err := b.Wait(ctx, PriorityFrom(ctx)); err != nil {
+				return err
+			}
+			err := next.Invoke(ctx, input, output)
+			if d, ok := tgerr.AsFloodWait(err); ok {
+				b.noteFloodWait(d)
+			}
+			return err
+		}
+	})
+}
@@ -1,9 +1,12 @@
 package cache
 
 import (
+	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/types"
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"strings"
 	"sync"
 
 	"github.com/coocood/freecache"
@@ -11,61 +14,107 @@ import (
 	"go.uber.org/zap"
 )
 
-var cache *Cache
+var cache Cache
 
-type Cache struct {
-	cache *freecache.Cache
-	mu    sync.RWMutex
-	log   *zap.Logger
+// Cache keeps file metadata between requests.
+type Cache interface {
+	Get(key string, value *types.File) error
+	Set(key string, value *types.File, expireSeconds int) error
+	Delete(key string) error
+	// Stats returns the lookups that found an entry and the ones that didn't.
+	Stats() (hits, misses int64)
 }
 
-func InitCache(log *zap.Logger) {
+// InitCache builds the cache selected by CACHE_BACKEND. The memory cache is
+// lost on restart; the Redis one is shared by every instance using REDIS_URL.
+func InitCache(log *zap.Logger) error {
 	log = log.Named("cache")
 	// Register all types that will be cached via gob encoding
 	gob.Register(types.File{})
 	gob.Register(tg.InputDocumentFileLocation{})
 	gob.Register(tg.InputPhotoFileLocation{})
-	defer log.Sugar().Info("Initialized")
-	// Increased cache size from 10MB to 100MB to handle more file metadata
-	// This is especially important when using multiple workers
-	cache = &Cache{cache: freecache.NewCache(100 * 1024 * 1024), log: log}
+	switch strings.ToLower(strings.TrimSpace(config.ValueOf.CacheBackend)) {
+	case "", "memory":
+		// Increased cache size from 10MB to 100MB to handle more file metadata
+		// This is especially important when using multiple workers
+		memory := &memoryCache{cache: freecache.NewCache(100 * 1024 * 1024)}
+		if config.ValueOf.CacheSnapshotFile != "" {
+			memory.lastRead = make(map[string]int64)
+			memory.loadSnapshot(log, config.ValueOf.CacheSnapshotFile)
+		}
+		cache = memory
+		log.Info("Initialized in-memory cache")
+	case "redis":
+		redis, err := NewRedis(config.ValueOf.RedisURL)
+		if err != nil {
+			return err
+		}
+		cache = redis
+		log.Info("Initialized Redis cache", zap.String("addr", redis.addr))
+	default:
+		return fmt.Errorf("unknown CACHE_BACKEND %q, expected 'memory' or 'redis'", config.ValueOf.CacheBackend)
+	}
+	return nil
 }
 
-func GetCache() *Cache {
+func GetCache() Cache {
 	return cache
 }
 
-func (c *Cache) Get(key string, value *types.File) error {
+func encode(value *types.File) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, value *types.File) error {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	return dec.Decode(&value)
+}
+
+// memoryCache is the in-process freecache.
+type memoryCache struct {
+	cache *freecache.Cache
+	mu    sync.RWMutex
+	// lastRead is when each key was last read, so a snapshot keeps the hot
+	// entries. Nil unless CACHE_SNAPSHOT_FILE is set.
+	lastRead   map[string]int64
+	lastReadMu sync.Mutex
+}
+
+func (c *memoryCache) Get(key string, value *types.File) error {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	data, err := c.cache.Get([]byte(key))
 	if err != nil {
 		return err
 	}
-	dec := gob.NewDecoder(bytes.NewReader(data))
-	err = dec.Decode(&value)
-	if err != nil {
-		return err
-	}
-	return nil
+	c.noteRead(key)
+	return decode(data, value)
 }
 
-func (c *Cache) Set(key string, value *types.File, expireSeconds int) error {
+func (c *memoryCache) Set(key string, value *types.File, expireSeconds int) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(value)
+	data, err := encode(value)
 	if err != nil {
 		return err
 	}
-	c.cache.Set([]byte(key), buf.Bytes(), expireSeconds)
+	c.cache.Set([]byte(key), data, expireSeconds)
 	return nil
 }
 
-func (c *Cache) Delete(key string) error {
+func (c *memoryCache) Stats() (hits, misses int64) {
+	return c.cache.HitCount(), c.cache.MissCount()
+}
+
+func (c *memoryCache) Delete(key string) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.cache.Del([]byte(key))
+	c.forgetRead(key)
 	return nil
 }
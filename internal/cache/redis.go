@@ -0,0 +1,225 @@
+package cache
+
+import (
+	"EverythingSuckz/fsb/internal/types"
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	redisKeyPrefix = "fsb:"
+	redisPoolSize  = 8
+	redisTimeout   = 5 * time.Second
+)
+
+// ErrNotFound is returned by the Redis cache for keys it doesn't hold.
+var ErrNotFound = errors.New("key not found in cache")
+
+// Redis keeps the cache in a Redis server so it survives restarts and is
+// shared between instances. It speaks just enough of RESP for GET, SET and
+// DEL, which avoids pulling in a client library.
+type Redis struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      *tls.Config
+	pool     chan *redisConn
+	hits     int64
+	misses   int64
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply from the server. The connection stays usable.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// NewRedis parses a redis:// or rediss:// (TLS) URL such as
+// redis://:password@host:6379/0 and checks the server answers.
+func NewRedis(rawURL string) (*Redis, error) {
+	if rawURL == "" {
+		return nil, errors.New("REDIS_URL is required when CACHE_BACKEND=redis")
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return nil, errors.New("invalid REDIS_URL, expected redis://[user:password@]host[:port][/db]")
+	}
+	r := &Redis{addr: u.Host, pool: make(chan *redisConn, redisPoolSize)}
+	if u.Port() == "" {
+		r.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		r.username = u.User.Username()
+		r.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid Redis database %q", db)
+		}
+	}
+	if u.Scheme == "rediss" {
+		r.tls = &tls.Config{ServerName: u.Hostname()}
+	}
+	if _, err := r.do("PING"); err != nil {
+		return nil, fmt.Errorf("failed to reach Redis at %s: %w", r.addr, err)
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(key string, value *types.File) error {
+	reply, err := r.do("GET", redisKeyPrefix+key)
+	if err != nil {
+		return err
+	}
+	data, ok := reply.([]byte)
+	if !ok {
+		atomic.AddInt64(&r.misses, 1)
+		return ErrNotFound
+	}
+	atomic.AddInt64(&r.hits, 1)
+	return decode(data, value)
+}
+
+func (r *Redis) Set(key string, value *types.File, expireSeconds int) error {
+	data, err := encode(value)
+	if err != nil {
+		return err
+	}
+	args := []string{"SET", redisKeyPrefix + key, string(data)}
+	if expireSeconds > 0 {
+		args = append(args, "EX", strconv.Itoa(expireSeconds))
+	}
+	_, err = r.do(args...)
+	return err
+}
+
+func (r *Redis) Delete(key string) error {
+	_, err := r.do("DEL", redisKeyPrefix+key)
+	return err
+}
+
+func (r *Redis) Stats() (hits, misses int64) {
+	return atomic.LoadInt64(&r.hits), atomic.LoadInt64(&r.misses)
+}
+
+// do runs one command on a pooled connection. Connections that fail are
+// dropped instead of going back to the pool.
+func (r *Redis) do(args ...string) (any, error) {
+	var conn *redisConn
+	select {
+	case conn = <-r.pool:
+	default:
+		var err error
+		if conn, err = r.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := conn.command(args...)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+	select {
+	case r.pool <- conn:
+	default:
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (r *Redis) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var c net.Conn
+	var err error
+	if r.tls != nil {
+		c, err = tls.DialWithDialer(dialer, "tcp", r.addr, r.tls)
+	} else {
+		c, err = dialer.Dial("tcp", r.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, r: bufio.NewReader(c)}
+	if r.password != "" {
+		auth := []string{"AUTH", r.password}
+		if r.username != "" {
+			auth = []string{"AUTH", r.username, r.password}
+		}
+		if _, err := conn.command(auth...); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.db != 0 {
+		if _, err := conn.command("SELECT", strconv.Itoa(r.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+func (c *redisConn) command(args ...string) (any, error) {
+	if err := c.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads a simple string, error, integer or bulk string reply. A
+// nil bulk string is returned as nil.
+func (c *redisConn) readReply() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"EverythingSuckz/fsb/config"
+	"cmp"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxTrackedReads bounds lastRead. Past it the read times start over, which
+// only makes the next snapshot a little less picky.
+const maxTrackedReads = 200000
+
+// snapshotVersion is bumped when the file layout changes; other versions are
+// ignored rather than misread.
+const snapshotVersion = 1
+
+type snapshotFile struct {
+	Version int
+	Entries []snapshotEntry
+}
+
+type snapshotEntry struct {
+	Key      string
+	Value    []byte // gob encoded types.File, as the cache holds it
+	ExpireAt uint32 // unix seconds, 0 for no expiry
+}
+
+func (c *memoryCache) noteRead(key string) {
+	if c.lastRead == nil {
+		return
+	}
+	c.lastReadMu.Lock()
+	if len(c.lastRead) >= maxTrackedReads {
+		clear(c.lastRead)
+	}
+	c.lastRead[key] = time.Now().Unix()
+	c.lastReadMu.Unlock()
+}
+
+func (c *memoryCache) forgetRead(key string) {
+	if c.lastRead == nil {
+		return
+	}
+	c.lastReadMu.Lock()
+	delete(c.lastRead, key)
+	c.lastReadMu.Unlock()
+}
+
+// SaveSnapshot writes the most recently read entries of the memory cache to
+// CACHE_SNAPSHOT_FILE, up to CACHE_SNAPSHOT_MB, so the next start doesn't
+// fetch all their metadata from Telegram again. It does nothing for the
+// Redis cache, which outlives restarts anyway.
+func SaveSnapshot(log *zap.Logger) error {
+	c, ok := cache.(*memoryCache)
+	path := config.ValueOf.CacheSnapshotFile
+	if !ok || path == "" {
+		return nil
+	}
+	now := uint32(time.Now().Unix())
+	var entries []snapshotEntry
+	c.mu.RLock()
+	it := c.cache.NewIterator()
+	for entry := it.Next(); entry != nil; entry = it.Next() {
+		if entry.ExpireAt != 0 && entry.ExpireAt <= now {
+			continue
+		}
+		entries = append(entries, snapshotEntry{Key: string(entry.Key), Value: entry.Value, ExpireAt: entry.ExpireAt})
+	}
+	c.mu.RUnlock()
+
+	c.lastReadMu.Lock()
+	slices.SortFunc(entries, func(a, b snapshotEntry) int {
+		return cmp.Or(cmp.Compare(c.lastRead[b.Key], c.lastRead[a.Key]), cmp.Compare(b.ExpireAt, a.ExpireAt))
+	})
+	c.lastReadMu.Unlock()
+	budget := config.ValueOf.CacheSnapshotMB * 1024 * 1024
+	kept := 0
+	for _, entry := range entries {
+		if budget -= len(entry.Key) + len(entry.Value); budget < 0 {
+			break
+		}
+		kept++
+	}
+	entries = entries[:kept]
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".cache-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := gob.NewEncoder(tmp).Encode(snapshotFile{Version: snapshotVersion, Entries: entries}); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	log.Named("cache").Info("Saved cache snapshot", zap.String("file", path), zap.Int("entries", kept))
+	return nil
+}
+
+// loadSnapshot fills c from the file SaveSnapshot wrote, skipping entries
+// that expired meanwhile. The file is removed afterwards so a crash doesn't
+// bring back stale entries on the start after next.
+func (c *memoryCache) loadSnapshot(log *zap.Logger, path string) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Warn("Failed to open cache snapshot", zap.Error(err))
+		return
+	}
+	var snapshot snapshotFile
+	err = gob.NewDecoder(f).Decode(&snapshot)
+	f.Close()
+	os.Remove(path)
+	if err == nil && snapshot.Version != snapshotVersion {
+		err = fmt.Errorf("unknown version %d", snapshot.Version)
+	}
+	if err != nil {
+		log.Warn("Ignoring cache snapshot", zap.String("file", path), zap.Error(err))
+		return
+	}
+	now := time.Now().Unix()
+	loaded := 0
+	for _, entry := range snapshot.Entries {
+		ttl := 0
+		if entry.ExpireAt != 0 {
+			if ttl = int(int64(entry.ExpireAt) - now); ttl <= 0 {
+				continue
+			}
+		}
+		if c.cache.Set([]byte(entry.Key), entry.Value, ttl) == nil {
+			loaded++
+		}
+	}
+	log.Info("Loaded cache snapshot", zap.String("file", path), zap.Int("entries", loaded), zap.Int("skipped", len(snapshot.Entries)-loaded))
+}
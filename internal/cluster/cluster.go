@@ -0,0 +1,159 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Load is what every replica reports on /api/load.
+type Load struct {
+	ActiveRequests int32 `json:"active_requests"`
+	BytesPerSecond int64 `json:"bytes_per_second"`
+}
+
+// Replica is a backend a front instance can redirect clients to.
+type Replica struct {
+	PublicURL string    `json:"public_url"`
+	LoadURL   string    `json:"load_url"`
+	Healthy   bool      `json:"healthy"`
+	Load      Load      `json:"load"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ParseReplicas reads REDIRECT_REPLICAS entries of the form
+// "public_url" or "public_url|status_url". The load is fetched from
+// status_url/api/load, defaulting to the public URL.
+func ParseReplicas(entries []string) ([]*Replica, error) {
+	replicas := make([]*Replica, 0, len(entries))
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		publicURL, statusURL, _ := strings.Cut(entry, "|")
+		publicURL = strings.TrimRight(strings.TrimSpace(publicURL), "/")
+		statusURL = strings.TrimRight(strings.TrimSpace(statusURL), "/")
+		if !strings.HasPrefix(publicURL, "http://") && !strings.HasPrefix(publicURL, "https://") {
+			return nil, fmt.Errorf("invalid replica URL %q", publicURL)
+		}
+		if statusURL == "" {
+			statusURL = publicURL
+		}
+		replicas = append(replicas, &Replica{PublicURL: publicURL, LoadURL: statusURL + "/api/load"})
+	}
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no replicas configured")
+	}
+	return replicas, nil
+}
+
+// Balancer tracks the load of every replica by polling them.
+type Balancer struct {
+	log      *zap.Logger
+	client   *http.Client
+	mu       sync.RWMutex
+	replicas []*Replica
+}
+
+func NewBalancer(log *zap.Logger, replicas []*Replica) *Balancer {
+	return &Balancer{
+		log:      log.Named("Cluster"),
+		client:   &http.Client{Timeout: 2 * time.Second},
+		replicas: replicas,
+	}
+}
+
+// Start polls every replica once per interval in the background.
+func (b *Balancer) Start(interval time.Duration) {
+	b.poll()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			b.poll()
+		}
+	}()
+}
+
+func (b *Balancer) poll() {
+	var wg sync.WaitGroup
+	for _, replica := range b.replicas {
+		wg.Add(1)
+		go func(replica *Replica) {
+			defer wg.Done()
+			load, err := b.fetchLoad(replica.LoadURL)
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if replica.Healthy && err != nil {
+				b.log.Warn("Replica unreachable", zap.String("replica", replica.PublicURL), zap.Error(err))
+			} else if !replica.Healthy && err == nil {
+				b.log.Info("Replica healthy", zap.String("replica", replica.PublicURL))
+			}
+			replica.Healthy = err == nil
+			replica.CheckedAt = time.Now()
+			if err == nil {
+				replica.Load = load
+			}
+		}(replica)
+	}
+	wg.Wait()
+}
+
+func (b *Balancer) fetchLoad(url string) (Load, error) {
+	var load Load
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return load, err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return load, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return load, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&load)
+	return load, err
+}
+
+// Pick returns the healthy replica serving the least bandwidth, breaking ties
+// on active requests. It returns nil when no replica is healthy.
+func (b *Balancer) Pick() *Replica {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var best *Replica
+	for _, replica := range b.replicas {
+		if !replica.Healthy {
+			continue
+		}
+		if best == nil ||
+			replica.Load.BytesPerSecond < best.Load.BytesPerSecond ||
+			(replica.Load.BytesPerSecond == best.Load.BytesPerSecond && replica.Load.ActiveRequests < best.Load.ActiveRequests) {
+			best = replica
+		}
+	}
+	if best != nil {
+		// Count the redirect until the next poll so bursts spread out
+		best.Load.ActiveRequests++
+	}
+	return best
+}
+
+// Snapshot returns a copy of the replica states.
+func (b *Balancer) Snapshot() []Replica {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	out := make([]Replica, 0, len(b.replicas))
+	for _, replica := range b.replicas {
+		out = append(out, *replica)
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package commands
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"time"
+
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/i18n"
+	"EverythingSuckz/fsb/internal/invites"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/celestix/gotgproto/storage"
+	"go.uber.org/zap"
+)
+
+// LoadInvite lets ADMIN_USERS create invite codes and users redeem them.
+func (m *command) LoadInvite(dispatcher dispatcher.Dispatcher) {
+	log := m.log.Named("invite")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("invite", createInvite(log)))
+	dispatcher.AddHandler(handlers.NewCommand("redeem", redeemCommand(log)))
+}
+
+// createInvite handles /invite [uses] [days] [role].
+func createInvite(log *zap.Logger) func(ctx *ext.Context, u *ext.Update) error {
+	return func(ctx *ext.Context, u *ext.Update) error {
+		chatId := u.EffectiveChat().GetID()
+		peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+		if peerChatId.Type != int(storage.TypeUser) {
+			return dispatcher.EndGroups
+		}
+		lang := userLang(u)
+		if !slices.Contains(config.Live().AdminUsers, chatId) {
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.not_allowed")), nil)
+			return dispatcher.EndGroups
+		}
+		args := u.Args()[1:]
+		var uses, days int
+		var role string
+		var err error
+		if len(args) > 0 {
+			uses, err = strconv.Atoi(args[0])
+		}
+		if err == nil && len(args) > 1 {
+			days, err = strconv.Atoi(args[1])
+		}
+		if len(args) > 2 {
+			role = args[2]
+		}
+		if err != nil || uses < 0 || days < 0 || len(args) > 3 {
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "invite.usage")), nil)
+			return dispatcher.EndGroups
+		}
+		invite, err := invites.Create(role, uses, time.Duration(days)*24*time.Hour, strconv.FormatInt(chatId, 10))
+		if errors.Is(err, invites.ErrUnknownRole) {
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "invite.usage")), nil)
+			return dispatcher.EndGroups
+		}
+		if err != nil {
+			log.Error("Failed to create invite", zap.Error(err))
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
+			return dispatcher.EndGroups
+		}
+		log.Info("Invite created", zap.Int64("by", chatId), zap.Int("maxUses", uses), zap.Int("days", days), zap.String("role", role))
+		usesText := i18n.T(lang, "invite.unlimited")
+		if invite.MaxUses > 0 {
+			usesText = strconv.Itoa(invite.MaxUses)
+		}
+		expiresText := i18n.T(lang, "invite.never")
+		if invite.ExpiresAt != nil {
+			expiresText = invite.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		link := "https://t.me/" + ctx.Self.Username + "?start=" + invite.Code
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "invite.created", invite.Code, usesText, expiresText, link)), nil)
+		return dispatcher.EndGroups
+	}
+}
+
+// redeemCommand handles /redeem <code>.
+func redeemCommand(log *zap.Logger) func(ctx *ext.Context, u *ext.Update) error {
+	return func(ctx *ext.Context, u *ext.Update) error {
+		chatId := u.EffectiveChat().GetID()
+		peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+		if peerChatId.Type != int(storage.TypeUser) {
+			return dispatcher.EndGroups
+		}
+		args := u.Args()
+		if len(args) != 2 {
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(userLang(u), "redeem.usage")), nil)
+			return dispatcher.EndGroups
+		}
+		redeemInvite(ctx, u, log, args[1])
+		return dispatcher.EndGroups
+	}
+}
+
+// redeemInvite lets the user in with code and tells them how it went.
+func redeemInvite(ctx *ext.Context, u *ext.Update, log *zap.Logger, code string) {
+	chatId := u.EffectiveChat().GetID()
+	lang := userLang(u)
+	invite, err := invites.Redeem(code, chatId)
+	var key string
+	switch {
+	case errors.Is(err, invites.ErrNotFound):
+		key = "redeem.not_found"
+	case errors.Is(err, invites.ErrExpired):
+		key = "redeem.expired"
+	case errors.Is(err, invites.ErrUsedUp):
+		key = "redeem.used_up"
+	case errors.Is(err, invites.ErrRedeemed):
+		key = "redeem.already"
+	case err != nil:
+		log.Error("Failed to redeem invite", zap.Int64("userID", chatId), zap.Error(err))
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
+		return
+	case invite.Role != "":
+		key = "redeem.ok_premium"
+	default:
+		key = "redeem.ok"
+	}
+	if err == nil {
+		log.Info("Invite redeemed", zap.Int64("userID", chatId), zap.String("code", invite.Code))
+	}
+	ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, key)), nil)
+}
@@ -0,0 +1,126 @@
+package commands
+
+import (
+	"errors"
+	"strconv"
+
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/i18n"
+	"EverythingSuckz/fsb/internal/invites"
+	"EverythingSuckz/fsb/internal/premium"
+	"EverythingSuckz/fsb/internal/utils"
+
+	"github.com/celestix/gotgproto/dispatcher"
+	"github.com/celestix/gotgproto/dispatcher/handlers"
+	"github.com/celestix/gotgproto/ext"
+	"github.com/celestix/gotgproto/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	// starsCurrency is the currency code of Telegram Stars; their invoices
+	// take no payment provider
+	starsCurrency  = "XTR"
+	premiumPayload = "premium"
+)
+
+// LoadPremium sells the premium role for PREMIUM_STARS_PRICE Telegram Stars.
+func (m *command) LoadPremium(dispatcher dispatcher.Dispatcher) {
+	if config.ValueOf.PremiumStarsPrice <= 0 {
+		return
+	}
+	log := m.log.Named("premium")
+	defer log.Sugar().Info("Loaded")
+	dispatcher.AddHandler(handlers.NewCommand("premium", sendPremiumInvoice))
+	dispatcher.AddHandler(handlers.NewAnyUpdate(premiumPayments(log)))
+}
+
+func sendPremiumInvoice(ctx *ext.Context, u *ext.Update) error {
+	chatId := u.EffectiveChat().GetID()
+	peerChatId := ctx.PeerStorage.GetPeerById(chatId)
+	if peerChatId.Type != int(storage.TypeUser) {
+		return dispatcher.EndGroups
+	}
+	lang := userLang(u)
+	if !invites.Allowed(chatId) {
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.not_allowed")), nil)
+		return dispatcher.EndGroups
+	}
+	description := i18n.T(lang, "premium.description_forever")
+	if days := config.ValueOf.PremiumDays; days > 0 {
+		description = i18n.T(lang, "premium.description", days)
+	}
+	title := i18n.T(lang, "premium.title")
+	_, err := ctx.SendMedia(chatId, &tg.MessagesSendMediaRequest{
+		Media: &tg.InputMediaInvoice{
+			Title:       title,
+			Description: description,
+			Invoice: tg.Invoice{
+				Currency: starsCurrency,
+				Prices:   []tg.LabeledPrice{{Label: title, Amount: int64(config.ValueOf.PremiumStarsPrice)}},
+			},
+			Payload:      []byte(premiumPayload),
+			ProviderData: tg.DataJSON{Data: "{}"},
+		},
+	})
+	if err != nil {
+		utils.Logger.Sugar().Error(err)
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
+	}
+	return dispatcher.EndGroups
+}
+
+// premiumPayments confirms Stars checkouts and grants the role once Telegram
+// reports the payment.
+func premiumPayments(log *zap.Logger) func(ctx *ext.Context, u *ext.Update) error {
+	return func(ctx *ext.Context, u *ext.Update) error {
+		if query, ok := u.UpdateClass.(*tg.UpdateBotPrecheckoutQuery); ok {
+			valid := string(query.Payload) == premiumPayload && query.Currency == starsCurrency &&
+				query.TotalAmount == int64(config.ValueOf.PremiumStarsPrice)
+			reason := ""
+			if !valid {
+				reason = i18n.T(i18n.Lang(""), "premium.invalid")
+			}
+			if _, err := ctx.SetPreCheckoutResults(valid, query.QueryID, reason); err != nil {
+				log.Warn("Failed to answer pre-checkout query", zap.Error(err))
+			}
+			return dispatcher.EndGroups
+		}
+
+		msg := u.EffectiveMessage
+		if msg == nil || !msg.IsService {
+			return nil
+		}
+		payment, ok := msg.Action.(*tg.MessageActionPaymentSentMe)
+		if !ok || string(payment.Payload) != premiumPayload {
+			return nil
+		}
+		userID := u.EffectiveChat().GetID()
+		lang := userLang(u)
+		grant, err := premium.Add(strconv.FormatInt(userID, 10), premium.SourceTelegramStars, payment.Charge.ID)
+		if errors.Is(err, premium.ErrDuplicatePayment) {
+			log.Info("Ignoring a Telegram Stars payment already applied", zap.String("chargeID", payment.Charge.ID))
+			return dispatcher.EndGroups
+		}
+		if err != nil {
+			// The charge ID is logged so the payment can be refunded or granted by hand
+			log.Error("Failed to grant premium after payment",
+				zap.Int64("userID", userID),
+				zap.String("chargeID", payment.Charge.ID),
+				zap.Error(err))
+			ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
+			return dispatcher.EndGroups
+		}
+		log.Info("Premium bought with Telegram Stars",
+			zap.Int64("userID", userID),
+			zap.Int64("stars", payment.TotalAmount),
+			zap.String("chargeID", payment.Charge.ID))
+		text := i18n.T(lang, "premium.thanks_forever")
+		if grant.ExpiresAt != nil {
+			text = i18n.T(lang, "premium.thanks", grant.ExpiresAt.Format("2006-01-02"))
+		}
+		ctx.Reply(u, ext.ReplyTextString(text), nil)
+		return dispatcher.EndGroups
+	}
+}
@@ -1,7 +1,8 @@
 package commands
 
 import (
-	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/i18n"
+	"EverythingSuckz/fsb/internal/invites"
 	"EverythingSuckz/fsb/internal/utils"
 
 	"github.com/celestix/gotgproto/dispatcher"
@@ -22,10 +23,24 @@ func start(ctx *ext.Context, u *ext.Update) error {
 	if peerChatId.Type != int(storage.TypeUser) {
 		return dispatcher.EndGroups
 	}
-	if len(config.ValueOf.AllowedUsers) != 0 && !utils.Contains(config.ValueOf.AllowedUsers, chatId) {
-		ctx.Reply(u, ext.ReplyTextString("You are not allowed to use this bot."), nil)
+	// t.me/<bot>?start=<code> links carry an invite code
+	if args := u.Args(); len(args) == 2 {
+		redeemInvite(ctx, u, utils.Logger.Named("invite"), args[1])
 		return dispatcher.EndGroups
 	}
-	ctx.Reply(u, ext.ReplyTextString("Hi, send me any file to get a direct streamble link to that file."), nil)
+	lang := userLang(u)
+	if !invites.Allowed(chatId) {
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.not_allowed")), nil)
+		return dispatcher.EndGroups
+	}
+	ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.start")), nil)
 	return dispatcher.EndGroups
 }
+
+// userLang is the language of the user's Telegram app, or LANG.
+func userLang(u *ext.Update) string {
+	if user := u.EffectiveUser(); user != nil {
+		return i18n.Lang(user.LangCode)
+	}
+	return i18n.Lang("")
+}
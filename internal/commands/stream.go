@@ -5,6 +5,9 @@ import (
 	"strings"
 
 	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/i18n"
+	"EverythingSuckz/fsb/internal/invites"
+	"EverythingSuckz/fsb/internal/userfiles"
 	"EverythingSuckz/fsb/internal/utils"
 
 	"github.com/celestix/gotgproto/dispatcher"
@@ -14,6 +17,7 @@ import (
 	"github.com/celestix/gotgproto/types"
 	"github.com/gotd/td/telegram/message/styling"
 	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
 )
 
 func (m *command) LoadStream(dispatcher dispatcher.Dispatcher) {
@@ -46,8 +50,9 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 	if peerChatId.Type != int(storage.TypeUser) {
 		return dispatcher.EndGroups
 	}
-	if len(config.ValueOf.AllowedUsers) != 0 && !utils.Contains(config.ValueOf.AllowedUsers, chatId) {
-		ctx.Reply(u, ext.ReplyTextString("You are not allowed to use this bot."), nil)
+	lang := userLang(u)
+	if !invites.Allowed(chatId) {
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.not_allowed")), nil)
 		return dispatcher.EndGroups
 	}
 	supported, err := supportedMediaFilter(u.EffectiveMessage)
@@ -55,20 +60,20 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 		return err
 	}
 	if !supported {
-		ctx.Reply(u, ext.ReplyTextString("Sorry, this message type is unsupported."), nil)
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.unsupported")), nil)
 		return dispatcher.EndGroups
 	}
 	update, err := utils.ForwardMessages(ctx, chatId, config.ValueOf.LogChannelID, u.EffectiveMessage.ID)
 	if err != nil {
 		utils.Logger.Sugar().Error(err)
-		ctx.Reply(u, ext.ReplyTextString(fmt.Sprintf("Error - %s", err.Error())), nil)
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
 		return dispatcher.EndGroups
 	}
 	messageID := update.Updates[0].(*tg.UpdateMessageID).ID
 	doc := update.Updates[1].(*tg.UpdateNewChannelMessage).Message.(*tg.Message).Media
 	file, err := utils.FileFromMedia(doc)
 	if err != nil {
-		ctx.Reply(u, ext.ReplyTextString(fmt.Sprintf("Error - %s", err.Error())), nil)
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
 		return dispatcher.EndGroups
 	}
 	fullHash := utils.PackFile(
@@ -78,25 +83,47 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 		file.ID,
 	)
 	hash := utils.GetShortHash(fullHash)
-	link := fmt.Sprintf("%s/stream/%d?hash=%s", config.ValueOf.Host, messageID, hash)
+	err = userfiles.Record(userfiles.File{
+		MessageID: messageID,
+		UserID:    chatId,
+		FileName:  file.FileName,
+		Size:      file.FileSize,
+		MimeType:  file.MimeType,
+		Hash:      fullHash,
+	})
+	if err != nil {
+		utils.Logger.Warn("Failed to record user file", zap.Int("messageID", messageID), zap.Error(err))
+	}
+	link := fmt.Sprintf("%s/stream/%d?hash=%s", config.ValueOf.LinkBase(), messageID, hash)
 	text := ext.ReplyTextStyledTextArray([]styling.StyledTextOption{styling.Code(link)})
 	row := tg.KeyboardButtonRow{
 		Buttons: []tg.KeyboardButtonClass{
 			&tg.KeyboardButtonURL{
-				Text: "Download",
+				Text: i18n.T(lang, "bot.button.download"),
 				URL:  link + "&d=true",
 			},
 		},
 	}
 	if strings.Contains(file.MimeType, "video") || strings.Contains(file.MimeType, "audio") || strings.Contains(file.MimeType, "pdf") {
 		row.Buttons = append(row.Buttons, &tg.KeyboardButtonURL{
-			Text: "Stream",
+			Text: i18n.T(lang, "bot.button.stream"),
 			URL:  link,
 		})
 	}
 	markup := &tg.ReplyInlineMarkup{
 		Rows: []tg.KeyboardButtonRow{row},
 	}
+	// With REGION_HOSTS, users pick the host nearest to them
+	if regions := config.ValueOf.Regions(); len(regions) > 0 {
+		regionRow := tg.KeyboardButtonRow{}
+		for _, region := range regions {
+			regionRow.Buttons = append(regionRow.Buttons, &tg.KeyboardButtonURL{
+				Text: i18n.T(lang, "bot.button.region", strings.ToUpper(region.Name)),
+				URL:  fmt.Sprintf("%s/stream/%d?hash=%s", region.URL, messageID, hash),
+			})
+		}
+		markup.Rows = append(markup.Rows, regionRow)
+	}
 	if strings.Contains(link, "http://localhost") {
 		_, err = ctx.Reply(u, text, &ext.ReplyOpts{
 			NoWebpage:        false,
@@ -111,7 +138,7 @@ func sendLink(ctx *ext.Context, u *ext.Update) error {
 	}
 	if err != nil {
 		utils.Logger.Sugar().Error(err)
-		ctx.Reply(u, ext.ReplyTextString(fmt.Sprintf("Error - %s", err.Error())), nil)
+		ctx.Reply(u, ext.ReplyTextString(i18n.T(lang, "bot.error", err.Error())), nil)
 	}
 	return dispatcher.EndGroups
 }
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"EverythingSuckz/fsb/config"
+	"sync"
+
+	"github.com/glebarez/sqlite"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// DB is the shared application database. It is nil until Init succeeds.
+var DB *gorm.DB
+
+var (
+	modelsMu sync.Mutex
+	models   []any
+)
+
+// RegisterModel adds a model to be migrated when the database is initialized.
+// Packages call it from init() so the schema lives next to the code using it.
+func RegisterModel(model any) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	models = append(models, model)
+}
+
+// Init opens the SQLite database at DATABASE_PATH and migrates all registered models.
+func Init(log *zap.Logger) error {
+	log = log.Named("Database")
+	db, err := Open(config.ValueOf.DatabasePath)
+	if err != nil {
+		return err
+	}
+	DB = db
+	log.Info("Database initialized",
+		zap.String("path", config.ValueOf.DatabasePath),
+		zap.Int("models", len(models)))
+	return nil
+}
+
+// Open opens the SQLite database at path and migrates all registered models.
+func Open(path string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	if err := db.AutoMigrate(models...); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,168 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// DumpVersion is bumped when the dump format changes incompatibly. Version
+// 1 keyed the columns by their JSON names, which lost the fields hidden from
+// JSON; it is still read.
+const DumpVersion = 2
+
+const importBatchSize = 500
+
+// Dump is a portable copy of every registered table, keyed by table name.
+// Each table is a list of rows keyed by column name.
+type Dump struct {
+	Version    int                        `json:"version"`
+	ExportedAt time.Time                  `json:"exported_at"`
+	Tables     map[string]json.RawMessage `json:"tables"`
+}
+
+// tables returns the schema of every registered model by table name.
+func tables(db *gorm.DB) (map[string]*schema.Schema, error) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	byName := make(map[string]*schema.Schema, len(models))
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		byName[stmt.Schema.Table] = stmt.Schema
+	}
+	return byName, nil
+}
+
+// newRows returns a pointer to an empty slice of the model of s.
+func newRows(s *schema.Schema) any {
+	return reflect.New(reflect.SliceOf(s.ModelType)).Interface()
+}
+
+// Export reads every registered table of db.
+func Export(db *gorm.DB) (*Dump, error) {
+	byName, err := tables(db)
+	if err != nil {
+		return nil, err
+	}
+	dump := &Dump{Version: DumpVersion, ExportedAt: time.Now().UTC(), Tables: make(map[string]json.RawMessage)}
+	for name, s := range byName {
+		rows := newRows(s)
+		if err := db.Model(reflect.New(s.ModelType).Interface()).Find(rows).Error; err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		data, err := json.Marshal(encodeRows(s, reflect.ValueOf(rows).Elem()))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		dump.Tables[name] = data
+	}
+	return dump, nil
+}
+
+// encodeRows keys the columns of rows by name, fields hidden from JSON
+// included.
+func encodeRows(s *schema.Schema, rows reflect.Value) []map[string]any {
+	encoded := make([]map[string]any, rows.Len())
+	for i := range encoded {
+		row := make(map[string]any, len(s.Fields))
+		for _, field := range s.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			row[field.DBName], _ = field.ValueOf(context.Background(), rows.Index(i))
+		}
+		encoded[i] = row
+	}
+	return encoded
+}
+
+// decodeRows reads the rows of a table written by encodeRows into a
+// pointer to a slice of its model. Columns this build doesn't know are
+// skipped.
+func decodeRows(s *schema.Schema, data json.RawMessage, rows any) error {
+	var encoded []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	slice := reflect.ValueOf(rows).Elem()
+	for _, columns := range encoded {
+		row := reflect.New(s.ModelType).Elem()
+		for _, field := range s.Fields {
+			raw, ok := columns[field.DBName]
+			if !ok || field.DBName == "" {
+				continue
+			}
+			value := reflect.New(field.FieldType)
+			if err := json.Unmarshal(raw, value.Interface()); err != nil {
+				return fmt.Errorf("column %s: %w", field.DBName, err)
+			}
+			if err := field.Set(context.Background(), row, value.Elem().Interface()); err != nil {
+				return fmt.Errorf("column %s: %w", field.DBName, err)
+			}
+		}
+		slice.Set(reflect.Append(slice, row))
+	}
+	return nil
+}
+
+// Import writes the tables of dump into db and returns the rows imported per
+// table. Rows are merged by primary key, or the tables are emptied first when
+// replace is set. Tables this build doesn't know are skipped.
+func Import(db *gorm.DB, dump *Dump, replace bool) (map[string]int, error) {
+	if dump.Version > DumpVersion {
+		return nil, fmt.Errorf("dump version %d is newer than this build supports (%d)", dump.Version, DumpVersion)
+	}
+	byName, err := tables(db)
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for name, data := range dump.Tables {
+			s, ok := byName[name]
+			if !ok {
+				continue
+			}
+			rows := newRows(s)
+			var decodeErr error
+			if dump.Version < 2 {
+				decodeErr = json.Unmarshal(data, rows)
+			} else {
+				decodeErr = decodeRows(s, data, rows)
+			}
+			if decodeErr != nil {
+				return fmt.Errorf("%s: %w", name, decodeErr)
+			}
+			model := reflect.New(s.ModelType).Interface()
+			if replace {
+				if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			n := reflect.ValueOf(rows).Elem().Len()
+			if n > 0 {
+				err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(rows, importBatchSize).Error
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+			}
+			counts[name] = n
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// Snapshot writes a consistent copy of db to the SQLite file at path.
+func Snapshot(db *gorm.DB, path string) error {
+	return db.Exec("VACUUM INTO ?", path).Error
+}
@@ -0,0 +1,111 @@
+package dyndns
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflare updates (or creates) an A/AAAA record through the Cloudflare API.
+// The token needs the Zone.DNS edit permission on the zone.
+type cloudflare struct {
+	token  string
+	zoneID string
+	client *http.Client
+}
+
+func newCloudflare(token, zoneID string) *cloudflare {
+	return &cloudflare{
+		token:  token,
+		zoneID: zoneID,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (c *cloudflare) Name() string {
+	return "cloudflare"
+}
+
+type cloudflareRecord struct {
+	ID      string `json:"id,omitempty"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl,omitempty"`
+}
+
+type cloudflareResponse struct {
+	Success bool                       `json:"success"`
+	Errors  []struct{ Message string } `json:"errors"`
+	Result  json.RawMessage            `json:"result"`
+}
+
+func (c *cloudflare) Update(ctx context.Context, record, ip string) error {
+	recordType := "A"
+	if strings.Contains(ip, ":") {
+		recordType = "AAAA"
+	}
+
+	query := url.Values{"type": {recordType}, "name": {record}}
+	var existing []cloudflareRecord
+	if err := c.do(ctx, http.MethodGet, "/dns_records?"+query.Encode(), nil, &existing); err != nil {
+		return err
+	}
+
+	body := cloudflareRecord{Type: recordType, Name: record, Content: ip, TTL: 1}
+	if len(existing) == 0 {
+		return c.do(ctx, http.MethodPost, "/dns_records", body, nil)
+	}
+	if existing[0].Content == ip {
+		return nil
+	}
+	return c.do(ctx, http.MethodPatch, "/dns_records/"+existing[0].ID, body, nil)
+}
+
+func (c *cloudflare) do(ctx context.Context, method, path string, body any, result any) error {
+	var reader *bytes.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, cloudflareAPI+"/zones/"+c.zoneID+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var parsed cloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return fmt.Errorf("cloudflare %s: %w", resp.Status, err)
+	}
+	if !parsed.Success {
+		messages := make([]string, 0, len(parsed.Errors))
+		for _, e := range parsed.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("cloudflare %s: %s", resp.Status, strings.Join(messages, "; "))
+	}
+	if result != nil {
+		return json.Unmarshal(parsed.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package dyndns
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/publicip"
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const updateTimeout = 30 * time.Second
+
+// Updater points a DNS record at a new address.
+type Updater interface {
+	Name() string
+	Update(ctx context.Context, record, ip string) error
+}
+
+// Start keeps DDNS_RECORD_NAME pointing at the public IP: the record is synced
+// once at startup and again every time the public IP watcher sees a change.
+func Start(log *zap.Logger) {
+	log = log.Named("DynDNS")
+	updater, err := newUpdater()
+	if err != nil {
+		log.Error("Dynamic DNS disabled", zap.Error(err))
+		return
+	}
+	if updater == nil {
+		return
+	}
+	record := recordName()
+	if record == "" {
+		log.Error("Dynamic DNS disabled: set DDNS_RECORD_NAME or a HOST with a domain name")
+		return
+	}
+	if config.ValueOf.PublicIPCheckMinutes <= 0 {
+		log.Warn("PUBLIC_IP_CHECK_MINUTES is 0, the record is only synced at startup")
+	}
+	log.Info("Dynamic DNS enabled", zap.String("provider", updater.Name()), zap.String("record", record))
+
+	publicip.OnChange(func(_, newIP, _ string) {
+		update(log, updater, record, newIP)
+	})
+	go func() {
+		ip := config.ValueOf.PublicIP()
+		if ip == "" {
+			ip, err = config.FetchPublicIP(config.ValueOf.PublicIPProviders, config.ValueOf.BindIPv6)
+			if err != nil {
+				log.Warn("Failed to fetch public IP for initial sync", zap.Error(err))
+				return
+			}
+		}
+		update(log, updater, record, ip)
+	}()
+}
+
+func update(log *zap.Logger, updater Updater, record, ip string) {
+	ctx, cancel := context.WithTimeout(context.Background(), updateTimeout)
+	defer cancel()
+	if err := updater.Update(ctx, record, ip); err != nil {
+		log.Error("Failed to update DNS record", zap.String("record", record), zap.String("ip", ip), zap.Error(err))
+		return
+	}
+	log.Info("DNS record updated", zap.String("record", record), zap.String("ip", ip))
+}
+
+func newUpdater() (Updater, error) {
+	switch strings.ToLower(strings.TrimSpace(config.ValueOf.DDNSProvider)) {
+	case "", "off":
+		return nil, nil
+	case "cloudflare":
+		if config.ValueOf.CloudflareAPIToken == "" || config.ValueOf.CloudflareZoneID == "" {
+			return nil, fmt.Errorf("CLOUDFLARE_API_TOKEN and CLOUDFLARE_ZONE_ID are required")
+		}
+		return newCloudflare(config.ValueOf.CloudflareAPIToken, config.ValueOf.CloudflareZoneID), nil
+	case "dyndns":
+		if config.ValueOf.DDNSUsername == "" || config.ValueOf.DDNSPassword == "" {
+			return nil, fmt.Errorf("DDNS_USERNAME and DDNS_PASSWORD are required")
+		}
+		return newDynDNS2(config.ValueOf.DDNSUpdateURL, config.ValueOf.DDNSUsername, config.ValueOf.DDNSPassword), nil
+	default:
+		return nil, fmt.Errorf("unknown DDNS_PROVIDER %q, expected 'cloudflare' or 'dyndns'", config.ValueOf.DDNSProvider)
+	}
+}
+
+// recordName defaults to the domain in HOST so most setups only pick a provider.
+func recordName() string {
+	if config.ValueOf.DDNSRecordName != "" {
+		return config.ValueOf.DDNSRecordName
+	}
+	u, err := url.Parse(config.ValueOf.GetHost())
+	if err != nil {
+		return ""
+	}
+	hostname := u.Hostname()
+	if hostname == "" || hostname == "localhost" || !strings.Contains(hostname, ".") || isIP(hostname) {
+		return ""
+	}
+	return hostname
+}
+
+func isIP(host string) bool {
+	return net.ParseIP(host) != nil
+}
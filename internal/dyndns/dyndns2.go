@@ -0,0 +1,56 @@
+package dyndns
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// dynDNS2 speaks the dyndns2 update protocol used by DynDNS, No-IP and most
+// router-friendly providers.
+type dynDNS2 struct {
+	updateURL string
+	username  string
+	password  string
+	client    *http.Client
+}
+
+func newDynDNS2(updateURL, username, password string) *dynDNS2 {
+	return &dynDNS2{
+		updateURL: updateURL,
+		username:  username,
+		password:  password,
+		client:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (d *dynDNS2) Name() string {
+	return "dyndns"
+}
+
+func (d *dynDNS2) Update(ctx context.Context, record, ip string) error {
+	query := url.Values{"hostname": {record}, "myip": {ip}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.updateURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(d.username, d.password)
+	req.Header.Set("User-Agent", "TG-FileStreamBot")
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	answer := strings.TrimSpace(string(body))
+	// "good <ip>" and "nochg <ip>" are the only success answers
+	if resp.StatusCode == http.StatusOK && (strings.HasPrefix(answer, "good") || strings.HasPrefix(answer, "nochg")) {
+		return nil
+	}
+	return fmt.Errorf("dyndns %s: %s", resp.Status, answer)
+}
@@ -0,0 +1,213 @@
+// Package flags gates experimental behaviors behind feature flags. A flag is
+// rolled out to a percentage of requests: its default can be changed with
+// FEATURE_FLAGS and overridden at runtime through the admin API, which keeps
+// the override in the database.
+package flags
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// Known flags.
+const (
+	StreamPrefetch     = "stream_prefetch"
+	BalancerTwoChoices = "balancer_two_choices"
+	CoalesceChunks     = "coalesce_chunks"
+)
+
+var ErrUnknownFlag = errors.New("unknown feature flag")
+
+type definition struct {
+	description string
+	percent     int
+}
+
+var definitions = map[string]definition{
+	StreamPrefetch: {
+		description: "Fetch the next chunk from Telegram while the current one is being sent",
+		percent:     100,
+	},
+	BalancerTwoChoices: {
+		description: "Pick the less loaded of two random workers instead of scanning all of them",
+		percent:     0,
+	},
+	CoalesceChunks: {
+		description: "Share one Telegram fetch between concurrent requests of the same chunk",
+		percent:     100,
+	},
+}
+
+// Override is a rollout set through the admin API.
+type Override struct {
+	Name      string    `gorm:"primaryKey" json:"name"`
+	Percent   int       `json:"percent"`
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (Override) TableName() string { return "feature_flags" }
+
+func init() {
+	database.RegisterModel(&Override{})
+}
+
+// Flag is the current state of a feature flag.
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Percent     int    `json:"percent"` // share of requests that get the behavior
+	Source      string `json:"source"`  // default, env or admin
+}
+
+var (
+	mu    sync.RWMutex
+	flags = make(map[string]*Flag)
+)
+
+func init() {
+	for name, def := range definitions {
+		flags[name] = &Flag{Name: name, Description: def.description, Percent: def.percent, Source: "default"}
+	}
+}
+
+// Load applies FEATURE_FLAGS and the overrides stored in the database. It
+// must run after database.Init.
+func Load(l *zap.Logger) {
+	log := l.Named("Flags")
+	for _, entry := range config.ValueOf.FeatureFlags {
+		name, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if _, valid := parsePercent(value); !valid || flags[name] == nil {
+			log.Sugar().Warnf("Ignoring FEATURE_FLAGS entry %q, expected <flag>=on|off|<percent>%%", entry)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for name, flag := range flags {
+		flag.Percent, flag.Source = basePercent(name)
+	}
+	if database.DB != nil {
+		var overrides []Override
+		if err := database.DB.Find(&overrides).Error; err != nil {
+			log.Error("Failed to load feature flag overrides", zap.Error(err))
+		}
+		for _, o := range overrides {
+			if flag, ok := flags[o.Name]; ok {
+				flag.Percent = o.Percent
+				flag.Source = "admin"
+			}
+		}
+	}
+	for _, flag := range flags {
+		if flag.Percent != definitions[flag.Name].percent {
+			log.Info("Feature flag set", zap.String("flag", flag.Name), zap.Int("percent", flag.Percent), zap.String("source", flag.Source))
+		}
+	}
+}
+
+// basePercent is the rollout of name without an admin override.
+func basePercent(name string) (int, string) {
+	percent, source := definitions[name].percent, "default"
+	for _, entry := range config.ValueOf.FeatureFlags {
+		envName, value, _ := strings.Cut(strings.TrimSpace(entry), "=")
+		if n, valid := parsePercent(value); envName == name && valid {
+			percent, source = n, "env"
+		}
+	}
+	return percent, source
+}
+
+// parsePercent reads "on", "off", "true", "false" or "25%".
+func parsePercent(value string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on", "true", "1":
+		return 100, true
+	case "off", "false", "0":
+		return 0, true
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if err != nil || n < 0 || n > 100 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Enabled decides whether the current request gets the behavior behind name,
+// drawing against the flag's rollout percentage.
+func Enabled(name string) bool {
+	mu.RLock()
+	flag, ok := flags[name]
+	percent := 0
+	if ok {
+		percent = flag.Percent
+	}
+	mu.RUnlock()
+	switch {
+	case percent >= 100:
+		return true
+	case percent <= 0:
+		return false
+	}
+	return rand.Intn(100) < percent
+}
+
+// List returns every flag, sorted by name.
+func List() []Flag {
+	mu.RLock()
+	defer mu.RUnlock()
+	out := make([]Flag, 0, len(flags))
+	for _, flag := range flags {
+		out = append(out, *flag)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Set rolls name out to percent of requests until it is reset. The override
+// is stored when the database is available so it survives restarts.
+func Set(name string, percent int, by string) (Flag, error) {
+	if _, ok := definitions[name]; !ok {
+		return Flag{}, ErrUnknownFlag
+	}
+	percent = min(max(percent, 0), 100)
+	if database.DB != nil {
+		err := database.DB.Clauses(clause.OnConflict{UpdateAll: true}).
+			Create(&Override{Name: name, Percent: percent, UpdatedBy: by, UpdatedAt: time.Now()}).Error
+		if err != nil {
+			return Flag{}, err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	flags[name].Percent = percent
+	flags[name].Source = "admin"
+	return *flags[name], nil
+}
+
+// Reset drops the admin override of name, going back to FEATURE_FLAGS or the
+// built-in default.
+func Reset(name string) (Flag, error) {
+	if _, ok := definitions[name]; !ok {
+		return Flag{}, ErrUnknownFlag
+	}
+	if database.DB != nil {
+		if err := database.DB.Delete(&Override{Name: name}).Error; err != nil {
+			return Flag{}, err
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	flag := flags[name]
+	flag.Percent, flag.Source = basePercent(name)
+	return *flag, nil
+}
@@ -0,0 +1,104 @@
+package i18n
+
+var en = map[string]string{
+	// Bot replies
+	"bot.not_allowed":     "You are not allowed to use this bot.",
+	"bot.start":           "Hi, send me any file to get a direct streamble link to that file.",
+	"bot.unsupported":     "Sorry, this message type is unsupported.",
+	"bot.error":           "Error - %s",
+	"bot.button.download": "Download",
+	"bot.button.stream":   "Stream",
+	"bot.button.region":   "Stream from %s",
+
+	// Premium
+	"premium.title":               "Premium",
+	"premium.description":         "Premium access for %d days.",
+	"premium.description_forever": "Premium access, for good.",
+	"premium.invalid":             "This invoice is no longer valid, send /premium again.",
+	"premium.thanks":              "Thanks! You are premium until %s.",
+	"premium.thanks_forever":      "Thanks! You are premium now.",
+
+	// Invites
+	"invite.usage":      "Usage: /invite [uses] [days] [role]. 0 uses or days means no limit, role is premium or empty.",
+	"invite.created":    "Invite code: %s\nUses: %s, expires: %s\nLink: %s",
+	"invite.unlimited":  "unlimited",
+	"invite.never":      "never",
+	"redeem.usage":      "Usage: /redeem <code>",
+	"redeem.ok":         "Welcome! You can use the bot now, send me any file.",
+	"redeem.ok_premium": "Welcome! You can use the bot now and you are premium.",
+	"redeem.not_found":  "This invite code doesn't exist.",
+	"redeem.expired":    "This invite code expired.",
+	"redeem.used_up":    "This invite code has no uses left.",
+	"redeem.already":    "You already redeemed this invite code.",
+
+	// Status dashboard
+	"status.title":            "Workers Status",
+	"status.heading":          "Workers Status Dashboard",
+	"status.subtitle":         "Real-time monitoring",
+	"status.no_workers":       "No workers available",
+	"status.auto_refresh":     "Auto-refresh (1s):",
+	"status.refresh_active":   "Active",
+	"status.refresh_paused":   "Paused",
+	"status.total_workers":    "Total Workers",
+	"status.active_requests":  "Active Requests",
+	"status.total_requests":   "Total Requests",
+	"status.success_rate":     "Success Rate",
+	"status.recent_requests":  "Recent Requests (Last 300)",
+	"status.last_updated":     "Last updated: %s",
+	"status.col.id":           "ID",
+	"status.col.bot":          "Bot",
+	"status.col.dc":           "DC",
+	"status.col.ping":         "Ping",
+	"status.col.channels":     "Channels",
+	"status.col.active":       "Active",
+	"status.col.total":        "Total",
+	"status.col.failed":       "Failed",
+	"status.col.success_rate": "Success Rate",
+	"status.col.avg_response": "Avg Response (Last 5)",
+	"status.col.uptime":       "Uptime",
+	"status.col.last_request": "Last Request",
+	"status.col.time":         "Time",
+	"status.col.message_id":   "Message ID",
+	"status.col.worker":       "Worker",
+	"status.col.range_start":  "Range Start",
+	"status.col.range_end":    "Range End",
+	"status.col.chunk_size":   "Chunk Size",
+	"status.col.bytes_sent":   "Bytes Sent",
+	"status.col.file_size":    "File Size",
+	"status.col.status":       "Status",
+	"status.col.duration":     "Duration",
+	"status.col.client_ip":    "Client IP",
+	"status.col.user_agent":   "User Agent",
+
+	// Errors of the streaming routes
+	"error.link_revoked":                     "this link was revoked",
+	"error.file_removed":                     "this file was removed",
+	"error.file_deleted":                     "this file was deleted",
+	"error.file_not_found":                   "file not found",
+	"error.message_not_found":                "message not found or has no media",
+	"error.invalid_message_id":               "invalid message ID",
+	"error.unknown_channel":                  "unknown channel",
+	"error.media_channel_not_configured":     "MEDIA_CHANNEL_ID not configured",
+	"error.missing_hash":                     "missing hash param",
+	"error.invalid_hash":                     "invalid hash",
+	"error.invalid_range":                    "invalid range header",
+	"error.range_not_satisfiable":            "requested range not satisfiable",
+	"error.refetch_failed":                   "file reference expired and refetch failed",
+	"error.photo_refetch_failed":             "photo file reference expired and refetch failed",
+	"error.photo_after_refetch":              "failed to get photo file after refetch",
+	"error.photo":                            "failed to get photo file",
+	"error.rate_limited":                     "too many requests, slow down",
+	"error.too_many_streams":                 "too many concurrent streams, close one and retry",
+	"error.abuse_banned":                     "access suspended after suspicious activity",
+	"error.premium_required":                 "this feature is for premium users",
+	"error.abuse_throttled":                  "too many requests after suspicious activity, slow down",
+	"error.auth_not_configured":              "stream authentication is not configured",
+	"error.auth_api_key":                     "unauthorized: invalid API key",
+	"error.auth_session":                     "unauthorized: invalid or expired stream session",
+	"error.auth_signature":                   "unauthorized: invalid or expired signature",
+	"error.auth_missing":                     "unauthorized: missing stream session token",
+	"error.unavailable.no_workers":           "no workers available",
+	"error.unavailable.telegram_unavailable": "failed to fetch file from Telegram",
+	"error.unavailable.busy":                 "all workers are busy with downloads, try again later",
+	"error.unavailable.no_channel_access":    "the server's bots can't read this channel",
+}
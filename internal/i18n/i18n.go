@@ -0,0 +1,88 @@
+// Package i18n translates the bot replies, the HTML pages and the error bodies
+// of the streaming routes. Each language is a catalog of messages by key; keys
+// missing from a catalog fall back to English.
+package i18n
+
+import (
+	"EverythingSuckz/fsb/config"
+	"fmt"
+	"strings"
+)
+
+// DefaultLang is the language of the built-in messages.
+const DefaultLang = "en"
+
+var catalogs = map[string]map[string]string{
+	"en":    en,
+	"pt-br": ptBR,
+}
+
+// aliases picks a catalog for a bare language, e.g. pt from Telegram.
+var aliases = map[string]string{
+	"pt": "pt-br",
+}
+
+// Match returns the catalog for a tag as found in LANG, a Telegram language
+// code or Accept-Language (pt-BR, pt_BR.UTF-8, pt), or "" when there is none.
+func Match(tag string) string {
+	tag, _, _ = strings.Cut(tag, ".")
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	if tag == "" {
+		return ""
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	base, _, _ := strings.Cut(tag, "-")
+	if _, ok := catalogs[base]; ok {
+		return base
+	}
+	return aliases[base]
+}
+
+// Lang returns the catalog for tag, falling back to LANG and then English.
+func Lang(tag string) string {
+	if lang := Match(tag); lang != "" {
+		return lang
+	}
+	if lang := Match(config.ValueOf.Lang); lang != "" {
+		return lang
+	}
+	return DefaultLang
+}
+
+// FromAcceptLanguage returns the first language of an Accept-Language header
+// with a catalog, else the one of LANG.
+func FromAcceptLanguage(header string) string {
+	if lang := AcceptLanguage(header); lang != "" {
+		return lang
+	}
+	return Lang("")
+}
+
+// AcceptLanguage returns the first language of an Accept-Language header with
+// a catalog, or "" when there is none.
+func AcceptLanguage(header string) string {
+	for _, part := range strings.Split(header, ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		if lang := Match(tag); lang != "" {
+			return lang
+		}
+	}
+	return ""
+}
+
+// T returns the message key in lang, formatted with args when given.
+func T(lang, key string, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		msg, ok = en[key]
+	}
+	if !ok {
+		msg = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
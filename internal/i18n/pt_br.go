@@ -0,0 +1,104 @@
+package i18n
+
+var ptBR = map[string]string{
+	// Bot replies
+	"bot.not_allowed":     "Você não tem permissão para usar este bot.",
+	"bot.start":           "Olá, envie qualquer arquivo para receber um link direto de streaming dele.",
+	"bot.unsupported":     "Desculpe, este tipo de mensagem não é suportado.",
+	"bot.error":           "Erro - %s",
+	"bot.button.download": "Baixar",
+	"bot.button.stream":   "Assistir",
+	"bot.button.region":   "Assistir em %s",
+
+	// Premium
+	"premium.title":               "Premium",
+	"premium.description":         "Acesso premium por %d dias.",
+	"premium.description_forever": "Acesso premium, para sempre.",
+	"premium.invalid":             "Esta fatura não é mais válida, envie /premium novamente.",
+	"premium.thanks":              "Obrigado! Você é premium até %s.",
+	"premium.thanks_forever":      "Obrigado! Agora você é premium.",
+
+	// Invites
+	"invite.usage":      "Uso: /invite [usos] [dias] [papel]. 0 usos ou dias significa sem limite, o papel é premium ou vazio.",
+	"invite.created":    "Código de convite: %s\nUsos: %s, expira: %s\nLink: %s",
+	"invite.unlimited":  "ilimitados",
+	"invite.never":      "nunca",
+	"redeem.usage":      "Uso: /redeem <código>",
+	"redeem.ok":         "Bem-vindo! Agora você pode usar o bot, envie qualquer arquivo.",
+	"redeem.ok_premium": "Bem-vindo! Agora você pode usar o bot e é premium.",
+	"redeem.not_found":  "Este código de convite não existe.",
+	"redeem.expired":    "Este código de convite expirou.",
+	"redeem.used_up":    "Este código de convite não tem mais usos.",
+	"redeem.already":    "Você já resgatou este código de convite.",
+
+	// Status dashboard
+	"status.title":            "Status dos Workers",
+	"status.heading":          "Painel de Status dos Workers",
+	"status.subtitle":         "Monitoramento em tempo real",
+	"status.no_workers":       "Nenhum worker disponível",
+	"status.auto_refresh":     "Atualização automática (1s):",
+	"status.refresh_active":   "Ativa",
+	"status.refresh_paused":   "Pausada",
+	"status.total_workers":    "Total de Workers",
+	"status.active_requests":  "Requisições Ativas",
+	"status.total_requests":   "Total de Requisições",
+	"status.success_rate":     "Taxa de Sucesso",
+	"status.recent_requests":  "Requisições Recentes (Últimas 300)",
+	"status.last_updated":     "Última atualização: %s",
+	"status.col.id":           "ID",
+	"status.col.bot":          "Bot",
+	"status.col.dc":           "DC",
+	"status.col.ping":         "Ping",
+	"status.col.channels":     "Canais",
+	"status.col.active":       "Ativas",
+	"status.col.total":        "Total",
+	"status.col.failed":       "Falhas",
+	"status.col.success_rate": "Taxa de Sucesso",
+	"status.col.avg_response": "Resposta Média (Últimas 5)",
+	"status.col.uptime":       "Tempo Ativo",
+	"status.col.last_request": "Última Requisição",
+	"status.col.time":         "Hora",
+	"status.col.message_id":   "ID da Mensagem",
+	"status.col.worker":       "Worker",
+	"status.col.range_start":  "Início do Intervalo",
+	"status.col.range_end":    "Fim do Intervalo",
+	"status.col.chunk_size":   "Tamanho do Bloco",
+	"status.col.bytes_sent":   "Bytes Enviados",
+	"status.col.file_size":    "Tamanho do Arquivo",
+	"status.col.status":       "Status",
+	"status.col.duration":     "Duração",
+	"status.col.client_ip":    "IP do Cliente",
+	"status.col.user_agent":   "User Agent",
+
+	// Errors of the streaming routes
+	"error.link_revoked":                     "este link foi revogado",
+	"error.file_removed":                     "este arquivo foi removido",
+	"error.file_deleted":                     "este arquivo foi apagado",
+	"error.file_not_found":                   "arquivo não encontrado",
+	"error.message_not_found":                "mensagem não encontrada ou sem mídia",
+	"error.invalid_message_id":               "ID de mensagem inválido",
+	"error.unknown_channel":                  "canal desconhecido",
+	"error.media_channel_not_configured":     "MEDIA_CHANNEL_ID não configurado",
+	"error.missing_hash":                     "parâmetro hash ausente",
+	"error.invalid_hash":                     "hash inválido",
+	"error.invalid_range":                    "cabeçalho Range inválido",
+	"error.range_not_satisfiable":            "o intervalo pedido não pode ser atendido",
+	"error.refetch_failed":                   "a referência do arquivo expirou e não pôde ser renovada",
+	"error.photo_refetch_failed":             "a referência da foto expirou e não pôde ser renovada",
+	"error.photo_after_refetch":              "falha ao obter a foto após renovar a referência",
+	"error.photo":                            "falha ao obter a foto",
+	"error.rate_limited":                     "muitas requisições, vá mais devagar",
+	"error.too_many_streams":                 "muitos streams simultâneos, feche um e tente de novo",
+	"error.abuse_banned":                     "acesso suspenso após atividade suspeita",
+	"error.premium_required":                 "este recurso é para usuários premium",
+	"error.abuse_throttled":                  "muitas requisições após atividade suspeita, vá mais devagar",
+	"error.auth_not_configured":              "a autenticação de streams não está configurada",
+	"error.auth_api_key":                     "não autorizado: chave de API inválida",
+	"error.auth_session":                     "não autorizado: sessão de stream inválida ou expirada",
+	"error.auth_signature":                   "não autorizado: assinatura inválida ou expirada",
+	"error.auth_missing":                     "não autorizado: token de sessão de stream ausente",
+	"error.unavailable.no_workers":           "nenhum worker disponível",
+	"error.unavailable.telegram_unavailable": "falha ao buscar o arquivo no Telegram",
+	"error.unavailable.busy":                 "todos os workers estão ocupados com downloads, tente novamente mais tarde",
+	"error.unavailable.no_channel_access":    "os bots do servidor não conseguem ler este canal",
+}
@@ -0,0 +1,54 @@
+package imagestore
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned by Get when the key is not cached.
+var ErrNotFound = errors.New("image not found in store")
+
+// Store keeps cached images (thumbnails and direct photos) by key.
+// Images are small, so the whole object is moved in memory.
+type Store interface {
+	Name() string
+	Get(ctx context.Context, key string) ([]byte, error)
+	Put(ctx context.Context, key string, data []byte) error
+	Delete(ctx context.Context, key string) error
+}
+
+// New builds the store selected by IMAGE_STORE. The local store keeps files
+// under dir; the S3 store keeps them in S3_BUCKET so stateless deployments
+// don't lose the cache on restart.
+func New(log *zap.Logger, dir string) (Store, error) {
+	log = log.Named("ImageStore")
+	switch strings.ToLower(strings.TrimSpace(config.ValueOf.ImageStore)) {
+	case "", "local":
+		log.Info("Using local image store", zap.String("dir", dir))
+		return NewLocal(dir), nil
+	case "s3":
+		store, err := NewS3(S3Options{
+			Endpoint:        config.ValueOf.S3Endpoint,
+			Region:          config.ValueOf.S3Region,
+			Bucket:          config.ValueOf.S3Bucket,
+			AccessKeyID:     config.ValueOf.S3AccessKeyID,
+			SecretAccessKey: config.ValueOf.S3SecretAccessKey,
+			Prefix:          config.ValueOf.S3Prefix,
+			PathStyle:       config.ValueOf.S3PathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		log.Info("Using S3 image store",
+			zap.String("bucket", config.ValueOf.S3Bucket),
+			zap.String("prefix", config.ValueOf.S3Prefix))
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown IMAGE_STORE %q, expected 'local' or 's3'", config.ValueOf.ImageStore)
+	}
+}
@@ -0,0 +1,85 @@
+package imagestore
+
+import (
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"os"
+	"path/filepath"
+)
+
+// Local stores images as files in a directory.
+type Local struct {
+	dir string
+}
+
+func NewLocal(dir string) *Local {
+	return &Local{dir: dir}
+}
+
+func (l *Local) Name() string {
+	return "local"
+}
+
+// Dir returns the directory holding the cached files.
+func (l *Local) Dir() string {
+	return l.dir
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.dir, filepath.FromSlash(key))
+}
+
+func (l *Local) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(l.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// Put writes the image atomically. It returns utils.ErrLowDiskSpace instead of
+// writing when the volume is below MIN_FREE_DISK_MB.
+func (l *Local) Put(_ context.Context, key string, data []byte) error {
+	target := l.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	if err := utils.CheckDiskSpace(filepath.Dir(target)); err != nil {
+		return err
+	}
+	return writeBytesAtomically(target, data, 0o644)
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	if err := os.Remove(l.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func writeBytesAtomically(targetFile string, data []byte, perm os.FileMode) error {
+	cacheDir := filepath.Dir(targetFile)
+	tmpFile, err := os.CreateTemp(cacheDir, filepath.Base(targetFile)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpPath)
+	}()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		return err
+	}
+	if err := tmpFile.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, targetFile)
+}
@@ -0,0 +1,202 @@
+// Package invites lets admins hand out codes that users redeem to be allowed
+// to use the bot, and optionally to get a role, without editing
+// ALLOWED_USERS.
+package invites
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/premium"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound    = errors.New("invite code not found")
+	ErrExpired     = errors.New("invite code expired")
+	ErrUsedUp      = errors.New("invite code has no uses left")
+	ErrRedeemed    = errors.New("invite code already redeemed")
+	ErrUnknownRole = errors.New("unknown role")
+	ErrNoDatabase  = errors.New("database not initialized")
+)
+
+// Invite is a code users can redeem. Role is "" when it only grants access.
+type Invite struct {
+	Code      string     `gorm:"primaryKey" json:"code"`
+	Role      string     `json:"role,omitempty"`
+	MaxUses   int        `json:"max_uses"` // 0 is unlimited
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedBy string     `json:"created_by"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (Invite) TableName() string { return "invites" }
+
+// Member is a user let in by an invite code.
+type Member struct {
+	UserID   int64     `gorm:"primaryKey;autoIncrement:false" json:"user_id"`
+	Code     string    `gorm:"index" json:"code"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+func (Member) TableName() string { return "invited_users" }
+
+func init() {
+	database.RegisterModel(&Invite{})
+	database.RegisterModel(&Member{})
+}
+
+// Members are checked on every message, so they are kept in memory.
+var (
+	membersMu sync.RWMutex
+	members   = make(map[int64]bool)
+)
+
+// Load reads the invited users. It must run after database.Init.
+func Load(log *zap.Logger) {
+	if database.DB == nil {
+		return
+	}
+	var rows []Member
+	if err := database.DB.Find(&rows).Error; err != nil {
+		log.Named("Invites").Error("Failed to load invited users", zap.Error(err))
+		return
+	}
+	membersMu.Lock()
+	for _, m := range rows {
+		members[m.UserID] = true
+	}
+	membersMu.Unlock()
+}
+
+// Allowed reports whether userID may use the bot: everyone when
+// ALLOWED_USERS is empty, otherwise the users listed there, ADMIN_USERS and
+// those who redeemed an invite.
+func Allowed(userID int64) bool {
+	if len(config.Live().AllowedUsers) == 0 ||
+		slices.Contains(config.Live().AllowedUsers, userID) ||
+		slices.Contains(config.Live().AdminUsers, userID) {
+		return true
+	}
+	membersMu.RLock()
+	defer membersMu.RUnlock()
+	return members[userID]
+}
+
+// Create makes a code usable maxUses times (0 for unlimited) until ttl has
+// passed (0 for never), that grants role on top of access.
+func Create(role string, maxUses int, ttl time.Duration, createdBy string) (*Invite, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	if role != "" && role != premium.RolePremium {
+		return nil, ErrUnknownRole
+	}
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	invite := &Invite{
+		Code:      base32.StdEncoding.EncodeToString(b),
+		Role:      role,
+		MaxUses:   max(maxUses, 0),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl)
+		invite.ExpiresAt = &expiresAt
+	}
+	return invite, database.DB.Create(invite).Error
+}
+
+// List returns every invite, newest first.
+func List() ([]Invite, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	invites := []Invite{}
+	return invites, database.DB.Order("created_at DESC").Find(&invites).Error
+}
+
+// Revoke deletes a code. Users who redeemed it keep their access.
+func Revoke(code string) error {
+	if database.DB == nil {
+		return ErrNoDatabase
+	}
+	res := database.DB.Delete(&Invite{}, "code = ?", normalize(code))
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Redeem lets userID in with code and grants its role.
+func Redeem(code string, userID int64) (*Invite, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	var invite Invite
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Limit(1).Find(&invite, "code = ?", normalize(code)).Error; err != nil {
+			return err
+		}
+		switch {
+		case invite.Code == "":
+			return ErrNotFound
+		case invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt):
+			return ErrExpired
+		}
+		var redeemed int64
+		if err := tx.Model(&Member{}).Where("user_id = ? AND code = ?", userID, invite.Code).Count(&redeemed).Error; err != nil {
+			return err
+		}
+		if redeemed > 0 {
+			return ErrRedeemed
+		}
+		// Checked and counted in one statement so concurrent redemptions
+		// can't overshoot MaxUses
+		res := tx.Model(&Invite{}).
+			Where("code = ? AND (max_uses = 0 OR uses < max_uses)", invite.Code).
+			Update("uses", gorm.Expr("uses + 1"))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrUsedUp
+		}
+		invite.Uses++
+		return tx.Save(&Member{UserID: userID, Code: invite.Code, JoinedAt: time.Now()}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	membersMu.Lock()
+	members[userID] = true
+	membersMu.Unlock()
+	if invite.Role == premium.RolePremium {
+		if _, err := premium.Add(strconv.FormatInt(userID, 10), premium.SourceInvite, invite.Code); err != nil && !errors.Is(err, premium.ErrDuplicatePayment) {
+			return &invite, err
+		}
+	}
+	return &invite, nil
+}
+
+// normalize accepts codes typed in lowercase.
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,196 @@
+package janitor
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Target describes a set of files the janitor is responsible for: every file
+// under Dir whose base name matches Pattern and is older than MaxAge is removed.
+//
+// RemoveOnStartup marks files that can only be leftovers of a previous run
+// (e.g. partial downloads) and are removed by Recover regardless of age.
+// Validate, when set, is used by Recover to drop corrupt files.
+type Target struct {
+	Name            string
+	Dir             string
+	Pattern         string
+	MaxAge          time.Duration
+	RemoveOnStartup bool
+	Validate        func(path string) bool
+}
+
+// Stats reports what the janitor has reclaimed since startup.
+type Stats struct {
+	Runs           int64     `json:"runs"`
+	FilesRemoved   int64     `json:"files_removed"`
+	BytesReclaimed int64     `json:"bytes_reclaimed"`
+	LastRun        time.Time `json:"last_run"`
+	LastRunRemoved int64     `json:"last_run_removed"`
+}
+
+var (
+	runs           int64
+	filesRemoved   int64
+	bytesReclaimed int64
+	lastRunMu      sync.RWMutex
+	lastRun        time.Time
+	lastRunRemoved int64
+
+	targetsMu sync.Mutex
+	targets   []Target
+)
+
+// Register adds a cleanup target. Subsystems owning cache directories register
+// their own targets so the janitor doesn't need to know their layout.
+func Register(target Target) {
+	targetsMu.Lock()
+	defer targetsMu.Unlock()
+	targets = append(targets, target)
+}
+
+// GetStats returns a copy of the janitor counters.
+func GetStats() Stats {
+	lastRunMu.RLock()
+	defer lastRunMu.RUnlock()
+	return Stats{
+		Runs:           atomic.LoadInt64(&runs),
+		FilesRemoved:   atomic.LoadInt64(&filesRemoved),
+		BytesReclaimed: atomic.LoadInt64(&bytesReclaimed),
+		LastRun:        lastRun,
+		LastRunRemoved: lastRunRemoved,
+	}
+}
+
+// Start runs the cleanup once per interval in the background.
+// A non-positive interval disables the janitor.
+func Start(log *zap.Logger, interval time.Duration) {
+	log = log.Named("Janitor")
+	if interval <= 0 {
+		log.Info("Janitor disabled")
+		return
+	}
+	log.Info("Janitor started", zap.Duration("interval", interval))
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			RunOnce(log)
+		}
+	}()
+}
+
+// RunOnce sweeps every registered target a single time.
+func RunOnce(log *zap.Logger) {
+	targetsMu.Lock()
+	current := append([]Target{}, targets...)
+	targetsMu.Unlock()
+
+	var removed, reclaimed int64
+	now := time.Now()
+	for _, target := range current {
+		n, b := sweep(log, target, now)
+		removed += n
+		reclaimed += b
+	}
+
+	atomic.AddInt64(&runs, 1)
+	atomic.AddInt64(&filesRemoved, removed)
+	atomic.AddInt64(&bytesReclaimed, reclaimed)
+	lastRunMu.Lock()
+	lastRun = now
+	lastRunRemoved = removed
+	lastRunMu.Unlock()
+
+	if removed > 0 {
+		log.Info("Cleanup finished",
+			zap.Int64("filesRemoved", removed),
+			zap.Int64("bytesReclaimed", reclaimed))
+	} else {
+		log.Debug("Cleanup finished, nothing to remove")
+	}
+}
+
+// Recover runs once at boot, before anything writes to the cache directories:
+// it removes leftovers of interrupted writes and files failing validation.
+func Recover(log *zap.Logger) {
+	log = log.Named("Janitor")
+	targetsMu.Lock()
+	current := append([]Target{}, targets...)
+	targetsMu.Unlock()
+
+	var removed, reclaimed int64
+	for _, target := range current {
+		if !target.RemoveOnStartup && target.Validate == nil {
+			continue
+		}
+		n, b := walkTarget(log, target, func(path string, info fs.FileInfo) bool {
+			if target.RemoveOnStartup {
+				return true
+			}
+			return !target.Validate(path)
+		})
+		removed += n
+		reclaimed += b
+	}
+
+	atomic.AddInt64(&filesRemoved, removed)
+	atomic.AddInt64(&bytesReclaimed, reclaimed)
+	if removed > 0 {
+		log.Info("Removed leftover and corrupt files from previous run",
+			zap.Int64("filesRemoved", removed),
+			zap.Int64("bytesReclaimed", reclaimed))
+	}
+}
+
+func sweep(log *zap.Logger, target Target, now time.Time) (int64, int64) {
+	if target.MaxAge <= 0 {
+		return 0, 0
+	}
+	return walkTarget(log, target, func(path string, info fs.FileInfo) bool {
+		return now.Sub(info.ModTime()) >= target.MaxAge
+	})
+}
+
+// walkTarget removes every file of the target for which shouldRemove is true.
+func walkTarget(log *zap.Logger, target Target, shouldRemove func(path string, info fs.FileInfo) bool) (int64, int64) {
+	if target.Dir == "" {
+		return 0, 0
+	}
+	var removed, reclaimed int64
+	err := filepath.WalkDir(target.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if matched, _ := filepath.Match(target.Pattern, d.Name()); !matched {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !shouldRemove(path, info) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Warn("Failed to remove file", zap.String("target", target.Name), zap.String("file", path), zap.Error(err))
+			return nil
+		}
+		removed++
+		reclaimed += info.Size()
+		return nil
+	})
+	if err != nil {
+		log.Warn("Failed to sweep directory", zap.String("target", target.Name), zap.String("dir", target.Dir), zap.Error(err))
+	}
+	return removed, reclaimed
+}
@@ -0,0 +1,89 @@
+// Package opaqueid turns channel and message IDs into opaque link IDs, so
+// public URLs can't be enumerated by counting message IDs. The IDs are
+// encrypted with ID_OBFUSCATION_KEY and need no database to resolve.
+package opaqueid
+
+import (
+	"EverythingSuckz/fsb/config"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// encodedLen is the length of an opaque ID: one AES block in unpadded
+// base64url.
+const encodedLen = 22
+
+var ErrInvalidID = errors.New("invalid opaque ID")
+
+var (
+	blockOnce sync.Once
+	block     cipher.Block
+)
+
+// cipherBlock is the AES-256 cipher keyed by ID_OBFUSCATION_KEY, or nil when
+// obfuscation is off.
+func cipherBlock() cipher.Block {
+	blockOnce.Do(func() {
+		if config.ValueOf.IDObfuscationKey == "" {
+			return
+		}
+		key := sha256.Sum256([]byte(config.ValueOf.IDObfuscationKey))
+		block, _ = aes.NewCipher(key[:])
+	})
+	return block
+}
+
+// Enabled reports whether ID_OBFUSCATION_KEY is set.
+func Enabled() bool {
+	return cipherBlock() != nil
+}
+
+// Encode returns the opaque ID of a message of channelID. The channel and
+// message IDs fill 12 bytes of a single AES block and the rest stays zero,
+// which is checked on decoding. Encrypting one block is deterministic, so a
+// message always gets the same link.
+func Encode(channelID int64, messageID int) string {
+	var plain, sealed [aes.BlockSize]byte
+	binary.BigEndian.PutUint64(plain[0:8], uint64(channelID))
+	binary.BigEndian.PutUint32(plain[8:12], uint32(messageID))
+	cipherBlock().Encrypt(sealed[:], plain[:])
+	return base64.RawURLEncoding.EncodeToString(sealed[:])
+}
+
+// Decode resolves an opaque ID back to its channel and message IDs.
+func Decode(id string) (channelID int64, messageID int, err error) {
+	b := cipherBlock()
+	if b == nil || len(id) != encodedLen {
+		return 0, 0, ErrInvalidID
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil || len(sealed) != aes.BlockSize {
+		return 0, 0, ErrInvalidID
+	}
+	var plain [aes.BlockSize]byte
+	b.Decrypt(plain[:], sealed)
+	if binary.BigEndian.Uint32(plain[12:16]) != 0 {
+		return 0, 0, ErrInvalidID
+	}
+	channelID = int64(binary.BigEndian.Uint64(plain[0:8]))
+	messageID = int(binary.BigEndian.Uint32(plain[8:12]))
+	if messageID <= 0 {
+		return 0, 0, ErrInvalidID
+	}
+	return channelID, messageID, nil
+}
+
+// ID is how a message of channelID appears in links: its opaque ID when
+// obfuscation is on, its message ID otherwise.
+func ID(channelID int64, messageID int) string {
+	if !Enabled() {
+		return strconv.Itoa(messageID)
+	}
+	return Encode(channelID, messageID)
+}
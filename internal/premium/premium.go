@@ -0,0 +1,157 @@
+// Package premium keeps the roles users bought through Telegram Stars or
+// Stripe. Limits and gated content look the role up with Role.
+package premium
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Roles a user can have. Users without a grant are RoleFree.
+const (
+	RoleFree    = "free"
+	RolePremium = "premium"
+)
+
+// Sources of a grant.
+const (
+	SourceTelegramStars = "telegram_stars"
+	SourceStripe        = "stripe"
+	SourceInvite        = "invite"
+)
+
+var (
+	ErrNoDatabase       = errors.New("database not initialized")
+	ErrDuplicatePayment = errors.New("payment already applied")
+)
+
+// roleCacheTTL is how long Role trusts a looked up role. Media requests
+// look it up for their limits, which shouldn't cost a query each.
+const roleCacheTTL = time.Minute
+
+// Grant is the role of a user. User IDs are Telegram user IDs in decimal or
+// the Firebase UIDs of stream sessions, as the payment named them.
+type Grant struct {
+	UserID    string     `gorm:"primaryKey" json:"user_id"`
+	Role      string     `json:"role"`
+	Source    string     `json:"source"`
+	Reference string     `json:"reference"` // charge or checkout session ID
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func (Grant) TableName() string { return "user_roles" }
+
+// Payment is a payment that was applied, so one delivered again, as
+// webhooks are on retries, is recognized whatever came in between.
+type Payment struct {
+	Source    string `gorm:"primaryKey"`
+	Reference string `gorm:"primaryKey"`
+	UserID    string `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+func (Payment) TableName() string { return "premium_payments" }
+
+func init() {
+	database.RegisterModel(&Grant{})
+	database.RegisterModel(&Payment{})
+}
+
+type cachedRole struct {
+	role     string
+	cachedAt time.Time
+}
+
+var roles sync.Map // user ID -> cachedRole
+
+// Role returns the current role of userID, as looked up at most
+// roleCacheTTL ago.
+func Role(userID string) string {
+	if cached, ok := roles.Load(userID); ok && time.Since(cached.(cachedRole).cachedAt) < roleCacheTTL {
+		return cached.(cachedRole).role
+	}
+	role, _ := Lookup(userID)
+	roles.Store(userID, cachedRole{role: role, cachedAt: time.Now()})
+	return role
+}
+
+// IsPremium reports whether userID has the premium role.
+func IsPremium(userID string) bool {
+	return userID != "" && Role(userID) == RolePremium
+}
+
+// Lookup returns the current role of userID and until when it lasts, nil
+// for roles that don't expire.
+func Lookup(userID string) (string, *time.Time) {
+	if database.DB == nil || userID == "" {
+		return RoleFree, nil
+	}
+	var grant Grant
+	if err := database.DB.Limit(1).Find(&grant, "user_id = ?", userID).Error; err != nil || grant.UserID == "" {
+		return RoleFree, nil
+	}
+	if grant.ExpiresAt != nil && time.Now().After(*grant.ExpiresAt) {
+		return RoleFree, nil
+	}
+	return grant.Role, grant.ExpiresAt
+}
+
+// Add makes userID premium for PREMIUM_DAYS, on top of any time left, or
+// for good when PREMIUM_DAYS is 0. A payment delivered again only counts
+// once: it gets the current grant and ErrDuplicatePayment.
+func Add(userID, source, reference string) (*Grant, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	defer roles.Delete(userID)
+	var current Grant
+	var grant *Grant
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Limit(1).Find(&current, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		if reference != "" {
+			created := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&Payment{Source: source, Reference: reference, UserID: userID})
+			if created.Error != nil {
+				return created.Error
+			}
+			if created.RowsAffected == 0 {
+				return ErrDuplicatePayment
+			}
+		}
+		now := time.Now()
+		grant = &Grant{UserID: userID, Role: RolePremium, Source: source, Reference: reference, UpdatedAt: now}
+		if days := config.ValueOf.PremiumDays; days > 0 {
+			from := now
+			if current.Role == RolePremium && current.ExpiresAt != nil && current.ExpiresAt.After(now) {
+				from = *current.ExpiresAt
+			}
+			expiresAt := from.AddDate(0, 0, days)
+			grant.ExpiresAt = &expiresAt
+		}
+		return tx.Save(grant).Error
+	})
+	switch {
+	case errors.Is(err, ErrDuplicatePayment):
+		return &current, err
+	case err != nil:
+		return nil, err
+	}
+	return grant, nil
+}
+
+// Remove takes the role of userID back, e.g. when a subscription ends.
+func Remove(userID string) error {
+	if database.DB == nil {
+		return ErrNoDatabase
+	}
+	defer roles.Delete(userID)
+	return database.DB.Delete(&Grant{}, "user_id = ?", userID).Error
+}
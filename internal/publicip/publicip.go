@@ -0,0 +1,81 @@
+package publicip
+
+import (
+	"EverythingSuckz/fsb/config"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ChangeFunc is called after the public IP changed. host is the current HOST,
+// which follows the IP only when it was detected with USE_PUBLIC_IP.
+type ChangeFunc func(oldIP, newIP, host string)
+
+var (
+	subscribersMu sync.Mutex
+	subscribers   []ChangeFunc
+)
+
+// OnChange registers fn to run whenever the watcher sees a new public IP.
+func OnChange(fn ChangeFunc) {
+	subscribersMu.Lock()
+	defer subscribersMu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+// Start re-checks the public IP every PUBLIC_IP_CHECK_MINUTES, for home
+// servers whose ISP hands out dynamic addresses. A non-positive interval
+// disables it.
+func Start(log *zap.Logger) {
+	log = log.Named("PublicIP")
+	interval := time.Duration(config.ValueOf.PublicIPCheckMinutes) * time.Minute
+	if interval <= 0 {
+		return
+	}
+	log.Info("Public IP watcher started", zap.Duration("interval", interval))
+
+	go func() {
+		current := config.ValueOf.PublicIP()
+		if current == "" {
+			current = check(log, "")
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			current = check(log, current)
+		}
+	}()
+}
+
+// check fetches the public IP and notifies subscribers when it differs from
+// current. It returns the IP to compare against next time.
+func check(log *zap.Logger, current string) string {
+	ip, err := config.FetchPublicIP(config.ValueOf.PublicIPProviders, config.ValueOf.BindIPv6)
+	if err != nil {
+		log.Warn("Failed to fetch public IP", zap.Error(err))
+		return current
+	}
+	if ip == current {
+		return current
+	}
+
+	host, hostChanged := config.ValueOf.UpdatePublicIP(ip)
+	if current == "" {
+		log.Info("Public IP detected", zap.String("ip", ip))
+		return ip
+	}
+	log.Info("Public IP changed",
+		zap.String("old", current),
+		zap.String("new", ip),
+		zap.Bool("hostUpdated", hostChanged),
+		zap.String("host", host))
+
+	subscribersMu.Lock()
+	notify := append([]ChangeFunc{}, subscribers...)
+	subscribersMu.Unlock()
+	for _, fn := range notify {
+		fn(current, ip, host)
+	}
+	return ip
+}
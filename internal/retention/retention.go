@@ -0,0 +1,141 @@
+// Package retention records the messages deleted by retention policies, so
+// their links can answer 410 Gone instead of looking broken.
+package retention
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm/clause"
+)
+
+// Tombstone is a channel message deleted by a retention policy.
+type Tombstone struct {
+	ChannelID int64     `gorm:"primaryKey;autoIncrement:false" json:"channel_id"`
+	MessageID int       `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	FileName  string    `json:"file_name"`
+	Size      int64     `json:"size"`
+	PostedAt  time.Time `json:"posted_at"`
+	DeletedAt time.Time `gorm:"index" json:"deleted_at"`
+}
+
+// Cursor is how far the retention job has scanned a channel, so each run
+// picks up after the messages it already went through.
+type Cursor struct {
+	ChannelID     int64 `gorm:"primaryKey;autoIncrement:false"`
+	LastMessageID int
+}
+
+func (Cursor) TableName() string { return "retention_cursors" }
+
+func init() {
+	database.RegisterModel(&Tombstone{})
+	database.RegisterModel(&Cursor{})
+}
+
+type messageKey struct {
+	channelID int64
+	messageID int
+}
+
+// Only the keys are kept in memory, so links can be checked without a query.
+var (
+	goneMu sync.RWMutex
+	gone   = make(map[messageKey]time.Time)
+)
+
+// Load reads the recorded tombstones. It must run after database.Init.
+func Load(log *zap.Logger) {
+	if database.DB == nil {
+		return
+	}
+	var rows []Tombstone
+	if err := database.DB.Select("channel_id", "message_id", "deleted_at").Find(&rows).Error; err != nil {
+		log.Named("Retention").Error("Failed to load tombstones", zap.Error(err))
+		return
+	}
+	goneMu.Lock()
+	defer goneMu.Unlock()
+	for _, row := range rows {
+		gone[messageKey{row.ChannelID, row.MessageID}] = row.DeletedAt
+	}
+}
+
+// Gone reports whether a message was deleted by a retention policy, and when.
+func Gone(channelID int64, messageID int) (time.Time, bool) {
+	goneMu.RLock()
+	defer goneMu.RUnlock()
+	deletedAt, ok := gone[messageKey{channelID, messageID}]
+	return deletedAt, ok
+}
+
+// Record stores tombstones for deleted messages.
+func Record(tombstones []Tombstone) error {
+	if len(tombstones) == 0 {
+		return nil
+	}
+	goneMu.Lock()
+	for _, t := range tombstones {
+		gone[messageKey{t.ChannelID, t.MessageID}] = t.DeletedAt
+	}
+	goneMu.Unlock()
+	if database.DB == nil {
+		return nil
+	}
+	return database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&tombstones).Error
+}
+
+// LastScanned returns the last message ID of channelID the job went through.
+func LastScanned(channelID int64) int {
+	if database.DB == nil {
+		return 0
+	}
+	var cursor Cursor
+	database.DB.Limit(1).Find(&cursor, "channel_id = ?", channelID)
+	return cursor.LastMessageID
+}
+
+// SetLastScanned moves the scan cursor of channelID.
+func SetLastScanned(channelID int64, messageID int) error {
+	if database.DB == nil {
+		return nil
+	}
+	return database.DB.Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&Cursor{ChannelID: channelID, LastMessageID: messageID}).Error
+}
+
+// ChannelTotal is what retention has reclaimed in one channel.
+type ChannelTotal struct {
+	ChannelID     int64     `json:"channel_id"`
+	Messages      int64     `json:"messages"`
+	Bytes         int64     `json:"bytes"`
+	LastDeletedAt time.Time `json:"last_deleted_at"`
+}
+
+// Totals sums the tombstones per channel.
+func Totals() ([]ChannelTotal, error) {
+	var rows []struct {
+		ChannelID     int64
+		Messages      int64
+		Bytes         int64
+		LastDeletedAt string
+	}
+	err := database.DB.Model(&Tombstone{}).
+		Select("channel_id, COUNT(*) AS messages, COALESCE(SUM(size), 0) AS bytes, MAX(deleted_at) AS last_deleted_at").
+		Group("channel_id").
+		Order("channel_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	totals := make([]ChannelTotal, 0, len(rows))
+	for _, row := range rows {
+		total := ChannelTotal{ChannelID: row.ChannelID, Messages: row.Messages, Bytes: row.Bytes}
+		// SQLite hands MAX() back as text
+		total.LastDeletedAt, _ = time.Parse("2006-01-02 15:04:05.999999999-07:00", row.LastDeletedAt)
+		totals = append(totals, total)
+	}
+	return totals, nil
+}
@@ -0,0 +1,291 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// What happens to flagged IPs, see ABUSE_ACTION.
+const (
+	abuseActionOff      = "off"
+	abuseActionLog      = "log"
+	abuseActionThrottle = "throttle"
+	abuseActionBan      = "ban"
+)
+
+// Reasons an IP was flagged, as labelled in the metrics.
+const (
+	abuseNotFound   = "not_found"
+	abuseSequential = "sequential"
+	abuseManyFiles  = "many_files"
+)
+
+var (
+	// abuseFlagged counts flagged IPs by reason.
+	abuseFlagged = map[string]*int64{
+		abuseNotFound:   new(int64),
+		abuseSequential: new(int64),
+		abuseManyFiles:  new(int64),
+	}
+	// abuseRejected counts requests refused by action.
+	abuseRejected = map[string]*int64{
+		abuseActionThrottle: new(int64),
+		abuseActionBan:      new(int64),
+	}
+)
+
+// abuseTracker watches the media requests of every IP for scraping patterns:
+// many 404s, walking message IDs one by one and opening too many files.
+var abuseTracker = struct {
+	mu        sync.Mutex
+	clients   map[string]*abuseClient
+	lastSweep time.Time
+}{clients: make(map[string]*abuseClient)}
+
+type abuseClient struct {
+	windowStart time.Time
+	lastSeen    time.Time
+	notFound    int
+	files       map[string]struct{}
+	lastChannel string
+	lastID      int
+	run         int // consecutive message IDs requested in a row
+
+	reason       string
+	detail       string
+	flaggedAt    time.Time
+	penaltyUntil time.Time
+	lastAllowed  time.Time // last request let through while throttled
+}
+
+// abuseGuardMiddleware refuses requests of penalized IPs and, once the
+// request is served, looks at its outcome. It goes after the auth and rate
+// limit middlewares.
+func abuseGuardMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		action := config.Live().AbuseAction
+		if action == abuseActionOff || ctx.GetString(authMethodKey) == internalAuthMethod {
+			ctx.Next()
+			return
+		}
+		// Premium users paid and are known by name, they are only reported
+		if isPremium(ctx) {
+			action = abuseActionLog
+		}
+		ip := ctx.ClientIP()
+		now := time.Now()
+
+		abuseTracker.mu.Lock()
+		client := abuseClientFor(ip, now)
+		rejected := ""
+		var retryAfter time.Duration
+		if now.Before(client.penaltyUntil) {
+			switch action {
+			case abuseActionBan:
+				rejected = abuseActionBan
+				retryAfter = client.penaltyUntil.Sub(now)
+			case abuseActionThrottle:
+				interval := time.Minute / time.Duration(config.Live().AbuseThrottlePerMinute)
+				if wait := client.lastAllowed.Add(interval).Sub(now); wait > 0 {
+					rejected = abuseActionThrottle
+					retryAfter = wait
+				} else {
+					client.lastAllowed = now
+				}
+			}
+		}
+		abuseTracker.mu.Unlock()
+
+		if rejected != "" {
+			atomic.AddInt64(abuseRejected[rejected], 1)
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			if rejected == abuseActionBan {
+				ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"error": errorText(ctx, "error.abuse_banned"),
+				})
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": errorText(ctx, "error.abuse_throttled"),
+			})
+			return
+		}
+
+		ctx.Next()
+
+		messageID, _ := strconv.Atoi(ctx.Param("messageID"))
+		status := ctx.Writer.Status()
+		now = time.Now()
+		abuseTracker.mu.Lock()
+		flagged := false
+		if client.observe(now, ctx.Param("channelAlias"), messageID, status) && !now.Before(client.penaltyUntil) {
+			client.flaggedAt = now
+			client.penaltyUntil = now.Add(time.Duration(config.Live().AbusePenaltySeconds) * time.Second)
+			client.lastAllowed = now
+			flagged = true
+		}
+		reason, detail, until := client.reason, client.detail, client.penaltyUntil
+		abuseTracker.mu.Unlock()
+
+		if flagged {
+			atomic.AddInt64(abuseFlagged[reason], 1)
+			logger.Warn("Suspicious activity detected",
+				zap.String("clientIP", ip),
+				zap.String("reason", reason),
+				zap.String("detail", detail),
+				zap.String("action", action),
+				zap.Time("until", until))
+			go alertAbuse(logger, ip, detail, action, until)
+		}
+	}
+}
+
+// abuseClientFor returns the tracked state of ip, dropping idle clients
+// now and then. abuseTracker.mu must be held.
+func abuseClientFor(ip string, now time.Time) *abuseClient {
+	window := time.Duration(config.Live().AbuseWindowSeconds) * time.Second
+	if now.Sub(abuseTracker.lastSweep) > window {
+		for key, c := range abuseTracker.clients {
+			if now.Sub(c.lastSeen) > window && now.After(c.penaltyUntil) {
+				delete(abuseTracker.clients, key)
+			}
+		}
+		abuseTracker.lastSweep = now
+	}
+	client := abuseTracker.clients[ip]
+	if client == nil {
+		client = &abuseClient{windowStart: now}
+		abuseTracker.clients[ip] = client
+	}
+	client.lastSeen = now
+	return client
+}
+
+// observe adds a served request and reports whether it crossed a threshold.
+// abuseTracker.mu must be held.
+func (c *abuseClient) observe(now time.Time, channel string, messageID, status int) bool {
+	if now.Sub(c.windowStart) > time.Duration(config.Live().AbuseWindowSeconds)*time.Second {
+		c.resetWindow(now)
+	}
+	if status == http.StatusNotFound || status == http.StatusGone {
+		c.notFound++
+	}
+	if messageID > 0 {
+		if config.Live().AbuseMaxFiles > 0 {
+			if c.files == nil {
+				c.files = make(map[string]struct{})
+			}
+			c.files[channel+":"+strconv.Itoa(messageID)] = struct{}{}
+		}
+		// Range requests for the same file keep the run going
+		switch {
+		case channel == c.lastChannel && (messageID == c.lastID+1 || messageID == c.lastID-1):
+			c.run++
+		case channel != c.lastChannel || messageID != c.lastID:
+			c.run = 1
+		}
+		c.lastChannel, c.lastID = channel, messageID
+	}
+
+	reason, detail := "", ""
+	switch {
+	case config.Live().AbuseMaxNotFound > 0 && c.notFound >= config.Live().AbuseMaxNotFound:
+		reason, detail = abuseNotFound, fmt.Sprintf("%d not found responses", c.notFound)
+	case config.Live().AbuseMaxSequential > 0 && c.run >= config.Live().AbuseMaxSequential:
+		reason, detail = abuseSequential, fmt.Sprintf("%d consecutive message IDs", c.run)
+	case config.Live().AbuseMaxFiles > 0 && len(c.files) >= config.Live().AbuseMaxFiles:
+		reason, detail = abuseManyFiles, fmt.Sprintf("%d distinct files", len(c.files))
+	default:
+		return false
+	}
+	c.reason, c.detail = reason, detail
+	// Start over so the client isn't flagged again right after its penalty
+	c.resetWindow(now)
+	c.run = 0
+	return true
+}
+
+func (c *abuseClient) resetWindow(now time.Time) {
+	c.windowStart = now
+	c.notFound = 0
+	c.files = nil
+}
+
+func alertAbuse(logger *zap.Logger, ip, detail, action string, until time.Time) {
+	text := fmt.Sprintf("🚨 Possible scraping from %s: %s within %ds.", ip, detail, config.Live().AbuseWindowSeconds)
+	switch action {
+	case abuseActionThrottle:
+		text += fmt.Sprintf("\nThrottled to %d requests per minute until %s.",
+			config.Live().AbuseThrottlePerMinute, until.UTC().Format(time.RFC3339))
+	case abuseActionBan:
+		text += fmt.Sprintf("\nBanned until %s.", until.UTC().Format(time.RFC3339))
+	}
+	if err := bot.NotifyAdmins(text); err != nil {
+		logger.Warn("Failed to report suspicious activity", zap.Error(err))
+	}
+}
+
+// abuseOffender is a flagged IP as listed by the admin API.
+type abuseOffender struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail"`
+	FlaggedAt time.Time `json:"flagged_at"`
+	Until     time.Time `json:"until"`
+}
+
+// listAbuseRoute lists the IPs whose penalty is still running.
+func listAbuseRoute(ctx *gin.Context) {
+	now := time.Now()
+	offenders := []abuseOffender{}
+	abuseTracker.mu.Lock()
+	for ip, c := range abuseTracker.clients {
+		if now.Before(c.penaltyUntil) {
+			offenders = append(offenders, abuseOffender{
+				IP:        ip,
+				Reason:    c.reason,
+				Detail:    c.detail,
+				FlaggedAt: c.flaggedAt,
+				Until:     c.penaltyUntil,
+			})
+		}
+	}
+	abuseTracker.mu.Unlock()
+	sort.Slice(offenders, func(i, j int) bool { return offenders[i].FlaggedAt.After(offenders[j].FlaggedAt) })
+	ctx.JSON(http.StatusOK, gin.H{
+		"action":    config.Live().AbuseAction,
+		"offenders": offenders,
+	})
+}
+
+// pardonAbuseRoute lifts the penalty of an IP and forgets what it did.
+func pardonAbuseRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		ip := ctx.Param("ip")
+		abuseTracker.mu.Lock()
+		_, ok := abuseTracker.clients[ip]
+		delete(abuseTracker.clients, ip)
+		abuseTracker.mu.Unlock()
+		if !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "IP not tracked",
+			})
+			return
+		}
+		logger.Info("Pardoned IP", zap.String("ip", ip), zap.String("by", ctx.ClientIP()))
+		ctx.Status(http.StatusNoContent)
+	}
+}
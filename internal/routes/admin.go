@@ -0,0 +1,340 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/backup"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/flags"
+	"EverythingSuckz/fsb/internal/trash"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LoadAdmin registers the /admin API. It is only available when ADMIN_TOKEN
+// or ADMIN_TOKENS is set. Each route names the role it needs; see
+// config.AdminRoleAllows.
+func (e *allRoutes) LoadAdmin(r *Route) {
+	if !config.ValueOf.AdminEnabled() {
+		return
+	}
+	adminLog := e.log.Named("Admin")
+	defer adminLog.Info("Loaded admin routes")
+	admin := r.Router.Group("/admin")
+	admin.DELETE("/files/:messageID", adminAuth(config.AdminRoleFull), deleteFileRoute(adminLog))
+	admin.GET("/trash", adminAuth(config.AdminRoleMetrics), getTrashRoute(adminLog))
+	admin.POST("/trash/:messageID/restore", adminAuth(config.AdminRoleFull), restoreFileRoute(adminLog))
+	admin.POST("/backup", adminAuth(config.AdminRoleFull), backupRoute(adminLog))
+	admin.GET("/flags", adminAuth(config.AdminRoleMetrics), listFlagsRoute)
+	admin.PUT("/flags/:name", adminAuth(config.AdminRoleFull), setFlagRoute(adminLog))
+	admin.DELETE("/flags/:name", adminAuth(config.AdminRoleFull), resetFlagRoute(adminLog))
+	admin.DELETE("/cache/:messageID", adminAuth(config.AdminRoleCache), purgeCacheRoute(adminLog))
+	admin.GET("/selftest", adminAuth(config.AdminRoleWorkers), selftestRoute(adminLog))
+	admin.GET("/opaque-ids/:messageID", adminAuth(config.AdminRoleMetrics), opaqueIDRoute)
+	admin.GET("/abuse", adminAuth(config.AdminRoleMetrics), listAbuseRoute)
+	admin.DELETE("/abuse/:ip", adminAuth(config.AdminRoleFull), pardonAbuseRoute(adminLog))
+	admin.POST("/reload", adminAuth(config.AdminRoleFull), reloadConfigRoute(adminLog))
+	registerBlocklistRoutes(admin, adminLog)
+	registerInviteRoutes(admin, adminLog)
+	registerWorkerRoutes(admin, adminLog)
+	r.Router.GET("/api/routes", adminAuth(config.AdminRoleMetrics), listRoutesRoute)
+}
+
+// adminAuth requires "Authorization: Bearer <token>" with a token whose role
+// allows needs.
+func adminAuth(needs string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, _ := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		role := config.ValueOf.AdminRole(token)
+		if role == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid admin token",
+			})
+			return
+		}
+		if !config.AdminRoleAllows(role, needs) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "admin token lacks the " + needs + " role",
+			})
+			return
+		}
+		ctx.Next()
+	}
+}
+
+func adminMessageID(ctx *gin.Context) (int, bool) {
+	messageID, err := strconv.Atoi(ctx.Param("messageID"))
+	if err != nil || messageID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid message ID",
+		})
+		return 0, false
+	}
+	return messageID, true
+}
+
+// deleteFileRoute deletes a file of MEDIA_CHANNEL_ID, through the trash
+// channel when one is configured.
+func deleteFileRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := adminMessageID(ctx)
+		if !ok {
+			return
+		}
+		if config.ValueOf.MediaChannelID == 0 {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "MEDIA_CHANNEL_ID not configured",
+			})
+			return
+		}
+		entry, err := trash.Delete(ctx, messageID, ctx.ClientIP())
+		switch {
+		case errors.Is(err, trash.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "file not found",
+			})
+			return
+		case errors.Is(err, trash.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to delete file", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to delete file from Telegram",
+			})
+			return
+		}
+		if entry == nil {
+			logger.Info("File deleted permanently", zap.Int("messageID", messageID))
+			ctx.JSON(http.StatusOK, gin.H{
+				"message_id": messageID,
+				"trashed":    false,
+			})
+			return
+		}
+		logger.Info("File moved to trash",
+			zap.Int("messageID", messageID),
+			zap.Int("trashMessageID", entry.TrashMessageID),
+			zap.Time("purgeAt", entry.PurgeAt))
+		ctx.JSON(http.StatusOK, gin.H{
+			"message_id": messageID,
+			"trashed":    true,
+			"purge_at":   entry.PurgeAt,
+		})
+	}
+}
+
+func getTrashRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		entries, err := trash.List()
+		if err != nil {
+			if errors.Is(err, trash.ErrNoDatabase) {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "database not initialized",
+				})
+				return
+			}
+			logger.Error("Failed to list trash", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list trash",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"items": entries,
+		})
+	}
+}
+
+func restoreFileRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := adminMessageID(ctx)
+		if !ok {
+			return
+		}
+		entry, err := trash.Restore(ctx, messageID)
+		switch {
+		case errors.Is(err, trash.ErrNotInTrash):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "file is not in the trash",
+			})
+			return
+		case errors.Is(err, trash.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to restore file", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to restore file in Telegram",
+			})
+			return
+		}
+		logger.Info("File restored from trash",
+			zap.Int("messageID", messageID),
+			zap.Int("newMessageID", entry.RestoredAs))
+		ctx.JSON(http.StatusOK, gin.H{
+			"message_id":     messageID,
+			"new_message_id": entry.RestoredAs,
+			"link":           requestLinkBase(ctx.Request) + "/direct/" + strconv.Itoa(entry.RestoredAs),
+		})
+	}
+}
+
+// purgeCacheRoute drops the cached metadata of a MEDIA_CHANNEL_ID file, for
+// every worker, so the next request reads it from Telegram again.
+func purgeCacheRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := adminMessageID(ctx)
+		if !ok {
+			return
+		}
+		for _, w := range bot.Snapshot() {
+			if err := utils.ForgetFileMetadata(config.ValueOf.MediaChannelID, messageID, w.Self.ID); err != nil {
+				logger.Error("Failed to purge cached metadata", zap.Int("messageID", messageID), zap.Error(err))
+				ctx.JSON(http.StatusBadGateway, gin.H{
+					"error": "failed to purge cache",
+				})
+				return
+			}
+		}
+		logger.Info("Cached metadata purged", zap.Int("messageID", messageID))
+		ctx.JSON(http.StatusOK, gin.H{
+			"message_id": messageID,
+			"purged":     true,
+		})
+	}
+}
+
+// backupRoute takes a backup right away instead of waiting for the schedule.
+func backupRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		res, err := backup.Run(ctx)
+		switch {
+		case errors.Is(err, backup.ErrDisabled):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "backups are not configured",
+			})
+			return
+		case err != nil:
+			logger.Error("Backup failed", zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to post backup",
+			})
+			return
+		}
+		logger.Info("Backup posted",
+			zap.Int("messageID", res.MessageID),
+			zap.Int("sessionFiles", res.SessionFiles))
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+func listFlagsRoute(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"flags": flags.List(),
+	})
+}
+
+type setFlagRequest struct {
+	Enabled *bool `json:"enabled"`
+	Percent *int  `json:"percent"`
+}
+
+// setFlagRoute rolls a feature flag out to a share of requests, either with
+// {"percent": 25} or {"enabled": true}.
+func setFlagRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		var req setFlagRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || (req.Enabled == nil) == (req.Percent == nil) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": `send either {"enabled": bool} or {"percent": 0-100}`,
+			})
+			return
+		}
+		percent := 0
+		switch {
+		case req.Percent != nil:
+			percent = *req.Percent
+		case *req.Enabled:
+			percent = 100
+		}
+		if percent < 0 || percent > 100 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "percent must be between 0 and 100",
+			})
+			return
+		}
+		flag, err := flags.Set(ctx.Param("name"), percent, ctx.ClientIP())
+		if !respondFlag(ctx, logger, flag, err) {
+			return
+		}
+		logger.Info("Feature flag changed", zap.String("flag", flag.Name), zap.Int("percent", flag.Percent))
+	}
+}
+
+// resetFlagRoute drops the runtime override of a feature flag.
+func resetFlagRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		flag, err := flags.Reset(ctx.Param("name"))
+		if !respondFlag(ctx, logger, flag, err) {
+			return
+		}
+		logger.Info("Feature flag reset", zap.String("flag", flag.Name), zap.Int("percent", flag.Percent))
+	}
+}
+
+func respondFlag(ctx *gin.Context, logger *zap.Logger, flag flags.Flag, err error) bool {
+	switch {
+	case errors.Is(err, flags.ErrUnknownFlag):
+		ctx.JSON(http.StatusNotFound, gin.H{
+			"error": "unknown feature flag",
+		})
+		return false
+	case err != nil:
+		logger.Error("Failed to store feature flag", zap.String("flag", ctx.Param("name")), zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to store feature flag",
+		})
+		return false
+	}
+	ctx.JSON(http.StatusOK, flag)
+	return true
+}
+
+// reloadConfigRoute applies the reloadable settings of fsb.env and the config
+// file without a restart, like SIGHUP does.
+func reloadConfigRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		changed, err := config.Reload(logger)
+		if err != nil {
+			logger.Warn("Failed to reload config", zap.Error(err))
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if changed == nil {
+			changed = []string{}
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"changed": changed,
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/invites"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// registerInviteRoutes lists, creates and revokes invite codes.
+func registerInviteRoutes(admin *gin.RouterGroup, logger *zap.Logger) {
+	admin.GET("/invites", adminAuth(config.AdminRoleMetrics), listInvitesRoute(logger))
+	admin.POST("/invites", adminAuth(config.AdminRoleFull), createInviteRoute(logger))
+	admin.DELETE("/invites/:code", adminAuth(config.AdminRoleFull), revokeInviteRoute(logger))
+}
+
+type createInviteRequest struct {
+	MaxUses        int    `json:"max_uses"`         // 0 is unlimited
+	ExpiresInHours int    `json:"expires_in_hours"` // 0 never expires
+	Role           string `json:"role"`             // "" or premium
+}
+
+func createInviteRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		var req createInviteRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.MaxUses < 0 || req.ExpiresInHours < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": `send {"max_uses": <n>, "expires_in_hours": <n>, "role": "" | "premium"}`,
+			})
+			return
+		}
+		ttl := time.Duration(req.ExpiresInHours) * time.Hour
+		invite, err := invites.Create(req.Role, req.MaxUses, ttl, "admin:"+ctx.ClientIP())
+		switch {
+		case errors.Is(err, invites.ErrUnknownRole):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case errors.Is(err, invites.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to create invite", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to create invite",
+			})
+			return
+		}
+		logger.Info("Invite created",
+			zap.String("clientIP", ctx.ClientIP()),
+			zap.Int("maxUses", invite.MaxUses),
+			zap.String("role", invite.Role))
+		ctx.JSON(http.StatusCreated, invite)
+	}
+}
+
+func listInvitesRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		list, err := invites.List()
+		if err != nil {
+			if errors.Is(err, invites.ErrNoDatabase) {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "database not initialized",
+				})
+				return
+			}
+			logger.Error("Failed to list invites", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list invites",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"invites": list,
+		})
+	}
+}
+
+// revokeInviteRoute deletes a code; users who already redeemed it keep access.
+func revokeInviteRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		err := invites.Revoke(ctx.Param("code"))
+		switch {
+		case errors.Is(err, invites.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "invite not found",
+			})
+			return
+		case errors.Is(err, invites.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to revoke invite", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to revoke invite",
+			})
+			return
+		}
+		logger.Info("Invite revoked", zap.String("clientIP", ctx.ClientIP()))
+		ctx.Status(http.StatusNoContent)
+	}
+}
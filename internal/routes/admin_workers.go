@@ -0,0 +1,174 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loadWorkerAdmin serves the worker routes of the admin API on the status
+// server too, which is usually kept off the public internet.
+func loadWorkerAdmin(log *zap.Logger, r *Route) {
+	if !config.ValueOf.AdminEnabled() {
+		return
+	}
+	workersLog := log.Named("Admin")
+	defer workersLog.Info("Loaded worker admin routes")
+	registerWorkerRoutes(r.Router.Group("/admin"), workersLog)
+}
+
+// registerWorkerRoutes lists, adds, drains and removes workers at runtime.
+func registerWorkerRoutes(admin *gin.RouterGroup, logger *zap.Logger) {
+	admin.GET("/workers", adminAuth(config.AdminRoleMetrics), listWorkersRoute)
+	admin.POST("/workers", adminAuth(config.AdminRoleWorkers), addWorkerRoute(logger))
+	admin.POST("/workers/:id/drain", adminAuth(config.AdminRoleWorkers), drainWorkerRoute(logger))
+	admin.DELETE("/workers/:id", adminAuth(config.AdminRoleWorkers), drainWorkerRoute(logger))
+}
+
+// adminWorker is a worker as listed by the admin API.
+type adminWorker struct {
+	ID             int    `json:"id"`
+	Username       string `json:"username"`
+	Draining       bool   `json:"draining"`
+	Healthy        bool   `json:"healthy"`
+	ActiveRequests int32  `json:"active_requests"`
+	// channels the worker turned out not to be a member of
+	LockedChannels []int64 `json:"locked_channels,omitempty"`
+	// access to each source channel, see ACCESS_CHECK_MINUTES
+	Channels []ChannelStatus `json:"channels"`
+}
+
+// ChannelStatus is a worker's access to a source channel; channels not
+// checked yet are left out.
+type ChannelStatus struct {
+	ChannelID int64     `json:"channel_id"`
+	Readable  bool      `json:"readable"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func newAdminWorker(w *bot.Worker) adminWorker {
+	return adminWorker{
+		ID:             w.ID,
+		Username:       w.Self.Username,
+		Draining:       w.Draining(),
+		Healthy:        w.Healthy(),
+		ActiveRequests: w.GetActiveRequests(),
+		LockedChannels: w.LockedChannels(),
+		Channels:       channelStatuses(w),
+	}
+}
+
+func channelStatuses(worker *bot.Worker) []ChannelStatus {
+	access := worker.ChannelAccess()
+	statuses := make([]ChannelStatus, 0, len(access))
+	for _, a := range access {
+		statuses = append(statuses, ChannelStatus{
+			ChannelID: a.ChannelID,
+			Readable:  a.Readable,
+			CheckedAt: a.CheckedAt,
+			Error:     a.Error,
+		})
+	}
+	return statuses
+}
+
+func listWorkersRoute(ctx *gin.Context) {
+	snapshot := bot.Snapshot()
+	workers := make([]adminWorker, 0, len(snapshot))
+	for _, w := range snapshot {
+		workers = append(workers, newAdminWorker(w))
+	}
+	ctx.JSON(http.StatusOK, gin.H{
+		"workers": workers,
+	})
+}
+
+// drainWorkerRoute stops routing requests to a worker and removes it once
+// its streams are done. It answers right away; GET /admin/workers shows the
+// progress. DELETE /admin/workers/<id> is the same, there is no removal that
+// cuts streams off.
+func drainWorkerRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		id, err := strconv.Atoi(ctx.Param("id"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid worker ID",
+			})
+			return
+		}
+		worker, err := bot.DrainWorker(logger, id)
+		switch {
+		case errors.Is(err, bot.ErrUnknownWorker):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case errors.Is(err, bot.ErrPinnedWorker), errors.Is(err, bot.ErrAlreadyDraining):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case err != nil:
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		ctx.JSON(http.StatusAccepted, newAdminWorker(worker))
+	}
+}
+
+type addWorkerRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// addWorkerRoute starts a worker for a new bot token, typically the
+// replacement of a drained one.
+func addWorkerRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		var req addWorkerRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": `send {"token": "<bot token>"}`,
+			})
+			return
+		}
+		timeout := time.Duration(config.ValueOf.WorkerStartTimeoutSeconds) * time.Second
+		if timeout <= 0 {
+			timeout = 120 * time.Second
+		}
+		startCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		worker, err := bot.AddWorker(startCtx, req.Token)
+		switch {
+		case errors.Is(err, bot.ErrInvalidBotToken):
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case errors.Is(err, bot.ErrDuplicateWorker):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to add worker", zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to start worker",
+			})
+			return
+		}
+		logger.Info("Worker added", zap.Int("workerID", worker.ID), zap.String("username", worker.Self.Username))
+		ctx.JSON(http.StatusCreated, newAdminWorker(worker))
+	}
+}
@@ -0,0 +1,334 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/stats"
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	maxPlaybackEventsPerRequest = 50
+	maxPlaybackBodyBytes        = 64 * 1024
+)
+
+// playbackEventRequest is what players post, alone or as an array.
+type playbackEventRequest struct {
+	SessionID string  `json:"session_id"`
+	MessageID int     `json:"message_id"`
+	Event     string  `json:"event"`
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Error     string  `json:"error"`
+}
+
+// LoadPlaybackAnalytics registers the endpoint players report events to.
+func (e *allRoutes) LoadPlaybackAnalytics(r *Route) {
+	analyticsLog := e.log.Named("Analytics")
+	defer analyticsLog.Info("Loaded playback analytics route")
+	r.Router.POST("/api/analytics/playback", e.mediaAuth, getPlaybackEventsRoute(analyticsLog))
+	r.Router.POST("/api/analytics/open", e.mediaAuth, linkOpenBeaconRoute)
+}
+
+// linkOpenBeaconRequest is what pages send, typically with
+// navigator.sendBeacon, when a link is clicked before playback starts.
+type linkOpenBeaconRequest struct {
+	MessageID int    `json:"message_id"`
+	Channel   string `json:"channel"`  // a MEDIA_CHANNELS alias; MEDIA_CHANNEL_ID when empty
+	Referrer  string `json:"referrer"` // the page's document.referrer
+}
+
+// linkOpenBeaconRoute counts a link open reported by a page. Beacons can't
+// set headers, so media auth usually comes in the query string.
+func linkOpenBeaconRoute(ctx *gin.Context) {
+	var req linkOpenBeaconRequest
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxPlaybackBodyBytes))
+	if err == nil {
+		err = json.Unmarshal(body, &req)
+	}
+	if err != nil || req.MessageID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "expected a JSON body with a message_id",
+		})
+		return
+	}
+	channelID := config.ValueOf.MediaChannelID
+	if req.Channel != "" {
+		channel, ok := config.ValueOf.MediaChannelFor(req.Channel)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "unknown channel",
+			})
+			return
+		}
+		channelID = channel.ID
+	}
+	referrer := req.Referrer
+	if referrer == "" {
+		referrer = ctx.Request.Referer()
+	}
+	stats.RecordOpen(stats.Open{
+		ChannelID: channelID,
+		MessageID: req.MessageID,
+		Referrer:  truncate(referrer, 2048),
+		UserAgent: ctx.Request.UserAgent(),
+	})
+	ctx.Status(http.StatusNoContent)
+}
+
+func getPlaybackEventsRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if database.DB == nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxPlaybackBodyBytes+1))
+		if err != nil || len(body) > maxPlaybackBodyBytes {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "request body too large",
+			})
+			return
+		}
+		var requests []playbackEventRequest
+		body = bytes.TrimSpace(body)
+		if len(body) > 0 && body[0] == '[' {
+			err = json.Unmarshal(body, &requests)
+		} else {
+			var single playbackEventRequest
+			err = json.Unmarshal(body, &single)
+			requests = append(requests, single)
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid JSON body",
+			})
+			return
+		}
+		if len(requests) == 0 || len(requests) > maxPlaybackEventsPerRequest {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "expected between 1 and 50 events",
+			})
+			return
+		}
+
+		session, _ := streamSessionFrom(ctx)
+		now := time.Now()
+		events := make([]stats.PlaybackEvent, 0, len(requests))
+		for _, req := range requests {
+			if req.MessageID <= 0 || !stats.IsPlaybackEvent(req.Event) ||
+				!validPlaybackSeconds(req.Position) || !validPlaybackSeconds(req.Duration) {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "each event needs a message_id, a known event type and non-negative position",
+				})
+				return
+			}
+			events = append(events, stats.PlaybackEvent{
+				CreatedAt: now,
+				UserID:    session.UserID,
+				SessionID: truncate(req.SessionID, 64),
+				MessageID: req.MessageID,
+				Event:     req.Event,
+				Position:  req.Position,
+				Duration:  req.Duration,
+				Error:     truncate(req.Error, 500),
+			})
+		}
+
+		if err := stats.RecordPlayback(events); err != nil {
+			logger.Error("Failed to record playback events", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to record playback events",
+			})
+			return
+		}
+		ctx.JSON(http.StatusAccepted, gin.H{
+			"accepted": len(events),
+		})
+	}
+}
+
+func validPlaybackSeconds(value float64) bool {
+	return value >= 0 && !math.IsInf(value, 0) && !math.IsNaN(value)
+}
+
+// truncate cuts value to at most max bytes, backing up to a rune boundary
+// so no character is split.
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
+// validStatsDays answers the error of a stats query that can't run: 503
+// without a database, 400 when from or to isn't a YYYY-MM-DD day. Empty days
+// are left open.
+func validStatsDays(ctx *gin.Context, from, to string) bool {
+	if database.DB == nil {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "database not initialized",
+		})
+		return false
+	}
+	for _, day := range []string{from, to} {
+		if day == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "from/to must be formatted as YYYY-MM-DD",
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// loadPlaybackStats registers the per-file playback report on the status server.
+func loadPlaybackStats(log *zap.Logger, r *Route) {
+	playbackLog := log.Named("Playback")
+	defer playbackLog.Info("Loaded playback stats route")
+	r.Router.GET("/api/stats/playback", func(ctx *gin.Context) {
+		from := ctx.Query("from")
+		to := ctx.Query("to")
+		if !validStatsDays(ctx, from, to) {
+			return
+		}
+
+		rows, err := stats.QueryPlayback(from, to)
+		if err != nil {
+			playbackLog.Error("Failed to query playback events", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to query playback events",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"from":  from,
+			"to":    to,
+			"files": rows,
+		})
+	})
+}
+
+// loadReferrerStats registers the report of where link opens come from on
+// the status server.
+func loadReferrerStats(log *zap.Logger, r *Route) {
+	referrerLog := log.Named("Referrers")
+	defer referrerLog.Info("Loaded referrer stats route")
+	r.Router.GET("/api/stats/referrers", func(ctx *gin.Context) {
+		from := ctx.Query("from")
+		to := ctx.Query("to")
+		if !validStatsDays(ctx, from, to) {
+			return
+		}
+		messageID := 0
+		if param := ctx.Query("message_id"); param != "" {
+			id, err := strconv.Atoi(param)
+			if err != nil || id <= 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "invalid message_id",
+				})
+				return
+			}
+			messageID = id
+		}
+
+		rows, err := stats.QueryOpens(from, to, messageID)
+		if err != nil {
+			referrerLog.Error("Failed to query link opens", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to query link opens",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"from":  from,
+			"to":    to,
+			"opens": rows,
+		})
+	})
+}
+
+const (
+	analyticsDefaultLimit = 100
+	analyticsMaxLimit     = 1000
+)
+
+// loadRequestAnalytics registers the aggregate queries over the request
+// history on the status server, since the groups include client IPs.
+func loadRequestAnalytics(log *zap.Logger, r *Route) {
+	analyticsLog := log.Named("Analytics")
+	defer analyticsLog.Info("Loaded request analytics route")
+	r.Router.GET("/analytics", func(ctx *gin.Context) {
+		q := stats.HistoryQuery{
+			From:    ctx.Query("from"),
+			To:      ctx.Query("to"),
+			GroupBy: ctx.DefaultQuery("group_by", stats.GroupByFile),
+			Limit:   analyticsDefaultLimit,
+		}
+		if !validStatsDays(ctx, q.From, q.To) {
+			return
+		}
+		switch q.GroupBy {
+		case stats.GroupByFile, stats.GroupByDay, stats.GroupByUser, stats.GroupByStatus:
+		default:
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "group_by must be file, day, user or status",
+			})
+			return
+		}
+		if param := ctx.Query("message_id"); param != "" {
+			id, err := strconv.Atoi(param)
+			if err != nil || id <= 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "invalid message_id",
+				})
+				return
+			}
+			q.MessageID = id
+		}
+		if param := ctx.Query("limit"); param != "" {
+			limit, err := strconv.Atoi(param)
+			if err != nil || limit <= 0 {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "invalid limit",
+				})
+				return
+			}
+			q.Limit = min(limit, analyticsMaxLimit)
+		}
+
+		rows, err := stats.QueryHistory(q)
+		if err != nil {
+			analyticsLog.Error("Failed to query request history", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to query request history",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"from":     q.From,
+			"to":       q.To,
+			"group_by": q.GroupBy,
+			"rows":     rows,
+		})
+	})
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// audioFormat is an output of /audio: the ffmpeg arguments and content type.
+type audioFormat struct {
+	contentType string
+	extension   string
+	args        []string
+}
+
+var audioFormats = map[string]audioFormat{
+	// Fragmented MP4 so it can be written to a pipe and played while streaming
+	"m4a":  {"audio/mp4", "m4a", []string{"-c:a", "aac", "-movflags", "frag_keyframe+empty_moov+default_base_moof", "-f", "mp4"}},
+	"opus": {"audio/ogg", "opus", []string{"-c:a", "libopus", "-f", "ogg"}},
+}
+
+var audioBitrates = map[string]bool{"48k": true, "64k": true, "96k": true, "128k": true, "192k": true}
+
+// audioSlots bounds concurrent ffmpeg processes; each one encodes in real
+// time for as long as the client listens.
+var audioSlots chan struct{}
+
+// LoadAudio registers /audio, which serves only the audio track of a video.
+// It needs ffmpeg and is skipped when it isn't installed.
+func (e *allRoutes) LoadAudio(r *Route) {
+	audioLog := e.log.Named("Audio")
+	if _, err := exec.LookPath(config.ValueOf.FFmpegPath); err != nil {
+		audioLog.Info("Audio route disabled, ffmpeg not found", zap.String("ffmpeg", config.ValueOf.FFmpegPath))
+		return
+	}
+	slots := config.ValueOf.AudioMaxJobs
+	if slots < 1 {
+		slots = 1
+	}
+	audioSlots = make(chan struct{}, slots)
+	r.Router.GET("/audio/:messageID", opaqueIDParams(false), e.mediaAuth, premiumOnly("audio"), rateLimit(true), e.abuseGuard, getAudioRoute(audioLog))
+	audioLog.Info("Loaded audio route", zap.Int("maxJobs", slots))
+}
+
+func getAudioRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, err := strconv.Atoi(ctx.Param("messageID"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": errorText(ctx, "error.invalid_message_id"),
+			})
+			return
+		}
+		if abortIfBlocked(ctx, config.ValueOf.MediaChannelID, messageID) {
+			return
+		}
+		format, ok := audioFormats[ctx.DefaultQuery("format", "m4a")]
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "format must be m4a or opus",
+			})
+			return
+		}
+		bitrate := ctx.DefaultQuery("bitrate", "96k")
+		if !audioBitrates[bitrate] {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "bitrate must be one of 48k, 64k, 96k, 128k or 192k",
+			})
+			return
+		}
+
+		select {
+		case audioSlots <- struct{}{}:
+			defer func() { <-audioSlots }()
+		default:
+			ctx.Header("Retry-After", "10")
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "too many audio extractions in progress",
+			})
+			return
+		}
+
+		url, headers := loopbackSource(messageID)
+		args := []string{"-nostdin", "-loglevel", "error", "-headers", headers, "-i", url,
+			"-map", "0:a:0", "-vn", "-b:a", bitrate}
+		args = append(args, format.args...)
+		args = append(args, "pipe:1")
+		// Tied to the request so ffmpeg stops when the client goes away
+		cmd := exec.CommandContext(ctx.Request.Context(), config.ValueOf.FFmpegPath, args...)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := cmd.Start(); err != nil {
+			logger.Error("Failed to start ffmpeg", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to start audio extraction",
+			})
+			return
+		}
+
+		// Nothing is written until ffmpeg produces output, so a source without
+		// an audio track still gets a proper error status.
+		buf := make([]byte, 32*1024)
+		n, readErr := stdout.Read(buf)
+		if n == 0 {
+			waitErr := cmd.Wait()
+			logger.Warn("Audio extraction produced no output",
+				zap.Int("messageID", messageID),
+				zap.NamedError("readError", readErr),
+				zap.NamedError("ffmpegError", waitErr))
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "no audio track could be extracted",
+			})
+			return
+		}
+
+		ctx.Header("Content-Type", format.contentType)
+		ctx.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%d.%s\"", messageID, format.extension))
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Status(http.StatusOK)
+		w := meteredWriter{ctx.Writer}
+		if _, err := w.Write(buf[:n]); err == nil {
+			_, _ = io.Copy(w, stdout)
+		}
+		if err := cmd.Wait(); err != nil && ctx.Request.Context().Err() == nil {
+			logger.Warn("Audio extraction ended with an error", zap.Int("messageID", messageID), zap.Error(err))
+		}
+	}
+}
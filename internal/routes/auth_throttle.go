@@ -0,0 +1,136 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Kinds of failed authentication, as labelled in the metrics.
+const (
+	authFailureFirebase   = "firebase"
+	authFailureAppCheck   = "app_check"
+	authFailureLegacyHMAC = "legacy_hmac"
+	authFailureAPIKey     = "api_key"
+	authFailureWebApp     = "webapp"
+	authFailureSignedLink = "signed_link"
+	authFailureSession    = "stream_session"
+)
+
+// authFailures counts failed authentications by kind.
+var authFailures = map[string]*int64{
+	authFailureFirebase:   new(int64),
+	authFailureAppCheck:   new(int64),
+	authFailureLegacyHMAC: new(int64),
+	authFailureAPIKey:     new(int64),
+	authFailureWebApp:     new(int64),
+	authFailureSignedLink: new(int64),
+	authFailureSession:    new(int64),
+}
+
+var (
+	authBans             int64 // IPs banned since the start
+	authBannedRejections int64 // attempts refused because the IP was banned
+)
+
+// authThrottle bans IPs that fail AUTH_MAX_FAILURES times within
+// AUTH_FAILURE_WINDOW_SECONDS from the auth surface for AUTH_BAN_SECONDS.
+var authThrottle = struct {
+	mu        sync.Mutex
+	clients   map[string]*authClient
+	lastSweep time.Time
+}{clients: make(map[string]*authClient)}
+
+type authClient struct {
+	failures    int
+	windowStart time.Time
+	bannedUntil time.Time
+}
+
+// authBanned answers 429 when the client IP is banned.
+func authBanned(ctx *gin.Context) bool {
+	if config.Live().AuthMaxFailures <= 0 {
+		return false
+	}
+	authThrottle.mu.Lock()
+	client := authThrottle.clients[ctx.ClientIP()]
+	var wait time.Duration
+	if client != nil {
+		wait = time.Until(client.bannedUntil)
+	}
+	authThrottle.mu.Unlock()
+	if wait <= 0 {
+		return false
+	}
+	atomic.AddInt64(&authBannedRejections, 1)
+	ctx.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error": "too many failed authentication attempts, try again later",
+	})
+	return true
+}
+
+// recordAuthFailure counts a failed authentication of the client IP and bans
+// it once it reaches AUTH_MAX_FAILURES.
+func recordAuthFailure(ctx *gin.Context, logger *zap.Logger, kind string) {
+	atomic.AddInt64(authFailures[kind], 1)
+	maxFailures := config.Live().AuthMaxFailures
+	if maxFailures <= 0 {
+		return
+	}
+	ip := ctx.ClientIP()
+	now := time.Now()
+	window := time.Duration(config.Live().AuthFailureWindowSeconds) * time.Second
+	ban := time.Duration(config.Live().AuthBanSeconds) * time.Second
+
+	authThrottle.mu.Lock()
+	defer authThrottle.mu.Unlock()
+	if now.Sub(authThrottle.lastSweep) > window {
+		for key, c := range authThrottle.clients {
+			if now.Sub(c.windowStart) > window && now.After(c.bannedUntil) {
+				delete(authThrottle.clients, key)
+			}
+		}
+		authThrottle.lastSweep = now
+	}
+	client := authThrottle.clients[ip]
+	switch {
+	case client == nil:
+		client = &authClient{windowStart: now}
+		authThrottle.clients[ip] = client
+	case now.Sub(client.windowStart) > window:
+		client.failures = 0
+		client.windowStart = now
+	}
+	client.failures++
+	if client.failures >= maxFailures && now.After(client.bannedUntil) {
+		client.bannedUntil = now.Add(ban)
+		client.failures = 0
+		client.windowStart = now
+		atomic.AddInt64(&authBans, 1)
+		logger.Warn("Banning IP after repeated authentication failures",
+			zap.String("clientIP", ip),
+			zap.String("lastFailure", kind),
+			zap.Duration("for", ban))
+	}
+}
+
+// authBannedIPs is the number of IPs currently banned.
+func authBannedIPs() int {
+	now := time.Now()
+	authThrottle.mu.Lock()
+	defer authThrottle.mu.Unlock()
+	n := 0
+	for _, c := range authThrottle.clients {
+		if now.Before(c.bannedUntil) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loadBalancerShadow registers the report of the balancer shadow mode.
+func loadBalancerShadow(log *zap.Logger, r *Route) {
+	shadowLog := log.Named("BalancerShadow")
+	defer shadowLog.Info("Loaded balancer shadow route")
+	r.Router.GET("/api/balancer/shadow", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, bot.GetShadowReport())
+	})
+}
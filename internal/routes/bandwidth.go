@@ -0,0 +1,84 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/stats"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loadBandwidthStats registers the bandwidth accounting export on the status server.
+func loadBandwidthStats(log *zap.Logger, r *Route) {
+	bandwidthLog := log.Named("Bandwidth")
+	defer bandwidthLog.Info("Loaded bandwidth stats route")
+	r.Router.GET("/api/stats/bandwidth", getBandwidthStatsRoute(bandwidthLog))
+}
+
+func getBandwidthStatsRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if database.DB == nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		}
+
+		from := ctx.Query("from")
+		to := ctx.Query("to")
+		for _, day := range []string{from, to} {
+			if day == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", day); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "from/to must be formatted as YYYY-MM-DD",
+				})
+				return
+			}
+		}
+
+		rows, err := stats.QueryBandwidth(from, to)
+		if err != nil {
+			logger.Error("Failed to query bandwidth usage", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to query bandwidth usage",
+			})
+			return
+		}
+
+		if ctx.Query("format") == "csv" {
+			ctx.Header("Content-Type", "text/csv; charset=utf-8")
+			ctx.Header("Content-Disposition", "attachment; filename=\"bandwidth.csv\"")
+			ctx.Status(http.StatusOK)
+			writer := csv.NewWriter(ctx.Writer)
+			_ = writer.Write([]string{"day", "channel_id", "bytes", "requests"})
+			for _, row := range rows {
+				_ = writer.Write([]string{
+					row.Day,
+					strconv.FormatInt(row.ChannelID, 10),
+					strconv.FormatInt(row.Bytes, 10),
+					strconv.FormatInt(row.Requests, 10),
+				})
+			}
+			writer.Flush()
+			return
+		}
+
+		var totalBytes int64
+		for _, row := range rows {
+			totalBytes += row.Bytes
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"from":        from,
+			"to":          to,
+			"total_bytes": totalBytes,
+			"usage":       rows,
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"net/http"
+	"strings"
+)
+
+// WithBasePath serves h under BASE_PATH: the prefix is stripped before the
+// request reaches the router and anything outside it is a 404. Routes are
+// registered without the prefix so every mode shares the same tables.
+// /robots.txt is only ever fetched from the root and passes through as is.
+func WithBasePath(h http.Handler) http.Handler {
+	base := config.ValueOf.BasePath
+	if base == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == robotsPath {
+			h.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path != base && !strings.HasPrefix(r.URL.Path, base+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		stripped := r.Clone(r.Context())
+		stripped.URL.Path = strings.TrimPrefix(r.URL.Path, base)
+		if stripped.URL.Path == "" {
+			stripped.URL.Path = "/"
+		}
+		if r.URL.RawPath != "" {
+			stripped.URL.RawPath = strings.TrimPrefix(r.URL.RawPath, base)
+		}
+		h.ServeHTTP(w, stripped)
+	})
+}
@@ -0,0 +1,159 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/blocklist"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// abortIfBlocked answers 403 for links revoked through the blocklist.
+func abortIfBlocked(ctx *gin.Context, channelID int64, messageID int) bool {
+	if _, ok := blocklist.MessageBlocked(channelID, messageID); !ok {
+		return false
+	}
+	ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error": errorText(ctx, "error.link_revoked"),
+	})
+	return true
+}
+
+// registerBlocklistRoutes lists, adds and removes revoked links.
+func registerBlocklistRoutes(admin *gin.RouterGroup, logger *zap.Logger) {
+	admin.GET("/blocklist", adminAuth(config.AdminRoleMetrics), listBlocklistRoute(logger))
+	admin.POST("/blocklist", adminAuth(config.AdminRoleFull), addBlocklistRoute(logger))
+	admin.DELETE("/blocklist/:id", adminAuth(config.AdminRoleFull), removeBlocklistRoute(logger))
+}
+
+type blocklistRequest struct {
+	MessageID int    `json:"message_id"`
+	Channel   string `json:"channel"` // a MEDIA_CHANNELS alias; MEDIA_CHANNEL_ID when empty
+	Hash      string `json:"hash"`    // the hash of a /stream link
+	Reason    string `json:"reason"`
+}
+
+func addBlocklistRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		var req blocklistRequest
+		err := ctx.ShouldBindJSON(&req)
+		req.Hash = strings.TrimSpace(req.Hash)
+		if err != nil || (req.MessageID > 0) == (req.Hash != "") || req.MessageID < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": `send {"message_id": <id>, "channel": "<alias>"} or {"hash": "<stream link hash>"}, with an optional "reason"`,
+			})
+			return
+		}
+		reason := truncate(req.Reason, 500)
+		var entry *blocklist.Entry
+		if req.Hash != "" {
+			entry, err = blocklist.BlockHash(req.Hash, reason)
+		} else {
+			channelID := config.ValueOf.MediaChannelID
+			if req.Channel != "" {
+				channel, ok := config.ValueOf.MediaChannelFor(req.Channel)
+				if !ok {
+					ctx.JSON(http.StatusBadRequest, gin.H{
+						"error": "unknown channel",
+					})
+					return
+				}
+				channelID = channel.ID
+			}
+			if channelID == 0 {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "MEDIA_CHANNEL_ID not configured",
+				})
+				return
+			}
+			entry, err = blocklist.BlockMessage(channelID, req.MessageID, reason)
+		}
+		switch {
+		case errors.Is(err, blocklist.ErrAlreadyBlocked):
+			ctx.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case errors.Is(err, blocklist.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to block link", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to block link",
+			})
+			return
+		}
+		logger.Info("Link blocked",
+			zap.Uint("id", entry.ID),
+			zap.Int64("channelID", entry.ChannelID),
+			zap.Int("messageID", entry.MessageID),
+			zap.String("hash", entry.Hash),
+			zap.String("clientIP", ctx.ClientIP()))
+		ctx.JSON(http.StatusCreated, entry)
+	}
+}
+
+func listBlocklistRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		entries, err := blocklist.List()
+		if err != nil {
+			if errors.Is(err, blocklist.ErrNoDatabase) {
+				ctx.JSON(http.StatusServiceUnavailable, gin.H{
+					"error": "database not initialized",
+				})
+				return
+			}
+			logger.Error("Failed to list blocklist", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list blocklist",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+		})
+	}
+}
+
+func removeBlocklistRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		id, err := strconv.ParseUint(ctx.Param("id"), 10, 64)
+		if err != nil || id == 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid blocklist entry ID",
+			})
+			return
+		}
+		err = blocklist.Unblock(uint(id))
+		switch {
+		case errors.Is(err, blocklist.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "blocklist entry not found",
+			})
+			return
+		case errors.Is(err, blocklist.ErrNoDatabase):
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to unblock link", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to unblock link",
+			})
+			return
+		}
+		logger.Info("Link unblocked", zap.Uint64("id", id), zap.String("clientIP", ctx.ClientIP()))
+		ctx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"fmt"
+	"html"
+)
+
+// brandName is BRAND_NAME, escaped for HTML.
+func brandName() string {
+	return html.EscapeString(config.ValueOf.BrandName)
+}
+
+// brandTitle is the <title> of an HTML page, followed by BRAND_NAME.
+func brandTitle(page string) string {
+	return html.EscapeString(page + " - " + config.ValueOf.BrandName)
+}
+
+// brandHead links the favicon and defines the BRAND_* colors as CSS variables
+// for the stylesheet of the page.
+func brandHead() string {
+	// The colors are validated as hex in config.Load
+	return fmt.Sprintf(`<link rel="icon" href="/favicon.ico">
+	<style>
+		:root {
+			--brand-color: %s;
+			--brand-accent-color: %s;
+		}
+	</style>`, config.ValueOf.BrandColor, config.ValueOf.BrandAccentColor)
+}
+
+// brandLogo is the logo <img>, from BRAND_LOGO_URL or the served asset.
+func brandLogo() string {
+	src := config.ValueOf.BrandLogoURL
+	if src == "" {
+		src = "/static/logo.svg"
+	}
+	return fmt.Sprintf(`<img class="logo" src="%s" alt="%s">`,
+		html.EscapeString(src), brandName())
+}
@@ -0,0 +1,123 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"sort"
+	"strings"
+
+	range_parser "github.com/quantumsheep/range-parser"
+)
+
+// maxByteRanges bounds the parts of a multipart/byteranges response; each part
+// is a Telegram fetch of its own.
+const maxByteRanges = 16
+
+var (
+	errRangeInvalid        = errors.New("invalid range header")
+	errRangeNotSatisfiable = errors.New("range not satisfiable")
+)
+
+// parseByteRanges reads the Range header of a request for a file of size
+// bytes. Overlapping and adjacent ranges are merged. A unit other than bytes
+// returns no ranges, the header is then ignored.
+func parseByteRanges(header string, size int64) ([]*range_parser.Range, error) {
+	unit, spec, ok := strings.Cut(header, "=")
+	if !ok {
+		return nil, errRangeInvalid
+	}
+	if strings.TrimSpace(unit) != "bytes" {
+		return nil, nil
+	}
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		// range_parser chokes on the spaces most clients put after commas
+		part = strings.TrimSpace(part)
+		if !strings.Contains(part, "-") {
+			return nil, errRangeInvalid
+		}
+		parts[i] = part
+	}
+	ranges, err := range_parser.Parse(size, "bytes="+strings.Join(parts, ","))
+	if err != nil {
+		return nil, errRangeNotSatisfiable
+	}
+	ranges = mergeRanges(ranges)
+	if len(ranges) > maxByteRanges {
+		return nil, errRangeNotSatisfiable
+	}
+	return ranges, nil
+}
+
+// mergeRanges sorts ranges and joins those that overlap or touch.
+func mergeRanges(ranges []*range_parser.Range) []*range_parser.Range {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := merged[len(merged)-1]
+		if r.Start <= last.End+1 {
+			last.End = max(last.End, r.End)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// byteRangesBody is a multipart/byteranges response with one part per range.
+type byteRangesBody struct {
+	boundary string
+	ranges   []*range_parser.Range
+	headers  []textproto.MIMEHeader
+	length   int64
+}
+
+// newByteRangesBody lays out the parts of ranges of a file of size bytes and
+// finds the length of the whole body, which is sent as Content-Length.
+func newByteRangesBody(ranges []*range_parser.Range, mimeType string, size int64) *byteRangesBody {
+	var counter byteCounter
+	mw := multipart.NewWriter(&counter)
+	body := &byteRangesBody{boundary: mw.Boundary(), ranges: ranges}
+	for _, r := range ranges {
+		header := textproto.MIMEHeader{
+			"Content-Type":  {mimeType},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", r.Start, r.End, size)},
+		}
+		// Writing to counter can't fail
+		_, _ = mw.CreatePart(header)
+		counter.n += r.End - r.Start + 1
+		body.headers = append(body.headers, header)
+	}
+	_ = mw.Close()
+	body.length = counter.n
+	return body
+}
+
+func (b *byteRangesBody) contentType() string {
+	return "multipart/byteranges; boundary=" + b.boundary
+}
+
+// write streams the parts from Telegram and returns the file bytes written.
+func (b *byteRangesBody) write(ctx context.Context, dst io.Writer, src *rangeSource) (int64, error) {
+	mw := multipart.NewWriter(dst)
+	if err := mw.SetBoundary(b.boundary); err != nil {
+		return 0, err
+	}
+	var written int64
+	for i, r := range b.ranges {
+		part, err := mw.CreatePart(b.headers[i])
+		if err != nil {
+			return written, err
+		}
+		n, err := copyFileRange(ctx, src, r.Start, r.End, part)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, mw.Close()
+}
@@ -0,0 +1,119 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/streamauth"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	publicAuthMethod = "public_channel"
+	// messageBatch is how many message IDs are asked from Telegram at once.
+	messageBatch = 100
+)
+
+// channelAliasParams renames the wildcards of /direct/<alias>/<id> to
+// channelAlias and messageID and turns unknown aliases away.
+func channelAliasParams(ctx *gin.Context) {
+	alias, messageID := ctx.Param("messageID"), ctx.Param("aliasedMessageID")
+	if _, ok := config.ValueOf.MediaChannelFor(alias); !ok {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": errorText(ctx, "error.unknown_channel"),
+		})
+		return
+	}
+	ctx.Params = gin.Params{
+		{Key: "channelAlias", Value: alias},
+		{Key: "messageID", Value: messageID},
+	}
+	ctx.Next()
+}
+
+// channelAuth lets requests for public MEDIA_CHANNELS channels through and
+// hands the others to mediaAuth.
+func channelAuth(mediaAuth gin.HandlerFunc) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		channel, _ := config.ValueOf.MediaChannelFor(ctx.Param("channelAlias"))
+		if !channel.Public {
+			mediaAuth(ctx)
+			return
+		}
+		ctx.Set(streamSessionKey, streamauth.Session{})
+		ctx.Set(authMethodKey, publicAuthMethod)
+		ctx.Next()
+	}
+}
+
+// channelQueryParam moves ?channel=<alias> of the routes that take no
+// message ID in their path to the channelAlias param the auth middlewares
+// look at, and turns unknown aliases away.
+func channelQueryParam(ctx *gin.Context) {
+	alias := ctx.Query("channel")
+	if alias == "" {
+		ctx.Next()
+		return
+	}
+	if _, ok := config.ValueOf.MediaChannelFor(alias); !ok {
+		ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+			"error": errorText(ctx, "error.unknown_channel"),
+		})
+		return
+	}
+	ctx.Params = append(ctx.Params, gin.Param{Key: "channelAlias", Value: alias})
+	ctx.Next()
+}
+
+// requestChannelID returns the channel of the channelAlias param, or
+// MEDIA_CHANNEL_ID without one. It answers 500 when neither is configured.
+func requestChannelID(ctx *gin.Context) (int64, bool) {
+	if alias := ctx.Param("channelAlias"); alias != "" {
+		channel, _ := config.ValueOf.MediaChannelFor(alias)
+		return channel.ID, true
+	}
+	if config.ValueOf.MediaChannelID == 0 {
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": errorText(ctx, "error.media_channel_not_configured"),
+		})
+		return 0, false
+	}
+	return config.ValueOf.MediaChannelID, true
+}
+
+// fetchChannelMessages returns the messages of channelID among ids that
+// still exist, in ID order.
+func fetchChannelMessages(ctx context.Context, worker *bot.Worker, channelID int64, ids []int) ([]*tg.Message, error) {
+	channel, err := utils.GetChannelPeer(ctx, worker.Client.API(), worker.Client.PeerStorage, channelID)
+	if err != nil {
+		return nil, err
+	}
+	var messages []*tg.Message
+	for batch := range slices.Chunk(ids, messageBatch) {
+		input := make([]tg.InputMessageClass, 0, len(batch))
+		for _, id := range batch {
+			input = append(input, &tg.InputMessageID{ID: id})
+		}
+		res, err := worker.Client.API().ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{Channel: channel, ID: input})
+		if err != nil {
+			return nil, err
+		}
+		modified, ok := res.AsModified()
+		if !ok {
+			return nil, fmt.Errorf("unexpected response %T", res)
+		}
+		for _, message := range modified.GetMessages() {
+			if m, ok := message.(*tg.Message); ok {
+				messages = append(messages, m)
+			}
+		}
+	}
+	slices.SortFunc(messages, func(a, b *tg.Message) int { return a.ID - b.ID })
+	return messages, nil
+}
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/cluster"
+	"EverythingSuckz/fsb/internal/stats"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loadClusterLoad registers the load report polled by redirect front instances.
+func loadClusterLoad(log *zap.Logger, r *Route) {
+	loadLog := log.Named("Load")
+	defer loadLog.Info("Loaded cluster load route")
+	r.Router.GET("/api/load", func(ctx *gin.Context) {
+		var active int32
+		for _, worker := range bot.Snapshot() {
+			active += worker.GetActiveRequests()
+		}
+		ctx.JSON(http.StatusOK, cluster.Load{
+			ActiveRequests: active,
+			BytesPerSecond: stats.Throughput(),
+		})
+	})
+}
+
+// LoadRedirect wires a front instance: every request is answered with a 307
+// to the least loaded replica, keeping path and query intact.
+func LoadRedirect(log *zap.Logger, r *gin.Engine, balancer *cluster.Balancer) {
+	log = log.Named("Redirect")
+	r.GET("/api/replicas", func(ctx *gin.Context) {
+		ctx.JSON(http.StatusOK, balancer.Snapshot())
+	})
+	r.NoRoute(func(ctx *gin.Context) {
+		replica := balancer.Pick()
+		if replica == nil {
+			log.Warn("No healthy replica to redirect to", zap.String("path", ctx.Request.URL.Path))
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "no replicas available",
+			})
+			return
+		}
+		ctx.Header("Cache-Control", "no-store")
+		// WithBasePath stripped BASE_PATH, which the replicas serve under too
+		ctx.Redirect(http.StatusTemporaryRedirect, replica.PublicURL+config.ValueOf.BasePath+ctx.Request.URL.RequestURI())
+	})
+	log.Info("Loaded redirect routes")
+}
@@ -3,15 +3,17 @@ package routes
 import (
 	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/bot"
-	"EverythingSuckz/fsb/internal/streamauth"
+	"EverythingSuckz/fsb/internal/budget"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/transcode"
 	"EverythingSuckz/fsb/internal/types"
 	"EverythingSuckz/fsb/internal/utils"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -86,9 +88,13 @@ func GetRequestLogs() []RequestLog {
 func (e *allRoutes) LoadDirect(r *Route) {
 	directLog := e.log.Named("DirectStream")
 	defer directLog.Info("Loaded direct stream route")
-	handler := getDirectStreamRoute(directLog, e.streamAuth)
-	r.Engine.GET("/direct/:messageID", handler)
-	r.Engine.HEAD("/direct/:messageID", handler)
+	handler := getDirectStreamRoute(directLog)
+	r.Router.GET("/direct/:messageID", opaqueIDParams(true), channelAuth(e.mediaAuth), rateLimit(true), e.abuseGuard, handler)
+	r.Router.HEAD("/direct/:messageID", opaqueIDParams(true), channelAuth(e.mediaAuth), rateLimit(false), e.abuseGuard, handler)
+	// A wildcard segment has one name on every route, so the alias of
+	// /direct/<alias>/<id> comes in as :messageID; see channelAliasParams
+	r.Router.GET("/direct/:messageID/:aliasedMessageID", channelAliasParams, opaqueIDParams(true), channelAuth(e.mediaAuth), rateLimit(true), e.abuseGuard, handler)
+	r.Router.HEAD("/direct/:messageID/:aliasedMessageID", channelAliasParams, opaqueIDParams(true), channelAuth(e.mediaAuth), rateLimit(false), e.abuseGuard, handler)
 }
 
 // fetchFileWithRetry attempts to fetch file with timeout and automatic retry using different workers.
@@ -122,6 +128,7 @@ func fetchFileWithRetry(
 		ctx, cancel := context.WithTimeout(ctx, metadataFetchTimeout)
 		defer cancel()
 		file, err := utils.FileFromMessageAndChannel(ctx, w.Client, channelID, messageID)
+		w.RecordChannelAccess(channelID, err)
 		return result{file: file, err: err, w: w}
 	}
 
@@ -147,7 +154,7 @@ func fetchFileWithRetry(
 		fallbackWorker := bot.GetNextWorkerExcluding(excludeWorkers)
 		if fallbackWorker == nil {
 			logger.Error("No fallback workers available")
-			return nil, nil, fmt.Errorf("all workers exhausted")
+			return nil, nil, fmt.Errorf("all workers exhausted: %w", res.err)
 		}
 		excludeWorkers = append(excludeWorkers, fallbackWorker.ID)
 
@@ -174,7 +181,7 @@ func fetchFileWithRetry(
 			zap.Error(res.err))
 	}
 
-	return nil, nil, fmt.Errorf("failed to fetch file after %d retries", maxRetries)
+	return nil, nil, fmt.Errorf("failed to fetch file after %d retries: %w", maxRetries, res.err)
 }
 
 // fetchFileWithRace spins two workers concurrently and returns the first successful response.
@@ -215,6 +222,7 @@ func fetchFileWithRace(
 			defer attemptCancel()
 
 			file, err := utils.FileFromMessageAndChannel(attemptCtx, worker.Client, channelID, messageID)
+			worker.RecordChannelAccess(channelID, err)
 			// Use buffered channel to avoid goroutine leak if caller returns early
 			results <- result{file: file, worker: worker, err: err}
 		}()
@@ -247,16 +255,23 @@ func fetchFileWithRace(
 	return nil, nil, firstErr
 }
 
-func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) gin.HandlerFunc {
+func getDirectStreamRoute(logger *zap.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
 		w := ctx.Writer
 		r := ctx.Request
 
-		// Check if MEDIA_CHANNEL_ID is configured
-		if config.ValueOf.MediaChannelID == 0 {
+		// /direct/<alias>/<id> streams from a MEDIA_CHANNELS channel, checked
+		// by channelAliasParams; /direct/<id> from MEDIA_CHANNEL_ID
+		channelID := config.ValueOf.MediaChannelID
+		alias := ctx.Param("channelAlias")
+		if alias != "" {
+			channel, _ := config.ValueOf.MediaChannelFor(alias)
+			channelID = channel.ID
+		} else if channelID == 0 {
 			logger.Error("MEDIA_CHANNEL_ID not configured")
 			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "MEDIA_CHANNEL_ID not configured",
+				"error": errorText(ctx, "error.media_channel_not_configured"),
 			})
 			return
 		}
@@ -267,58 +282,38 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 		if err != nil {
 			logger.Warn("Invalid message ID", zap.String("messageID", messageIDParam), zap.Error(err))
 			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "invalid message ID",
+				"error": errorText(ctx, "error.invalid_message_id"),
 			})
 			return
 		}
-
-		authMethod := "none"
-		rangeHeader := r.Header.Get("Range")
-		hasRangeHeader := rangeHeader != ""
-
-		// Firebase-only auth flow:
-		// 1) Client exchanges Firebase ID token for short-lived stream token.
-		// 2) /direct validates this stream session token.
-		if authService == nil || !authService.Enabled() {
-			logger.Error("Firebase stream auth is disabled; refusing direct stream request",
-				zap.Int("messageID", messageID),
-				zap.String("clientIP", ctx.ClientIP()))
-			ctx.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "stream authentication is not configured",
-			})
+		if abortIfBlocked(ctx, channelID, messageID) || abortIfGone(ctx, channelID, messageID) {
 			return
 		}
 
-		sessionToken := extractStreamSessionToken(ctx, authService.CookieName())
-		if sessionToken == "" {
-			logger.Warn("Direct stream unauthorized: missing stream session token",
-				zap.Int("messageID", messageID),
-				zap.String("clientIP", ctx.ClientIP()))
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error": "unauthorized: missing stream session token",
-			})
-			return
+		rangeHeader := r.Header.Get("Range")
+		hasRangeHeader := rangeHeader != ""
+		session, authMethod := streamSessionFrom(ctx)
+		if r.Method == http.MethodHead {
+			setFileStatsHeaders(ctx, channelID, messageID)
 		}
 
-		session, valid := authService.ValidateSession(sessionToken)
-		if !valid {
-			logger.Warn("Stream session validation failed",
-				zap.Int("messageID", messageID),
-				zap.String("clientIP", ctx.ClientIP()))
-			ctx.JSON(http.StatusUnauthorized, gin.H{
-				"error": "unauthorized: invalid or expired stream session",
-			})
-			return
+		// Serve a pre-generated rendition when asked for one, otherwise the
+		// original; plays of the original make the file a transcode candidate.
+		if transcode.Enabled() && authMethod != internalAuthMethod && alias == "" {
+			if quality := ctx.Query("quality"); quality != "" && serveRendition(ctx, logger, messageID, quality) {
+				return
+			}
+			if renditions := renditionsHeader(messageID); renditions != "" {
+				ctx.Header("X-Renditions", renditions)
+			}
+			if isPlaybackStart(rangeHeader) {
+				transcode.NoteRequest(messageID)
+			}
 		}
-		authMethod = "firebase_session"
-
-		logger.Debug("Authorized direct stream with Firebase session",
-			zap.Int("messageID", messageID),
-			zap.String("userID", session.UserID))
 
 		logger.Debug("Direct stream request",
 			zap.Int("messageID", messageID),
-			zap.Int64("channelID", config.ValueOf.MediaChannelID),
+			zap.Int64("channelID", channelID),
 			zap.String("method", r.Method),
 			zap.Bool("hasRange", hasRangeHeader),
 			zap.String("authMethod", authMethod),
@@ -331,13 +326,26 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 			raceWorkers = 1
 		}
 
-		primaryWorker := bot.GetNextWorker()
+		// Bulk downloads get a single worker and are refused first under load;
+		// internal requests are scheduled through the budget priority instead.
+		class := classRealtime
+		if authMethod != internalAuthMethod {
+			class = classifyRequest(ctx, rangeHeader)
+		}
+		var primaryWorker *bot.Worker
+		if class == classBulk {
+			raceWorkers = 1
+			primaryWorker = bot.GetNextBulkWorker()
+			if primaryWorker == nil && len(bot.Snapshot()) > 0 {
+				logger.Info("Bulk download refused, workers busy", zap.Int("messageID", messageID))
+				respondUnavailable(ctx, unavailableBusy, messageID)
+				return
+			}
+		}
 		if primaryWorker == nil {
-			logger.Error("No workers available")
-			ctx.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "no workers available",
-			})
-			return
+			if primaryWorker = acquireWorker(ctx, logger, bot.GetNextWorker, messageID); primaryWorker == nil {
+				return
+			}
 		}
 		workerPool := []*bot.Worker{primaryWorker}
 		seenWorkerIDs := []int{primaryWorker.ID}
@@ -369,51 +377,58 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 
 		// Create a background context for Telegram API calls that won't be cancelled
 		// when the HTTP client disconnects. This prevents "context canceled" errors
-		// during file streaming.
-		bgCtx := context.Background()
+		// during file streaming. Bulk downloads and internal requests (transcodes,
+		// audio) yield the worker's budget to viewers.
+		priority := class.budgetPriority()
+		if authMethod == internalAuthMethod {
+			priority = budget.Backfill
+		}
+		bgCtx := budget.WithPriority(context.Background(), priority)
 
 		// Race two bots (when available) and fall back to remaining pool if both fail
-		file, selectedWorker, err := fetchFileWithRace(bgCtx, logger, workerPool, messageID, config.ValueOf.MediaChannelID)
+		file, selectedWorker, err := fetchFileWithRace(bgCtx, logger, workerPool, messageID, channelID)
 		if err != nil {
 			fallbackWorker := bot.GetNextWorkerExcluding(seenWorkerIDs)
 			if fallbackWorker != nil {
 				seenWorkerIDs = append(seenWorkerIDs, fallbackWorker.ID)
-				file, selectedWorker, err = fetchFileWithRetry(bgCtx, logger, fallbackWorker, messageID, config.ValueOf.MediaChannelID, seenWorkerIDs)
+				file, selectedWorker, err = fetchFileWithRetry(bgCtx, logger, fallbackWorker, messageID, channelID, seenWorkerIDs)
 			}
 		}
 
 		if err != nil {
 			logger.Error("Failed to get file from channel after retries",
 				zap.Int("messageID", messageID),
-				zap.Int64("channelID", config.ValueOf.MediaChannelID),
+				zap.Int64("channelID", channelID),
 				zap.Error(err))
 
 			// Check if it's a "not found" type of error
 			if err.Error() == "message not found in channel" || err.Error() == "message was deleted or is not accessible" {
 				ctx.JSON(http.StatusNotFound, gin.H{
-					"error": "message not found or has no media",
+					"error": errorText(ctx, "error.message_not_found"),
 				})
 				return
 			}
 
+			if utils.IsNoChannelAccess(err) {
+				respondUnavailable(ctx, unavailableNoAccess, messageID)
+				return
+			}
+
 			// Other errors are likely Telegram API issues
-			ctx.JSON(http.StatusBadGateway, gin.H{
-				"error": "failed to fetch file from Telegram",
-			})
+			respondUnavailable(ctx, unavailableTelegram, messageID)
 			return
 		}
 
 		// Safety check: ensure we have a worker for streaming
 		if selectedWorker == nil {
 			logger.Error("No worker selected after fetch")
-			ctx.JSON(http.StatusServiceUnavailable, gin.H{
-				"error": "no workers available",
-			})
+			respondUnavailable(ctx, unavailableNoWorkers, messageID)
 			return
 		}
 
 		// Now that we know the winning worker, mark the request as active
 		selectedWorker.StartRequest()
+		setRequestWorker(ctx, selectedWorker)
 		reqLog.WorkerID = selectedWorker.ID
 		reqLog.WorkerName = selectedWorker.Self.Username
 
@@ -428,6 +443,18 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 			reqLog.Duration = time.Since(requestStartTime).Milliseconds()
 			reqLog.BytesSent = int64(w.Size())
 			AddRequestLog(reqLog)
+			stats.Record(stats.Request{
+				Route:      "direct",
+				ChannelID:  channelID,
+				MessageID:  messageID,
+				FileName:   file.FileName,
+				Bytes:      reqLog.BytesSent,
+				UserID:     session.UserID,
+				ClientIP:   reqLog.ClientIP,
+				StatusCode: reqLog.StatusCode,
+				Duration:   time.Since(requestStartTime),
+				View:       r.Method != http.MethodHead && reqLog.StatusCode < http.StatusBadRequest && isPlaybackStart(rangeHeader),
+			})
 
 			if reqLog.StatusCode >= http.StatusBadRequest {
 				logger.Warn("Direct",
@@ -459,20 +486,29 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 			zap.String("workerUsername", selectedWorker.Self.Username),
 			zap.Int32("activeRequests", selectedWorker.GetActiveRequests()))
 
+		if fileNotModified(ctx, file) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
+		if hasRangeHeader && !ifRangeMatches(r, file) {
+			// The client's partial copy is stale, it gets the whole file
+			rangeHeader, hasRangeHeader = "", false
+		}
+
 		// Handle photos (which have FileSize 0)
 		if file.FileSize == 0 {
-			cacheFile := getDirectPhotoCachePath(messageID)
-			servedFromCache, cacheErr := serveDirectPhotoFromCache(ctx, cacheFile, file.MimeType, file.FileName)
+			cacheKey := channelImageCacheKey(channelID, messageID)
+			servedFromCache, cacheErr := serveDirectPhotoFromCache(ctx, cacheKey, file.MimeType, file.FileName)
 			if cacheErr != nil {
 				logger.Warn("Failed to serve cached direct photo, falling back to Telegram download",
 					zap.Int("messageID", messageID),
-					zap.String("cacheFile", cacheFile),
+					zap.String("cacheKey", cacheKey),
 					zap.Error(cacheErr))
 			}
 			if servedFromCache {
-				logger.Debug("Direct photo served from local cache",
+				logger.Debug("Direct photo served from image store",
 					zap.Int("messageID", messageID),
-					zap.String("cacheFile", cacheFile))
+					zap.String("cacheKey", cacheKey))
 				return
 			}
 
@@ -483,13 +519,13 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 					logger.Warn("FILE_REFERENCE_EXPIRED for photo, refetching metadata",
 						zap.Int("messageID", messageID))
 
-					freshFile, refetchErr := utils.RefetchFileFromMessageAndChannel(bgCtx, selectedWorker.Client, config.ValueOf.MediaChannelID, messageID)
+					freshFile, refetchErr := utils.RefetchFileFromMessageAndChannel(bgCtx, selectedWorker.Client, channelID, messageID)
 					if refetchErr != nil {
 						logger.Error("Failed to refetch photo after FILE_REFERENCE_EXPIRED",
 							zap.Int("messageID", messageID),
 							zap.Error(refetchErr))
 						ctx.JSON(http.StatusInternalServerError, gin.H{
-							"error": "photo file reference expired and refetch failed",
+							"error": errorText(ctx, "error.photo_refetch_failed"),
 						})
 						return
 					}
@@ -500,28 +536,35 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 					if err != nil {
 						logger.Error("Failed to get photo file after refetch", zap.Error(err))
 						ctx.JSON(http.StatusInternalServerError, gin.H{
-							"error": "failed to get photo file after refetch",
+							"error": errorText(ctx, "error.photo_after_refetch"),
 						})
 						return
 					}
 				} else {
 					logger.Error("Failed to get photo file", zap.Error(err))
 					ctx.JSON(http.StatusInternalServerError, gin.H{
-						"error": "failed to get photo file",
+						"error": errorText(ctx, "error.photo"),
 					})
 					return
 				}
 			}
 
-			if err := writeBytesAtomically(cacheFile, fileBytes, 0o644); err != nil {
-				logger.Warn("Failed to persist direct photo cache",
-					zap.Int("messageID", messageID),
-					zap.String("cacheFile", cacheFile),
-					zap.Error(err))
+			if err := imageStore.Put(bgCtx, cacheKey, fileBytes); err != nil {
+				if errors.Is(err, utils.ErrLowDiskSpace) {
+					logger.Warn("Skipping direct photo cache write",
+						zap.Int("messageID", messageID),
+						zap.String("cacheKey", cacheKey),
+						zap.Error(err))
+				} else {
+					logger.Warn("Failed to persist direct photo cache",
+						zap.Int("messageID", messageID),
+						zap.String("cacheKey", cacheKey),
+						zap.Error(err))
+				}
 			} else {
 				logger.Debug("Direct photo cached",
 					zap.Int("messageID", messageID),
-					zap.String("cacheFile", cacheFile),
+					zap.String("cacheKey", cacheKey),
 					zap.Int("bytes", len(fileBytes)))
 			}
 
@@ -547,20 +590,86 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 
 		// Handle range requests for video/document streaming
 		ctx.Header("Accept-Ranges", "bytes")
-		var start, end int64
-		if rangeHeader == "" {
-			start = 0
-			end = file.FileSize - 1
-			w.WriteHeader(http.StatusOK)
-		} else {
-			ranges, err := range_parser.Parse(file.FileSize, r.Header.Get("Range"))
+		var ranges []*range_parser.Range
+		if rangeHeader != "" {
+			ranges, err = parseByteRanges(rangeHeader, file.FileSize)
+			if errors.Is(err, errRangeNotSatisfiable) {
+				ctx.Header("Content-Range", fmt.Sprintf("bytes */%d", file.FileSize))
+				ctx.JSON(http.StatusRequestedRangeNotSatisfiable, gin.H{
+					"error": errorText(ctx, "error.range_not_satisfiable"),
+				})
+				return
+			}
 			if err != nil {
 				logger.Warn("Failed to parse range header", zap.Error(err))
 				ctx.JSON(http.StatusBadRequest, gin.H{
-					"error": "invalid range header",
+					"error": errorText(ctx, "error.invalid_range"),
 				})
 				return
 			}
+		}
+
+		mimeType := file.MimeType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+
+		disposition := "inline"
+
+		// Allow forced download via query parameter
+		if ctx.Query("d") == "true" {
+			disposition = "attachment"
+		}
+
+		ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.FileName))
+		setFaststartHeaders(ctx, logger, selectedWorker, file)
+
+		// A worker failing mid-stream hands the rest of the range to another
+		src := channelSource(logger, selectedWorker, channelID, messageID, file)
+		src.tried = seenWorkerIDs
+		src.switched = func(from, to *bot.Worker) {
+			from.EndRequest(requestStartTime, true)
+			to.StartRequest()
+			setRequestWorker(ctx, to)
+			selectedWorker = to
+			reqLog.WorkerID = to.ID
+			reqLog.WorkerName = to.Self.Username
+		}
+
+		// Several ranges, e.g. from PDF viewers, get one part each
+		if len(ranges) > 1 {
+			body := newByteRangesBody(ranges, mimeType, file.FileSize)
+			reqLog.FileSize = file.FileSize
+			reqLog.RangeStart = ranges[0].Start
+			reqLog.RangeEnd = ranges[len(ranges)-1].End
+			reqLog.ChunkSize = body.length
+			ctx.Header("Content-Type", body.contentType())
+			ctx.Header("Content-Length", strconv.FormatInt(body.length, 10))
+			w.WriteHeader(http.StatusPartialContent)
+			if r.Method == http.MethodHead {
+				return
+			}
+			var dst io.Writer = w
+			if class == classBulk {
+				dst = bulkWriter(ctx.Request.Context(), w)
+			}
+			bytesWritten, err := body.write(bgCtx, dst, src)
+			if err != nil {
+				logger.Warn("Error while streaming byte ranges",
+					zap.Int("messageID", messageID),
+					zap.Int("ranges", len(ranges)),
+					zap.Int64("bytesWritten", bytesWritten),
+					zap.Error(err))
+			}
+			return
+		}
+
+		var start, end int64
+		if len(ranges) == 0 {
+			start = 0
+			end = file.FileSize - 1
+			w.WriteHeader(http.StatusOK)
+		} else {
 			start = ranges[0].Start
 			end = ranges[0].End
 			ctx.Header("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, file.FileSize))
@@ -578,35 +687,25 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 		reqLog.ChunkSize = end - start + 1
 
 		contentLength := end - start + 1
-		mimeType := file.MimeType
-
-		if mimeType == "" {
-			mimeType = "application/octet-stream"
-		}
 
 		ctx.Header("Content-Type", mimeType)
 		ctx.Header("Content-Length", strconv.FormatInt(contentLength, 10))
 
-		disposition := "inline"
-
-		// Allow forced download via query parameter
-		if ctx.Query("d") == "true" {
-			disposition = "attachment"
-		}
-
-		ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.FileName))
-
 		// Stream the file content
 		if r.Method != "HEAD" {
-			lr, err := utils.NewTelegramReader(bgCtx, selectedWorker.Client, file.Location, start, end, contentLength)
-			if err != nil {
-				logger.Error("Failed to create Telegram reader",
-					zap.Int("messageID", messageID),
-					zap.Error(err))
-				return
+			if authMethod != internalAuthMethod && isPlaybackStart(rangeHeader) {
+				stats.RecordOpen(stats.Open{
+					ChannelID: channelID,
+					MessageID: messageID,
+					Referrer:  r.Referer(),
+					UserAgent: r.UserAgent(),
+				})
 			}
-
-			bytesWritten, err := copyStreamWithBuffer(w, lr, contentLength)
+			var dst io.Writer = w
+			if class == classBulk {
+				dst = bulkWriter(ctx.Request.Context(), w)
+			}
+			bytesWritten, err := copyFileRange(bgCtx, src, start, end, dst)
 			if err != nil {
 				// Check if the error is due to client disconnection
 				if ctx.Request.Context().Err() != nil {
@@ -618,49 +717,6 @@ func getDirectStreamRoute(logger *zap.Logger, authService *streamauth.Service) g
 					return
 				}
 
-				// Check if it's FILE_REFERENCE_EXPIRED error and retry once
-				if err.Error() != "" && strings.Contains(err.Error(), "FILE_REFERENCE_EXPIRED") {
-					logger.Warn("FILE_REFERENCE_EXPIRED detected, refetching file metadata and retrying",
-						zap.Int("messageID", messageID))
-
-					// Refetch file metadata with fresh file_reference
-					freshFile, refetchErr := utils.RefetchFileFromMessageAndChannel(bgCtx, selectedWorker.Client, config.ValueOf.MediaChannelID, messageID)
-					if refetchErr != nil {
-						logger.Error("Failed to refetch file after FILE_REFERENCE_EXPIRED",
-							zap.Int("messageID", messageID),
-							zap.Error(refetchErr))
-						ctx.JSON(http.StatusInternalServerError, gin.H{
-							"error": "file reference expired and refetch failed",
-						})
-						return
-					}
-
-					// Retry streaming with fresh file_reference
-					lr2, err2 := utils.NewTelegramReader(bgCtx, selectedWorker.Client, freshFile.Location, start, end, contentLength)
-					if err2 != nil {
-						logger.Error("Failed to create Telegram reader after refetch",
-							zap.Int("messageID", messageID),
-							zap.Error(err2))
-						return
-					}
-
-					bytesWritten2, err2 := copyStreamWithBuffer(w, lr2, contentLength)
-					if err2 != nil {
-						logger.Error("Error while copying stream after refetch",
-							zap.Int("messageID", messageID),
-							zap.Int64("bytesWritten", bytesWritten2),
-							zap.Int64("expectedBytes", contentLength),
-							zap.Error(err2))
-						return
-					}
-
-					logger.Debug("Direct stream completed successfully after refetch",
-						zap.Int("messageID", messageID),
-						zap.String("filename", freshFile.FileName),
-						zap.Int64("bytesStreamed", bytesWritten2))
-					return
-				}
-
 				logger.Error("Error while copying stream",
 					zap.Int("messageID", messageID),
 					zap.Int64("bytesWritten", bytesWritten),
@@ -686,7 +742,7 @@ func copyStreamWithBuffer(dst io.Writer, src io.Reader, n int64) (int64, error)
 	}
 	defer streamCopyPool.Put(buf)
 
-	written, err := io.CopyBuffer(dst, io.LimitReader(src, n), buf)
+	written, err := io.CopyBuffer(meteredWriter{dst}, io.LimitReader(src, n), buf)
 	if err != nil {
 		return written, err
 	}
@@ -696,12 +752,31 @@ func copyStreamWithBuffer(dst io.Writer, src io.Reader, n int64) (int64, error)
 	return written, nil
 }
 
+// meteredWriter feeds streamed bytes to the bandwidth meter used for
+// cluster load reporting.
+type meteredWriter struct {
+	io.Writer
+}
+
+func (m meteredWriter) Write(p []byte) (int, error) {
+	n, err := m.Writer.Write(p)
+	stats.CountStreamed(int64(n))
+	return n, err
+}
+
 func extractStreamSessionToken(ctx *gin.Context, cookieName string) string {
 	queryToken := strings.TrimSpace(ctx.Query("st"))
 	if queryToken != "" {
 		return queryToken
 	}
 
+	// ?session= is the fallback for cross-site players where third-party
+	// cookies are blocked and custom headers can't be set on <video> tags
+	sessionQueryToken := strings.TrimSpace(ctx.Query("session"))
+	if sessionQueryToken != "" {
+		return sessionQueryToken
+	}
+
 	headerToken := strings.TrimSpace(ctx.GetHeader("x-stream-token"))
 	if headerToken != "" {
 		return headerToken
@@ -723,23 +798,11 @@ func extractStreamSessionToken(ctx *gin.Context, cookieName string) string {
 	return strings.TrimSpace(cookieToken)
 }
 
-func serveDirectPhotoFromCache(ctx *gin.Context, cacheFile, mimeType, fileName string) (bool, error) {
-	cacheInfo, err := os.Stat(cacheFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return false, nil
-		}
-		return false, err
-	}
-	if cacheInfo.IsDir() || cacheInfo.Size() == 0 {
-		return false, nil
-	}
-
-	cacheHandle, err := os.Open(cacheFile)
-	if err != nil {
+func serveDirectPhotoFromCache(ctx *gin.Context, cacheKey, mimeType, fileName string) (bool, error) {
+	cached, err := getCachedImage(ctx, cacheKey)
+	if err != nil || cached == nil {
 		return false, err
 	}
-	defer cacheHandle.Close()
 
 	if mimeType == "" {
 		mimeType = "image/jpeg"
@@ -752,12 +815,12 @@ func serveDirectPhotoFromCache(ctx *gin.Context, cacheFile, mimeType, fileName s
 	if ctx.Request.Method == http.MethodHead {
 		ctx.Header("Content-Disposition", headers["Content-Disposition"])
 		ctx.Header("Content-Type", mimeType)
-		ctx.Header("Content-Length", strconv.FormatInt(cacheInfo.Size(), 10))
+		ctx.Header("Content-Length", strconv.Itoa(len(cached)))
 		ctx.Status(http.StatusOK)
 		return true, nil
 	}
 
-	ctx.DataFromReader(http.StatusOK, cacheInfo.Size(), mimeType, cacheHandle, headers)
+	ctx.DataFromReader(http.StatusOK, int64(len(cached)), mimeType, bytes.NewReader(cached), headers)
 	return true, nil
 }
 
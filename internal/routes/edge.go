@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// maxEdgeImageBytes caps how much of an origin image response the edge buffers.
+const maxEdgeImageBytes = 10 * 1024 * 1024
+
+// LoadEdge wires the routes of an edge instance. /thumb is served from the
+// image store, revalidated against and filled from the origin; everything
+// else (/direct, /stream, /auth) is reverse-proxied untouched so the origin
+// keeps handling auth, ranges and ETags.
+func LoadEdge(log *zap.Logger, r *gin.Engine, origin string) error {
+	log = log.Named("Edge")
+	originURL, err := url.Parse(origin)
+	if err != nil || originURL.Host == "" {
+		return fmt.Errorf("invalid EDGE_ORIGIN_URL %q", origin)
+	}
+	if err := initImageStore(log); err != nil {
+		return err
+	}
+
+	proxy := httputil.NewSingleHostReverseProxy(originURL)
+	director := proxy.Director
+	proxy.Director = func(req *http.Request) {
+		director(req)
+		req.Host = originURL.Host
+	}
+	// Stream bytes as they arrive instead of buffering video chunks
+	proxy.FlushInterval = -1
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		log.Warn("Origin request failed", zap.String("path", req.URL.Path), zap.Error(err))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	r.GET("/thumb/:messageID", getEdgeThumbRoute(log, client, origin))
+	r.NoRoute(gin.WrapH(proxy))
+	log.Info("Loaded edge routes", zap.String("origin", origin))
+	return nil
+}
+
+func getEdgeThumbRoute(logger *zap.Logger, client *http.Client, origin string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		// Opaque IDs resolve with the ID_OBFUSCATION_KEY shared with the origin
+		messageIDParam := ctx.Param("messageID")
+		messageID, err := strconv.Atoi(messageIDParam)
+		if err != nil && opaqueid.Enabled() {
+			_, messageID, err = opaqueid.Decode(messageIDParam)
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid message ID",
+			})
+			return
+		}
+
+		key := imageCacheKey(messageID)
+		cached, err := getCachedImage(ctx, key)
+		if err != nil {
+			logger.Warn("Failed to read cached thumbnail", zap.String("key", key), zap.Error(err))
+		}
+
+		// The origin authorizes every request: credentials are forwarded and a
+		// cached copy is only revalidated with If-None-Match, so hits stay cheap
+		// without letting the edge serve media to unauthenticated clients.
+		originURL := origin + "/thumb/" + messageIDParam
+		if ctx.Request.URL.RawQuery != "" {
+			originURL += "?" + ctx.Request.URL.RawQuery
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, originURL, nil)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for _, header := range []string{"Authorization", "Cookie", "X-Stream-Token"} {
+			if value := ctx.GetHeader(header); value != "" {
+				req.Header.Set(header, value)
+			}
+		}
+		if cached != nil {
+			req.Header.Set("If-None-Match", imageETag(cached))
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			logger.Warn("Origin thumbnail request failed", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "origin unreachable",
+			})
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotModified && cached != nil {
+			serveImage(ctx, cached)
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			ctx.DataFromReader(resp.StatusCode, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+			return
+		}
+
+		if resp.ContentLength > maxEdgeImageBytes {
+			logger.Warn("Origin thumbnail too large", zap.Int("messageID", messageID), zap.Int64("length", resp.ContentLength))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "thumbnail from origin is too large",
+			})
+			return
+		}
+		// One byte past the cap tells a body without Content-Length that is
+		// too large from one that fits, so a cut-off image is never cached
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxEdgeImageBytes+1))
+		if err == nil && len(data) > maxEdgeImageBytes {
+			logger.Warn("Origin thumbnail too large", zap.Int("messageID", messageID))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "thumbnail from origin is too large",
+			})
+			return
+		}
+		if err != nil {
+			logger.Warn("Failed to read origin thumbnail", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to read thumbnail from origin",
+			})
+			return
+		}
+		if err := imageStore.Put(ctx, key, data); err != nil {
+			logger.Warn("Failed to cache origin thumbnail", zap.String("key", key), zap.Error(err))
+		}
+		serveImage(ctx, data)
+	}
+}
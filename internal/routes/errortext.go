@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/i18n"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errorText is the error message key in the first language of the request's
+// Accept-Language with a catalog, else English. Embedded players often show
+// the error body as is, so it is worth reading in the viewer's language.
+func errorText(ctx *gin.Context, key string, args ...any) string {
+	lang := i18n.AcceptLanguage(ctx.GetHeader("Accept-Language"))
+	if lang == "" {
+		lang = i18n.DefaultLang
+	}
+	ctx.Header("Content-Language", lang)
+	ctx.Writer.Header().Add("Vary", "Accept-Language")
+	return i18n.T(lang, key, args...)
+}
@@ -0,0 +1,93 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/types"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// imageETag derives a strong ETag from image bytes. Edges compute it from
+// their cached copy, so it must only depend on the content.
+func imageETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// fileETag identifies a Telegram file by its ID and size, which never change
+// for the same media.
+func fileETag(file *types.File) string {
+	return fmt.Sprintf(`"%d-%d"`, file.ID, file.FileSize)
+}
+
+// fileModTime is the Last-Modified of file, zero when its date is unknown.
+func fileModTime(file *types.File) time.Time {
+	if file.Date <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(file.Date), 0).UTC()
+}
+
+// fileNotModified sends the ETag and Last-Modified of file and reports
+// whether If-None-Match or, without it, If-Modified-Since make the request
+// a 304.
+func fileNotModified(ctx *gin.Context, file *types.File) bool {
+	etag, modTime := fileETag(file), fileModTime(file)
+	ctx.Header("ETag", etag)
+	if !modTime.IsZero() {
+		ctx.Header("Last-Modified", modTime.Format(http.TimeFormat))
+	}
+	r := ctx.Request
+	if r.Header.Get("If-None-Match") != "" {
+		return etagMatches(r, etag)
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.IsZero() && !modTime.After(since)
+}
+
+// ifRangeMatches reports whether the validator in If-Range still matches
+// file, so its Range can be honored. Weak ETags never match.
+func ifRangeMatches(r *http.Request, file *types.File) bool {
+	value := strings.TrimSpace(r.Header.Get("If-Range"))
+	if value == "" {
+		return true
+	}
+	if strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "W/") {
+		return value == fileETag(file)
+	}
+	modTime := fileModTime(file)
+	t, err := http.ParseTime(value)
+	return err == nil && !modTime.IsZero() && modTime.Equal(t)
+}
+
+// etagMatches reports whether the request's If-None-Match covers etag.
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// serveImage writes a cached image with its ETag, answering 304 when the
+// client already has it.
+func serveImage(ctx *gin.Context, data []byte) {
+	etag := imageETag(data)
+	ctx.Header("ETag", etag)
+	if etagMatches(ctx.Request, etag) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, "image/jpeg", data)
+}
@@ -0,0 +1,138 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/types"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// maxStreamFailovers bounds how many other workers one copy moves to before
+// it gives up.
+const maxStreamFailovers = 2
+
+// rangeSource is where a copy reads a file from: the worker, the file as that
+// worker sees it (file references are tied to the bot), and how to look the
+// file up again on any worker.
+type rangeSource struct {
+	worker *bot.Worker
+	file   *types.File
+	// lookup returns the file's metadata for w, bypassing the cache when fresh.
+	lookup func(ctx context.Context, w *bot.Worker, fresh bool) (*types.File, error)
+	// tried are the workers not to fail over to; the current one is added.
+	tried []int
+	// switched, when set, is told the copy moved to another worker.
+	switched func(from, to *bot.Worker)
+	logger   *zap.Logger
+}
+
+// channelSource reads a message of channelID through FileFromMessageAndChannel.
+func channelSource(logger *zap.Logger, worker *bot.Worker, channelID int64, messageID int, file *types.File) *rangeSource {
+	return &rangeSource{
+		worker: worker,
+		file:   file,
+		lookup: func(ctx context.Context, w *bot.Worker, fresh bool) (*types.File, error) {
+			if fresh {
+				return utils.RefetchFileFromMessageAndChannel(ctx, w.Client, channelID, messageID)
+			}
+			return utils.FileFromMessageAndChannel(ctx, w.Client, channelID, messageID)
+		},
+		logger: logger,
+	}
+}
+
+// copyFileRange copies bytes start..end of the source's file from Telegram.
+// When reading fails partway, the copy resumes where it stopped instead of
+// cutting the response short: an expired file reference, which long copies
+// can outlive, is refreshed once on the same worker, and other Telegram
+// errors move the rest of the range to another worker. Errors writing to dst
+// end the copy, the client is gone.
+func copyFileRange(ctx context.Context, src *rangeSource, start, end int64, dst io.Writer) (int64, error) {
+	out := &failoverWriter{Writer: dst}
+	var written int64
+	refetched, failovers := false, 0
+	for {
+		remaining := end - start + 1 - written
+		lr, err := utils.NewTelegramReader(ctx, src.worker.Client, src.file.Location, start+written, end, remaining)
+		if err == nil {
+			var n int64
+			n, err = copyStreamWithBuffer(out, limitStreamRate(ctx, lr), remaining)
+			written += n
+		}
+		if err == nil || out.err != nil || ctx.Err() != nil {
+			return written, err
+		}
+
+		if !refetched && strings.Contains(err.Error(), "FILE_REFERENCE_EXPIRED") {
+			refetched = true
+			fresh, refetchErr := src.lookup(ctx, src.worker, true)
+			if refetchErr != nil {
+				return written, refetchErr
+			}
+			src.file = fresh
+			continue
+		}
+		if failovers >= maxStreamFailovers {
+			return written, err
+		}
+		failovers++
+		next, file, nextErr := src.nextWorker(ctx)
+		if nextErr != nil {
+			return written, fmt.Errorf("%w; no worker to resume on: %v", err, nextErr)
+		}
+		src.logger.Warn("Worker failed mid-stream, resuming on another worker",
+			zap.Int("fromWorkerID", src.worker.ID),
+			zap.Int("toWorkerID", next.ID),
+			zap.Int64("offset", start+written),
+			zap.Error(err))
+		if src.switched != nil {
+			src.switched(src.worker, next)
+		}
+		src.worker, src.file = next, file
+		refetched = false
+	}
+}
+
+// nextWorker picks a worker not tried yet that sees the same file.
+func (src *rangeSource) nextWorker(ctx context.Context) (*bot.Worker, *types.File, error) {
+	src.tried = append(src.tried, src.worker.ID)
+	for {
+		next := bot.GetNextWorkerExcluding(src.tried)
+		if next == nil {
+			return nil, nil, fmt.Errorf("all workers tried")
+		}
+		src.tried = append(src.tried, next.ID)
+		lookupCtx, cancel := context.WithTimeout(ctx, metadataFetchTimeout)
+		file, err := src.lookup(lookupCtx, next, false)
+		cancel()
+		if err != nil {
+			src.logger.Debug("Failover worker can't read the file", zap.Int("workerID", next.ID), zap.Error(err))
+			continue
+		}
+		// A message edited meanwhile holds another file; its bytes don't continue ours
+		if file.ID != src.file.ID || file.FileSize != src.file.FileSize {
+			return nil, nil, fmt.Errorf("file changed during the stream")
+		}
+		return next, file, nil
+	}
+}
+
+// failoverWriter remembers the first write error, which tells a client that
+// went away from a worker that failed.
+type failoverWriter struct {
+	io.Writer
+	err error
+}
+
+func (w *failoverWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return n, err
+}
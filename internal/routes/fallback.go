@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Reasons reported in the "code" field of a 503.
+const (
+	unavailableNoWorkers = "no_workers"
+	unavailableTelegram  = "telegram_unavailable"
+	unavailableBusy      = "busy"
+	// the workers aren't members of the channel, see bot.WarmUpPeers
+	unavailableNoAccess = "no_channel_access"
+)
+
+// unavailableRetryAfter is the Retry-After sent with 503s, in seconds. Busy
+// workers free up quickly; Telegram outages take longer.
+var unavailableRetryAfter = map[string]int{
+	unavailableNoWorkers: 15,
+	unavailableTelegram:  30,
+	unavailableBusy:      5,
+	unavailableNoAccess:  300,
+}
+
+// unavailableResponses counts the 503s sent for each reason, for /metrics.
+var unavailableResponses = map[string]*int64{
+	unavailableNoWorkers: new(int64),
+	unavailableTelegram:  new(int64),
+	unavailableBusy:      new(int64),
+	unavailableNoAccess:  new(int64),
+}
+
+// fallbackURL expands FALLBACK_URL for messageID, or returns "" when none is
+// configured.
+func fallbackURL(messageID int) string {
+	if config.ValueOf.FallbackURL == "" {
+		return ""
+	}
+	return strings.ReplaceAll(config.ValueOf.FallbackURL, "{id}", strconv.Itoa(messageID))
+}
+
+// respondUnavailable answers 503 with a machine-readable reason and, when
+// configured, where clients can fetch the file instead, so apps can degrade
+// gracefully rather than keep retrying. Requests for several messages pass a
+// messageID of 0 and get no fallback.
+func respondUnavailable(ctx *gin.Context, code string, messageID int) {
+	atomic.AddInt64(unavailableResponses[code], 1)
+	retryAfter := unavailableRetryAfter[code]
+	ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+	body := gin.H{
+		"error":       errorText(ctx, "error.unavailable."+code),
+		"code":        code,
+		"retry_after": retryAfter,
+	}
+	if url := fallbackURL(messageID); url != "" && messageID > 0 {
+		ctx.Header("X-Fallback-URL", url)
+		body["fallback_url"] = url
+	}
+	ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, body)
+}
+
+// acquireWorker returns the worker chosen by pick, or answers 503 and returns
+// nil when there is none, so handlers never dereference a missing worker.
+func acquireWorker(ctx *gin.Context, logger *zap.Logger, pick func() *bot.Worker, messageID int) *bot.Worker {
+	if worker := pick(); worker != nil {
+		setRequestWorker(ctx, worker)
+		return worker
+	}
+	logger.Error("No workers available", zap.Int("messageID", messageID))
+	respondUnavailable(ctx, unavailableNoWorkers, messageID)
+	return nil
+}
@@ -0,0 +1,212 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/types"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// mp4HeadBytes is read from the start of a file to find its first
+	// boxes; Telegram sends whole chunks anyway.
+	mp4HeadBytes      = 64 * 1024
+	mp4MaxBoxes       = 16
+	mp4LayoutTimeout  = 10 * time.Second
+	moovPrefetchLimit = 64 * 1024 * 1024
+	mp4LayoutsKept    = 10000
+	// mp4FailureRetry is how long a file whose layout couldn't be found is
+	// left alone
+	mp4FailureRetry = 30 * time.Minute
+)
+
+// mp4MimeTypes are the files whose layout is looked at.
+var mp4MimeTypes = map[string]bool{
+	"video/mp4":       true,
+	"video/quicktime": true,
+	"video/x-m4v":     true,
+	"audio/mp4":       true,
+	"audio/x-m4a":     true,
+}
+
+var errNotMP4 = errors.New("not an MP4 file")
+
+// mp4Layout is where an MP4 keeps its moov box, the index players need
+// before the first frame. Files that aren't faststart have it after the
+// media data, so players first seek to the end of the file.
+type mp4Layout struct {
+	faststart bool
+	moovStart int64
+	moovEnd   int64
+	// failedAt is set when the layout couldn't be found, which is not
+	// tried again before mp4FailureRetry
+	failedAt time.Time
+}
+
+var (
+	mp4LayoutsMu sync.Mutex
+	mp4Layouts   = make(map[int64]mp4Layout) // by file ID
+	mp4Probing   sync.Map
+	moovFetching sync.Map
+)
+
+// setFaststartHeaders sends X-FSB-Faststart for MP4s and, for those that
+// aren't, X-FSB-Moov-Range with the Range that fetches their moov. Only
+// layouts already known are sent: the first request of a file starts
+// looking for it in the background instead of waiting on Telegram. With
+// MOOV_PREFETCH, the moov is fetched into the chunk cache when playback
+// starts, so the player's seek to it doesn't wait on Telegram either.
+func setFaststartHeaders(ctx *gin.Context, logger *zap.Logger, worker *bot.Worker, file *types.File) {
+	if !config.Live().FaststartCheck || !mp4MimeTypes[strings.ToLower(file.MimeType)] {
+		return
+	}
+	playbackStart := ctx.Request.Method != http.MethodHead && isPlaybackStart(ctx.GetHeader("Range"))
+	prefetch := playbackStart && config.Live().MoovPrefetch && utils.ChunkCacheEnabled()
+	layout, ok := cachedMP4Layout(file.ID)
+	if !ok {
+		go probeMP4Layout(logger, worker, file, prefetch)
+		return
+	}
+	if !layout.failedAt.IsZero() {
+		return
+	}
+	ctx.Header("X-FSB-Faststart", strconv.FormatBool(layout.faststart))
+	if layout.faststart {
+		return
+	}
+	ctx.Header("X-FSB-Moov-Range", fmt.Sprintf("bytes=%d-%d", layout.moovStart, layout.moovEnd))
+	if prefetch {
+		go prefetchMoov(logger, worker, file, layout)
+	}
+}
+
+// cachedMP4Layout returns the known layout of a file, failed or not. Failed
+// ones are forgotten after mp4FailureRetry.
+func cachedMP4Layout(fileID int64) (mp4Layout, bool) {
+	mp4LayoutsMu.Lock()
+	defer mp4LayoutsMu.Unlock()
+	layout, ok := mp4Layouts[fileID]
+	if ok && !layout.failedAt.IsZero() && time.Since(layout.failedAt) > mp4FailureRetry {
+		delete(mp4Layouts, fileID)
+		return mp4Layout{}, false
+	}
+	return layout, ok
+}
+
+// probeMP4Layout reads the box headers of file from Telegram and keeps its
+// layout, or the failure, for the next requests. With prefetch, the moov of
+// a file that isn't faststart is fetched right away.
+func probeMP4Layout(logger *zap.Logger, worker *bot.Worker, file *types.File, prefetch bool) {
+	if _, busy := mp4Probing.LoadOrStore(file.ID, true); busy {
+		return
+	}
+	defer mp4Probing.Delete(file.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), mp4LayoutTimeout)
+	defer cancel()
+	read := func(offset, length int64) ([]byte, error) {
+		length = min(length, file.FileSize-offset)
+		lr, err := utils.NewTelegramReader(ctx, worker.Client, file.Location, offset, offset+length-1, length)
+		if err != nil {
+			return nil, err
+		}
+		defer lr.Close()
+		return io.ReadAll(lr)
+	}
+	layout, err := findMP4Layout(read, file.FileSize)
+	if err != nil {
+		logger.Debug("Failed to find the MP4 layout", zap.Int64("fileID", file.ID), zap.Error(err))
+		layout = mp4Layout{failedAt: time.Now()}
+	}
+	mp4LayoutsMu.Lock()
+	if len(mp4Layouts) >= mp4LayoutsKept {
+		for id := range mp4Layouts {
+			delete(mp4Layouts, id)
+			break
+		}
+	}
+	mp4Layouts[file.ID] = layout
+	mp4LayoutsMu.Unlock()
+	if err == nil && !layout.faststart && prefetch {
+		prefetchMoov(logger, worker, file, layout)
+	}
+}
+
+// findMP4Layout walks the top-level boxes of a file of size bytes until it
+// meets the moov. Box headers past the first read are fetched one by one,
+// which for the usual ftyp, mdat, moov order is one more read.
+func findMP4Layout(read func(offset, length int64) ([]byte, error), size int64) (mp4Layout, error) {
+	head, err := read(0, mp4HeadBytes)
+	if err != nil {
+		return mp4Layout{}, err
+	}
+	var offset int64
+	sawMdat := false
+	for i := 0; i < mp4MaxBoxes && offset+8 <= size; i++ {
+		header := head[min(offset, int64(len(head))):]
+		if int64(len(header)) < 16 && offset+int64(len(header)) < size {
+			if header, err = read(offset, 16); err != nil {
+				return mp4Layout{}, err
+			}
+		}
+		if len(header) < 8 {
+			break
+		}
+		boxSize, boxType := int64(binary.BigEndian.Uint32(header)), string(header[4:8])
+		switch {
+		case boxSize == 1 && len(header) >= 16:
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		case boxSize == 0:
+			boxSize = size - offset
+		}
+		if i == 0 && boxType != "ftyp" {
+			return mp4Layout{}, errNotMP4
+		}
+		if boxSize < 8 || offset+boxSize > size {
+			return mp4Layout{}, fmt.Errorf("box %q at %d has a bad size", boxType, offset)
+		}
+		switch boxType {
+		case "moov":
+			return mp4Layout{faststart: !sawMdat, moovStart: offset, moovEnd: offset + boxSize - 1}, nil
+		case "mdat":
+			sawMdat = true
+		}
+		offset += boxSize
+	}
+	return mp4Layout{}, errors.New("no moov box found")
+}
+
+// prefetchMoov reads the moov of a file that isn't faststart, which stores
+// its chunks in the chunk cache.
+func prefetchMoov(logger *zap.Logger, worker *bot.Worker, file *types.File, layout mp4Layout) {
+	length := layout.moovEnd - layout.moovStart + 1
+	if length > moovPrefetchLimit {
+		return
+	}
+	if _, busy := moovFetching.LoadOrStore(file.ID, true); busy {
+		return
+	}
+	defer moovFetching.Delete(file.ID)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	lr, err := utils.NewTelegramReader(ctx, worker.Client, file.Location, layout.moovStart, layout.moovEnd, length)
+	if err == nil {
+		_, err = io.Copy(io.Discard, lr)
+		lr.Close()
+	}
+	if err != nil {
+		logger.Debug("Failed to prefetch the moov", zap.Int64("fileID", file.ID), zap.Error(err))
+	}
+}
@@ -0,0 +1,26 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/stats"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setFileStatsHeaders adds the views and last access of a file to a HEAD
+// response, for callers holding an admin token of any role. Media auth may already use
+// Authorization, so the token comes in its own header.
+func setFileStatsHeaders(ctx *gin.Context, channelID int64, messageID int) {
+	if !config.ValueOf.FileStatsHeaders || config.ValueOf.AdminRole(ctx.GetHeader("X-FSB-Admin-Token")) == "" {
+		return
+	}
+	access, ok := stats.GetFileAccess(channelID, messageID)
+	ctx.Header("X-FSB-Views", strconv.FormatInt(access.Views, 10))
+	if ok && !access.LastAccessed.IsZero() {
+		ctx.Header("X-FSB-Last-Accessed", access.LastAccessed.UTC().Format(http.TimeFormat))
+	}
+	// The numbers are per admin, keep them out of shared caches
+	ctx.Header("Cache-Control", "private, no-store")
+}
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/premium"
 	"EverythingSuckz/fsb/internal/streamauth"
 	"net/http"
 	"strings"
@@ -20,13 +22,18 @@ func (e *allRoutes) LoadFirebaseAuth(r *Route) {
 	}
 
 	handler := getFirebaseExchangeRoute(authLog, e.streamAuth)
-	r.Engine.POST("/auth/firebase/exchange", handler)
-	r.Engine.GET("/auth/firebase/exchange", handler)
+	r.Router.POST("/auth/firebase/exchange", handler)
+	r.Router.GET("/auth/firebase/exchange", handler)
+	r.Router.GET("/auth/session", getSessionRoute(e.streamAuth))
 	authLog.Info("Loaded firebase auth exchange route")
 }
 
 func getFirebaseExchangeRoute(logger *zap.Logger, authService *streamauth.Service) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if authBanned(ctx) {
+			return
+		}
 		bearerToken := extractBearerToken(ctx.GetHeader("Authorization"))
 		if bearerToken == "" {
 			ctx.JSON(http.StatusUnauthorized, gin.H{
@@ -35,8 +42,29 @@ func getFirebaseExchangeRoute(logger *zap.Logger, authService *streamauth.Servic
 			return
 		}
 
+		if authService.AppCheckEnabled() {
+			appCheckToken := strings.TrimSpace(ctx.GetHeader("X-Firebase-AppCheck"))
+			if appCheckToken == "" {
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"error": "missing app check token",
+				})
+				return
+			}
+			if _, err := authService.VerifyAppCheckToken(ctx.Request.Context(), appCheckToken); err != nil {
+				recordAuthFailure(ctx, logger, authFailureAppCheck)
+				logger.Warn("App Check token verification failed",
+					zap.String("clientIP", ctx.ClientIP()),
+					zap.Error(err))
+				ctx.JSON(http.StatusUnauthorized, gin.H{
+					"error": "invalid app check token",
+				})
+				return
+			}
+		}
+
 		claims, err := authService.VerifyFirebaseToken(ctx.Request.Context(), bearerToken)
 		if err != nil {
+			recordAuthFailure(ctx, logger, authFailureFirebase)
 			logger.Warn("Firebase token verification failed",
 				zap.String("clientIP", ctx.ClientIP()),
 				zap.Error(err))
@@ -46,7 +74,7 @@ func getFirebaseExchangeRoute(logger *zap.Logger, authService *streamauth.Servic
 			return
 		}
 
-		sessionToken, expiresAt, err := authService.CreateSession(claims.Subject, claims.Email)
+		sessionToken, expiresAt, err := authService.CreateSession(claims)
 		if err != nil {
 			logger.Error("Failed to create stream session", zap.Error(err))
 			ctx.JSON(http.StatusInternalServerError, gin.H{
@@ -55,22 +83,7 @@ func getFirebaseExchangeRoute(logger *zap.Logger, authService *streamauth.Servic
 			return
 		}
 
-		maxAge := int(time.Until(expiresAt).Seconds())
-		if maxAge < 0 {
-			maxAge = 0
-		}
-
-		http.SetCookie(ctx.Writer, &http.Cookie{
-			Name:     authService.CookieName(),
-			Value:    sessionToken,
-			Path:     "/",
-			Domain:   authService.CookieDomain(),
-			MaxAge:   maxAge,
-			Expires:  expiresAt,
-			HttpOnly: true,
-			Secure:   authService.CookieSecure(),
-			SameSite: http.SameSiteLaxMode,
-		})
+		setSessionCookie(ctx, authService, sessionToken, expiresAt)
 
 		ctx.Header("Cache-Control", "no-store")
 		ctx.JSON(http.StatusOK, gin.H{
@@ -79,6 +92,69 @@ func getFirebaseExchangeRoute(logger *zap.Logger, authService *streamauth.Servic
 			"expires_at":   expiresAt.Unix(),
 			"user_id":      claims.Subject,
 			"email":        claims.Email,
+			"project_id":   claims.ProjectID,
+			"base_url":     requestLinkBase(ctx.Request),
+		})
+	}
+}
+
+// setSessionCookie stores the stream session token in the exchange cookie
+// until expiresAt.
+func setSessionCookie(ctx *gin.Context, authService *streamauth.Service, token string, expiresAt time.Time) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	if maxAge < 0 {
+		maxAge = 0
+	}
+
+	http.SetCookie(ctx.Writer, &http.Cookie{
+		Name:     authService.CookieName(),
+		Value:    token,
+		Path:     config.ValueOf.BasePath + "/",
+		Domain:   authService.CookieDomain(),
+		MaxAge:   maxAge,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   authService.CookieSecureFor(ctx.Request),
+		SameSite: authService.CookieSameSite(),
+	})
+}
+
+// getSessionRoute reports the session behind the request's stream token so
+// frontends can check the cookie without attempting a stream.
+func getSessionRoute(authService *streamauth.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "no-store")
+		sessionToken := extractStreamSessionToken(ctx, authService.CookieName())
+		if sessionToken == "" {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"error": "missing stream session token",
+			})
+			return
+		}
+		session, valid := authService.ValidateSession(sessionToken)
+		if !valid {
+			ctx.JSON(http.StatusUnauthorized, gin.H{
+				"error": "invalid or expired stream session",
+			})
+			return
+		}
+
+		expiresIn := int64(time.Until(session.ExpiresAt).Seconds())
+		if expiresIn < 0 {
+			expiresIn = 0
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"user_id":    session.UserID,
+			"email":      session.Email,
+			"project_id": session.ProjectID,
+			"created_at": session.CreatedAt.Unix(),
+			"expires_at": session.ExpiresAt.Unix(),
+			"expires_in": expiresIn,
+			"scopes":     session.Scopes,
+			"claims":     session.Claims,
+			"role":       premium.Role(session.UserID),
+			// No per-user quota is enforced yet; null means unlimited
+			"remaining_quota": nil,
 		})
 	}
 }
@@ -93,3 +169,21 @@ func extractBearerToken(value string) string {
 	}
 	return strings.TrimSpace(value[7:])
 }
+
+// requestLinkBase is the base clients should use for media links: the host
+// of their region with REGION_HOSTS, then PUBLIC_URL when set, otherwise the
+// scheme and host the client reached us on (through X-Forwarded-* with
+// TRUST_FORWARDED_HEADERS), falling back to HOST.
+func requestLinkBase(r *http.Request) string {
+	if base, ok := config.ValueOf.RegionURL(requestRegion(r)); ok {
+		return base
+	}
+	if config.ValueOf.PublicURL != "" {
+		return config.ValueOf.PublicURL
+	}
+	base := streamauth.RequestBaseURL(r, config.ValueOf.TrustForwardedHeaders)
+	if base == "" {
+		return config.ValueOf.LinkBase()
+	}
+	return base + config.ValueOf.BasePath
+}
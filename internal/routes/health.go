@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/cache"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// loadHealth registers the probes for Kubernetes and load balancers. They
+// are cheap enough to poll every second, unlike /status.
+func loadHealth(log *zap.Logger, r *Route) {
+	healthLog := log.Named("Health")
+	defer healthLog.Info("Loaded health routes")
+	r.Router.GET("/healthz", healthzRoute)
+	r.Router.HEAD("/healthz", healthzRoute)
+	r.Router.GET("/readyz", readyzRoute)
+	r.Router.HEAD("/readyz", readyzRoute)
+}
+
+func (e *allRoutes) LoadHealth(r *Route) {
+	loadHealth(e.log, r)
+}
+
+// healthzRoute answers as long as the process serves HTTP.
+func healthzRoute(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, gin.H{
+		"ok": true,
+	})
+}
+
+// readyzRoute answers 503 until a worker is serving, Telegram answers its
+// pings and the metadata cache is up, so traffic only goes to instances
+// that can stream.
+func readyzRoute(ctx *gin.Context) {
+	workers := bot.Readiness()
+	cacheReady := cache.GetCache() != nil
+	ready := workers.Serving > 0 && workers.Reachable && cacheReady
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(status, gin.H{
+		"ready":   ready,
+		"workers": workers,
+		"cache":   cacheReady,
+	})
+}
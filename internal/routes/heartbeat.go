@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const heartbeatWarmTimeout = 30 * time.Second
+
+// heartbeatWarming holds the files a heartbeat is fetching the metadata of,
+// so viewers of the same file don't fetch it in parallel.
+var heartbeatWarming sync.Map
+
+// heartbeatRequest is what players post every minute or so while playing.
+type heartbeatRequest struct {
+	MessageID int     `json:"message_id"`
+	Channel   string  `json:"channel"` // a MEDIA_CHANNELS alias; MEDIA_CHANNEL_ID when empty
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+}
+
+// LoadHeartbeat registers the endpoint players ping during playback. It
+// renews the stream session, records the watch position and keeps the
+// file's metadata cached so seeks don't wait on Telegram.
+func (e *allRoutes) LoadHeartbeat(r *Route) {
+	heartbeatLog := e.log.Named("Heartbeat")
+	defer heartbeatLog.Info("Loaded heartbeat route")
+	r.Router.POST("/api/heartbeat", e.mediaAuth, rateLimit(false), heartbeatRoute(heartbeatLog, e))
+}
+
+func heartbeatRoute(logger *zap.Logger, e *allRoutes) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		var req heartbeatRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil || req.MessageID <= 0 ||
+			!validPlaybackSeconds(req.Position) || !validPlaybackSeconds(req.Duration) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "expected a JSON body with a message_id and a non-negative position",
+			})
+			return
+		}
+		channelID := config.ValueOf.MediaChannelID
+		if req.Channel != "" {
+			channel, ok := config.ValueOf.MediaChannelFor(req.Channel)
+			if !ok {
+				ctx.JSON(http.StatusBadRequest, gin.H{
+					"error": "unknown channel",
+				})
+				return
+			}
+			channelID = channel.ID
+		}
+		// Revoked files get neither a renewal nor their metadata fetched
+		if abortIfBlocked(ctx, channelID, req.MessageID) {
+			return
+		}
+
+		session, authMethod := streamSessionFrom(ctx)
+		response := gin.H{}
+		if authMethod == sessionAuthMethod {
+			token := extractStreamSessionToken(ctx, e.streamAuth.CookieName())
+			if renewed, ok := e.streamAuth.RenewSession(token); ok {
+				if cookie, err := ctx.Cookie(e.streamAuth.CookieName()); err == nil && cookie == token {
+					setSessionCookie(ctx, e.streamAuth, token, renewed.ExpiresAt)
+				}
+				response["expires_at"] = renewed.ExpiresAt.Unix()
+			}
+		}
+
+		// Resume positions are kept for the default channel only, like the
+		// progress API
+		if session.UserID != "" && req.Channel == "" && req.Position > 0 && database.DB != nil {
+			err := stats.SaveProgress(stats.PlaybackProgress{
+				UserID:    session.UserID,
+				MessageID: req.MessageID,
+				Position:  req.Position,
+				Duration:  req.Duration,
+			})
+			if err != nil {
+				logger.Warn("Failed to save heartbeat progress", zap.Int("messageID", req.MessageID), zap.Error(err))
+			}
+		}
+
+		if channelID != 0 {
+			go warmFileMetadata(logger, channelID, req.MessageID)
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, response)
+	}
+}
+
+// warmFileMetadata fetches the metadata of a file being played into the
+// cache, unless it is still there, so the player's next range request
+// doesn't wait on Telegram.
+func warmFileMetadata(logger *zap.Logger, channelID int64, messageID int) {
+	key := [2]int64{channelID, int64(messageID)}
+	if _, busy := heartbeatWarming.LoadOrStore(key, true); busy {
+		return
+	}
+	defer heartbeatWarming.Delete(key)
+	worker := bot.GetNextWorker()
+	if worker == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), heartbeatWarmTimeout)
+	defer cancel()
+	if _, err := utils.FileFromMessageAndChannel(ctx, worker.Client, channelID, messageID); err != nil {
+		logger.Debug("Failed to warm file metadata", zap.Int("messageID", messageID), zap.Error(err))
+	}
+}
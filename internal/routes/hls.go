@@ -0,0 +1,395 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/transcode"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	hlsPlaylistType = "application/vnd.apple.mpegurl"
+	hlsSourceName   = "source"
+	hlsProbeTimeout = 30 * time.Second
+	// hlsKeyframeTimeout bounds the scan for keyframes, which reads the
+	// whole variant
+	hlsKeyframeTimeout = 10 * time.Minute
+
+	hlsProbeCacheSize = 10000
+)
+
+// hlsSlots bounds concurrent ffmpeg remuxes of segments.
+var hlsSlots chan struct{}
+
+// hlsProbe is what the playlists need to know about a variant.
+type hlsProbe struct {
+	duration float64 // seconds
+	bitRate  int64   // bits per second
+	height   int
+	width    int
+}
+
+var (
+	hlsProbeMu    sync.Mutex
+	hlsProbeCache = make(map[string]hlsProbe)
+	// hlsSegmentCache keeps the segment start times of a variant
+	hlsSegmentCache = make(map[string][]float64)
+)
+
+// LoadHLS registers /hls, which serves channel videos as HLS for players that
+// can't play progressive MP4 well. Segments are cut from /direct (or from a
+// rendition) by ffmpeg without re-encoding, so they start on keyframes. It
+// needs ffmpeg and ffprobe.
+func (e *allRoutes) LoadHLS(r *Route) {
+	hlsLog := e.log.Named("HLS")
+	for _, tool := range []string{config.ValueOf.FFmpegPath, config.ValueOf.FFprobePath} {
+		if _, err := exec.LookPath(tool); err != nil {
+			hlsLog.Info("HLS route disabled, tool not found", zap.String("tool", tool))
+			return
+		}
+	}
+	slots := max(config.ValueOf.HLSMaxJobs, 1)
+	hlsSlots = make(chan struct{}, slots)
+	r.Router.GET("/hls/:messageID", opaqueIDParams(false), e.mediaAuth, premiumOnly("hls"), rateLimit(false), e.abuseGuard, getHLSMasterRoute(hlsLog))
+	r.Router.GET("/hls/:messageID/:quality/:file", opaqueIDParams(false), e.mediaAuth, premiumOnly("hls"), rateLimit(true), getHLSMediaRoute(hlsLog))
+	hlsLog.Info("Loaded HLS routes", zap.Int("maxJobs", slots))
+}
+
+// hlsInput returns what ffmpeg reads for a variant: the original through
+// /direct on loopback, or a generated rendition from disk.
+func hlsInput(messageID int, quality string) (input string, headers string, ok bool) {
+	if quality == hlsSourceName {
+		url, headers := loopbackSource(messageID)
+		return url, headers, true
+	}
+	height, err := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	if err != nil {
+		return "", "", false
+	}
+	path, ok := transcode.Path(messageID, height)
+	return path, "", ok
+}
+
+// probeHLSVariant reads the duration and bitrate of a variant, once.
+func probeHLSVariant(ctx context.Context, messageID int, quality string) (hlsProbe, error) {
+	key := strconv.Itoa(messageID) + "/" + quality
+	hlsProbeMu.Lock()
+	probe, ok := hlsProbeCache[key]
+	hlsProbeMu.Unlock()
+	if ok {
+		return probe, nil
+	}
+	input, headers, ok := hlsInput(messageID, quality)
+	if !ok {
+		return probe, errors.New("unknown variant")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hlsProbeTimeout)
+	defer cancel()
+	args := []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-select_streams", "v:0"}
+	if headers != "" {
+		args = append(args, "-headers", headers)
+	}
+	out, err := exec.CommandContext(ctx, config.ValueOf.FFprobePath, append(args, input)...).Output()
+	if err != nil {
+		return probe, fmt.Errorf("ffprobe: %w", err)
+	}
+	var result struct {
+		Format struct {
+			Duration string `json:"duration"`
+			BitRate  string `json:"bit_rate"`
+		} `json:"format"`
+		Streams []struct {
+			Width  int `json:"width"`
+			Height int `json:"height"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return probe, err
+	}
+	probe.duration, _ = strconv.ParseFloat(result.Format.Duration, 64)
+	probe.bitRate, _ = strconv.ParseInt(result.Format.BitRate, 10, 64)
+	if len(result.Streams) == 0 || probe.duration <= 0 {
+		return probe, errors.New("not a video")
+	}
+	probe.width, probe.height = result.Streams[0].Width, result.Streams[0].Height
+
+	hlsProbeMu.Lock()
+	if len(hlsProbeCache) >= hlsProbeCacheSize {
+		clear(hlsProbeCache)
+	}
+	hlsProbeCache[key] = probe
+	hlsProbeMu.Unlock()
+	return probe, nil
+}
+
+// hlsSegments returns the start times of the segments of a variant. Stream
+// copy can only cut on keyframes, so segments start on the first keyframe at
+// least HLS_SEGMENT_SECONDS after the previous start; cutting elsewhere would
+// leave the segment without a keyframe to decode from. They are looked up
+// once, by reading the packets of the whole variant.
+func hlsSegments(ctx context.Context, messageID int, quality string) ([]float64, error) {
+	key := strconv.Itoa(messageID) + "/" + quality
+	hlsProbeMu.Lock()
+	starts, ok := hlsSegmentCache[key]
+	hlsProbeMu.Unlock()
+	if ok {
+		return starts, nil
+	}
+	input, headers, ok := hlsInput(messageID, quality)
+	if !ok {
+		return nil, errors.New("unknown variant")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hlsKeyframeTimeout)
+	defer cancel()
+	args := []string{"-v", "error", "-select_streams", "v:0", "-show_entries", "packet=pts_time,flags", "-of", "csv=p=0"}
+	if headers != "" {
+		args = append(args, "-headers", headers)
+	}
+	out, err := exec.CommandContext(ctx, config.ValueOf.FFprobePath, append(args, input)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe: %w", err)
+	}
+	var keyframes []float64
+	for _, line := range strings.Split(string(out), "\n") {
+		pts, flags, _ := strings.Cut(strings.TrimSpace(line), ",")
+		if !strings.HasPrefix(flags, "K") {
+			continue
+		}
+		if t, err := strconv.ParseFloat(pts, 64); err == nil {
+			keyframes = append(keyframes, t)
+		}
+	}
+	if len(keyframes) == 0 {
+		return nil, errors.New("no keyframes")
+	}
+	// Packets come in decode order
+	slices.Sort(keyframes)
+
+	segmentLength := float64(max(config.ValueOf.HLSSegmentSeconds, 1))
+	starts = []float64{0}
+	for _, t := range keyframes {
+		if t-starts[len(starts)-1] >= segmentLength {
+			starts = append(starts, t)
+		}
+	}
+
+	hlsProbeMu.Lock()
+	if len(hlsSegmentCache) >= hlsProbeCacheSize {
+		clear(hlsSegmentCache)
+	}
+	hlsSegmentCache[key] = starts
+	hlsProbeMu.Unlock()
+	return starts, nil
+}
+
+// hlsQuery carries the credentials of the playlist request over to the URIs
+// it lists, so players that don't send cookies stay authorized.
+func hlsQuery(ctx *gin.Context) string {
+	if ctx.Request.URL.RawQuery == "" {
+		return ""
+	}
+	return "?" + ctx.Request.URL.RawQuery
+}
+
+func getHLSMasterRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, err := strconv.Atoi(ctx.Param("messageID"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": errorText(ctx, "error.invalid_message_id"),
+			})
+			return
+		}
+		if abortIfBlocked(ctx, config.ValueOf.MediaChannelID, messageID) {
+			return
+		}
+		qualities := []string{hlsSourceName}
+		for _, height := range transcode.Available(messageID) {
+			qualities = append(qualities, strconv.Itoa(height)+"p")
+		}
+
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n")
+		for _, quality := range qualities {
+			probe, err := probeHLSVariant(ctx, messageID, quality)
+			if err != nil {
+				if quality == hlsSourceName {
+					logger.Warn("Failed to probe video for HLS", zap.Int("messageID", messageID), zap.Error(err))
+					ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+						"error": "file is not a playable video",
+					})
+					return
+				}
+				continue
+			}
+			fmt.Fprintf(&b, "#EXT-X-STREAM-INF:BANDWIDTH=%d", max(probe.bitRate, 1))
+			if probe.width > 0 && probe.height > 0 {
+				fmt.Fprintf(&b, ",RESOLUTION=%dx%d", probe.width, probe.height)
+			}
+			fmt.Fprintf(&b, "\n%s/%s/index.m3u8%s\n", opaqueid.ID(config.ValueOf.MediaChannelID, messageID), quality, hlsQuery(ctx))
+		}
+		ctx.Header("Cache-Control", "no-cache")
+		ctx.Data(http.StatusOK, hlsPlaylistType, []byte(b.String()))
+	}
+}
+
+func getHLSMediaRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, err := strconv.Atoi(ctx.Param("messageID"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": errorText(ctx, "error.invalid_message_id"),
+			})
+			return
+		}
+		if abortIfBlocked(ctx, config.ValueOf.MediaChannelID, messageID) {
+			return
+		}
+		quality := ctx.Param("quality")
+		if _, _, ok := hlsInput(messageID, quality); !ok {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "unknown quality",
+			})
+			return
+		}
+		probe, err := probeHLSVariant(ctx, messageID, quality)
+		if err != nil {
+			logger.Warn("Failed to probe video for HLS", zap.Int("messageID", messageID), zap.String("quality", quality), zap.Error(err))
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "file is not a playable video",
+			})
+			return
+		}
+		starts, err := hlsSegments(ctx, messageID, quality)
+		if err != nil {
+			logger.Warn("Failed to find keyframes for HLS", zap.Int("messageID", messageID), zap.String("quality", quality), zap.Error(err))
+			ctx.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error": "file is not a playable video",
+			})
+			return
+		}
+		segmentLength := func(i int) float64 {
+			if i+1 < len(starts) {
+				return starts[i+1] - starts[i]
+			}
+			return max(probe.duration-starts[i], 0.001)
+		}
+
+		file := ctx.Param("file")
+		if file == "index.m3u8" {
+			target := 1.0
+			for i := range starts {
+				target = max(target, segmentLength(i))
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-PLAYLIST-TYPE:VOD\n#EXT-X-TARGETDURATION:%d\n#EXT-X-MEDIA-SEQUENCE:0\n", int(math.Ceil(target)))
+			for i := range starts {
+				fmt.Fprintf(&b, "#EXTINF:%.3f,\n%d.ts%s\n", segmentLength(i), i, hlsQuery(ctx))
+			}
+			b.WriteString("#EXT-X-ENDLIST\n")
+			ctx.Header("Cache-Control", "no-cache")
+			ctx.Data(http.StatusOK, hlsPlaylistType, []byte(b.String()))
+			return
+		}
+
+		index, err := strconv.Atoi(strings.TrimSuffix(file, ".ts"))
+		if err != nil || !strings.HasSuffix(file, ".ts") || index < 0 || index >= len(starts) {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "segment not found",
+			})
+			return
+		}
+		serveHLSSegment(ctx, logger, messageID, quality, starts[index], segmentLength(index))
+	}
+}
+
+// serveHLSSegment remuxes [start, start+length) of a variant to MPEG-TS.
+// start is a keyframe from hlsSegments, which input seeking lands on;
+// timestamps are kept so consecutive segments line up on the player's
+// timeline.
+func serveHLSSegment(ctx *gin.Context, logger *zap.Logger, messageID int, quality string, start, length float64) {
+	select {
+	case hlsSlots <- struct{}{}:
+		defer func() { <-hlsSlots }()
+	default:
+		ctx.Header("Retry-After", "2")
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "too many HLS segments in progress",
+		})
+		return
+	}
+
+	input, headers, _ := hlsInput(messageID, quality)
+	args := []string{"-nostdin", "-loglevel", "error"}
+	if headers != "" {
+		args = append(args, "-headers", headers)
+	}
+	startArg := strconv.FormatFloat(start, 'f', -1, 64)
+	// Seeking a hair past the keyframe keeps rounding of its timestamp from
+	// landing on the one before
+	seekArg := strconv.FormatFloat(start+0.0005, 'f', 4, 64)
+	args = append(args,
+		"-ss", seekArg, "-i", input, "-t", strconv.FormatFloat(length, 'f', 3, 64),
+		"-map", "0:v:0", "-map", "0:a:0?", "-c", "copy",
+		"-output_ts_offset", startArg, "-muxdelay", "0", "-f", "mpegts", "pipe:1")
+	// Tied to the request so ffmpeg stops when the player moves on
+	cmd := exec.CommandContext(ctx.Request.Context(), config.ValueOf.FFmpegPath, args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		logger.Error("Failed to start ffmpeg", zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, gin.H{
+			"error": "failed to start segmenting",
+		})
+		return
+	}
+
+	buf := make([]byte, 32*1024)
+	n, readErr := stdout.Read(buf)
+	if n == 0 {
+		waitErr := cmd.Wait()
+		logger.Warn("HLS segment produced no output",
+			zap.Int("messageID", messageID),
+			zap.String("quality", quality),
+			zap.Float64("start", start),
+			zap.NamedError("readError", readErr),
+			zap.NamedError("ffmpegError", waitErr))
+		ctx.JSON(http.StatusBadGateway, gin.H{
+			"error": "failed to cut segment",
+		})
+		return
+	}
+
+	ctx.Header("Content-Type", "video/mp2t")
+	ctx.Header("Cache-Control", "private, max-age=3600")
+	ctx.Status(http.StatusOK)
+	w := meteredWriter{ctx.Writer}
+	if _, err := w.Write(buf[:n]); err == nil {
+		_, _ = io.Copy(w, stdout)
+	}
+	if err := cmd.Wait(); err != nil && ctx.Request.Context().Err() == nil {
+		logger.Warn("HLS segment ended with an error", zap.Int("messageID", messageID), zap.Error(err))
+	}
+}
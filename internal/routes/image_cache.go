@@ -1,16 +1,28 @@
 package routes
 
 import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/imagestore"
+	"EverythingSuckz/fsb/internal/janitor"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 const (
 	defaultImageCacheDir = "./images"
 	imageCacheDirEnvName = "IMAGE_DIR"
 	thumbDirEnvName      = "THUMB_DIR"
+	tempFileMaxAge       = time.Hour
 )
 
 func getImageCacheBaseDir() string {
@@ -25,41 +37,99 @@ func getImageCacheBaseDir() string {
 	return filepath.Clean(defaultImageCacheDir)
 }
 
-func getThumbCacheDir() string {
-	return getImageCacheBaseDir()
-}
-
-func getDirectPhotoCachePath(messageID int) string {
-	return filepath.Join(getImageCacheBaseDir(), fmt.Sprintf("%d.jpg", messageID))
-}
+var imageStore imagestore.Store
 
-func writeBytesAtomically(targetFile string, data []byte, perm os.FileMode) error {
-	cacheDir := filepath.Dir(targetFile)
-	if err := os.MkdirAll(cacheDir, 0o755); err != nil {
+// initImageStore selects the image cache backend. Only the local store lives
+// on disk, so only it is handed to the janitor: interrupted downloads leave
+// *.tmp files behind, and cached images are dropped after
+// IMAGE_CACHE_MAX_AGE_HOURS so they get refetched on demand.
+func initImageStore(log *zap.Logger) error {
+	dir := getImageCacheBaseDir()
+	store, err := imagestore.New(log, dir)
+	if err != nil {
 		return err
 	}
+	imageStore = store
+	if _, ok := store.(*imagestore.Local); !ok {
+		return nil
+	}
+	janitor.Register(janitor.Target{
+		Name:            "image-tmp",
+		Dir:             dir,
+		Pattern:         "*.tmp",
+		MaxAge:          tempFileMaxAge,
+		RemoveOnStartup: true,
+	})
+	janitor.Register(janitor.Target{
+		Name:     "image-cache",
+		Dir:      dir,
+		Pattern:  "*.jpg",
+		MaxAge:   time.Duration(config.ValueOf.ImageCacheMaxAgeHours) * time.Hour,
+		Validate: isValidCachedImage,
+	})
+	return nil
+}
 
-	tmpFile, err := os.CreateTemp(cacheDir, filepath.Base(targetFile)+".*.tmp")
+// isValidCachedImage rejects empty files and files that don't start with a
+// known image signature, which is what a crash mid-write leaves behind.
+func isValidCachedImage(path string) bool {
+	f, err := os.Open(path)
 	if err != nil {
-		return err
+		return false
 	}
-	tmpPath := tmpFile.Name()
-	defer func() {
-		_ = tmpFile.Close()
-		_ = os.Remove(tmpPath)
-	}()
+	defer f.Close()
 
-	if _, err := tmpFile.Write(data); err != nil {
-		return err
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(f, header)
+	return isValidImageData(header[:n])
+}
+
+// isValidImageData reports whether data starts with a JPEG, PNG or WebP signature.
+func isValidImageData(data []byte) bool {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}): // JPEG
+		return true
+	case bytes.HasPrefix(data, []byte("\x89PNG")):
+		return true
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return true
 	}
-	if err := tmpFile.Chmod(perm); err != nil {
-		return err
+	return false
+}
+
+// Image cache lookups, for /metrics.
+var imageCacheHits, imageCacheMisses int64
+
+// imageCacheKey is the store key shared by /thumb and /direct photos.
+func imageCacheKey(messageID int) string {
+	return fmt.Sprintf("%d.jpg", messageID)
+}
+
+// channelImageCacheKey keeps images of MEDIA_CHANNELS channels apart from
+// the MEDIA_CHANNEL_ID ones, which use imageCacheKey.
+func channelImageCacheKey(channelID int64, messageID int) string {
+	if channelID == config.ValueOf.MediaChannelID {
+		return imageCacheKey(messageID)
 	}
-	if err := tmpFile.Close(); err != nil {
-		return err
+	return fmt.Sprintf("%d_%d.jpg", channelID, messageID)
+}
+
+// getCachedImage returns the cached image for key, dropping entries that fail
+// validation so they get refetched. A miss is reported as (nil, nil).
+func getCachedImage(ctx context.Context, key string) ([]byte, error) {
+	data, err := imageStore.Get(ctx, key)
+	if err != nil {
+		if errors.Is(err, imagestore.ErrNotFound) {
+			atomic.AddInt64(&imageCacheMisses, 1)
+			return nil, nil
+		}
+		return nil, err
 	}
-	if err := os.Rename(tmpPath, targetFile); err != nil {
-		return err
+	if !isValidImageData(data) {
+		_ = imageStore.Delete(ctx, key)
+		atomic.AddInt64(&imageCacheMisses, 1)
+		return nil, nil
 	}
-	return nil
+	atomic.AddInt64(&imageCacheHits, 1)
+	return data, nil
 }
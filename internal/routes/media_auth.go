@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/streamauth"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	streamSessionKey = "streamSession"
+	authMethodKey    = "authMethod"
+	apiKeyAuthMethod = "api_key"
+	apiKeyHeader     = "X-API-Key"
+	// apiKeyUserPrefix marks the user ID of API key sessions, e.g. to list
+	// them in UPLOAD_ALLOWED_UIDS as apikey:<label>
+	apiKeyUserPrefix = "apikey:"
+	// sessionAuthMethod marks requests authorized by a stream session
+	sessionAuthMethod = "firebase_session"
+	// signedLinkAuthMethod marks requests of links signed with SignLink
+	signedLinkAuthMethod = "signed_link"
+	// linkSigParam carries the signature of a signed link, next to exp
+	linkSigParam = "link_sig"
+)
+
+// mediaAuthMiddleware authorizes requests for channel media. It accepts a
+// stream session (cookie, ?st=/?session=, x-stream-token or Bearer token), a
+// key from API_KEYS (X-API-Key or ?api_key=), links signed with SignLink
+// (?link_sig=&exp=) and, when
+// STREAM_ALLOW_LEGACY_HMAC is on, links signed with STREAM_SECRET.
+// The session and method are stored on the context for the handlers.
+func mediaAuthMiddleware(logger *zap.Logger, authService *streamauth.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if isInternalRequest(ctx) {
+			ctx.Set(streamSessionKey, streamauth.Session{})
+			ctx.Set(authMethodKey, internalAuthMethod)
+			ctx.Next()
+			return
+		}
+
+		sessionsEnabled := authService.Enabled()
+		if !sessionsEnabled && !authService.LegacyHMACEnabled() && !config.Live().APIKeysEnabled() {
+			logger.Error("Stream auth is disabled; refusing media request",
+				zap.String("path", ctx.Request.URL.Path),
+				zap.String("clientIP", ctx.ClientIP()))
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": errorText(ctx, "error.auth_not_configured"),
+			})
+			return
+		}
+
+		// A ban covers every kind of credential, so a client banned for one
+		// can't keep probing with another
+		if authBanned(ctx) {
+			return
+		}
+
+		if key := extractAPIKey(ctx); key != "" && config.Live().APIKeysEnabled() {
+			label := config.Live().APIKeyLabel(key)
+			if label == "" {
+				recordAuthFailure(ctx, logger, authFailureAPIKey)
+				logger.Warn("API key validation failed",
+					zap.String("path", ctx.Request.URL.Path),
+					zap.String("clientIP", ctx.ClientIP()))
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error": errorText(ctx, "error.auth_api_key"),
+				})
+				return
+			}
+			ctx.Set(streamSessionKey, streamauth.Session{UserID: apiKeyUserPrefix + label})
+			ctx.Set(authMethodKey, apiKeyAuthMethod)
+			ctx.Next()
+			return
+		}
+
+		if sessionsEnabled {
+			if sessionToken := extractStreamSessionToken(ctx, authService.CookieName()); sessionToken != "" {
+				session, valid := authService.ValidateSession(sessionToken)
+				if !valid {
+					recordAuthFailure(ctx, logger, authFailureSession)
+					logger.Warn("Stream session validation failed",
+						zap.String("path", ctx.Request.URL.Path),
+						zap.String("clientIP", ctx.ClientIP()))
+					ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+						"error": errorText(ctx, "error.auth_session"),
+					})
+					return
+				}
+				ctx.Set(streamSessionKey, session)
+				ctx.Set(authMethodKey, sessionAuthMethod)
+				setClaims(ctx, logger, authService, session)
+				ctx.Next()
+				return
+			}
+		}
+
+		if sig := ctx.Query(linkSigParam); sig != "" {
+			channelID, _ := requestChannelID(ctx)
+			messageID, err := strconv.Atoi(ctx.Param("messageID"))
+			if err == nil && channelID != 0 && authService.VerifyLink(channelID, messageID, sig, ctx.Query("exp")) {
+				ctx.Set(streamSessionKey, streamauth.Session{})
+				ctx.Set(authMethodKey, signedLinkAuthMethod)
+				ctx.Next()
+				return
+			}
+			recordAuthFailure(ctx, logger, authFailureSignedLink)
+			logger.Warn("Signed link validation failed",
+				zap.String("path", ctx.Request.URL.Path),
+				zap.String("clientIP", ctx.ClientIP()))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": errorText(ctx, "error.auth_signature"),
+			})
+			return
+		}
+
+		// Legacy signatures only cover the message ID, so they are limited
+		// to MEDIA_CHANNEL_ID
+		if sig := ctx.Query("sig"); sig != "" && authService.LegacyHMACEnabled() && ctx.Param("channelAlias") == "" {
+			messageID, err := strconv.Atoi(ctx.Param("messageID"))
+			if err == nil && authService.VerifyLegacyHMAC(messageID, sig, ctx.Query("exp")) {
+				ctx.Set(streamSessionKey, streamauth.Session{})
+				ctx.Set(authMethodKey, "legacy_hmac")
+				ctx.Next()
+				return
+			}
+			recordAuthFailure(ctx, logger, authFailureLegacyHMAC)
+			logger.Warn("Legacy HMAC validation failed",
+				zap.String("path", ctx.Request.URL.Path),
+				zap.String("clientIP", ctx.ClientIP()))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": errorText(ctx, "error.auth_signature"),
+			})
+			return
+		}
+
+		logger.Warn("Media request unauthorized: missing credentials",
+			zap.String("path", ctx.Request.URL.Path),
+			zap.String("clientIP", ctx.ClientIP()))
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"error": errorText(ctx, "error.auth_missing"),
+		})
+	}
+}
+
+// extractAPIKey returns the API key of the request, from the X-API-Key header
+// or the api_key query parameter.
+func extractAPIKey(ctx *gin.Context) string {
+	if key := strings.TrimSpace(ctx.GetHeader(apiKeyHeader)); key != "" {
+		return key
+	}
+	return ctx.Query("api_key")
+}
+
+// setClaims signs the session as a JWT and keeps it in the request context,
+// for requests to downstream systems that apply their own policies. It is
+// not sent back to the client.
+func setClaims(ctx *gin.Context, logger *zap.Logger, authService *streamauth.Service, session streamauth.Session) {
+	if !authService.ClaimsSigningEnabled() {
+		return
+	}
+	token, err := authService.SignClaims(session)
+	if err != nil {
+		logger.Warn("Failed to sign session claims", zap.Error(err))
+		return
+	}
+	ctx.Request = ctx.Request.WithContext(streamauth.WithClaims(ctx.Request.Context(), token))
+}
+
+// streamSessionFrom returns the session and auth method set by mediaAuthMiddleware.
+func streamSessionFrom(ctx *gin.Context) (streamauth.Session, string) {
+	session, _ := ctx.Get(streamSessionKey)
+	method := ctx.GetString(authMethodKey)
+	if method == "" {
+		method = "none"
+	}
+	s, _ := session.(streamauth.Session)
+	return s, method
+}
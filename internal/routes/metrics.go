@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/cache"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// metricsContentType is the Prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// loadMetrics registers the Prometheus scrape endpoint.
+func loadMetrics(log *zap.Logger, r *Route) {
+	metricsLog := log.Named("Metrics")
+	defer metricsLog.Info("Loaded metrics route")
+	r.Router.GET("/metrics", func(ctx *gin.Context) {
+		var m metricsWriter
+		writeWorkerMetrics(&m)
+		writeCacheMetrics(&m)
+		m.family("fsb_streamed_bytes_total", "counter", "Bytes written to clients since the start.")
+		m.sample("fsb_streamed_bytes_total", nil, float64(stats.StreamedTotal()))
+		m.family("fsb_stream_throughput_bytes_per_second", "gauge", "Bytes written to clients per second, averaged over the last few seconds.")
+		m.sample("fsb_stream_throughput_bytes_per_second", nil, float64(stats.Throughput()))
+		m.family("fsb_chunks_coalesced_total", "counter", "Chunk requests served by another request's Telegram fetch.")
+		m.sample("fsb_chunks_coalesced_total", nil, float64(utils.CoalescedChunks()))
+		m.family("fsb_unavailable_responses_total", "counter", "503 responses sent, by reason.")
+		for _, code := range []string{unavailableNoWorkers, unavailableBusy, unavailableTelegram, unavailableNoAccess} {
+			m.sample("fsb_unavailable_responses_total", []string{"code", code}, float64(atomic.LoadInt64(unavailableResponses[code])))
+		}
+		m.family("fsb_rate_limited_total", "counter", "429 responses sent by the rate limiter, by reason.")
+		for _, reason := range []string{rateLimitedRequests, rateLimitedStreams} {
+			m.sample("fsb_rate_limited_total", []string{"reason", reason}, float64(atomic.LoadInt64(rateLimited[reason])))
+		}
+		m.family("fsb_abuse_flagged_total", "counter", "IPs flagged for scraping patterns, by reason.")
+		for _, reason := range []string{abuseNotFound, abuseSequential, abuseManyFiles} {
+			m.sample("fsb_abuse_flagged_total", []string{"reason", reason}, float64(atomic.LoadInt64(abuseFlagged[reason])))
+		}
+		m.family("fsb_abuse_rejected_total", "counter", "Requests of flagged IPs refused, by action.")
+		for _, action := range []string{abuseActionThrottle, abuseActionBan} {
+			m.sample("fsb_abuse_rejected_total", []string{"action", action}, float64(atomic.LoadInt64(abuseRejected[action])))
+		}
+		writeAuthMetrics(&m)
+		ctx.Data(http.StatusOK, metricsContentType, []byte(m.String()))
+	})
+}
+
+func writeWorkerMetrics(m *metricsWriter) {
+	workers := bot.Snapshot()
+	m.family("fsb_workers", "gauge", "Telegram workers currently running.")
+	m.sample("fsb_workers", nil, float64(len(workers)))
+
+	type workerSample struct {
+		labels  []string
+		metrics bot.WorkerMetrics
+		worker  *bot.Worker
+	}
+	samples := make([]workerSample, 0, len(workers))
+	for _, w := range workers {
+		samples = append(samples, workerSample{
+			labels:  []string{"worker", strconv.Itoa(w.ID)},
+			metrics: w.GetMetrics(),
+			worker:  w,
+		})
+	}
+
+	m.family("fsb_worker_info", "gauge", "Worker identity; always 1.")
+	for _, s := range samples {
+		m.sample("fsb_worker_info", append(s.labels, "username", s.worker.Self.Username, "dc", strconv.Itoa(s.worker.DC())), 1)
+	}
+	m.family("fsb_worker_healthy", "gauge", "1 while the worker answers its pings, 0 while it is out of rotation.")
+	for _, s := range samples {
+		healthy := 0.0
+		if s.worker.Healthy() {
+			healthy = 1
+		}
+		m.sample("fsb_worker_healthy", s.labels, healthy)
+	}
+	m.family("fsb_worker_active_requests", "gauge", "Requests the worker is serving right now.")
+	for _, s := range samples {
+		m.sample("fsb_worker_active_requests", s.labels, float64(s.metrics.ActiveRequests))
+	}
+	m.family("fsb_worker_requests_total", "counter", "Requests handled by the worker.")
+	for _, s := range samples {
+		m.sample("fsb_worker_requests_total", s.labels, float64(s.metrics.TotalRequests))
+	}
+	m.family("fsb_worker_failed_requests_total", "counter", "Requests the worker failed to serve.")
+	for _, s := range samples {
+		m.sample("fsb_worker_failed_requests_total", s.labels, float64(s.metrics.FailedRequests))
+	}
+	m.family("fsb_worker_response_time_seconds_total", "counter", "Time spent serving requests.")
+	for _, s := range samples {
+		m.sample("fsb_worker_response_time_seconds_total", s.labels, float64(s.metrics.TotalResponseTime)/1000)
+	}
+	m.family("fsb_worker_response_time_seconds", "gauge", "Average response time of the last 5 requests.")
+	for _, s := range samples {
+		m.sample("fsb_worker_response_time_seconds", s.labels, s.worker.GetAverageResponseTime()/1000)
+	}
+	m.family("fsb_worker_uptime_seconds", "gauge", "Time since the worker started.")
+	for _, s := range samples {
+		m.sample("fsb_worker_uptime_seconds", s.labels, time.Since(s.metrics.StartTime).Seconds())
+	}
+	m.family("fsb_worker_ping_seconds", "gauge", "Last measured round trip to the worker's DC.")
+	for _, s := range samples {
+		m.sample("fsb_worker_ping_seconds", s.labels, s.worker.Ping().Seconds())
+	}
+	m.family("fsb_worker_budget_waits_total", "counter", "Telegram calls that waited for the worker's request budget.")
+	for _, s := range samples {
+		waits := s.worker.BudgetWaits()
+		priorities := make([]string, 0, len(waits))
+		for p := range waits {
+			priorities = append(priorities, p)
+		}
+		sort.Strings(priorities)
+		for _, p := range priorities {
+			m.sample("fsb_worker_budget_waits_total", append(s.labels, "priority", p), float64(waits[p]))
+		}
+	}
+}
+
+func writeCacheMetrics(m *metricsWriter) {
+	if c := cache.GetCache(); c != nil {
+		hits, misses := c.Stats()
+		m.family("fsb_metadata_cache_hits_total", "counter", "File metadata lookups served from the cache.")
+		m.sample("fsb_metadata_cache_hits_total", nil, float64(hits))
+		m.family("fsb_metadata_cache_misses_total", "counter", "File metadata lookups that went to Telegram.")
+		m.sample("fsb_metadata_cache_misses_total", nil, float64(misses))
+	}
+	m.family("fsb_image_cache_hits_total", "counter", "Thumbnail and photo requests served from the image cache.")
+	m.sample("fsb_image_cache_hits_total", nil, float64(atomic.LoadInt64(&imageCacheHits)))
+	m.family("fsb_image_cache_misses_total", "counter", "Thumbnail and photo requests that missed the image cache.")
+	m.sample("fsb_image_cache_misses_total", nil, float64(atomic.LoadInt64(&imageCacheMisses)))
+	chunkHits, chunkMisses := utils.ChunkCacheStats()
+	m.family("fsb_chunk_cache_hits_total", "counter", "File chunks served from the disk chunk cache.")
+	m.sample("fsb_chunk_cache_hits_total", nil, float64(chunkHits))
+	m.family("fsb_chunk_cache_misses_total", "counter", "File chunks that had to be fetched from Telegram.")
+	m.sample("fsb_chunk_cache_misses_total", nil, float64(chunkMisses))
+	m.family("fsb_cache_writes_skipped_low_disk_total", "counter", "Cache writes skipped because the disk was nearly full.")
+	m.sample("fsb_cache_writes_skipped_low_disk_total", nil, float64(utils.DiskGuardSkips()))
+}
+
+func writeAuthMetrics(m *metricsWriter) {
+	m.family("fsb_auth_failures_total", "counter", "Failed Firebase exchanges, legacy signatures, API keys and mini app init data, by kind.")
+	for _, kind := range []string{authFailureFirebase, authFailureAppCheck, authFailureLegacyHMAC, authFailureAPIKey, authFailureWebApp, authFailureSignedLink, authFailureSession} {
+		m.sample("fsb_auth_failures_total", []string{"kind", kind}, float64(atomic.LoadInt64(authFailures[kind])))
+	}
+	m.family("fsb_auth_bans_total", "counter", "IPs banned after repeated authentication failures.")
+	m.sample("fsb_auth_bans_total", nil, float64(atomic.LoadInt64(&authBans)))
+	m.family("fsb_auth_banned_rejections_total", "counter", "Authentication attempts refused because the IP was banned.")
+	m.sample("fsb_auth_banned_rejections_total", nil, float64(atomic.LoadInt64(&authBannedRejections)))
+	m.family("fsb_auth_banned_ips", "gauge", "IPs currently banned from authenticating.")
+	m.sample("fsb_auth_banned_ips", nil, float64(authBannedIPs()))
+}
+
+// metricsWriter builds a scrape in the Prometheus text format.
+type metricsWriter struct {
+	strings.Builder
+}
+
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(m, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value; labels alternate names and values.
+func (m *metricsWriter) sample(name string, labels []string, value float64) {
+	m.WriteString(name)
+	if len(labels) > 0 {
+		m.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				m.WriteByte(',')
+			}
+			fmt.Fprintf(m, "%s=\"%s\"", labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		m.WriteByte('}')
+	}
+	fmt.Fprintf(m, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// opaqueIDParams resolves the opaque ID in :messageID back to the message ID
+// and, for MEDIA_CHANNELS, to the channelAlias param when aliases is set.
+// When the path already names the alias, the ID must belong to its channel.
+// With ID_OBFUSCATION_ONLY numeric IDs are refused, except for internal
+// requests. It goes before the auth middlewares, which depend on the channel.
+func opaqueIDParams(aliases bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !opaqueid.Enabled() {
+			ctx.Next()
+			return
+		}
+		param := ctx.Param("messageID")
+		if _, err := strconv.Atoi(param); err == nil {
+			if config.ValueOf.IDObfuscationOnly && !isInternalRequest(ctx) {
+				abortUnknownFile(ctx)
+				return
+			}
+			ctx.Next()
+			return
+		}
+		channelID, messageID, err := opaqueid.Decode(param)
+		if err != nil {
+			abortUnknownFile(ctx)
+			return
+		}
+		alias := ""
+		if channelID != config.ValueOf.MediaChannelID {
+			var ok bool
+			alias, ok = config.ValueOf.MediaChannelAlias(channelID)
+			if !aliases || !ok {
+				abortUnknownFile(ctx)
+				return
+			}
+		}
+		pathAlias := ctx.Param("channelAlias")
+		if pathAlias != "" && pathAlias != alias {
+			abortUnknownFile(ctx)
+			return
+		}
+		params := make(gin.Params, 0, len(ctx.Params)+1)
+		for _, p := range ctx.Params {
+			if p.Key == "messageID" {
+				p.Value = strconv.Itoa(messageID)
+			}
+			params = append(params, p)
+		}
+		if alias != "" && pathAlias == "" {
+			params = append(params, gin.Param{Key: "channelAlias", Value: alias})
+		}
+		ctx.Params = params
+		ctx.Next()
+	}
+}
+
+// queryMessageID resolves a message ID of channelID given in the query,
+// numeric or opaque. Like opaqueIDParams it refuses numeric IDs under
+// ID_OBFUSCATION_ONLY, except for internal requests.
+func queryMessageID(ctx *gin.Context, value string, channelID int64) (int, bool) {
+	value = strings.TrimSpace(value)
+	if id, err := strconv.Atoi(value); err == nil {
+		if opaqueid.Enabled() && config.ValueOf.IDObfuscationOnly && !isInternalRequest(ctx) {
+			return 0, false
+		}
+		return id, true
+	}
+	if !opaqueid.Enabled() {
+		return 0, false
+	}
+	decodedChannelID, id, err := opaqueid.Decode(value)
+	if err != nil || decodedChannelID != channelID {
+		return 0, false
+	}
+	return id, true
+}
+
+// abortUnknownFile answers IDs that don't resolve like missing files, so
+// they tell nothing about which IDs exist.
+func abortUnknownFile(ctx *gin.Context) {
+	ctx.AbortWithStatusJSON(http.StatusNotFound, gin.H{
+		"error": errorText(ctx, "error.file_not_found"),
+	})
+}
+
+// opaqueIDRoute tells admins the opaque ID of a message, e.g. to build links
+// for files posted before ID_OBFUSCATION_KEY was set.
+func opaqueIDRoute(ctx *gin.Context) {
+	if !opaqueid.Enabled() {
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{
+			"error": "ID_OBFUSCATION_KEY not configured",
+		})
+		return
+	}
+	messageID, ok := adminMessageID(ctx)
+	if !ok {
+		return
+	}
+	channelID := config.ValueOf.MediaChannelID
+	if alias := ctx.Query("channel"); alias != "" {
+		channel, ok := config.ValueOf.MediaChannelFor(alias)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "unknown channel",
+			})
+			return
+		}
+		channelID = channel.ID
+	}
+	id := opaqueid.Encode(channelID, messageID)
+	ctx.JSON(http.StatusOK, gin.H{
+		"message_id": messageID,
+		"id":         id,
+		"link":       requestLinkBase(ctx.Request) + "/direct/" + id,
+	})
+}
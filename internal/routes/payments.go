@@ -0,0 +1,160 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/premium"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// stripeTolerance is how old a signed webhook may be, against replays
+	stripeTolerance   = 5 * time.Minute
+	stripeMaxBodySize = 1 << 20
+)
+
+// stripeEvent holds the fields of the handled Stripe events. User IDs are
+// passed as client_reference_id of the Checkout Session or as user_id in the
+// metadata of the session or subscription.
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object struct {
+			ID                  string            `json:"id"`
+			ClientReferenceID   string            `json:"client_reference_id"`
+			PaymentStatus       string            `json:"payment_status"`
+			BillingReason       string            `json:"billing_reason"`
+			Metadata            map[string]string `json:"metadata"`
+			SubscriptionDetails struct {
+				Metadata map[string]string `json:"metadata"`
+			} `json:"subscription_details"`
+		} `json:"object"`
+	} `json:"data"`
+}
+
+// LoadPayments registers the Stripe webhook that grants the premium role.
+// Telegram Stars payments go through the bot's /premium command instead.
+func (e *allRoutes) LoadPayments(r *Route) {
+	if config.ValueOf.StripeWebhookSecret == "" {
+		return
+	}
+	paymentsLog := e.log.Named("Payments")
+	defer paymentsLog.Info("Loaded Stripe webhook route")
+	r.Router.POST("/payments/stripe", postStripeWebhookRoute(paymentsLog))
+}
+
+// verifyStripeSignature checks the Stripe-Signature header of a webhook, see
+// https://docs.stripe.com/webhooks#verify-manually
+func verifyStripeSignature(header string, payload []byte, secret string) bool {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return false
+	}
+	if age := time.Since(time.Unix(sent, 0)); age > stripeTolerance || age < -stripeTolerance {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	for _, signature := range signatures {
+		if hmac.Equal([]byte(expected), []byte(signature)) {
+			return true
+		}
+	}
+	return false
+}
+
+func postStripeWebhookRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		payload, err := io.ReadAll(io.LimitReader(ctx.Request.Body, stripeMaxBodySize))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read body"})
+			return
+		}
+		if !verifyStripeSignature(ctx.GetHeader("Stripe-Signature"), payload, config.ValueOf.StripeWebhookSecret) {
+			logger.Warn("Stripe webhook signature rejected", zap.String("clientIP", ctx.ClientIP()))
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid signature"})
+			return
+		}
+		var event stripeEvent
+		if err := json.Unmarshal(payload, &event); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid event"})
+			return
+		}
+		object := event.Data.Object
+		log := logger.With(zap.String("event", event.ID), zap.String("type", event.Type))
+
+		switch event.Type {
+		case "checkout.session.completed", "checkout.session.async_payment_succeeded":
+			if object.PaymentStatus == "unpaid" {
+				// Delayed payment methods follow up with async_payment_succeeded
+				break
+			}
+			userID := object.ClientReferenceID
+			if userID == "" {
+				userID = object.Metadata["user_id"]
+			}
+			err = grantStripePremium(log, userID, object.ID)
+		case "invoice.paid":
+			// The first invoice of a subscription comes with its checkout
+			// session, only renewals extend the role here
+			if object.BillingReason == "subscription_cycle" {
+				err = grantStripePremium(log, object.SubscriptionDetails.Metadata["user_id"], object.ID)
+			}
+		case "customer.subscription.deleted":
+			if userID := object.Metadata["user_id"]; userID != "" {
+				err = premium.Remove(userID)
+				log.Info("Premium removed after the subscription ended", zap.String("userID", userID))
+			}
+		}
+		if err != nil {
+			log.Error("Failed to apply Stripe event", zap.Error(err))
+			// Stripe retries failed deliveries
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply event"})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{"received": true})
+	}
+}
+
+func grantStripePremium(log *zap.Logger, userID, reference string) error {
+	if userID == "" {
+		log.Warn("Stripe payment without a user ID, set client_reference_id or metadata.user_id")
+		return nil
+	}
+	_, err := premium.Add(userID, premium.SourceStripe, reference)
+	if errors.Is(err, premium.ErrDuplicatePayment) {
+		log.Info("Ignoring a Stripe payment already applied", zap.String("userID", userID))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Info("Premium bought through Stripe", zap.String("userID", userID))
+	return nil
+}
@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/blocklist"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/streamauth"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	playlistContentType = "audio/x-mpegurl; charset=utf-8"
+	playlistTimeout     = time.Minute
+	// playlistLinkTTL is how long the signed links of a playlist play
+	playlistLinkTTL = 24 * time.Hour
+)
+
+// playlistItem is a video or audio file of the playlist range.
+type playlistItem struct {
+	messageID int
+	name      string
+}
+
+// LoadPlaylist registers /playlist, an M3U of the videos and audio between
+// two message IDs of a channel, so VLC or mpv can queue a whole channel from
+// one URL.
+func (e *allRoutes) LoadPlaylist(r *Route) {
+	playlistLog := e.log.Named("Playlist")
+	defer playlistLog.Info("Loaded playlist route")
+	r.Router.GET("/playlist", channelQueryParam, channelAuth(e.mediaAuth), premiumOnly("playlist"), rateLimit(false), getPlaylistRoute(playlistLog, e.streamAuth))
+}
+
+func getPlaylistRoute(logger *zap.Logger, authService *streamauth.Service) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		channelID, ok := requestChannelID(ctx)
+		if !ok {
+			return
+		}
+		alias := ctx.Param("channelAlias")
+
+		from, okFrom := queryMessageID(ctx, ctx.Query("from"), channelID)
+		to, okTo := queryMessageID(ctx, ctx.Query("to"), channelID)
+		if !okFrom || !okTo || from < 1 || to < from {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "from and to must be file IDs, from <= to",
+			})
+			return
+		}
+		if limit := config.ValueOf.PlaylistMaxMessages; to-from+1 > limit {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("the range spans more than %d messages", limit),
+			})
+			return
+		}
+
+		worker := acquireWorker(ctx, logger, bot.GetNextLightWorker, from)
+		if worker == nil {
+			return
+		}
+		worker.AcquireSlot()
+		items, err := playlistItems(ctx, worker, channelID, from, to)
+		worker.ReleaseSlot()
+		if err != nil {
+			worker.RecordChannelAccess(channelID, err)
+			if utils.IsNoChannelAccess(err) {
+				respondUnavailable(ctx, unavailableNoAccess, 0)
+				return
+			}
+			logger.Warn("Failed to list playlist messages",
+				zap.Int64("channelID", channelID),
+				zap.Int("from", from),
+				zap.Int("to", to),
+				zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to fetch the messages from Telegram",
+			})
+			return
+		}
+
+		base := requestLinkBase(ctx.Request)
+		_, method := streamSessionFrom(ctx)
+		expiresAt := time.Now().Add(playlistLinkTTL)
+		var b strings.Builder
+		b.WriteString("#EXTM3U\n")
+		for _, item := range items {
+			link := base + directPath(channelID, alias, item.messageID)
+			// Players don't send the browser's cookies or headers, so each
+			// link carries its own signature, never the caller's credential
+			if method != publicAuthMethod {
+				q := url.Values{}
+				q.Set(linkSigParam, authService.SignLink(channelID, item.messageID, expiresAt))
+				q.Set("exp", strconv.FormatInt(expiresAt.Unix(), 10))
+				link += "?" + q.Encode()
+			}
+			fmt.Fprintf(&b, "#EXTINF:-1,%s\n%s\n", item.name, link)
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Header("Content-Disposition", fmt.Sprintf(`inline; filename="playlist-%s-%s.m3u8"`, opaqueid.ID(channelID, from), opaqueid.ID(channelID, to)))
+		ctx.Data(http.StatusOK, playlistContentType, []byte(b.String()))
+	}
+}
+
+// playlistItems fetches the messages from..to of channelID and keeps the
+// videos and audio files that aren't revoked, in message order.
+func playlistItems(ctx context.Context, worker *bot.Worker, channelID int64, from, to int) ([]playlistItem, error) {
+	ctx, cancel := context.WithTimeout(ctx, playlistTimeout)
+	defer cancel()
+	ids := make([]int, 0, to-from+1)
+	for id := from; id <= to; id++ {
+		ids = append(ids, id)
+	}
+	messages, err := fetchChannelMessages(ctx, worker, channelID, ids)
+	if err != nil {
+		return nil, err
+	}
+	var items []playlistItem
+	for _, m := range messages {
+		if _, blocked := blocklist.MessageBlocked(channelID, m.ID); blocked {
+			continue
+		}
+		file, err := utils.FileFromMedia(m.Media)
+		if err != nil || !(strings.HasPrefix(file.MimeType, "video/") || strings.HasPrefix(file.MimeType, "audio/")) {
+			continue
+		}
+		name := file.FileName
+		if name == "" {
+			name = opaqueid.ID(channelID, m.ID)
+		}
+		items = append(items, playlistItem{messageID: m.ID, name: playlistNameEscaper.Replace(name)})
+	}
+	return items, nil
+}
+
+// playlistNameEscaper keeps file names on their #EXTINF line.
+var playlistNameEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+// directPath is the /direct path of a message. Opaque IDs carry the channel,
+// numeric IDs of MEDIA_CHANNELS need the alias.
+func directPath(channelID int64, alias string, messageID int) string {
+	if alias == "" || opaqueid.Enabled() {
+		return "/direct/" + opaqueid.ID(channelID, messageID)
+	}
+	return "/direct/" + alias + "/" + strconv.Itoa(messageID)
+}
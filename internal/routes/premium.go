@@ -0,0 +1,62 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/premium"
+	"context"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+const premiumKey = "premium"
+
+// premiumContextKey marks premium requests on the request context too, for
+// the copies that only get that.
+type premiumContextKey struct{}
+
+// isPremium reports whether the request comes from a premium user. The role
+// is looked up once per request.
+func isPremium(ctx *gin.Context) bool {
+	if cached, ok := ctx.Get(premiumKey); ok {
+		return cached.(bool)
+	}
+	session, _ := streamSessionFrom(ctx)
+	isPremium := premium.IsPremium(session.UserID)
+	ctx.Set(premiumKey, isPremium)
+	if isPremium {
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), premiumContextKey{}, true))
+	}
+	return isPremium
+}
+
+// premiumRequest is isPremium for the request context.
+func premiumRequest(ctx context.Context) bool {
+	isPremium, _ := ctx.Value(premiumContextKey{}).(bool)
+	return isPremium
+}
+
+// premiumLimit scales a limit by PREMIUM_LIMIT_MULTIPLIER for premium
+// requests. 0 stands for no limit, as in the settings it scales.
+func premiumLimit(limit int, isPremium bool) int {
+	if !isPremium || limit <= 0 {
+		return limit
+	}
+	return limit * config.ValueOf.PremiumLimitMultiplier
+}
+
+// premiumOnly refuses feature to users without the premium role when it is
+// in PREMIUM_ONLY. It goes after the auth middlewares.
+func premiumOnly(feature string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !slices.Contains(config.ValueOf.PremiumOnly, feature) ||
+			ctx.GetString(authMethodKey) == internalAuthMethod || isPremium(ctx) {
+			ctx.Next()
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": errorText(ctx, "error.premium_required"),
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/budget"
+	"context"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// requestClass tells playback apart from bulk downloads, which give way
+// first under load.
+type requestClass string
+
+const (
+	classRealtime requestClass = "realtime"
+	classBulk     requestClass = "bulk"
+)
+
+// classifyRequest honours ?priority=realtime|bulk and otherwise treats forced
+// downloads (?d=true) and requests without a Range header, which is how
+// download tools fetch a whole file, as bulk. Players always send ranges.
+func classifyRequest(ctx *gin.Context, rangeHeader string) requestClass {
+	switch requestClass(strings.ToLower(ctx.Query("priority"))) {
+	case classRealtime:
+		return classRealtime
+	case classBulk:
+		return classBulk
+	}
+	if ctx.Query("d") == "true" || rangeHeader == "" {
+		return classBulk
+	}
+	return classRealtime
+}
+
+// budgetPriority is the Telegram budget priority of the class.
+func (c requestClass) budgetPriority() budget.Priority {
+	if c == classBulk {
+		return budget.Backfill
+	}
+	return budget.Stream
+}
+
+var (
+	bulkLimiterOnce sync.Once
+	bulkLimiter     *rate.Limiter
+)
+
+// bulkWriter throttles dst to the BULK_MAX_MBPS shared by every bulk
+// download, or returns dst as is when there is no cap.
+func bulkWriter(ctx context.Context, dst io.Writer) io.Writer {
+	bulkLimiterOnce.Do(func() {
+		if config.ValueOf.BulkMaxMbps > 0 {
+			bytesPerSecond := config.ValueOf.BulkMaxMbps * 1000 * 1000 / 8
+			bulkLimiter = rate.NewLimiter(rate.Limit(bytesPerSecond), streamCopyBufferSize)
+		}
+	})
+	if bulkLimiter == nil {
+		return dst
+	}
+	return throttledWriter{ctx: ctx, dst: dst, limiter: bulkLimiter}
+}
+
+type throttledWriter struct {
+	ctx     context.Context
+	dst     io.Writer
+	limiter *rate.Limiter
+}
+
+func (t throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), t.limiter.Burst())
+		if err := t.limiter.WaitN(t.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := t.dst.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
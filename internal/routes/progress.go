@@ -0,0 +1,172 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/stats"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultProgressListLimit = 20
+	maxProgressListLimit     = 100
+)
+
+type progressRequest struct {
+	Position  float64 `json:"position"`
+	Duration  float64 `json:"duration"`
+	Completed bool    `json:"completed"`
+}
+
+// LoadProgress registers the "continue watching" API of the signed-in user.
+// Positions are also updated from playback analytics events.
+func (e *allRoutes) LoadProgress(r *Route) {
+	progressLog := e.log.Named("Progress")
+	defer progressLog.Info("Loaded progress routes")
+	me := r.Router.Group("/api/me/progress", e.mediaAuth, requireProgressUser)
+	me.GET("", getProgressListRoute(progressLog))
+	me.GET("/:messageID", getProgressRoute(progressLog))
+	me.PUT("/:messageID", putProgressRoute(progressLog))
+	me.DELETE("/:messageID", deleteProgressRoute(progressLog))
+}
+
+// requireProgressUser rejects requests without a user behind them (legacy
+// signed links) and requests made before the database is up.
+func requireProgressUser(ctx *gin.Context) {
+	if database.DB == nil {
+		ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"error": "database not initialized",
+		})
+		return
+	}
+	if session, _ := streamSessionFrom(ctx); session.UserID == "" {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "a user session is required",
+		})
+		return
+	}
+	ctx.Next()
+}
+
+func progressMessageID(ctx *gin.Context) (int, bool) {
+	messageID, err := strconv.Atoi(ctx.Param("messageID"))
+	if err != nil || messageID <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{
+			"error": "invalid message ID",
+		})
+		return 0, false
+	}
+	return messageID, true
+}
+
+func getProgressListRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		session, _ := streamSessionFrom(ctx)
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(defaultProgressListLimit)))
+		if err != nil || limit <= 0 {
+			limit = defaultProgressListLimit
+		}
+		if limit > maxProgressListLimit {
+			limit = maxProgressListLimit
+		}
+		includeCompleted := ctx.Query("completed") == "true"
+
+		rows, err := stats.ListProgress(session.UserID, limit, includeCompleted)
+		if err != nil {
+			logger.Error("Failed to list progress", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list progress",
+			})
+			return
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, gin.H{
+			"items": rows,
+		})
+	}
+}
+
+func getProgressRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := progressMessageID(ctx)
+		if !ok {
+			return
+		}
+		session, _ := streamSessionFrom(ctx)
+		progress, err := stats.GetProgress(session.UserID, messageID)
+		if err != nil {
+			logger.Error("Failed to read progress", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to read progress",
+			})
+			return
+		}
+		if progress == nil {
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": "no progress for this file",
+			})
+			return
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, progress)
+	}
+}
+
+func putProgressRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := progressMessageID(ctx)
+		if !ok {
+			return
+		}
+		var req progressRequest
+		if err := ctx.ShouldBindJSON(&req); err != nil ||
+			!validPlaybackSeconds(req.Position) || !validPlaybackSeconds(req.Duration) {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "expected a JSON body with a non-negative position",
+			})
+			return
+		}
+
+		session, _ := streamSessionFrom(ctx)
+		err := stats.SaveProgress(stats.PlaybackProgress{
+			UserID:    session.UserID,
+			MessageID: messageID,
+			Position:  req.Position,
+			Duration:  req.Duration,
+			Completed: req.Completed,
+		})
+		if err != nil {
+			logger.Error("Failed to save progress", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to save progress",
+			})
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func deleteProgressRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		messageID, ok := progressMessageID(ctx)
+		if !ok {
+			return
+		}
+		session, _ := streamSessionFrom(ctx)
+		if err := stats.DeleteProgress(session.UserID, messageID); err != nil {
+			logger.Error("Failed to delete progress", zap.Int("messageID", messageID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to delete progress",
+			})
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,137 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reasons a request was limited, as labelled in the metrics.
+const (
+	rateLimitedRequests = "requests"
+	rateLimitedStreams  = "streams"
+)
+
+// rateLimitIdle is how long an unused bucket is kept.
+const rateLimitIdle = 10 * time.Minute
+
+// rateLimited counts 429 responses by reason.
+var rateLimited = map[string]*int64{
+	rateLimitedRequests: new(int64),
+	rateLimitedStreams:  new(int64),
+}
+
+// rateLimiter keeps a token bucket and the open streams of every client, so
+// one client can't keep all workers busy.
+var rateLimiter = struct {
+	mu        sync.Mutex
+	clients   map[string]*rateClient
+	lastSweep time.Time
+}{clients: make(map[string]*rateClient)}
+
+type rateClient struct {
+	tokens   float64
+	lastSeen time.Time
+	streams  int
+}
+
+// rateLimitKey is the session user of the request or, without one, its IP.
+func rateLimitKey(ctx *gin.Context) string {
+	if session, _ := streamSessionFrom(ctx); session.UserID != "" {
+		return "user:" + session.UserID
+	}
+	return "ip:" + ctx.ClientIP()
+}
+
+// rateLimit applies RATE_LIMIT_PER_MINUTE and, when streams is set,
+// MAX_STREAMS_PER_CLIENT, scaled by PREMIUM_LIMIT_MULTIPLIER for premium
+// users. It goes after the auth middleware so sessions are limited as a
+// whole, whatever IPs they come from.
+func rateLimit(streams bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString(authMethodKey) == internalAuthMethod {
+			ctx.Next()
+			return
+		}
+		premiumUser := isPremium(ctx)
+		perMinute := premiumLimit(config.Live().RateLimitPerMinute, premiumUser)
+		burst := premiumLimit(config.Live().RateLimitBurst, premiumUser)
+		maxStreams := premiumLimit(config.Live().MaxStreamsPerClient, premiumUser)
+		if !streams {
+			maxStreams = 0
+		}
+		if perMinute <= 0 && maxStreams <= 0 {
+			ctx.Next()
+			return
+		}
+		key := rateLimitKey(ctx)
+		now := time.Now()
+
+		rateLimiter.mu.Lock()
+		if now.Sub(rateLimiter.lastSweep) > rateLimitIdle {
+			for k, c := range rateLimiter.clients {
+				if c.streams == 0 && now.Sub(c.lastSeen) > rateLimitIdle {
+					delete(rateLimiter.clients, k)
+				}
+			}
+			rateLimiter.lastSweep = now
+		}
+		client := rateLimiter.clients[key]
+		if client == nil {
+			client = &rateClient{tokens: float64(burst), lastSeen: now}
+			rateLimiter.clients[key] = client
+		}
+		var retryAfter time.Duration
+		reason := ""
+		if perMinute > 0 {
+			rate := float64(perMinute) / 60
+			client.tokens = math.Min(float64(burst), client.tokens+now.Sub(client.lastSeen).Seconds()*rate)
+			if client.tokens < 1 {
+				reason = rateLimitedRequests
+				retryAfter = time.Duration((1 - client.tokens) / rate * float64(time.Second))
+			}
+		}
+		if reason == "" && maxStreams > 0 && client.streams >= maxStreams {
+			// A stream slot frees up when one ends, which can't be predicted
+			reason = rateLimitedStreams
+			retryAfter = 5 * time.Second
+		}
+		client.lastSeen = now
+		if reason == "" {
+			if perMinute > 0 {
+				client.tokens--
+			}
+			if maxStreams > 0 {
+				client.streams++
+			}
+		}
+		rateLimiter.mu.Unlock()
+
+		if reason != "" {
+			atomic.AddInt64(rateLimited[reason], 1)
+			ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			message := errorText(ctx, "error.rate_limited")
+			if reason == rateLimitedStreams {
+				message = errorText(ctx, "error.too_many_streams")
+			}
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error": message,
+			})
+			return
+		}
+		if maxStreams > 0 {
+			defer func() {
+				rateLimiter.mu.Lock()
+				client.streams--
+				rateLimiter.mu.Unlock()
+			}()
+		}
+		ctx.Next()
+	}
+}
@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"net/http"
+	"strings"
+)
+
+// requestRegion picks the REGION_HOSTS region of a request's links: the one
+// the client asks for with ?region= or X-FSB-Region, then with
+// REGION_POLICY=geoip the one REGION_COUNTRIES gives the country a CDN put
+// in REGION_COUNTRY_HEADER. It returns "" when none applies.
+func requestRegion(r *http.Request) string {
+	if len(config.ValueOf.Regions()) == 0 {
+		return ""
+	}
+	hint := r.URL.Query().Get("region")
+	if hint == "" {
+		hint = r.Header.Get("X-FSB-Region")
+	}
+	if _, ok := config.ValueOf.RegionURL(hint); ok {
+		return strings.ToLower(strings.TrimSpace(hint))
+	}
+	if config.ValueOf.RegionPolicy == config.RegionPolicyGeoIP {
+		return config.ValueOf.RegionForCountry(r.Header.Get(config.ValueOf.RegionCountryHeader))
+	}
+	return ""
+}
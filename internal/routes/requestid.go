@@ -0,0 +1,106 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "requestID"
+	workerIDKey     = "workerID"
+	maxRequestIDLen = 64
+)
+
+// RequestID tags each request with an ID, sent back in X-Request-ID. An ID a
+// proxy in front already set is kept, and edges pass theirs on to the origin,
+// so one request can be followed across servers.
+func RequestID(ctx *gin.Context) {
+	id := ctx.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+	ctx.Set(requestIDKey, id)
+	ctx.Request.Header.Set(requestIDHeader, id)
+	ctx.Header(requestIDHeader, id)
+	ctx.Next()
+}
+
+// validRequestID accepts the IDs proxies and tracing tools make: short, and
+// safe to put in a header and a log line.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestLogger is logger with the request ID, for the handlers' log lines.
+func requestLogger(ctx *gin.Context, logger *zap.Logger) *zap.Logger {
+	if id := ctx.GetString(requestIDKey); id != "" {
+		return logger.With(zap.String("requestID", id))
+	}
+	return logger
+}
+
+// setRequestWorker notes the worker serving the request for the access log.
+func setRequestWorker(ctx *gin.Context, worker *bot.Worker) {
+	ctx.Set(workerIDKey, worker.ID)
+}
+
+// AccessLog writes one structured line per request once it is answered. Query
+// strings are left out, they can carry API keys and stream tokens.
+func AccessLog(log *zap.Logger) gin.HandlerFunc {
+	log = log.Named("Access")
+	return func(ctx *gin.Context) {
+		if !config.Live().AccessLog {
+			ctx.Next()
+			return
+		}
+		start := time.Now()
+		ctx.Next()
+		route := ctx.FullPath()
+		if route == "" {
+			route = "-"
+		}
+		fields := []zap.Field{
+			zap.String("requestID", ctx.GetString(requestIDKey)),
+			zap.String("method", ctx.Request.Method),
+			zap.String("route", route),
+			zap.String("path", ctx.Request.URL.Path),
+			zap.Int("status", ctx.Writer.Status()),
+			zap.Int("bytes", max(ctx.Writer.Size(), 0)),
+			zap.Duration("duration", time.Since(start)),
+			zap.String("clientIP", ctx.ClientIP()),
+		}
+		if id, ok := ctx.Get(workerIDKey); ok {
+			fields = append(fields, zap.Int("workerID", id.(int)))
+		}
+		// Probes poll every few seconds; only their failures are news
+		if (route == "/healthz" || route == "/readyz") && ctx.Writer.Status() < http.StatusBadRequest {
+			log.Debug("Request", fields...)
+			return
+		}
+		log.Info("Request", fields...)
+	}
+}
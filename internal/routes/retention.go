@@ -0,0 +1,73 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/retention"
+	"EverythingSuckz/fsb/internal/trash"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// abortIfGone answers links to removed messages: 410 for files deleted or
+// expired by a retention policy, and for files in the trash; links to files
+// restored from the trash redirect to their new message ID.
+func abortIfGone(ctx *gin.Context, channelID int64, messageID int) bool {
+	if deletedAt, ok := retention.Gone(channelID, messageID); ok {
+		ctx.AbortWithStatusJSON(http.StatusGone, gin.H{
+			"error":      errorText(ctx, "error.file_removed"),
+			"deleted_at": deletedAt,
+		})
+		return true
+	}
+	if channelID != config.ValueOf.MediaChannelID {
+		return false
+	}
+	restoredAs, trashed := trash.Lookup(messageID)
+	switch {
+	case !trashed:
+		return false
+	case restoredAs == 0:
+		ctx.AbortWithStatusJSON(http.StatusGone, gin.H{
+			"error": errorText(ctx, "error.file_deleted"),
+		})
+	default:
+		target := config.ValueOf.BasePath + strings.Replace(ctx.FullPath(), ":messageID", opaqueid.ID(config.ValueOf.MediaChannelID, restoredAs), 1)
+		if ctx.Request.URL.RawQuery != "" {
+			target += "?" + ctx.Request.URL.RawQuery
+		}
+		ctx.Redirect(http.StatusPermanentRedirect, target)
+		ctx.Abort()
+	}
+	return true
+}
+
+// loadRetentionStats exposes the storage reclaimed by retention policies on
+// the status server.
+func loadRetentionStats(log *zap.Logger, r *Route) {
+	retentionLog := log.Named("Retention")
+	defer retentionLog.Info("Loaded retention stats route")
+	r.Router.GET("/api/stats/retention", func(ctx *gin.Context) {
+		if database.DB == nil {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "database not initialized",
+			})
+			return
+		}
+		totals, err := retention.Totals()
+		if err != nil {
+			retentionLog.Error("Failed to query tombstones", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to query tombstones",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"channels": totals,
+		})
+	})
+}
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const robotsPath = "/robots.txt"
+
+// LoadRobots serves /robots.txt as set by ROBOTS_TXT.
+func (e *allRoutes) LoadRobots(r *Route) {
+	robotsLog := e.log.Named("Robots")
+	body := "User-agent: *\nDisallow: /\n"
+	switch config.ValueOf.RobotsTxt {
+	case "off":
+		robotsLog.Info("robots.txt disabled")
+		return
+	case "allow":
+		body = "User-agent: *\nDisallow:\n"
+	}
+	r.Router.GET(robotsPath, func(ctx *gin.Context) {
+		ctx.Header("Cache-Control", "public, max-age=86400")
+		ctx.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(body))
+	})
+	robotsLog.Info("Loaded robots.txt route")
+}
+
+// noIndexHeader asks crawlers that ignore robots.txt, or reached a link
+// from elsewhere, not to index what they fetched.
+func noIndexHeader(ctx *gin.Context) {
+	ctx.Header("X-Robots-Tag", "noindex, nofollow")
+	ctx.Next()
+}
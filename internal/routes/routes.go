@@ -3,7 +3,15 @@ package routes
 import (
 	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/streamauth"
-	"reflect"
+	"EverythingSuckz/fsb/internal/transcode"
+	"EverythingSuckz/fsb/internal/upload"
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,45 +21,235 @@ import (
 type Route struct {
 	Name   string
 	Engine *gin.Engine
+	// Router is where a group registers its routes: Engine, behind the
+	// middleware the registry configures for the group
+	Router gin.IRouter
 }
 
 func (r *Route) Init(engine *gin.Engine) {
 	r.Engine = engine
+	r.Router = engine
 }
 
 type allRoutes struct {
 	log        *zap.Logger
 	streamAuth *streamauth.Service
+	// mediaAuth guards every route serving channel media
+	mediaAuth gin.HandlerFunc
+	// abuseGuard watches media requests for scraping, after mediaAuth
+	abuseGuard gin.HandlerFunc
+}
+
+// newAllRoutes builds the services the route groups depend on.
+func newAllRoutes(log *zap.Logger) (*allRoutes, error) {
+	streamAuthService, err := streamauth.NewService(log, streamauth.ServiceOptions{
+		FirebaseProjectIDs:     config.ValueOf.FirebaseProjectIDs,
+		FirebaseCertsURL:       config.ValueOf.FirebaseCertsURL,
+		CertsGracePeriod:       time.Duration(config.ValueOf.FirebaseCertsGraceMinutes) * time.Minute,
+		AppCheckProjectNumbers: config.ValueOf.AppCheckProjectNumbers,
+		AppCheckAppIDs:         config.ValueOf.AppCheckAppIDs,
+		AppCheckJWKSURL:        config.ValueOf.AppCheckJWKSURL,
+		PassthroughClaims:      config.ValueOf.PassthroughClaims,
+		ClaimsSigningSecret:    config.ValueOf.ClaimsSigningSecret,
+		ClaimsTTL:              time.Duration(config.ValueOf.ClaimsTTLSeconds) * time.Second,
+		SessionTTL:             time.Duration(config.ValueOf.StreamSessionTTLSeconds) * time.Second,
+		SessionMaxAge:          time.Duration(config.ValueOf.StreamSessionMaxSeconds) * time.Second,
+		CleanupInterval:        time.Duration(config.ValueOf.StreamSessionCleanupSeconds) * time.Second,
+		CookieName:             config.ValueOf.StreamSessionCookieName,
+		CookieSecure:           config.ValueOf.StreamSessionCookieSecure,
+		CookieDomain:           config.ValueOf.StreamSessionCookieDomain,
+		CookieSameSite:         config.ValueOf.StreamSessionCookieSameSite,
+		TrustForwardedHeaders:  config.ValueOf.TrustForwardedHeaders,
+		AllowLegacyHMAC:        config.ValueOf.StreamAllowLegacyHMAC,
+		StreamSecret:           config.ValueOf.StreamSecret,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("stream authentication: %w", err)
+	}
+	config.OnReload(func(changed []string) {
+		if slices.Contains(changed, "STREAM_SECRET") {
+			streamAuthService.SetStreamSecret(config.Live().StreamSecret)
+		}
+		if slices.Contains(changed, "STREAM_SESSION_TTL_SECONDS") {
+			streamAuthService.SetSessionTTL(time.Duration(config.Live().StreamSessionTTLSeconds) * time.Second)
+		}
+	})
+	if err := initImageStore(log); err != nil {
+		return nil, fmt.Errorf("image store: %w", err)
+	}
+	if err := transcode.Start(log, loopbackSource); err != nil {
+		return nil, fmt.Errorf("transcoding: %w", err)
+	}
+	if err := upload.Start(log, prefetchThumbnail(log.Named("Thumb"))); err != nil {
+		return nil, fmt.Errorf("uploads: %w", err)
+	}
+	return &allRoutes{
+		log:        log,
+		streamAuth: streamAuthService,
+		mediaAuth:  mediaAuthMiddleware(log.Named("MediaAuth"), streamAuthService),
+		abuseGuard: abuseGuardMiddleware(log.Named("Abuse")),
+	}, nil
 }
 
 func Load(log *zap.Logger, r *gin.Engine) {
 	log = log.Named("routes")
 	defer log.Sugar().Info("Loaded all API Routes")
 
-	streamAuthService, err := streamauth.NewService(log, streamauth.ServiceOptions{
-		FirebaseProjectID: config.ValueOf.FirebaseProjectID,
-		FirebaseCertsURL:  config.ValueOf.FirebaseCertsURL,
-		SessionTTL:        time.Duration(config.ValueOf.StreamSessionTTLSeconds) * time.Second,
-		CleanupInterval:   time.Duration(config.ValueOf.StreamSessionCleanupSeconds) * time.Second,
-		CookieName:        config.ValueOf.StreamSessionCookieName,
-		CookieSecure:      config.ValueOf.StreamSessionCookieSecure,
-		CookieDomain:      config.ValueOf.StreamSessionCookieDomain,
-	})
+	all, err := newAllRoutes(log)
 	if err != nil {
-		log.Fatal("Failed to initialize stream authentication", zap.Error(err))
+		log.Fatal("Failed to start route services", zap.Error(err))
+	}
+	if config.ValueOf.NoIndex {
+		r.Use(noIndexHeader)
 	}
-
 	route := &Route{Name: "/", Engine: r}
 	route.Init(r)
-	all := &allRoutes{
-		log:        log,
-		streamAuth: streamAuthService,
+	var off []string
+	owners := make(map[string]string) // "METHOD path" -> group
+	for _, g := range all.groups() {
+		if g.disabled {
+			if !slices.Contains(off, g.flag) {
+				off = append(off, g.flag)
+			}
+			continue
+		}
+		route.Router = r
+		if len(g.middleware) > 0 {
+			route.Router = r.Group("", g.middleware...)
+		}
+		if err := registerGroup(route, g, owners); err != nil {
+			log.Fatal("Conflicting routes", zap.String("group", g.name), zap.Error(err))
+		}
+	}
+	if len(off) > 0 {
+		log.Info("Skipped disabled routes", zap.Strings("flags", off))
+	}
+	log.Info("Registered routes\n" + formatRoutes(sortedRoutes()))
+}
+
+// routeGroup is a set of routes loaded together, with the auth they share,
+// middleware run before their own and the DISABLE_* flag turning them off.
+type routeGroup struct {
+	name       string
+	auth       string
+	load       func(*Route)
+	middleware []gin.HandlerFunc
+	flag       string
+	disabled   bool
+}
+
+// RouteInfo is a registered route, as listed at startup and by /api/routes.
+type RouteInfo struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Group  string `json:"group"`
+	Auth   string `json:"auth"`
+}
+
+// registeredRoutes is filled once by Load.
+var registeredRoutes []RouteInfo
+
+// groups lists the routes of the main server in registration order, so a
+// deployment can drop the ones it doesn't use.
+func (e *allRoutes) groups() []routeGroup {
+	const (
+		mediaAuth   = "media auth"
+		channelAuth = "media auth, public channels open"
+		none        = "none"
+	)
+	c := config.ValueOf
+	return []routeGroup{
+		{name: "robots", auth: none, load: e.LoadRobots},
+		{name: "health", auth: none, load: e.LoadHealth},
+		{name: "static", auth: none, load: e.LoadStatic, flag: "DISABLE_STATIC", disabled: c.DisableStatic},
+		{name: "status", auth: none, load: e.LoadStatus, flag: "DISABLE_STATUS", disabled: c.DisableStatus},
+		{name: "firebase_auth", auth: "Firebase ID token", load: e.LoadFirebaseAuth},
+		{name: "stream", auth: "link hash", load: e.LoadHome, flag: "DISABLE_STREAM", disabled: c.DisableStream},
+		{name: "direct", auth: channelAuth, load: e.LoadDirect, flag: "DISABLE_DIRECT", disabled: c.DisableDirect},
+		{name: "thumb", auth: mediaAuth, load: e.LoadThumb, flag: "DISABLE_THUMB", disabled: c.DisableThumb},
+		{name: "hls", auth: mediaAuth, load: e.LoadHLS, flag: "DISABLE_HLS", disabled: c.DisableHLS},
+		{name: "audio", auth: mediaAuth, load: e.LoadAudio, flag: "DISABLE_AUDIO", disabled: c.DisableAudio},
+		{name: "playlist", auth: channelAuth, load: e.LoadPlaylist, flag: "DISABLE_PLAYLIST", disabled: c.DisablePlaylist},
+		{name: "zip", auth: channelAuth, load: e.LoadZip, flag: "DISABLE_ZIP", disabled: c.DisableZip},
+		{name: "analytics", auth: mediaAuth, load: e.LoadPlaybackAnalytics, flag: "DISABLE_ANALYTICS", disabled: c.DisableAnalytics},
+		{name: "progress", auth: "media auth, signed-in user", load: e.LoadProgress, flag: "DISABLE_PROGRESS", disabled: c.DisableProgress},
+		{name: "heartbeat", auth: mediaAuth, load: e.LoadHeartbeat},
+		{name: "upload", auth: "media auth, uploader", load: e.LoadUpload, flag: "DISABLE_UPLOAD", disabled: c.DisableUpload},
+		{name: "tus", auth: "media auth, uploader", load: e.LoadTus, flag: "DISABLE_UPLOAD", disabled: c.DisableUpload},
+		{name: "webapp", auth: "mini app init data", load: e.LoadWebApp, middleware: []gin.HandlerFunc{noStore}},
+		{name: "payments", auth: "Stripe signature", load: e.LoadPayments},
+		{name: "admin", auth: "admin token, role per route", load: e.LoadAdmin, middleware: []gin.HandlerFunc{noStore}},
 	}
-	Type := reflect.TypeOf(all)
-	Value := reflect.ValueOf(all)
-	for i := 0; i < Type.NumMethod(); i++ {
-		Type.Method(i).Func.Call([]reflect.Value{Value, reflect.ValueOf(route)})
+}
+
+// registerGroup loads g and records the routes it added. gin panics on
+// routes that clash with registered ones; the panic is turned into an error
+// naming the groups involved.
+func registerGroup(r *Route, g routeGroup, owners map[string]string) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			msg := fmt.Sprint(p)
+			var clashes []string
+			for key, owner := range owners {
+				_, path, _ := strings.Cut(key, " ")
+				if strings.Contains(msg, "'"+path+"'") && !slices.Contains(clashes, owner) {
+					clashes = append(clashes, owner)
+				}
+			}
+			if len(clashes) > 0 {
+				msg += " (registered by " + strings.Join(clashes, ", ") + ")"
+			}
+			err = errors.New(msg)
+		}
+	}()
+	g.load(r)
+	for _, info := range r.Engine.Routes() {
+		key := info.Method + " " + info.Path
+		if _, ok := owners[key]; ok {
+			continue
+		}
+		owners[key] = g.name
+		registeredRoutes = append(registeredRoutes, RouteInfo{
+			Method: info.Method,
+			Path:   info.Path,
+			Group:  g.name,
+			Auth:   g.auth,
+		})
 	}
+	return nil
+}
+
+// sortedRoutes returns the registered routes ordered by path.
+func sortedRoutes() []RouteInfo {
+	routes := slices.Clone(registeredRoutes)
+	slices.SortFunc(routes, func(a, b RouteInfo) int {
+		return cmp.Or(strings.Compare(a.Path, b.Path), strings.Compare(a.Method, b.Method))
+	})
+	return routes
+}
+
+// formatRoutes lays routes out as a table.
+func formatRoutes(routes []RouteInfo) string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATH\tGROUP\tAUTH")
+	for _, route := range routes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", route.Method, route.Path, route.Group, route.Auth)
+	}
+	w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// noStore keeps responses with private data out of browser and proxy caches.
+func noStore(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+}
+
+// listRoutesRoute serves the routes registered at startup.
+func listRoutesRoute(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, gin.H{
+		"routes": sortedRoutes(),
+	})
 }
 
 // LoadStatusOnly loads only the status route on a separate router
@@ -62,5 +260,21 @@ func LoadStatusOnly(log *zap.Logger, r *gin.Engine) {
 	route := &Route{Name: "/", Engine: r}
 	route.Init(r)
 	allRoutes := &allRoutes{log: log}
-	allRoutes.LoadStatus(route)
+	if !config.ValueOf.DisableStatus {
+		allRoutes.LoadStatus(route)
+		loadCapacity(log, route)
+	}
+	loadBandwidthStats(log, route)
+	loadClusterLoad(log, route)
+	loadHealth(log, route)
+	loadPlaybackStats(log, route)
+	loadReferrerStats(log, route)
+	loadRequestAnalytics(log, route)
+	loadRetentionStats(log, route)
+	loadMetrics(log, route)
+	loadBalancerShadow(log, route)
+	loadWorkerAdmin(log, route)
+	if !config.ValueOf.DisableStatic {
+		loadStatic(log, route)
+	}
 }
@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/utils"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	mathrand "math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	selftestSize    = 256 * 1024
+	selftestTimeout = 2 * time.Minute
+)
+
+// selftestResult is the report of one canary run. Durations are milliseconds.
+type selftestResult struct {
+	OK         bool   `json:"ok"`
+	Step       string `json:"step,omitempty"` // where it failed
+	Error      string `json:"error,omitempty"`
+	WorkerID   int    `json:"worker_id"`
+	MessageID  int    `json:"message_id,omitempty"`
+	Size       int    `json:"size"`
+	UploadMs   int64  `json:"upload_ms"`
+	MetadataMs int64  `json:"metadata_ms"`
+	DownloadMs int64  `json:"download_ms"`
+	TotalMs    int64  `json:"total_ms"`
+}
+
+// selftestRoute uploads random bytes to LOG_CHANNEL, streams them back
+// through a worker and checks they match. ?worker=<id> picks the worker,
+// otherwise a random one is used.
+func selftestRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		workers := bot.Snapshot()
+		if len(workers) == 0 {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"error": "no workers available",
+			})
+			return
+		}
+		worker := workers[mathrand.Intn(len(workers))]
+		if id := ctx.Query("worker"); id != "" {
+			worker = nil
+			for _, w := range workers {
+				if strconv.Itoa(w.ID) == id {
+					worker = w
+				}
+			}
+			if worker == nil {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"error": "unknown worker",
+				})
+				return
+			}
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, selftestTimeout)
+		defer cancel()
+		res := runSelftest(runCtx, worker)
+		if !res.OK {
+			logger.Warn("Self-test failed",
+				zap.Int("workerID", res.WorkerID),
+				zap.String("step", res.Step),
+				zap.String("error", res.Error))
+			ctx.JSON(http.StatusServiceUnavailable, res)
+			return
+		}
+		logger.Info("Self-test passed",
+			zap.Int("workerID", res.WorkerID),
+			zap.Int64("totalMs", res.TotalMs))
+		ctx.JSON(http.StatusOK, res)
+	}
+}
+
+func runSelftest(ctx context.Context, worker *bot.Worker) *selftestResult {
+	res := &selftestResult{WorkerID: worker.ID, Size: selftestSize}
+	started := time.Now()
+	fail := func(step string, err error) *selftestResult {
+		res.Step = step
+		res.Error = err.Error()
+		res.TotalMs = time.Since(started).Milliseconds()
+		return res
+	}
+
+	payload := make([]byte, selftestSize)
+	if _, err := rand.Read(payload); err != nil {
+		return fail("generate", err)
+	}
+	tmp, err := os.CreateTemp("", "fsb-selftest-*.bin")
+	if err != nil {
+		return fail("generate", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(payload)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fail("generate", err)
+	}
+
+	step := time.Now()
+	name := fmt.Sprintf("fsb-selftest-%d.bin", started.Unix())
+	channelID := config.ValueOf.LogChannelID
+	res.MessageID, err = bot.UploadToChannel(ctx, channelID, tmp.Name(), name, "application/octet-stream", "fsb self-test, deleted once checked", nil)
+	res.UploadMs = time.Since(step).Milliseconds()
+	if err != nil {
+		return fail("upload", err)
+	}
+	defer func() {
+		// Outlive a timed out run so the canary doesn't pile up in the channel
+		cleanupCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = bot.DeleteChannelMessages(cleanupCtx, channelID, res.MessageID)
+	}()
+
+	step = time.Now()
+	file, err := utils.FileFromMessageAndChannel(ctx, worker.Client, channelID, res.MessageID)
+	res.MetadataMs = time.Since(step).Milliseconds()
+	if err != nil {
+		return fail("metadata", err)
+	}
+
+	step = time.Now()
+	reader, err := utils.NewTelegramReader(ctx, worker.Client, file.Location, 0, file.FileSize-1, file.FileSize)
+	if err != nil {
+		return fail("download", err)
+	}
+	defer reader.Close()
+	got, err := io.ReadAll(reader)
+	res.DownloadMs = time.Since(step).Milliseconds()
+	if err != nil {
+		return fail("download", err)
+	}
+	if !bytes.Equal(got, payload) {
+		return fail("verify", fmt.Errorf("streamed %d bytes that differ from the %d uploaded", len(got), len(payload)))
+	}
+
+	res.OK = true
+	res.TotalMs = time.Since(started).Milliseconds()
+	return res
+}
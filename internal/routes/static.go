@@ -0,0 +1,96 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"embed"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticCacheControl lets browsers keep assets for a day; they only change
+// with a release or a restart with another LOGO_FILE.
+const staticCacheControl = "public, max-age=86400"
+
+type staticAsset struct {
+	data        []byte
+	contentType string
+}
+
+// LoadStatic registers /favicon.ico and /static/* on the main server.
+func (e *allRoutes) LoadStatic(r *Route) {
+	loadStatic(e.log, r)
+}
+
+// loadStatic serves the embedded favicon and dashboard assets. LOGO_FILE and
+// FAVICON_FILE replace the embedded logo and favicon for white-labeling.
+func loadStatic(log *zap.Logger, r *Route) {
+	staticLog := log.Named("Static")
+	defer staticLog.Info("Loaded static routes")
+
+	assets := make(map[string]staticAsset)
+	fs.WalkDir(embeddedStatic, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := embeddedStatic.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		assets[path.Base(name)] = newStaticAsset(name, data)
+		return nil
+	})
+	overrides := map[string]string{
+		"logo.svg":    config.ValueOf.LogoFile,
+		"favicon.ico": config.ValueOf.FaviconFile,
+	}
+	for name, file := range overrides {
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			staticLog.Warn("Failed to read custom asset, using the built-in one", zap.String("asset", name), zap.Error(err))
+			continue
+		}
+		assets[name] = newStaticAsset(file, data)
+	}
+
+	serve := func(ctx *gin.Context, name string) {
+		asset, ok := assets[name]
+		if !ok {
+			ctx.Status(http.StatusNotFound)
+			return
+		}
+		ctx.Header("Cache-Control", staticCacheControl)
+		ctx.Data(http.StatusOK, asset.contentType, asset.data)
+	}
+	r.Router.GET("/favicon.ico", func(ctx *gin.Context) {
+		serve(ctx, "favicon.ico")
+	})
+	r.Router.GET("/static/*file", func(ctx *gin.Context) {
+		serve(ctx, path.Base(ctx.Param("file")))
+	})
+}
+
+// newStaticAsset types data by the extension of the file it came from, so a
+// PNG logo keeps working under /static/logo.svg.
+func newStaticAsset(file string, data []byte) staticAsset {
+	contentType := mime.TypeByExtension(filepath.Ext(file))
+	if filepath.Ext(file) == ".ico" {
+		contentType = "image/x-icon"
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+	return staticAsset{data: data, contentType: contentType}
+}
@@ -1,10 +1,18 @@
 package routes
 
 import (
+	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/i18n"
+	"EverythingSuckz/fsb/internal/janitor"
+	"EverythingSuckz/fsb/internal/updatecheck"
+	"EverythingSuckz/fsb/internal/utils"
 	"fmt"
+	"html"
+	"html/template"
 	"net/http"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,38 +24,66 @@ import (
 func (e *allRoutes) LoadStatus(r *Route) {
 	statusLog := e.log.Named("Status")
 	defer statusLog.Info("Loaded status route")
-	r.Engine.GET("/status", getStatusRoute(statusLog))
+	r.Router.GET("/status", getStatusRoute(statusLog))
+}
+
+// loadCapacity registers /status/capacity, on the status server only.
+func loadCapacity(log *zap.Logger, r *Route) {
+	defer log.Named("Capacity").Info("Loaded capacity route")
+	r.Router.GET("/status/capacity", getCapacityRoute)
 }
 
 type WorkerStatus struct {
-	ID                int     `json:"id"`
-	Username          string  `json:"username"`
-	ActiveRequests    int32   `json:"active_requests"`
-	TotalRequests     int64   `json:"total_requests"`
-	FailedRequests    int64   `json:"failed_requests"`
-	SuccessRate       float64 `json:"success_rate"`
-	AverageResponseMs float64 `json:"average_response_ms"`
-	UptimeSeconds     int64   `json:"uptime_seconds"`
-	LastRequestAgo    string  `json:"last_request_ago"`
+	ID                int              `json:"id"`
+	Username          string           `json:"username"`
+	Class             string           `json:"class,omitempty"` // WORKER_LABELS class, empty when unlabelled
+	ActiveRequests    int32            `json:"active_requests"`
+	TotalRequests     int64            `json:"total_requests"`
+	FailedRequests    int64            `json:"failed_requests"`
+	SuccessRate       float64          `json:"success_rate"`
+	AverageResponseMs float64          `json:"average_response_ms"`
+	UptimeSeconds     int64            `json:"uptime_seconds"`
+	LastRequestAgo    string           `json:"last_request_ago"`
+	BudgetWaits       map[string]int64 `json:"budget_waits,omitempty"` // calls that waited for the request budget, by priority
+	DC                int              `json:"dc"`
+	PingMs            float64          `json:"ping_ms"`                      // round trip to the DC, 0 until measured
+	Healthy           bool             `json:"healthy"`                      // false while failing pings, see WORKER_UNHEALTHY_AFTER
+	FloodWaitSeconds  int              `json:"flood_wait_seconds,omitempty"` // left of a FLOOD_WAIT, no new requests are routed here meanwhile
+	// Source channels checked and readable, see ACCESS_CHECK_MINUTES. Which
+	// ones and why is left to GET /admin/workers.
+	ChannelsChecked  int `json:"channels_checked"`
+	ChannelsReadable int `json:"channels_readable"`
 }
 
 type StatusResponse struct {
-	TotalWorkers       int            `json:"total_workers"`
-	TotalActiveReqs    int32          `json:"total_active_requests"`
-	TotalRequests      int64          `json:"total_requests"`
-	TotalFailedReqs    int64          `json:"total_failed_requests"`
-	OverallSuccessRate float64        `json:"overall_success_rate"`
-	Workers            []WorkerStatus `json:"workers"`
-	RequestLogs        []RequestLog   `json:"request_logs"`
-	Timestamp          time.Time      `json:"timestamp"`
+	TotalWorkers       int                 `json:"total_workers"`
+	TotalActiveReqs    int32               `json:"total_active_requests"`
+	TotalRequests      int64               `json:"total_requests"`
+	TotalFailedReqs    int64               `json:"total_failed_requests"`
+	OverallSuccessRate float64             `json:"overall_success_rate"`
+	Workers            []WorkerStatus      `json:"workers"`
+	RequestLogs        []RequestLog        `json:"request_logs"`
+	Janitor            janitor.Stats       `json:"janitor"`
+	CacheWritesSkipped int64               `json:"cache_writes_skipped_low_disk"`
+	ChunksCoalesced    int64               `json:"chunks_coalesced"`
+	Update             *updatecheck.Status `json:"update,omitempty"`
+	Timestamp          time.Time           `json:"timestamp"`
+}
+
+// getCapacityRoute serves the load against CAPACITY_MBPS and
+// CAPACITY_STREAMS_PER_WORKER for autoscalers.
+func getCapacityRoute(ctx *gin.Context) {
+	ctx.Header("Cache-Control", "no-store")
+	ctx.JSON(http.StatusOK, bot.CurrentCapacity())
 }
 
 func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		if bot.Workers == nil || len(bot.Workers.Bots) == 0 {
+		snapshot := bot.Snapshot()
+		if len(snapshot) == 0 {
 			// Check if request wants HTML
-			if ctx.GetHeader("Accept") == "text/html" || ctx.Query("format") == "html" {
-				ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(getNoWorkersHTML()))
+			if !config.ValueOf.DisableStatusHTML && (ctx.GetHeader("Accept") == "text/html" || ctx.Query("format") == "html") {
+				ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(getNoWorkersHTML(i18n.FromAcceptLanguage(ctx.GetHeader("Accept-Language")))))
 				return
 			}
 			ctx.JSON(http.StatusOK, gin.H{
@@ -60,11 +96,11 @@ func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 		var totalActiveReqs int32
 		var totalRequests int64
 		var totalFailedReqs int64
-		workers := make([]WorkerStatus, 0, len(bot.Workers.Bots))
+		workers := make([]WorkerStatus, 0, len(snapshot))
 
 		now := time.Now()
 
-		for _, worker := range bot.Workers.Bots {
+		for _, worker := range snapshot {
 			metrics := worker.GetMetrics()
 
 			totalActiveReqs += metrics.ActiveRequests
@@ -97,6 +133,7 @@ func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 			workers = append(workers, WorkerStatus{
 				ID:                worker.ID,
 				Username:          worker.Self.Username,
+				Class:             worker.Class(),
 				ActiveRequests:    metrics.ActiveRequests,
 				TotalRequests:     metrics.TotalRequests,
 				FailedRequests:    metrics.FailedRequests,
@@ -104,7 +141,19 @@ func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 				AverageResponseMs: worker.GetAverageResponseTime(),
 				UptimeSeconds:     int64(uptime),
 				LastRequestAgo:    lastRequestAgo,
+				BudgetWaits:       worker.BudgetWaits(),
+				DC:                worker.DC(),
+				PingMs:            float64(worker.Ping().Microseconds()) / 1000,
+				Healthy:           worker.Healthy(),
+				FloodWaitSeconds:  int((worker.FloodWaitRemaining() + time.Second - 1) / time.Second),
 			})
+			status := &workers[len(workers)-1]
+			for _, access := range worker.ChannelAccess() {
+				status.ChannelsChecked++
+				if access.Readable {
+					status.ChannelsReadable++
+				}
+			}
 		}
 
 		// Calculate overall success rate
@@ -118,23 +167,27 @@ func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 		requestLogs := GetRequestLogs()
 
 		response := StatusResponse{
-			TotalWorkers:       len(bot.Workers.Bots),
+			TotalWorkers:       len(snapshot),
 			TotalActiveReqs:    totalActiveReqs,
 			TotalRequests:      totalRequests,
 			TotalFailedReqs:    totalFailedReqs,
 			OverallSuccessRate: overallSuccessRate,
 			Workers:            workers,
 			RequestLogs:        requestLogs,
+			Janitor:            janitor.GetStats(),
+			CacheWritesSkipped: utils.DiskGuardSkips(),
+			ChunksCoalesced:    utils.CoalescedChunks(),
+			Update:             updatecheck.Last(),
 			Timestamp:          now,
 		}
 
 		// Check if browser is requesting (wants HTML)
 		acceptHeader := ctx.GetHeader("Accept")
-		if ctx.Query("format") == "html" || (acceptHeader != "" &&
+		if !config.ValueOf.DisableStatusHTML && (ctx.Query("format") == "html" || (acceptHeader != "" &&
 			(ctx.GetHeader("Accept") == "text/html" ||
-				ctx.GetHeader("User-Agent") != "" && len(acceptHeader) > 0)) {
+				ctx.GetHeader("User-Agent") != "" && len(acceptHeader) > 0))) {
 			// Return HTML table view
-			htmlContent := generateStatusHTML(response)
+			htmlContent := generateStatusHTML(response, i18n.FromAcceptLanguage(ctx.GetHeader("Accept-Language")))
 			ctx.Data(http.StatusOK, "text/html; charset=utf-8", []byte(htmlContent))
 			return
 		}
@@ -144,20 +197,21 @@ func getStatusRoute(logger *zap.Logger) gin.HandlerFunc {
 	}
 }
 
-func getNoWorkersHTML() string {
-	return `<!DOCTYPE html>
+func getNoWorkersHTML(lang string) string {
+	return fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head>
 	<meta charset="UTF-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
 	<meta http-equiv="refresh" content="1">
-	<title>Workers Status</title>
+	<title>%s</title>
+	%s
 	<style>
 		body {
 			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
 			margin: 0;
 			padding: 20px;
-			background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+			background: linear-gradient(135deg, var(--brand-color) 0%%, var(--brand-accent-color) 100%%);
 			min-height: 100vh;
 		}
 		.container {
@@ -183,14 +237,15 @@ func getNoWorkersHTML() string {
 </head>
 <body>
 	<div class="container">
-		<h1>⚠️ Workers Status</h1>
-		<div class="error">No workers available</div>
+		<h1>⚠️ %s</h1>
+		<div class="error">%s</div>
 	</div>
 </body>
-</html>`
+</html>`, brandTitle(i18n.T(lang, "status.title")), brandHead(),
+		html.EscapeString(i18n.T(lang, "status.title")), html.EscapeString(i18n.T(lang, "status.no_workers")))
 }
 
-func generateStatusHTML(response StatusResponse) string {
+func generateStatusHTML(response StatusResponse, lang string) string {
 	// Sort workers by ID
 	sort.Slice(response.Workers, func(i, j int) bool {
 		return response.Workers[i].ID < response.Workers[j].ID
@@ -202,7 +257,10 @@ func generateStatusHTML(response StatusResponse) string {
 		// Determine status color based on active requests
 		statusClass := "status-idle"
 		statusIcon := "🟢"
-		if worker.ActiveRequests > 5 {
+		if worker.FloodWaitSeconds > 0 {
+			statusClass = "status-busy"
+			statusIcon = "⏳"
+		} else if worker.ActiveRequests > 5 {
 			statusClass = "status-busy"
 			statusIcon = "🔴"
 		} else if worker.ActiveRequests > 0 {
@@ -217,6 +275,9 @@ func generateStatusHTML(response StatusResponse) string {
 		<tr class="%s">
 			<td><strong>#%d</strong></td>
 			<td>%s @%s</td>
+			<td>%s</td>
+			<td>%s</td>
+			%s
 			<td class="active-reqs">%d</td>
 			<td>%d</td>
 			<td>%d</td>
@@ -225,6 +286,7 @@ func generateStatusHTML(response StatusResponse) string {
 			<td>%s</td>
 			<td>%s</td>
 		</tr>`, statusClass, worker.ID, statusIcon, worker.Username,
+			formatDC(worker.DC), formatPing(worker.PingMs), formatChannels(worker.ChannelsReadable, worker.ChannelsChecked),
 			worker.ActiveRequests, worker.TotalRequests, worker.FailedRequests,
 			worker.SuccessRate, worker.AverageResponseMs, uptimeStr, worker.LastRequestAgo)
 	}
@@ -282,7 +344,8 @@ func generateStatusHTML(response StatusResponse) string {
 <head>
 	<meta charset="UTF-8">
 	<meta name="viewport" content="width=device-width, initial-scale=1.0">
-	<title>Workers Status - Real-time Dashboard</title>
+	<title>%s</title>
+	%s
 	<style>
 		* {
 			margin: 0;
@@ -291,7 +354,7 @@ func generateStatusHTML(response StatusResponse) string {
 		}
 		body {
 			font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
-			background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
+			background: linear-gradient(135deg, var(--brand-color) 0%%, var(--brand-accent-color) 100%%);
 			min-height: 100vh;
 			padding: 20px;
 		}
@@ -309,6 +372,10 @@ func generateStatusHTML(response StatusResponse) string {
 			text-align: center;
 			font-size: 32px;
 		}
+		h1 .logo {
+			height: 36px;
+			vertical-align: middle;
+		}
 		.subtitle {
 			text-align: center;
 			color: #718096;
@@ -381,7 +448,7 @@ func generateStatusHTML(response StatusResponse) string {
 			margin-bottom: 30px;
 		}
 		.stat-card {
-			background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%);
+			background: linear-gradient(135deg, var(--brand-color) 0%%, var(--brand-accent-color) 100%%);
 			color: white;
 			padding: 20px;
 			border-radius: 8px;
@@ -487,16 +554,30 @@ func generateStatusHTML(response StatusResponse) string {
 		.blink {
 			animation: blink 1s ease-in-out infinite;
 		}
+		.update-banner {
+			background: #ebf8ff;
+			border: 1px solid #90cdf4;
+			color: #2c5282;
+			border-radius: 8px;
+			padding: 12px 16px;
+			margin-bottom: 20px;
+			font-size: 14px;
+		}
+		.update-banner.breaking {
+			background: #fffaf0;
+			border-color: #f6ad55;
+			color: #7b341e;
+		}
 	</style>
 </head>
 <body>
 	<div class="container">
-		<h1>🤖 Workers Status Dashboard</h1>
-		<div class="subtitle">Real-time monitoring</div>
-		
+		<h1>%s %s</h1>
+		<div class="subtitle">%s · %s</div>
+		%s
 		<div class="controls">
 			<div class="control-group">
-				<span class="control-label">Auto-refresh (1s):</span>
+				<span class="control-label">%s</span>
 				<label class="switch">
 					<input type="checkbox" id="autoRefreshToggle" checked>
 					<span class="slider"></span>
@@ -504,26 +585,26 @@ func generateStatusHTML(response StatusResponse) string {
 			</div>
 			<div class="control-group">
 				<span id="refreshStatus" class="control-label" style="color: #48bb78;">
-					<span class="blink">●</span> Active
+					<span class="blink">●</span> %s
 				</span>
 			</div>
 		</div>
 		
 		<div class="stats-grid">
 			<div class="stat-card">
-				<h3>Total Workers</h3>
+				<h3>%s</h3>
 				<div class="value">%d</div>
 			</div>
 			<div class="stat-card">
-				<h3>Active Requests</h3>
+				<h3>%s</h3>
 				<div class="value">%d</div>
 			</div>
 			<div class="stat-card">
-				<h3>Total Requests</h3>
+				<h3>%s</h3>
 				<div class="value">%d</div>
 			</div>
 			<div class="stat-card">
-				<h3>Success Rate</h3>
+				<h3>%s</h3>
 				<div class="value">%.1f%%</div>
 			</div>
 		</div>
@@ -532,15 +613,7 @@ func generateStatusHTML(response StatusResponse) string {
 			<table>
 				<thead>
 					<tr>
-						<th>ID</th>
-						<th>Bot</th>
-						<th>Active</th>
-						<th>Total</th>
-						<th>Failed</th>
-						<th>Success Rate</th>
-						<th>Avg Response (Last 5)</th>
-						<th>Uptime</th>
-						<th>Last Request</th>
+						%s
 					</tr>
 				</thead>
 				<tbody>
@@ -549,23 +622,12 @@ func generateStatusHTML(response StatusResponse) string {
 			</table>
 		</div>
 
-		<h2 style="margin-top: 40px; margin-bottom: 20px; color: #2d3748;">📊 Recent Requests (Last 300)</h2>
+		<h2 style="margin-top: 40px; margin-bottom: 20px; color: #2d3748;">📊 %s</h2>
 		<div class="table-container">
 			<table>
 				<thead>
 					<tr>
-						<th>Time</th>
-						<th>Message ID</th>
-						<th>Worker</th>
-						<th>Range Start</th>
-						<th>Range End</th>
-						<th>Chunk Size</th>
-						<th>Bytes Sent</th>
-						<th>File Size</th>
-						<th>Status</th>
-						<th>Duration</th>
-						<th>Client IP</th>
-						<th>User Agent</th>
+						%s
 					</tr>
 				</thead>
 				<tbody>
@@ -574,7 +636,7 @@ func generateStatusHTML(response StatusResponse) string {
 			</table>
 		</div>
 
-		<div class="timestamp">Last updated: %s</div>
+		<div class="timestamp">%s</div>
 	</div>
 
 	<script>
@@ -586,10 +648,10 @@ func generateStatusHTML(response StatusResponse) string {
 
 		function updateStatus() {
 			if (isAutoRefreshEnabled) {
-				statusText.innerHTML = '<span class="blink">●</span> Active';
+				statusText.innerHTML = '<span class="blink">●</span> %s';
 				statusText.style.color = '#48bb78';
 			} else {
-				statusText.innerHTML = '○ Paused';
+				statusText.innerHTML = '○ %s';
 				statusText.style.color = '#e53e3e';
 			}
 		}
@@ -623,13 +685,90 @@ func generateStatusHTML(response StatusResponse) string {
 	</script>
 </body>
 </html>`,
+		brandTitle(i18n.T(lang, "status.title")),
+		brandHead(),
+		brandLogo(),
+		html.EscapeString(i18n.T(lang, "status.heading")),
+		brandName(),
+		html.EscapeString(i18n.T(lang, "status.subtitle")),
+		updateBannerHTML(response.Update),
+		html.EscapeString(i18n.T(lang, "status.auto_refresh")),
+		html.EscapeString(i18n.T(lang, "status.refresh_active")),
+		html.EscapeString(i18n.T(lang, "status.total_workers")),
 		response.TotalWorkers,
+		html.EscapeString(i18n.T(lang, "status.active_requests")),
 		response.TotalActiveReqs,
+		html.EscapeString(i18n.T(lang, "status.total_requests")),
 		response.TotalRequests,
+		html.EscapeString(i18n.T(lang, "status.success_rate")),
 		response.OverallSuccessRate,
+		tableHeader(lang, "id", "bot", "dc", "ping", "channels", "active", "total", "failed",
+			"success_rate", "avg_response", "uptime", "last_request"),
 		workerRows,
+		html.EscapeString(i18n.T(lang, "status.recent_requests")),
+		tableHeader(lang, "time", "message_id", "worker", "range_start", "range_end", "chunk_size",
+			"bytes_sent", "file_size", "status", "duration", "client_ip", "user_agent"),
 		requestRows,
-		response.Timestamp.Format("2006-01-02 15:04:05"))
+		html.EscapeString(i18n.T(lang, "status.last_updated", response.Timestamp.Format("2006-01-02 15:04:05"))),
+		template.JSEscapeString(i18n.T(lang, "status.refresh_active")),
+		template.JSEscapeString(i18n.T(lang, "status.refresh_paused")))
+}
+
+// tableHeader is a row of <th> with the status.col.<column> messages.
+func tableHeader(lang string, columns ...string) string {
+	var b strings.Builder
+	for _, column := range columns {
+		fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(i18n.T(lang, "status.col."+column)))
+	}
+	return b.String()
+}
+
+// updateBannerHTML announces a newer release, if the update check found one.
+func updateBannerHTML(status *updatecheck.Status) string {
+	if status == nil || !status.UpdateAvailable {
+		return ""
+	}
+	class := "update-banner"
+	text := fmt.Sprintf("⬆️ Version %s is available (running %s).", html.EscapeString(status.Latest), html.EscapeString(status.Current))
+	if status.Breaking {
+		class += " breaking"
+		text += " ⚠️ It contains breaking changes:"
+	}
+	notes := ""
+	for _, r := range status.Releases {
+		for _, note := range r.Breaking {
+			notes += fmt.Sprintf("<li>%s: %s</li>", html.EscapeString(r.Version), html.EscapeString(note))
+		}
+	}
+	if notes != "" {
+		notes = "<ul>" + notes + "</ul>"
+	}
+	return fmt.Sprintf(`<div class="%s">%s%s</div>`, class, text, notes)
+}
+
+func formatDC(dc int) string {
+	if dc == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("DC%d", dc)
+}
+
+func formatPing(ms float64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f ms", ms)
+}
+
+// formatChannels is the readable channels out of the checked ones.
+func formatChannels(readable, checked int) string {
+	if checked == 0 {
+		return "<td>-</td>"
+	}
+	if readable == checked {
+		return fmt.Sprintf("<td>%d/%d</td>", readable, checked)
+	}
+	return fmt.Sprintf(`<td class="status-error">⚠️ %d/%d</td>`, readable, checked)
 }
 
 func formatUptime(seconds int64) string {
@@ -646,20 +785,3 @@ func formatUptime(seconds int64) string {
 		return fmt.Sprintf("%dm", minutes)
 	}
 }
-
-func formatFileSize(bytes int64) string {
-	if bytes == 0 {
-		return "0 B"
-	}
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
-	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
-	}
-	units := []string{"KB", "MB", "GB", "TB"}
-	return fmt.Sprintf("%.1f %s", float64(bytes)/float64(div), units[exp])
-}
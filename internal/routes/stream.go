@@ -1,13 +1,17 @@
 package routes
 
 import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/blocklist"
 	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/types"
 	"EverythingSuckz/fsb/internal/utils"
 	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gotd/td/tg"
 	range_parser "github.com/quantumsheep/range-parser"
@@ -21,10 +25,12 @@ var log *zap.Logger
 func (e *allRoutes) LoadHome(r *Route) {
 	log = e.log.Named("Stream")
 	defer log.Info("Loaded stream route")
-	r.Engine.GET("/stream/:messageID", getStreamRoute)
+	r.Router.GET("/stream/:messageID", rateLimit(true), e.abuseGuard, getStreamRoute)
 }
 
 func getStreamRoute(ctx *gin.Context) {
+	log := requestLogger(ctx, log)
+	requestStartTime := time.Now()
 	w := ctx.Writer
 	r := ctx.Request
 
@@ -34,14 +40,26 @@ func getStreamRoute(ctx *gin.Context) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if abortIfBlocked(ctx, config.ValueOf.LogChannelID, messageID) || abortIfGone(ctx, config.ValueOf.LogChannelID, messageID) {
+		return
+	}
 
 	authHash := ctx.Query("hash")
 	if authHash == "" {
-		http.Error(w, "missing hash param", http.StatusBadRequest)
+		http.Error(w, errorText(ctx, "error.missing_hash"), http.StatusBadRequest)
+		return
+	}
+	if _, blocked := blocklist.HashBlocked(authHash); blocked {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": errorText(ctx, "error.link_revoked"),
+		})
 		return
 	}
 
-	worker := bot.GetNextWorker()
+	worker := acquireWorker(ctx, log, bot.GetNextWorker, messageID)
+	if worker == nil {
+		return
+	}
 
 	// Create a background context for Telegram API calls that won't be cancelled
 	// when the HTTP client disconnects. This prevents "context canceled" errors.
@@ -60,7 +78,12 @@ func getStreamRoute(ctx *gin.Context) {
 		file.ID,
 	)
 	if !utils.CheckHash(authHash, expectedHash) {
-		http.Error(w, "invalid hash", http.StatusBadRequest)
+		http.Error(w, errorText(ctx, "error.invalid_hash"), http.StatusBadRequest)
+		return
+	}
+
+	if fileNotModified(ctx, file) {
+		ctx.Status(http.StatusNotModified)
 		return
 	}
 
@@ -89,15 +112,19 @@ func getStreamRoute(ctx *gin.Context) {
 	}
 
 	ctx.Header("Accept-Ranges", "bytes")
+	setFaststartHeaders(ctx, log, worker, file)
 	var start, end int64
 	rangeHeader := r.Header.Get("Range")
+	if rangeHeader != "" && !ifRangeMatches(r, file) {
+		rangeHeader = ""
+	}
 
 	if rangeHeader == "" {
 		start = 0
 		end = file.FileSize - 1
 		w.WriteHeader(http.StatusOK)
 	} else {
-		ranges, err := range_parser.Parse(file.FileSize, r.Header.Get("Range"))
+		ranges, err := range_parser.Parse(file.FileSize, rangeHeader)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
@@ -128,9 +155,41 @@ func getStreamRoute(ctx *gin.Context) {
 	ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=\"%s\"", disposition, file.FileName))
 
 	if r.Method != "HEAD" {
-		lr, _ := utils.NewTelegramReader(bgCtx, worker.Client, file.Location, start, end, contentLength)
-		if _, err := io.CopyN(w, lr, contentLength); err != nil {
+		if isPlaybackStart(rangeHeader) {
+			stats.RecordOpen(stats.Open{
+				ChannelID: config.ValueOf.LogChannelID,
+				MessageID: messageID,
+				Referrer:  r.Referer(),
+				UserAgent: r.UserAgent(),
+			})
+		}
+		// A worker failing mid-stream hands the rest of the range to another
+		src := &rangeSource{
+			worker: worker,
+			file:   file,
+			lookup: func(ctx context.Context, w *bot.Worker, fresh bool) (*types.File, error) {
+				if fresh {
+					_ = utils.ForgetMessageFile(messageID, w.Client.Self.ID)
+				}
+				return utils.FileFromMessage(ctx, w.Client, messageID)
+			},
+			switched: func(from, to *bot.Worker) { setRequestWorker(ctx, to) },
+			logger:   log,
+		}
+		written, err := copyFileRange(bgCtx, src, start, end, w)
+		if err != nil {
 			log.Error("Error while copying stream", zap.Error(err))
 		}
+		stats.Record(stats.Request{
+			Route:      "stream",
+			ChannelID:  config.ValueOf.LogChannelID,
+			MessageID:  messageID,
+			FileName:   file.FileName,
+			Bytes:      written,
+			ClientIP:   ctx.ClientIP(),
+			StatusCode: w.Status(),
+			Duration:   time.Since(requestStartTime),
+			View:       w.Status() < http.StatusBadRequest && isPlaybackStart(rangeHeader),
+		})
 	}
 }
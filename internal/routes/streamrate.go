@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+)
+
+// limitStreamRate caps a single download to MAX_STREAM_RATE megabytes per
+// second, times PREMIUM_LIMIT_MULTIPLIER for premium users, so a few clients
+// pulling at line speed can't push the workers into flood waits. It returns
+// src as is when there is no cap.
+func limitStreamRate(ctx context.Context, src io.Reader) io.Reader {
+	megabytes := config.ValueOf.MaxStreamRate
+	if megabytes <= 0 {
+		return src
+	}
+	if premiumRequest(ctx) {
+		if config.ValueOf.PremiumLimitMultiplier == 0 {
+			return src
+		}
+		megabytes *= float64(config.ValueOf.PremiumLimitMultiplier)
+	}
+	bytesPerSecond := megabytes * 1024 * 1024
+	return &throttledReader{
+		ctx:     ctx,
+		src:     src,
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), streamCopyBufferSize),
+	}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	src     io.Reader
+	limiter *rate.Limiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > t.limiter.Burst() {
+		p = p[:t.limiter.Burst()]
+	}
+	n, err := t.src.Read(p)
+	if n > 0 {
+		if waitErr := t.limiter.WaitN(t.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
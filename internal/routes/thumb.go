@@ -3,12 +3,14 @@ package routes
 import (
 	"EverythingSuckz/fsb/config"
 	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/budget"
+	"EverythingSuckz/fsb/internal/imagestore"
+	"EverythingSuckz/fsb/internal/upload"
 	"EverythingSuckz/fsb/internal/utils"
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,23 +32,18 @@ type ThumbnailFetcher struct {
 	messageBuffer *sync.Map
 	bufferOrder   []int
 	bufferMutex   sync.Mutex
-	thumbDir      string
+	store         imagestore.Store
 	entity        tg.InputChannelClass
 	entityMutex   sync.Mutex
 }
 
-func NewThumbnailFetcher(client *gotgproto.Client, logger *zap.Logger, thumbDir string) *ThumbnailFetcher {
-	// Create thumb directory if it doesn't exist
-	if err := os.MkdirAll(thumbDir, 0755); err != nil {
-		logger.Error("Failed to create thumb directory", zap.Error(err))
-	}
-
+func NewThumbnailFetcher(client *gotgproto.Client, logger *zap.Logger, store imagestore.Store) *ThumbnailFetcher {
 	return &ThumbnailFetcher{
 		client:        client,
 		logger:        logger,
 		messageBuffer: &sync.Map{},
 		bufferOrder:   make([]int, 0, messageBufferSize),
-		thumbDir:      thumbDir,
+		store:         store,
 	}
 }
 
@@ -116,19 +113,25 @@ func (tf *ThumbnailFetcher) addToBuffer(messageID int, msg *tg.Message) {
 	}
 }
 
-func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (string, error) {
-	thumbFile := filepath.Join(tf.thumbDir, fmt.Sprintf("%d.jpg", messageID))
+// getThumbnail returns the thumbnail bytes, from the image store when cached.
+// Failing to cache a fresh download doesn't fail the request.
+func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) ([]byte, error) {
+	key := imageCacheKey(messageID)
 
-	// Check if thumbnail already exists
-	if _, err := os.Stat(thumbFile); err == nil {
-		tf.logger.Debug("Thumbnail file exists", zap.String("file", thumbFile))
-		return thumbFile, nil
+	// Check if thumbnail is already cached and isn't a truncated leftover
+	cached, err := getCachedImage(ctx, key)
+	if err != nil {
+		tf.logger.Warn("Failed to read cached thumbnail", zap.String("key", key), zap.Error(err))
+	}
+	if cached != nil {
+		tf.logger.Debug("Thumbnail found in store", zap.String("key", key))
+		return cached, nil
 	}
 
 	// Get message
 	msg, err := tf.resolveMessage(ctx, messageID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Check if media is a video document
@@ -139,22 +142,22 @@ func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (st
 	case *tg.MessageMediaDocument:
 		doc, ok := m.Document.AsNotEmpty()
 		if !ok {
-			return "", fmt.Errorf("unsupported media type for thumbnail")
+			return nil, fmt.Errorf("unsupported media type for thumbnail")
 		}
 		document = doc
 
 		// Verify it's a video
 		mime := strings.ToLower(document.MimeType)
 		if mime == "" || (!strings.HasPrefix(mime, "video/") && !strings.HasPrefix(mime, "image/")) {
-			return "", fmt.Errorf("unsupported media type for thumbnail: %s", document.MimeType)
+			return nil, fmt.Errorf("unsupported media type for thumbnail: %s", document.MimeType)
 		}
 	default:
-		return "", fmt.Errorf("unsupported media type for thumbnail")
+		return nil, fmt.Errorf("unsupported media type for thumbnail")
 	}
 
 	// Check if document has thumbs
 	if len(document.Thumbs) == 0 {
-		return "", fmt.Errorf("no thumbnail found in Telegram")
+		return nil, fmt.Errorf("no thumbnail found in Telegram")
 	}
 
 	// Get the largest thumbnail (use the last one, which is usually the largest)
@@ -162,13 +165,13 @@ func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (st
 
 	// Verify it's a valid thumbnail
 	if _, ok := largestThumb.AsNotEmpty(); !ok {
-		return "", fmt.Errorf("no valid thumbnail found")
+		return nil, fmt.Errorf("no valid thumbnail found")
 	}
 
 	// Get the type string from the thumbnail
 	thumbSize, ok := largestThumb.AsNotEmpty()
 	if !ok {
-		return "", fmt.Errorf("failed to get thumbnail type")
+		return nil, fmt.Errorf("failed to get thumbnail type")
 	}
 
 	// Download thumbnail
@@ -179,17 +182,10 @@ func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (st
 		ThumbSize:     thumbSize.GetType(),
 	}
 
-	// Create temp file
-	tempFile := thumbFile + ".tmp"
-	f, err := os.Create(tempFile)
-	if err != nil {
-		return "", fmt.Errorf("failed to create temp file: %w", err)
-	}
-	defer f.Close()
-
 	// Download using Telegram API
 	offset := int64(0)
 	limit := 1024 * 1024 // 1MB chunks
+	var thumbBytes []byte
 
 	for {
 		res, err := tf.client.API().UploadGetFile(ctx, &tg.UploadGetFileRequest{
@@ -198,25 +194,19 @@ func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (st
 			Limit:    limit,
 		})
 		if err != nil {
-			os.Remove(tempFile)
-			return "", fmt.Errorf("failed to download thumbnail: %w", err)
+			return nil, fmt.Errorf("failed to download thumbnail: %w", err)
 		}
 
 		file, ok := res.(*tg.UploadFile)
 		if !ok {
-			os.Remove(tempFile)
-			return "", fmt.Errorf("unexpected upload response type")
+			return nil, fmt.Errorf("unexpected upload response type")
 		}
 
 		bytes := file.GetBytes()
 		if len(bytes) == 0 {
 			break
 		}
-
-		if _, err := f.Write(bytes); err != nil {
-			os.Remove(tempFile)
-			return "", fmt.Errorf("failed to write thumbnail: %w", err)
-		}
+		thumbBytes = append(thumbBytes, bytes...)
 
 		if len(bytes) < limit {
 			break
@@ -225,49 +215,88 @@ func (tf *ThumbnailFetcher) getThumbnail(ctx context.Context, messageID int) (st
 		offset += int64(len(bytes))
 	}
 
-	f.Close()
-
-	// Rename temp file to final file
-	if err := os.Rename(tempFile, thumbFile); err != nil {
-		os.Remove(tempFile)
-		return "", fmt.Errorf("failed to rename temp file: %w", err)
+	// The local store refuses writes when the volume is nearly full; the
+	// thumbnail is still served from memory.
+	if err := tf.store.Put(ctx, key, thumbBytes); err != nil {
+		if errors.Is(err, utils.ErrLowDiskSpace) {
+			tf.logger.Warn("Skipping thumbnail cache write", zap.String("key", key), zap.Error(err))
+		} else {
+			tf.logger.Warn("Failed to cache thumbnail", zap.String("key", key), zap.Error(err))
+		}
+		return thumbBytes, nil
 	}
 
-	tf.logger.Debug("✅ Thumbnail saved", zap.String("file", thumbFile))
-	return thumbFile, nil
+	tf.logger.Debug("✅ Thumbnail saved", zap.String("key", key), zap.String("store", tf.store.Name()))
+	return thumbBytes, nil
 }
 
 // Global thumbnail fetcher instance
 var thumbnailFetcher *ThumbnailFetcher
-var thumbnailFetcherOnce sync.Once
+var thumbnailFetcherMu sync.Mutex
 
+// lightThumbnailFetchers are the fetchers of the workers thumbnails are
+// spread over with WORKER_LABELS, by worker ID.
+var lightThumbnailFetchers = make(map[int]*ThumbnailFetcher)
+
+// getThumbnailFetcher returns the shared fetcher, or nil while the default
+// worker isn't up. Creation is retried on the next call. With WORKER_LABELS
+// it returns the fetcher of the next light worker instead.
 func getThumbnailFetcher(logger *zap.Logger) *ThumbnailFetcher {
-	thumbnailFetcherOnce.Do(func() {
+	thumbnailFetcherMu.Lock()
+	defer thumbnailFetcherMu.Unlock()
+	if config.ValueOf.WorkerClassesEnabled() {
+		worker := bot.GetNextLightWorker()
+		if worker == nil {
+			return nil
+		}
+		fetcher, ok := lightThumbnailFetchers[worker.ID]
+		if !ok || fetcher.client != worker.Client {
+			fetcher = NewThumbnailFetcher(worker.Client, logger, imageStore)
+			lightThumbnailFetchers[worker.ID] = fetcher
+		}
+		return fetcher
+	}
+	if thumbnailFetcher == nil {
 		// Use the default/main bot that has channel access
 		worker := bot.GetDefaultWorker()
 		if worker == nil {
-			logger.Fatal("No default worker available for thumbnail fetching")
+			return nil
 		}
-		thumbDir := getThumbCacheDir()
-
-		thumbnailFetcher = NewThumbnailFetcher(worker.Client, logger, thumbDir)
-	})
+		thumbnailFetcher = NewThumbnailFetcher(worker.Client, logger, imageStore)
+	}
 	return thumbnailFetcher
 }
 
+// prefetchThumbnail caches the thumbnail of a freshly uploaded file, for the
+// thumbnail upload post-processing step.
+func prefetchThumbnail(logger *zap.Logger) upload.ThumbnailFunc {
+	return func(ctx context.Context, messageID int) error {
+		fetcher := getThumbnailFetcher(logger)
+		if fetcher == nil {
+			return errors.New("no workers available")
+		}
+		_, err := fetcher.getThumbnail(budget.WithPriority(ctx, budget.Backfill), messageID)
+		if isThumbnailNotAvailableError(err) {
+			return upload.ErrSkipped
+		}
+		return err
+	}
+}
+
 func (e *allRoutes) LoadThumb(r *Route) {
 	thumbLog := e.log.Named("Thumb")
 	defer thumbLog.Info("Loaded thumbnail route")
-	r.Engine.GET("/thumb/:messageID", getThumbnailRoute(thumbLog))
+	r.Router.GET("/thumb/:messageID", opaqueIDParams(false), e.mediaAuth, rateLimit(false), e.abuseGuard, getThumbnailRoute(thumbLog))
 }
 
 func getThumbnailRoute(logger *zap.Logger) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
 		// Check if MEDIA_CHANNEL_ID is configured
 		if config.ValueOf.MediaChannelID == 0 {
 			logger.Error("MEDIA_CHANNEL_ID not configured")
 			ctx.JSON(http.StatusInternalServerError, gin.H{
-				"error": "MEDIA_CHANNEL_ID not configured",
+				"error": errorText(ctx, "error.media_channel_not_configured"),
 			})
 			return
 		}
@@ -278,10 +307,13 @@ func getThumbnailRoute(logger *zap.Logger) gin.HandlerFunc {
 		if err != nil {
 			logger.Warn("Invalid message ID", zap.String("messageID", messageIDParam), zap.Error(err))
 			ctx.JSON(http.StatusBadRequest, gin.H{
-				"error": "invalid message ID",
+				"error": errorText(ctx, "error.invalid_message_id"),
 			})
 			return
 		}
+		if abortIfBlocked(ctx, config.ValueOf.MediaChannelID, messageID) || abortIfGone(ctx, config.ValueOf.MediaChannelID, messageID) {
+			return
+		}
 
 		logger.Debug("Thumbnail request",
 			zap.Int("messageID", messageID),
@@ -289,7 +321,12 @@ func getThumbnailRoute(logger *zap.Logger) gin.HandlerFunc {
 
 		// Get thumbnail
 		fetcher := getThumbnailFetcher(logger)
-		thumbFile, err := fetcher.getThumbnail(ctx, messageID)
+		if fetcher == nil {
+			logger.Error("No default worker available for thumbnail fetching")
+			respondUnavailable(ctx, unavailableNoWorkers, messageID)
+			return
+		}
+		thumbBytes, err := fetcher.getThumbnail(budget.WithPriority(ctx, budget.Thumb), messageID)
 		if err != nil {
 			if isThumbnailNotAvailableError(err) {
 				logger.Warn("Thumbnail not available", zap.Int("messageID", messageID), zap.Error(err))
@@ -306,8 +343,7 @@ func getThumbnailRoute(logger *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		// Serve the thumbnail file
-		ctx.File(thumbFile)
+		serveImage(ctx, thumbBytes)
 	}
 }
 
@@ -0,0 +1,118 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/transcode"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	internalTokenHeader = "X-Fsb-Internal"
+	internalAuthMethod  = "internal"
+)
+
+// internalToken lets ffmpeg, running next to this server, read /direct over
+// loopback without a user session (renditions and /audio).
+var internalToken = newInternalToken()
+
+func newInternalToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// isInternalRequest reports whether ctx carries the internal token and comes
+// from this host. RemoteAddr is used rather than ClientIP so forwarded
+// headers can't fake it.
+func isInternalRequest(ctx *gin.Context) bool {
+	token := ctx.GetHeader(internalTokenHeader)
+	if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(internalToken)) != 1 {
+		return false
+	}
+	host, _, err := net.SplitHostPort(ctx.Request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loopbackSource points ffmpeg at /direct on the loopback interface and
+// returns the header that authorizes it.
+func loopbackSource(messageID int) (string, string) {
+	host := "127.0.0.1"
+	if config.ValueOf.BindIPv6 {
+		host = "::1"
+	}
+	url := "http://" + net.JoinHostPort(host, strconv.Itoa(config.ValueOf.Port)) +
+		config.ValueOf.BasePath + "/direct/" + strconv.Itoa(messageID)
+	return url, internalTokenHeader + ": " + internalToken + "\r\n"
+}
+
+// serveRendition serves the ?quality= rendition of messageID when it has been
+// generated. It returns false so the caller falls back to the original.
+func serveRendition(ctx *gin.Context, logger *zap.Logger, messageID int, quality string) bool {
+	height, err := strconv.Atoi(strings.TrimSuffix(quality, "p"))
+	if err != nil {
+		return false
+	}
+	path, ok := transcode.Path(messageID, height)
+	if !ok {
+		return false
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		logger.Warn("Failed to open rendition", zap.String("path", path), zap.Error(err))
+		return false
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	ctx.Header("Content-Type", "video/mp4")
+	ctx.Header("X-Rendition", strconv.Itoa(height)+"p")
+	http.ServeContent(meteredResponseWriter{ctx.Writer}, ctx.Request, "", info.ModTime(), file)
+	return true
+}
+
+// meteredResponseWriter counts the bytes of responses served by net/http
+// helpers toward the throughput reported on /api/load.
+type meteredResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (m meteredResponseWriter) Write(p []byte) (int, error) {
+	n, err := m.ResponseWriter.Write(p)
+	stats.CountStreamed(int64(n))
+	return n, err
+}
+
+// renditionsHeader lists the generated qualities of messageID, e.g. "480p,720p".
+func renditionsHeader(messageID int) string {
+	available := transcode.Available(messageID)
+	qualities := make([]string, 0, len(available))
+	for _, height := range available {
+		qualities = append(qualities, strconv.Itoa(height)+"p")
+	}
+	return strings.Join(qualities, ",")
+}
+
+// isPlaybackStart tells a new play apart from the range requests a player
+// makes while seeking or buffering.
+func isPlaybackStart(rangeHeader string) bool {
+	return rangeHeader == "" || strings.HasPrefix(strings.TrimSpace(rangeHeader), "bytes=0-")
+}
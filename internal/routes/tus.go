@@ -0,0 +1,337 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/upload"
+	"EverythingSuckz/fsb/internal/utils"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Only the core protocol plus these extensions of tus 1.0.0 are supported,
+// see https://tus.io/protocols/resumable-upload
+const (
+	tusVersion     = "1.0.0"
+	tusExtensions  = "creation,creation-with-upload,termination,expiration"
+	tusContentType = "application/offset+octet-stream"
+)
+
+// LoadTus registers /upload/tus/, which takes resumable uploads into
+// MEDIA_CHANNEL_ID. Disabled unless UPLOAD_ENABLED is set.
+func (e *allRoutes) LoadTus(r *Route) {
+	if !upload.Enabled() {
+		return
+	}
+	tusLog := e.log.Named("Tus")
+	defer tusLog.Info("Loaded tus upload routes")
+	// Discovery needs no session, like a CORS preflight
+	r.Router.OPTIONS("/upload/tus", tusOptionsRoute)
+	r.Router.OPTIONS("/upload/tus/*id", tusOptionsRoute)
+	tus := r.Router.Group("/upload/tus", tusHeaders, e.mediaAuth, requireUploader)
+	tus.POST("", postTusRoute(tusLog))
+	tus.POST("/", postTusRoute(tusLog))
+	tus.HEAD("/:id", headTusRoute(tusLog))
+	tus.GET("/:id", getTusRoute(tusLog))
+	tus.PATCH("/:id", patchTusRoute(tusLog))
+	tus.DELETE("/:id", deleteTusRoute(tusLog))
+	r.Router.GET("/api/me/uploads", e.mediaAuth, requireUploader, getUploadsRoute(tusLog))
+}
+
+func tusOptionsRoute(ctx *gin.Context) {
+	ctx.Header("Tus-Resumable", tusVersion)
+	ctx.Header("Tus-Version", tusVersion)
+	ctx.Header("Tus-Extension", tusExtensions)
+	ctx.Header("Tus-Max-Size", strconv.FormatInt(upload.MaxSize(), 10))
+	ctx.Status(http.StatusNoContent)
+}
+
+// tusHeaders checks the protocol version the client speaks. GET is not part
+// of tus, it reports the state of an upload as JSON.
+func tusHeaders(ctx *gin.Context) {
+	ctx.Header("Tus-Resumable", tusVersion)
+	if ctx.Request.Method != http.MethodGet && ctx.GetHeader("Tus-Resumable") != tusVersion {
+		ctx.Header("Tus-Version", tusVersion)
+		ctx.AbortWithStatus(http.StatusPreconditionFailed)
+		return
+	}
+	ctx.Next()
+}
+
+// requireUploader only lets signed-in users, and only those listed in
+// UPLOAD_ALLOWED_UIDS when it's set, upload.
+func requireUploader(ctx *gin.Context) {
+	session, _ := streamSessionFrom(ctx)
+	if session.UserID == "" {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "a user session is required",
+		})
+		return
+	}
+	if allowed := config.ValueOf.UploadAllowedUIDs; len(allowed) > 0 && !slices.Contains(allowed, session.UserID) {
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "uploads are not allowed for this user",
+		})
+		return
+	}
+	ctx.Next()
+}
+
+// parseTusMetadata decodes Upload-Metadata: comma-separated "key base64value"
+// pairs, where the value may be omitted.
+func parseTusMetadata(header string) (map[string]string, bool) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, true
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, false
+		}
+		metadata[key] = string(decoded)
+	}
+	return metadata, true
+}
+
+// ownedUpload loads the upload in the URL, answering 404 for uploads of
+// other users so IDs can't be probed.
+func ownedUpload(ctx *gin.Context, logger *zap.Logger) (*upload.Upload, bool) {
+	u, err := upload.Get(ctx.Param("id"))
+	session, _ := streamSessionFrom(ctx)
+	if errors.Is(err, upload.ErrNotFound) || (err == nil && u.Owner != session.UserID) {
+		ctx.AbortWithStatus(http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		logger.Error("Failed to load upload", zap.String("id", ctx.Param("id")), zap.Error(err))
+		ctx.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	return u, true
+}
+
+func setTusStateHeaders(ctx *gin.Context, u *upload.Upload) {
+	ctx.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	ctx.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	ctx.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	ctx.Header("X-Upload-Status", u.Status)
+	if u.MessageID != 0 {
+		ctx.Header("X-Message-Id", strconv.Itoa(u.MessageID))
+	}
+}
+
+// writeTusError maps a failed append to the status tus clients expect.
+func writeTusError(ctx *gin.Context, logger *zap.Logger, id string, err error) {
+	switch {
+	case errors.Is(err, upload.ErrOffsetMismatch), errors.Is(err, upload.ErrNotUploading):
+		ctx.Status(http.StatusConflict)
+	case errors.Is(err, upload.ErrTooLarge):
+		ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrLowDiskSpace):
+		ctx.Header("Retry-After", "60")
+		ctx.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+	default:
+		// Usually the client went away; the bytes received so far are kept
+		logger.Debug("Upload chunk interrupted", zap.String("id", id), zap.Error(err))
+		ctx.Status(http.StatusInternalServerError)
+	}
+}
+
+func postTusRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if ctx.GetHeader("Upload-Defer-Length") != "" {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "Upload-Defer-Length is not supported",
+			})
+			return
+		}
+		length, err := strconv.ParseInt(ctx.GetHeader("Upload-Length"), 10, 64)
+		if err != nil || length <= 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "Upload-Length must be a positive integer",
+			})
+			return
+		}
+		if length > upload.MaxSize() {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": "upload exceeds Tus-Max-Size",
+			})
+			return
+		}
+		metadata, ok := parseTusMetadata(ctx.GetHeader("Upload-Metadata"))
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid Upload-Metadata",
+			})
+			return
+		}
+
+		session, _ := streamSessionFrom(ctx)
+		u, err := upload.Create(session.UserID, length, metadata)
+		if err != nil {
+			if errors.Is(err, utils.ErrLowDiskSpace) {
+				writeTusError(ctx, logger, "", err)
+				return
+			}
+			logger.Error("Failed to create upload", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to create upload",
+			})
+			return
+		}
+		logger.Info("Upload created",
+			zap.String("id", u.ID),
+			zap.String("user", session.UserID),
+			zap.String("file", u.FileName()),
+			zap.Int64("length", length))
+		ctx.Header("Location", requestLinkBase(ctx.Request)+"/upload/tus/"+u.ID)
+
+		// creation-with-upload: the first chunk may come with the POST
+		if ctx.GetHeader("Content-Type") == tusContentType && ctx.Request.ContentLength != 0 {
+			if appended, err := upload.Append(u.ID, 0, ctx.Request.Body); appended != nil {
+				u = appended
+				ctx.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+			} else if err != nil {
+				logger.Debug("First upload chunk interrupted", zap.String("id", u.ID), zap.Error(err))
+			}
+		}
+		ctx.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+		ctx.Status(http.StatusCreated)
+	}
+}
+
+func headTusRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		u, ok := ownedUpload(ctx, logger)
+		if !ok {
+			return
+		}
+		setTusStateHeaders(ctx, u)
+		ctx.Header("Cache-Control", "no-store")
+		ctx.Status(http.StatusOK)
+	}
+}
+
+// uploadJSON describes an upload and its post-processing steps.
+func uploadJSON(ctx *gin.Context, u *upload.Upload) gin.H {
+	resp := gin.H{
+		"id":         u.ID,
+		"file_name":  u.FileName(),
+		"status":     u.Status,
+		"offset":     u.Offset,
+		"length":     u.Length,
+		"created_at": u.CreatedAt,
+		"expires_at": u.ExpiresAt,
+	}
+	if u.MessageID != 0 {
+		resp["message_id"] = u.MessageID
+		resp["link"] = requestLinkBase(ctx.Request) + "/direct/" + opaqueid.ID(config.ValueOf.MediaChannelID, u.MessageID)
+	}
+	if u.Error != "" {
+		resp["error"] = u.Error
+	}
+	if len(u.Steps) > 0 {
+		resp["steps"] = u.Steps
+	}
+	return resp
+}
+
+func getTusRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		u, ok := ownedUpload(ctx, logger)
+		if !ok {
+			return
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, uploadJSON(ctx, u))
+	}
+}
+
+// getUploadsRoute lists the uploads of the signed-in user, newest first.
+func getUploadsRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		session, _ := streamSessionFrom(ctx)
+		uploads, err := upload.List(session.UserID)
+		if err != nil {
+			logger.Error("Failed to list uploads", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list uploads",
+			})
+			return
+		}
+		items := make([]gin.H, 0, len(uploads))
+		for _, u := range uploads {
+			items = append(items, uploadJSON(ctx, u))
+		}
+		ctx.Header("Cache-Control", "no-store")
+		ctx.JSON(http.StatusOK, gin.H{
+			"items": items,
+		})
+	}
+}
+
+func patchTusRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if ctx.GetHeader("Content-Type") != tusContentType {
+			ctx.Status(http.StatusUnsupportedMediaType)
+			return
+		}
+		offset, err := strconv.ParseInt(ctx.GetHeader("Upload-Offset"), 10, 64)
+		if err != nil || offset < 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "Upload-Offset must be a non-negative integer",
+			})
+			return
+		}
+		u, ok := ownedUpload(ctx, logger)
+		if !ok {
+			return
+		}
+		u, err = upload.Append(u.ID, offset, ctx.Request.Body)
+		if err != nil {
+			writeTusError(ctx, logger, ctx.Param("id"), err)
+			return
+		}
+		if u.Status == upload.StatusProcessing {
+			logger.Info("Upload complete, sending to Telegram",
+				zap.String("id", u.ID),
+				zap.String("file", u.FileName()))
+		}
+		ctx.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+		ctx.Header("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+		ctx.Status(http.StatusNoContent)
+	}
+}
+
+func deleteTusRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		u, ok := ownedUpload(ctx, logger)
+		if !ok {
+			return
+		}
+		if err := upload.Delete(u.ID); err != nil {
+			logger.Error("Failed to delete upload", zap.String("id", u.ID), zap.Error(err))
+			ctx.Status(http.StatusInternalServerError)
+			return
+		}
+		ctx.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,113 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/internal/upload"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LoadUpload registers POST /upload, which takes a whole file in one request
+// and answers with its link once it is in MEDIA_CHANNEL_ID. It shares the
+// settings and the listing of the tus uploads.
+func (e *allRoutes) LoadUpload(r *Route) {
+	if !upload.Enabled() {
+		return
+	}
+	uploadLog := e.log.Named("Upload")
+	defer uploadLog.Info("Loaded upload route")
+	r.Router.POST("/upload", e.mediaAuth, requireUploader, postUploadRoute(uploadLog))
+}
+
+// uploadBody returns the file of a POST /upload: the "file" field of a
+// multipart form, or else the raw body named by ?name= or X-File-Name.
+func uploadBody(ctx *gin.Context) (io.Reader, map[string]string, bool) {
+	metadata := make(map[string]string)
+	mediaType, _, _ := mime.ParseMediaType(ctx.GetHeader("Content-Type"))
+	if mediaType != "multipart/form-data" {
+		metadata["filename"] = ctx.Query("name")
+		if metadata["filename"] == "" {
+			metadata["filename"] = ctx.GetHeader("X-File-Name")
+		}
+		if mediaType != "" && mediaType != "application/octet-stream" {
+			metadata["filetype"] = mediaType
+		}
+		return ctx.Request.Body, metadata, true
+	}
+
+	reader, err := ctx.Request.MultipartReader()
+	if err != nil {
+		return nil, nil, false
+	}
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return nil, nil, false
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		metadata["filename"] = filepath.Base(part.FileName())
+		if partType := part.Header.Get("Content-Type"); partType != "" && partType != "application/octet-stream" {
+			metadata["filetype"] = partType
+		}
+		return part, metadata, true
+	}
+}
+
+func postUploadRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		if ctx.Request.ContentLength > upload.MaxSize() {
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error": upload.ErrOverMaxSize.Error(),
+			})
+			return
+		}
+		body, metadata, ok := uploadBody(ctx)
+		if !ok {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": `send the file as the raw body or in the "file" field of a multipart form`,
+			})
+			return
+		}
+
+		session, _ := streamSessionFrom(ctx)
+		u, err := upload.Put(session.UserID, metadata, body)
+		switch {
+		case errors.Is(err, upload.ErrOverMaxSize):
+			ctx.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, upload.ErrEmpty):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, utils.ErrLowDiskSpace):
+			ctx.Header("Retry-After", "60")
+			ctx.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			// Usually the client went away mid-body
+			logger.Warn("Upload failed", zap.String("user", session.UserID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to store upload",
+			})
+			return
+		}
+		if u.Status != upload.StatusDone {
+			ctx.JSON(http.StatusBadGateway, uploadJSON(ctx, u))
+			return
+		}
+		logger.Info("File uploaded",
+			zap.String("id", u.ID),
+			zap.String("user", session.UserID),
+			zap.String("file", u.FileName()),
+			zap.Int("messageID", u.MessageID))
+		ctx.JSON(http.StatusCreated, uploadJSON(ctx, u))
+	}
+}
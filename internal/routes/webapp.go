@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/invites"
+	"EverythingSuckz/fsb/internal/premium"
+	"EverythingSuckz/fsb/internal/streamauth"
+	"EverythingSuckz/fsb/internal/userfiles"
+	"EverythingSuckz/fsb/internal/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	webAppUserKey       = "webAppUser"
+	webAppInitDataHdr   = "X-Telegram-Init-Data"
+	webAppDefaultLimit  = 50
+	webAppMaxLimit      = 200
+	webAppAuthScheme    = "tma "
+	webAppAllowedHeader = "Authorization, " + webAppInitDataHdr
+)
+
+// webAppFile is a file as listed to the mini app, with its links.
+type webAppFile struct {
+	userfiles.File
+	StreamURL   string `json:"stream_url"`
+	DownloadURL string `json:"download_url"`
+}
+
+// LoadWebApp registers /webapp, the API behind a Telegram mini app of the
+// main bot. Requests carry the mini app's initData instead of a session.
+func (e *allRoutes) LoadWebApp(r *Route) {
+	if !config.ValueOf.WebAppEnabled {
+		return
+	}
+	webAppLog := e.log.Named("WebApp")
+	defer webAppLog.Info("Loaded mini app routes")
+	webApp := r.Router.Group("/webapp", webAppCORS)
+	webApp.OPTIONS("/*path", func(ctx *gin.Context) {
+		ctx.Status(http.StatusNoContent)
+	})
+	webApp.Use(webAppAuth(webAppLog))
+	webApp.GET("/me", getWebAppMeRoute(webAppLog))
+	webApp.GET("/files", getWebAppFilesRoute(webAppLog))
+	webApp.GET("/files/:messageID", getWebAppFileRoute(webAppLog))
+}
+
+// webAppCORS lets a mini app hosted on WEBAPP_ORIGIN call the API.
+func webAppCORS(ctx *gin.Context) {
+	origin := config.ValueOf.WebAppOrigin
+	if origin == "" {
+		return
+	}
+	ctx.Header("Access-Control-Allow-Origin", origin)
+	ctx.Header("Access-Control-Allow-Headers", webAppAllowedHeader)
+	ctx.Header("Access-Control-Allow-Methods", "GET, OPTIONS")
+	ctx.Header("Vary", "Origin")
+}
+
+// webAppAuth validates the initData sent as "Authorization: tma <initData>"
+// or in X-Telegram-Init-Data, against the main bot token.
+func webAppAuth(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		initData := ctx.GetHeader(webAppInitDataHdr)
+		if auth := ctx.GetHeader("Authorization"); initData == "" && strings.HasPrefix(auth, webAppAuthScheme) {
+			initData = strings.TrimPrefix(auth, webAppAuthScheme)
+		}
+		if initData == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized: missing init data",
+			})
+			return
+		}
+		if authBanned(ctx) {
+			return
+		}
+		maxAge := time.Duration(config.ValueOf.WebAppInitDataMaxAgeSeconds) * time.Second
+		user, err := streamauth.ValidateWebAppInitData(initData, config.ValueOf.BotToken, maxAge)
+		if err != nil {
+			if errors.Is(err, streamauth.ErrInitDataSignature) {
+				recordAuthFailure(ctx, logger, authFailureWebApp)
+			}
+			logger.Warn("Mini app init data rejected",
+				zap.String("clientIP", ctx.ClientIP()),
+				zap.Error(err))
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "unauthorized: " + err.Error(),
+			})
+			return
+		}
+		if !invites.Allowed(user.ID) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "you are not allowed to use this bot",
+			})
+			return
+		}
+		ctx.Set(webAppUserKey, user)
+		ctx.Next()
+	}
+}
+
+func webAppUserFrom(ctx *gin.Context) streamauth.WebAppUser {
+	user, _ := ctx.Get(webAppUserKey)
+	u, _ := user.(streamauth.WebAppUser)
+	return u
+}
+
+// newWebAppFile adds the same links the bot replies with.
+func newWebAppFile(ctx *gin.Context, f userfiles.File) webAppFile {
+	link := fmt.Sprintf("%s/stream/%d?hash=%s", requestLinkBase(ctx.Request), f.MessageID, utils.GetShortHash(f.Hash))
+	return webAppFile{File: f, StreamURL: link, DownloadURL: link + "&d=true"}
+}
+
+func getWebAppMeRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		user := webAppUserFrom(ctx)
+		_, total, err := userfiles.List(user.ID, 0, 0)
+		if err != nil {
+			logger.Error("Failed to count user files", zap.Int64("userID", user.ID), zap.Error(err))
+		}
+		role, until := premium.Lookup(strconv.FormatInt(user.ID, 10))
+		ctx.JSON(http.StatusOK, gin.H{
+			"user":          user,
+			"files_total":   total,
+			"role":          role,
+			"premium_until": until,
+		})
+	}
+}
+
+func getWebAppFilesRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		user := webAppUserFrom(ctx)
+		page, err := strconv.Atoi(ctx.DefaultQuery("page", "1"))
+		if err != nil || page < 1 {
+			page = 1
+		}
+		limit, err := strconv.Atoi(ctx.DefaultQuery("limit", strconv.Itoa(webAppDefaultLimit)))
+		if err != nil || limit < 1 {
+			limit = webAppDefaultLimit
+		}
+		limit = min(limit, webAppMaxLimit)
+
+		files, total, err := userfiles.List(user.ID, (page-1)*limit, limit)
+		if err != nil {
+			logger.Error("Failed to list user files", zap.Int64("userID", user.ID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to list files",
+			})
+			return
+		}
+		out := make([]webAppFile, 0, len(files))
+		for _, f := range files {
+			out = append(out, newWebAppFile(ctx, f))
+		}
+		ctx.JSON(http.StatusOK, gin.H{
+			"files": out,
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		})
+	}
+}
+
+func getWebAppFileRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		user := webAppUserFrom(ctx)
+		messageID, err := strconv.Atoi(ctx.Param("messageID"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": "invalid message ID",
+			})
+			return
+		}
+		f, err := userfiles.Get(user.ID, messageID)
+		switch {
+		case errors.Is(err, userfiles.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case err != nil:
+			logger.Error("Failed to get user file", zap.Int64("userID", user.ID), zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to get file",
+			})
+			return
+		}
+		ctx.JSON(http.StatusOK, newWebAppFile(ctx, f))
+	}
+}
@@ -0,0 +1,339 @@
+package routes
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/stats"
+	"EverythingSuckz/fsb/internal/types"
+	"EverythingSuckz/fsb/internal/utils"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	zipMetadataTimeout = time.Minute
+	// zipDataDescriptor marks entries whose CRC follows their data, since
+	// it is only known once the file went through.
+	zipDataDescriptor = 0x8
+	zipUTF8Names      = 0x800
+	zipVersion20      = 20
+)
+
+var errZipIDs = errors.New("ids must be a comma separated list of file IDs")
+
+// zipEntry is a file of the archive.
+type zipEntry struct {
+	messageID int
+	file      *types.File
+	header    *zip.FileHeader
+	// photos are downloaded before the archive starts, Telegram doesn't
+	// tell their size
+	data []byte
+}
+
+// LoadZip registers /zip, which streams several files of a channel as one
+// ZIP archive. Entries are stored uncompressed, so the archive length is
+// known upfront and sent as Content-Length.
+func (e *allRoutes) LoadZip(r *Route) {
+	zipLog := e.log.Named("Zip")
+	defer zipLog.Info("Loaded zip route")
+	handler := getZipRoute(zipLog)
+	r.Router.GET("/zip", channelQueryParam, channelAuth(e.mediaAuth), premiumOnly("zip"), rateLimit(true), handler)
+	r.Router.HEAD("/zip", channelQueryParam, channelAuth(e.mediaAuth), premiumOnly("zip"), rateLimit(false), handler)
+}
+
+func getZipRoute(logger *zap.Logger) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		logger := requestLogger(ctx, logger)
+		requestStartTime := time.Now()
+		channelID, ok := requestChannelID(ctx)
+		if !ok {
+			return
+		}
+		ids, err := parseZipIDs(ctx, ctx.Query("ids"), channelID)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		if limit := config.ValueOf.ZipMaxFiles; len(ids) > limit {
+			ctx.JSON(http.StatusBadRequest, gin.H{
+				"error": fmt.Sprintf("at most %d files fit in one archive", limit),
+			})
+			return
+		}
+		for _, id := range ids {
+			if abortIfBlocked(ctx, channelID, id) {
+				return
+			}
+		}
+
+		worker := acquireWorker(ctx, logger, bot.GetNextWorker, ids[0])
+		if worker == nil {
+			return
+		}
+		worker.StartRequest()
+		failed := false
+		defer func() { worker.EndRequest(requestStartTime, failed) }()
+
+		entries, err := zipEntries(ctx, worker, channelID, ids)
+		if err != nil {
+			var missing *zipMissingError
+			if errors.As(err, &missing) {
+				ctx.JSON(http.StatusNotFound, gin.H{
+					"error": err.Error(),
+				})
+				return
+			}
+			failed = true
+			worker.RecordChannelAccess(channelID, err)
+			if utils.IsNoChannelAccess(err) {
+				respondUnavailable(ctx, unavailableNoAccess, 0)
+				return
+			}
+			logger.Warn("Failed to prepare archive",
+				zap.Int64("channelID", channelID),
+				zap.Ints("ids", ids),
+				zap.Error(err))
+			ctx.JSON(http.StatusBadGateway, gin.H{
+				"error": "failed to fetch the files from Telegram",
+			})
+			return
+		}
+		length, err := zipLength(entries)
+		if err != nil {
+			failed = true
+			logger.Error("Failed to size archive", zap.Error(err))
+			ctx.JSON(http.StatusInternalServerError, gin.H{
+				"error": "failed to build the archive",
+			})
+			return
+		}
+
+		ctx.Header("Content-Type", "application/zip")
+		ctx.Header("Content-Length", strconv.FormatInt(length, 10))
+		ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="files-%s.zip"`, opaqueid.ID(channelID, ids[0])))
+		ctx.Status(http.StatusOK)
+		if ctx.Request.Method == http.MethodHead {
+			return
+		}
+
+		zw := zip.NewWriter(ctx.Writer)
+		for _, entry := range entries {
+			entryStart := time.Now()
+			written, err := writeZipEntry(ctx, logger, zw, worker, channelID, entry)
+			stats.Record(stats.Request{
+				Route:      "zip",
+				ChannelID:  channelID,
+				MessageID:  entry.messageID,
+				FileName:   entry.header.Name,
+				Bytes:      written,
+				ClientIP:   ctx.ClientIP(),
+				StatusCode: http.StatusOK,
+				Duration:   time.Since(entryStart),
+			})
+			if err != nil {
+				// The length was promised, the client sees a truncated body
+				failed = true
+				logger.Error("Error while streaming archive",
+					zap.Int("messageID", entry.messageID),
+					zap.Int64("written", written),
+					zap.Error(err))
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			failed = true
+			logger.Error("Failed to finish archive", zap.Error(err))
+		}
+	}
+}
+
+// parseZipIDs reads ?ids=1,2,3, dropping repeated IDs.
+func parseZipIDs(ctx *gin.Context, value string, channelID int64) ([]int, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(value, ",") {
+		id, ok := queryMessageID(ctx, part, channelID)
+		if !ok || id < 1 {
+			return nil, errZipIDs
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// zipMissingError names a file that can't go in the archive, by the ID its
+// links use.
+type zipMissingError struct {
+	id     string
+	reason string
+}
+
+func (e *zipMissingError) Error() string {
+	return fmt.Sprintf("file %s %s", e.id, e.reason)
+}
+
+// zipEntries looks up the files of ids, in the order asked for.
+func zipEntries(ctx context.Context, worker *bot.Worker, channelID int64, ids []int) ([]*zipEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, zipMetadataTimeout)
+	defer cancel()
+	messages, err := fetchChannelMessages(ctx, worker, channelID, ids)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*tg.Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	used := make(map[string]bool)
+	entries := make([]*zipEntry, 0, len(ids))
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok {
+			return nil, &zipMissingError{opaqueid.ID(channelID, id), "not found"}
+		}
+		file, err := utils.FileFromMedia(m.Media)
+		if err != nil {
+			return nil, &zipMissingError{opaqueid.ID(channelID, id), "has no file"}
+		}
+		entry := &zipEntry{messageID: id, file: file}
+		size := file.FileSize
+		if size == 0 {
+			if entry.data, err = downloadPhotoBytes(ctx, worker.Client.API(), file.Location); err != nil {
+				return nil, fmt.Errorf("photo %d: %w", id, err)
+			}
+			size = int64(len(entry.data))
+		}
+		entry.header = zipHeader(zipEntryName(file, opaqueid.ID(channelID, id), used), time.Unix(int64(m.Date), 0), size)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// zipHeader describes a stored entry. Sizes are set upfront and the CRC goes
+// in a data descriptor, so the archive is streamed in one pass.
+func zipHeader(name string, modified time.Time, size int64) *zip.FileHeader {
+	h := &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		Flags:              zipDataDescriptor,
+		CreatorVersion:     zipVersion20,
+		ReaderVersion:      zipVersion20,
+		CompressedSize64:   uint64(size),
+		UncompressedSize64: uint64(size),
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] >= 0x80 {
+			h.Flags |= zipUTF8Names
+			break
+		}
+	}
+	// MS-DOS time, which starts in 1980 and has a two second resolution
+	modified = modified.UTC()
+	if modified.Year() < 1980 {
+		modified = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	h.ModifiedDate = uint16(modified.Day() + int(modified.Month())<<5 + (modified.Year()-1980)<<9)
+	h.ModifiedTime = uint16(modified.Second()/2 + modified.Minute()<<5 + modified.Hour()<<11)
+	return h
+}
+
+// zipEntryName is the name of a file in the archive. Repeated names, common
+// in albums, get the file ID appended.
+func zipEntryName(file *types.File, id string, used map[string]bool) string {
+	name := strings.NewReplacer("/", "_", `\`, "_").Replace(file.FileName)
+	if strings.Trim(name, ".") == "" {
+		name = id
+		if exts, _ := mime.ExtensionsByType(file.MimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	if used[name] {
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s (%s)%s", strings.TrimSuffix(name, ext), id, ext)
+	}
+	used[name] = true
+	return name
+}
+
+// zipLength is the size of the archive of entries, found by writing it with
+// the file contents skipped.
+func zipLength(entries []*zipEntry) (int64, error) {
+	var counter byteCounter
+	zw := zip.NewWriter(&counter)
+	for _, entry := range entries {
+		header := *entry.header
+		w, err := zw.CreateRaw(&header)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := io.CopyN(w, blankReader{}, int64(header.UncompressedSize64)); err != nil {
+			return 0, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	return counter.n, nil
+}
+
+// writeZipEntry streams one file into the archive and fills in its CRC.
+func writeZipEntry(ctx *gin.Context, logger *zap.Logger, zw *zip.Writer, worker *bot.Worker, channelID int64, entry *zipEntry) (int64, error) {
+	w, err := zw.CreateRaw(entry.header)
+	if err != nil {
+		return 0, err
+	}
+	crc := crc32.NewIEEE()
+	dst := io.MultiWriter(w, crc)
+	var written int64
+	if entry.data != nil {
+		n, err := meteredWriter{dst}.Write(entry.data)
+		written = int64(n)
+		if err != nil {
+			return written, err
+		}
+	} else if written, err = copyFileRange(ctx.Request.Context(), channelSource(logger, worker, channelID, entry.messageID, entry.file), 0, entry.file.FileSize-1, dst); err != nil {
+		return written, err
+	}
+	// Read when the next entry or the central directory is written
+	entry.header.CRC32 = crc.Sum32()
+	return written, nil
+}
+
+// byteCounter is a writer that only counts.
+type byteCounter struct {
+	n int64
+}
+
+func (c *byteCounter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+// blankReader fills nothing in; zipLength only needs the lengths.
+type blankReader struct{}
+
+func (blankReader) Read(p []byte) (int, error) {
+	return len(p), nil
+}
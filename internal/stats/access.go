@@ -0,0 +1,135 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FileAccess is how often a file was opened and when it was last requested.
+type FileAccess struct {
+	ChannelID    int64     `gorm:"primaryKey;autoIncrement:false" json:"channel_id"`
+	MessageID    int       `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	Views        int64     `json:"views"`
+	LastAccessed time.Time `json:"last_accessed"`
+}
+
+func (FileAccess) TableName() string { return "file_access" }
+
+func init() {
+	database.RegisterModel(&FileAccess{})
+}
+
+type accessKey struct {
+	channelID int64
+	messageID int
+}
+
+var (
+	accessMu      sync.Mutex
+	accessPending = make(map[accessKey]*FileAccess)
+)
+
+func recordAccess(req Request, at time.Time) {
+	key := accessKey{req.ChannelID, req.MessageID}
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	access, ok := accessPending[key]
+	if !ok {
+		access = &FileAccess{ChannelID: req.ChannelID, MessageID: req.MessageID}
+		accessPending[key] = access
+	}
+	if req.View {
+		access.Views++
+	}
+	access.LastAccessed = at
+}
+
+// FlushAccess writes pending per-file counters to the database, adding to
+// existing rows.
+func FlushAccess() error {
+	if database.DB == nil {
+		return nil
+	}
+	accessMu.Lock()
+	pending := accessPending
+	accessPending = make(map[accessKey]*FileAccess)
+	accessMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]FileAccess, 0, len(pending))
+	for _, access := range pending {
+		rows = append(rows, *access)
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "channel_id"}, {Name: "message_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"views":         gorm.Expr("views + excluded.views"),
+			"last_accessed": gorm.Expr("MAX(last_accessed, excluded.last_accessed)"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		// Put the counters back so they are retried on the next flush.
+		accessMu.Lock()
+		for key, access := range pending {
+			if current, ok := accessPending[key]; ok {
+				current.Views += access.Views
+				if access.LastAccessed.After(current.LastAccessed) {
+					current.LastAccessed = access.LastAccessed
+				}
+			} else {
+				accessPending[key] = access
+			}
+		}
+		accessMu.Unlock()
+	}
+	return err
+}
+
+// GetFileAccess returns the views and last access of a file, counting what
+// has not been flushed yet. ok is false when the file was never requested.
+func GetFileAccess(channelID int64, messageID int) (access FileAccess, ok bool) {
+	access = FileAccess{ChannelID: channelID, MessageID: messageID}
+	if database.DB != nil {
+		var rows []FileAccess
+		database.DB.Limit(1).Find(&rows, "channel_id = ? AND message_id = ?", channelID, messageID)
+		if len(rows) == 1 {
+			access, ok = rows[0], true
+		}
+	}
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	if pending, found := accessPending[accessKey{channelID, messageID}]; found {
+		access.Views += pending.Views
+		if pending.LastAccessed.After(access.LastAccessed) {
+			access.LastAccessed = pending.LastAccessed
+		}
+		ok = true
+	}
+	return access, ok
+}
+
+// LatestMessageID is the newest message of channelID that was requested, or
+// 0 when none was.
+func LatestMessageID(channelID int64) int {
+	var latest int
+	if database.DB != nil {
+		var row struct{ Latest int }
+		database.DB.Model(&FileAccess{}).Select("MAX(message_id) AS latest").Where("channel_id = ?", channelID).Scan(&row)
+		latest = row.Latest
+	}
+	accessMu.Lock()
+	defer accessMu.Unlock()
+	for key := range accessPending {
+		if key.channelID == channelID && key.messageID > latest {
+			latest = key.messageID
+		}
+	}
+	return latest
+}
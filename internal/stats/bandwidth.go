@@ -0,0 +1,137 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	bandwidthFlushInterval = 30 * time.Second
+	bandwidthDayLayout     = "2006-01-02"
+)
+
+// BandwidthUsage is the bytes served from a channel on a given day (UTC).
+type BandwidthUsage struct {
+	Day       string `gorm:"primaryKey" json:"day"`
+	ChannelID int64  `gorm:"primaryKey;autoIncrement:false" json:"channel_id"`
+	Bytes     int64  `json:"bytes"`
+	Requests  int64  `json:"requests"`
+}
+
+func init() {
+	database.RegisterModel(&BandwidthUsage{})
+}
+
+type bandwidthKey struct {
+	day       string
+	channelID int64
+}
+
+var (
+	bandwidthMu      sync.Mutex
+	bandwidthPending = make(map[bandwidthKey]*BandwidthUsage)
+)
+
+func recordBandwidth(channelID int64, bytes int64, at time.Time) {
+	key := bandwidthKey{day: at.UTC().Format(bandwidthDayLayout), channelID: channelID}
+	bandwidthMu.Lock()
+	defer bandwidthMu.Unlock()
+	usage, ok := bandwidthPending[key]
+	if !ok {
+		usage = &BandwidthUsage{Day: key.day, ChannelID: channelID}
+		bandwidthPending[key] = usage
+	}
+	usage.Bytes += bytes
+	usage.Requests++
+}
+
+// StartBandwidthFlusher periodically persists the accumulated bandwidth counters.
+// Writes are batched so the hot streaming path never touches the database.
+func StartBandwidthFlusher(log *zap.Logger) {
+	log = log.Named("Bandwidth")
+	if database.DB == nil {
+		log.Warn("Database not initialized, bandwidth accounting disabled")
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(bandwidthFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := FlushBandwidth(); err != nil {
+				log.Error("Failed to flush bandwidth usage", zap.Error(err))
+			}
+			if err := FlushAccess(); err != nil {
+				log.Error("Failed to flush file access counters", zap.Error(err))
+			}
+			if err := FlushOpens(); err != nil {
+				log.Error("Failed to flush link opens", zap.Error(err))
+			}
+			if err := FlushHistory(); err != nil {
+				log.Error("Failed to flush request history", zap.Error(err))
+			}
+		}
+	}()
+}
+
+// FlushBandwidth writes pending counters to the database, adding to existing rows.
+func FlushBandwidth() error {
+	if database.DB == nil {
+		return nil
+	}
+	bandwidthMu.Lock()
+	pending := bandwidthPending
+	bandwidthPending = make(map[bandwidthKey]*BandwidthUsage)
+	bandwidthMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]BandwidthUsage, 0, len(pending))
+	for _, usage := range pending {
+		rows = append(rows, *usage)
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "day"}, {Name: "channel_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"bytes":    gorm.Expr("bytes + excluded.bytes"),
+			"requests": gorm.Expr("requests + excluded.requests"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		// Put the counters back so they are retried on the next flush.
+		bandwidthMu.Lock()
+		for key, usage := range pending {
+			if current, ok := bandwidthPending[key]; ok {
+				current.Bytes += usage.Bytes
+				current.Requests += usage.Requests
+			} else {
+				bandwidthPending[key] = usage
+			}
+		}
+		bandwidthMu.Unlock()
+	}
+	return err
+}
+
+// QueryBandwidth returns the per-channel daily usage between from and to (inclusive, YYYY-MM-DD).
+func QueryBandwidth(from, to string) ([]BandwidthUsage, error) {
+	if err := FlushBandwidth(); err != nil {
+		return nil, err
+	}
+	var rows []BandwidthUsage
+	query := database.DB.Model(&BandwidthUsage{})
+	if from != "" {
+		query = query.Where("day >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("day <= ?", to)
+	}
+	err := query.Order("day, channel_id").Find(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,202 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// maxPendingRecords bounds the records kept in memory while the database
+	// can't be written to.
+	maxPendingRecords    = 10000
+	historyPruneInterval = time.Hour
+)
+
+// RequestRecord is one served /direct or /stream request, kept for
+// REQUEST_HISTORY_DAYS so traffic can be analysed per file, day and user.
+type RequestRecord struct {
+	ID         uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	Day        string    `gorm:"index" json:"day"` // UTC, YYYY-MM-DD
+	Route      string    `json:"route"`
+	ChannelID  int64     `json:"channel_id"`
+	MessageID  int       `gorm:"index" json:"message_id"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"duration_ms"`
+	UserID     string    `json:"user_id,omitempty"`
+	ClientIP   string    `json:"client_ip"`
+	StatusCode int       `json:"status_code"`
+}
+
+func (RequestRecord) TableName() string { return "request_history" }
+
+func init() {
+	database.RegisterModel(&RequestRecord{})
+}
+
+var (
+	historyMu      sync.Mutex
+	historyPending []RequestRecord
+)
+
+func recordHistory(req Request, at time.Time) {
+	if database.DB == nil {
+		return
+	}
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if len(historyPending) >= maxPendingRecords {
+		return
+	}
+	historyPending = append(historyPending, RequestRecord{
+		CreatedAt:  at,
+		Day:        at.UTC().Format(bandwidthDayLayout),
+		Route:      req.Route,
+		ChannelID:  req.ChannelID,
+		MessageID:  req.MessageID,
+		Bytes:      req.Bytes,
+		DurationMs: req.Duration.Milliseconds(),
+		UserID:     req.UserID,
+		ClientIP:   req.ClientIP,
+		StatusCode: req.StatusCode,
+	})
+}
+
+// FlushHistory writes the pending request records to the database.
+func FlushHistory() error {
+	if database.DB == nil {
+		return nil
+	}
+	historyMu.Lock()
+	pending := historyPending
+	historyPending = nil
+	historyMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	err := database.DB.CreateInBatches(&pending, 500).Error
+	if err != nil {
+		// Put the records back so they are retried on the next flush.
+		historyMu.Lock()
+		room := max(maxPendingRecords-len(historyPending), 0)
+		historyPending = append(historyPending, pending[:min(room, len(pending))]...)
+		historyMu.Unlock()
+	}
+	return err
+}
+
+// StartHistoryPruner deletes request records older than days every hour.
+// 0 keeps them forever.
+func StartHistoryPruner(log *zap.Logger, days int) {
+	if database.DB == nil || days <= 0 {
+		return
+	}
+	log = log.Named("History")
+	go func() {
+		for {
+			if deleted, err := PruneHistory(days); err != nil {
+				log.Error("Failed to prune request history", zap.Error(err))
+			} else if deleted > 0 {
+				log.Debug("Pruned request history", zap.Int64("records", deleted))
+			}
+			time.Sleep(historyPruneInterval)
+		}
+	}()
+}
+
+// PruneHistory deletes the request records older than days.
+func PruneHistory(days int) (int64, error) {
+	if database.DB == nil || days <= 0 {
+		return 0, nil
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -days).Format(bandwidthDayLayout)
+	res := database.DB.Where("day < ?", cutoff).Delete(&RequestRecord{})
+	return res.RowsAffected, res.Error
+}
+
+// Ways request records can be grouped by QueryHistory.
+const (
+	GroupByFile   = "file"
+	GroupByDay    = "day"
+	GroupByUser   = "user"
+	GroupByStatus = "status"
+)
+
+// HistoryQuery selects and groups request records. From and To are inclusive
+// days (YYYY-MM-DD); empty bounds are open.
+type HistoryQuery struct {
+	From      string
+	To        string
+	MessageID int
+	GroupBy   string
+	Limit     int
+}
+
+// HistoryStat aggregates the request records of a group. Only the fields of
+// the grouping are set.
+type HistoryStat struct {
+	Day           string  `json:"day,omitempty"`
+	ChannelID     int64   `json:"channel_id,omitempty"`
+	MessageID     int     `json:"message_id,omitempty"`
+	User          string  `json:"user,omitempty"`
+	StatusCode    int     `json:"status_code,omitempty"`
+	Requests      int64   `json:"requests"`
+	Bytes         int64   `json:"bytes"`
+	Errors        int64   `json:"errors"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+	Clients       int64   `json:"clients"`
+}
+
+// historyGroups are the columns selected and grouped by for each grouping.
+var historyGroups = map[string]string{
+	GroupByFile:   "channel_id, message_id",
+	GroupByDay:    "day",
+	GroupByUser:   "COALESCE(NULLIF(user_id, ''), client_ip)",
+	GroupByStatus: "status_code",
+}
+
+// QueryHistory aggregates the request records matching q, busiest groups
+// first. Pending records are flushed first so the numbers are current.
+func QueryHistory(q HistoryQuery) ([]HistoryStat, error) {
+	group, ok := historyGroups[q.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown grouping %q", q.GroupBy)
+	}
+	if err := FlushHistory(); err != nil {
+		return nil, err
+	}
+	columns := group
+	if q.GroupBy == GroupByUser {
+		columns = group + " AS user"
+	}
+	query := database.DB.Model(&RequestRecord{}).Select(columns + ", " +
+		"COUNT(*) AS requests, " +
+		"SUM(bytes) AS bytes, " +
+		"SUM(CASE WHEN status_code >= 400 THEN 1 ELSE 0 END) AS errors, " +
+		"AVG(duration_ms) AS avg_duration_ms, " +
+		"COUNT(DISTINCT COALESCE(NULLIF(user_id, ''), client_ip)) AS clients")
+	if q.From != "" {
+		query = query.Where("day >= ?", q.From)
+	}
+	if q.To != "" {
+		query = query.Where("day <= ?", q.To)
+	}
+	if q.MessageID > 0 {
+		query = query.Where("message_id = ?", q.MessageID)
+	}
+	order := "bytes DESC"
+	if q.GroupBy == GroupByDay {
+		order = "day"
+	}
+	if q.Limit > 0 {
+		query = query.Limit(q.Limit)
+	}
+	var rows []HistoryStat
+	err := query.Group(group).Order(order).Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,207 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Where a link was opened from.
+const (
+	SourceTelegram = "telegram"
+	SourceWeb      = "web" // another site linking to or embedding the file
+	SourceDirect   = "direct"
+)
+
+// What opened a link, from its User-Agent.
+const (
+	ClientBrowser = "browser"
+	ClientPlayer  = "player"
+	ClientBot     = "bot" // crawlers and link previews
+	ClientOther   = "other"
+)
+
+// LinkOpen counts the opens of a file on a given day (UTC) by where they came
+// from.
+type LinkOpen struct {
+	Day       string `gorm:"primaryKey" json:"day"`
+	ChannelID int64  `gorm:"primaryKey;autoIncrement:false" json:"channel_id"`
+	MessageID int    `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	Source    string `gorm:"primaryKey" json:"source"`
+	Referrer  string `gorm:"primaryKey" json:"referrer,omitempty"` // host of the referring page
+	Client    string `gorm:"primaryKey" json:"client"`
+	Opens     int64  `json:"opens"`
+}
+
+func (LinkOpen) TableName() string { return "link_opens" }
+
+func init() {
+	database.RegisterModel(&LinkOpen{})
+}
+
+// Open is a link opened before any byte of the file is streamed.
+type Open struct {
+	ChannelID int64
+	MessageID int
+	Referrer  string // Referer header, or the page's document.referrer for beacons
+	UserAgent string
+}
+
+type openKey struct {
+	day       string
+	channelID int64
+	messageID int
+	source    string
+	referrer  string
+	client    string
+}
+
+var (
+	opensMu      sync.Mutex
+	opensPending = make(map[openKey]int64)
+)
+
+// RecordOpen counts a link open. Like the bandwidth counters it is only
+// written to the database on the next flush.
+func RecordOpen(open Open) {
+	source, host := ClassifyReferrer(open.Referrer)
+	client := ClassifyUserAgent(open.UserAgent)
+	if source != SourceTelegram && strings.Contains(open.UserAgent, "Telegram") {
+		// In-app browsers and link previews send no Referer
+		source = SourceTelegram
+	}
+	key := openKey{
+		day:       time.Now().UTC().Format(bandwidthDayLayout),
+		channelID: open.ChannelID,
+		messageID: open.MessageID,
+		source:    source,
+		referrer:  host,
+		client:    client,
+	}
+	opensMu.Lock()
+	opensPending[key]++
+	opensMu.Unlock()
+}
+
+// ClassifyReferrer tells where a Referer points to and returns its host.
+func ClassifyReferrer(referrer string) (source, host string) {
+	if referrer == "" {
+		return SourceDirect, ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return SourceDirect, ""
+	}
+	host = strings.ToLower(u.Hostname())
+	switch {
+	case host == "t.me", host == "telegram.me", host == "telegram.org", strings.HasSuffix(host, ".telegram.org"):
+		return SourceTelegram, host
+	default:
+		return SourceWeb, host
+	}
+}
+
+// ClassifyUserAgent tells browsers apart from media players and bots.
+func ClassifyUserAgent(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ClientOther
+	case strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"),
+		strings.Contains(ua, "preview"), strings.Contains(ua, "facebookexternalhit"):
+		return ClientBot
+	case strings.Contains(ua, "vlc"), strings.Contains(ua, "mpv"), strings.Contains(ua, "exoplayer"),
+		strings.Contains(ua, "kodi"), strings.Contains(ua, "applecoremedia"), strings.Contains(ua, "lavf"),
+		strings.Contains(ua, "stagefright"), strings.Contains(ua, "infuse"), strings.Contains(ua, "mxplayer"):
+		return ClientPlayer
+	case strings.HasPrefix(ua, "mozilla/"):
+		return ClientBrowser
+	default:
+		return ClientOther
+	}
+}
+
+// FlushOpens writes pending link opens to the database, adding to existing
+// rows.
+func FlushOpens() error {
+	if database.DB == nil {
+		return nil
+	}
+	opensMu.Lock()
+	pending := opensPending
+	opensPending = make(map[openKey]int64)
+	opensMu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	rows := make([]LinkOpen, 0, len(pending))
+	for key, opens := range pending {
+		rows = append(rows, LinkOpen{
+			Day:       key.day,
+			ChannelID: key.channelID,
+			MessageID: key.messageID,
+			Source:    key.source,
+			Referrer:  key.referrer,
+			Client:    key.client,
+			Opens:     opens,
+		})
+	}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "day"}, {Name: "channel_id"}, {Name: "message_id"},
+			{Name: "source"}, {Name: "referrer"}, {Name: "client"},
+		},
+		DoUpdates: clause.Assignments(map[string]any{
+			"opens": gorm.Expr("opens + excluded.opens"),
+		}),
+	}).Create(&rows).Error
+	if err != nil {
+		// Put the counters back so they are retried on the next flush.
+		opensMu.Lock()
+		for key, opens := range pending {
+			opensPending[key] += opens
+		}
+		opensMu.Unlock()
+	}
+	return err
+}
+
+// OpenStat sums the opens of a file from one source, referrer and client.
+type OpenStat struct {
+	ChannelID int64  `json:"channel_id"`
+	MessageID int    `json:"message_id"`
+	Source    string `json:"source"`
+	Referrer  string `json:"referrer,omitempty"`
+	Client    string `json:"client"`
+	Opens     int64  `json:"opens"`
+}
+
+// QueryOpens sums link opens between from and to (inclusive, YYYY-MM-DD),
+// for a single file when messageID is set.
+func QueryOpens(from, to string, messageID int) ([]OpenStat, error) {
+	if err := FlushOpens(); err != nil {
+		return nil, err
+	}
+	query := database.DB.Model(&LinkOpen{}).
+		Select("channel_id, message_id, source, referrer, client, SUM(opens) AS opens")
+	if from != "" {
+		query = query.Where("day >= ?", from)
+	}
+	if to != "" {
+		query = query.Where("day <= ?", to)
+	}
+	if messageID > 0 {
+		query = query.Where("message_id = ?", messageID)
+	}
+	var rows []OpenStat
+	err := query.Group("channel_id, message_id, source, referrer, client").
+		Order("opens DESC, message_id").Scan(&rows).Error
+	return rows, err
+}
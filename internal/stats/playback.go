@@ -0,0 +1,97 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"time"
+)
+
+// Playback event types emitted by players.
+const (
+	PlaybackPlay     = "play"
+	PlaybackPause    = "pause"
+	PlaybackSeek     = "seek"
+	PlaybackComplete = "complete"
+	PlaybackError    = "error"
+)
+
+// PlaybackEvent is a single player event, kept for watch-time analytics.
+type PlaybackEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+	UserID    string    `gorm:"index" json:"user_id"`
+	SessionID string    `json:"session_id"` // player-generated ID of one viewing
+	MessageID int       `gorm:"index" json:"message_id"`
+	Event     string    `json:"event"`
+	Position  float64   `json:"position"` // seconds into the media
+	Duration  float64   `json:"duration,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// PlaybackStat aggregates the events of a file over a period.
+type PlaybackStat struct {
+	MessageID   int     `json:"message_id"`
+	Plays       int64   `json:"plays"`
+	Completes   int64   `json:"completes"`
+	Errors      int64   `json:"errors"`
+	Viewers     int64   `json:"viewers"`
+	MaxPosition float64 `json:"max_position"`
+}
+
+func init() {
+	database.RegisterModel(&PlaybackEvent{})
+}
+
+// IsPlaybackEvent reports whether event is a known playback event type.
+func IsPlaybackEvent(event string) bool {
+	switch event {
+	case PlaybackPlay, PlaybackPause, PlaybackSeek, PlaybackComplete, PlaybackError:
+		return true
+	}
+	return false
+}
+
+// RecordPlayback stores a batch of player events and moves the resume
+// position of each viewer along. Unlike stream traffic these are sparse (a
+// handful per viewing), so they are written straight away.
+func RecordPlayback(events []PlaybackEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	if err := database.DB.Create(&events).Error; err != nil {
+		return err
+	}
+	for _, progress := range progressFromEvents(events) {
+		if err := SaveProgress(progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryPlayback aggregates playback events per file between from and to
+// (inclusive, YYYY-MM-DD). Empty bounds are open.
+func QueryPlayback(from, to string) ([]PlaybackStat, error) {
+	query := database.DB.Model(&PlaybackEvent{}).Select("message_id, " +
+		"SUM(CASE WHEN event = 'play' THEN 1 ELSE 0 END) AS plays, " +
+		"SUM(CASE WHEN event = 'complete' THEN 1 ELSE 0 END) AS completes, " +
+		"SUM(CASE WHEN event = 'error' THEN 1 ELSE 0 END) AS errors, " +
+		"COUNT(DISTINCT user_id) AS viewers, " +
+		"MAX(position) AS max_position")
+	if from != "" {
+		day, err := time.Parse(bandwidthDayLayout, from)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at >= ?", day)
+	}
+	if to != "" {
+		day, err := time.Parse(bandwidthDayLayout, to)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at < ?", day.AddDate(0, 0, 1))
+	}
+	var rows []PlaybackStat
+	err := query.Group("message_id").Order("plays DESC, message_id").Scan(&rows).Error
+	return rows, err
+}
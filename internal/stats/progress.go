@@ -0,0 +1,108 @@
+package stats
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// completedThreshold is the share of the duration after which a file counts
+// as watched even without a "complete" event (credits are usually skipped).
+const completedThreshold = 0.95
+
+// PlaybackProgress is the last known position of a user in a file, used for
+// "continue watching".
+type PlaybackProgress struct {
+	UserID    string    `gorm:"primaryKey" json:"-"`
+	MessageID int       `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	Position  float64   `json:"position"`
+	Duration  float64   `json:"duration,omitempty"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `gorm:"index" json:"updated_at"`
+}
+
+func init() {
+	database.RegisterModel(&PlaybackProgress{})
+}
+
+// SaveProgress stores the position of a user in a file, replacing the
+// previous one. A zero duration keeps the one already known.
+func SaveProgress(progress PlaybackProgress) error {
+	if progress.Duration > 0 && progress.Position >= progress.Duration*completedThreshold {
+		progress.Completed = true
+	}
+	progress.UpdatedAt = time.Now()
+	updates := []string{"position", "completed", "updated_at"}
+	if progress.Duration > 0 {
+		updates = append(updates, "duration")
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "message_id"}},
+		DoUpdates: clause.AssignmentColumns(updates),
+	}).Create(&progress).Error
+}
+
+// progressFromEvents keeps the latest position of every user and file in a
+// batch of playback events.
+func progressFromEvents(events []PlaybackEvent) []PlaybackProgress {
+	type key struct {
+		userID    string
+		messageID int
+	}
+	latest := make(map[key]PlaybackProgress)
+	var order []key
+	for _, event := range events {
+		if event.UserID == "" || event.Event == PlaybackError {
+			continue
+		}
+		k := key{event.UserID, event.MessageID}
+		previous, ok := latest[k]
+		if !ok {
+			order = append(order, k)
+		}
+		duration := event.Duration
+		if duration == 0 {
+			duration = previous.Duration
+		}
+		latest[k] = PlaybackProgress{
+			UserID:    event.UserID,
+			MessageID: event.MessageID,
+			Position:  event.Position,
+			Duration:  duration,
+			Completed: event.Event == PlaybackComplete,
+		}
+	}
+	out := make([]PlaybackProgress, 0, len(order))
+	for _, k := range order {
+		out = append(out, latest[k])
+	}
+	return out
+}
+
+// GetProgress returns the position of a user in a file, or nil when unknown.
+func GetProgress(userID string, messageID int) (*PlaybackProgress, error) {
+	var rows []PlaybackProgress
+	err := database.DB.Where("user_id = ? AND message_id = ?", userID, messageID).Limit(1).Find(&rows).Error
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	return &rows[0], nil
+}
+
+// ListProgress returns the most recently watched files of a user. Finished
+// files are left out unless includeCompleted is set.
+func ListProgress(userID string, limit int, includeCompleted bool) ([]PlaybackProgress, error) {
+	query := database.DB.Where("user_id = ?", userID)
+	if !includeCompleted {
+		query = query.Where("completed = ?", false)
+	}
+	var rows []PlaybackProgress
+	err := query.Order("updated_at DESC").Limit(limit).Find(&rows).Error
+	return rows, err
+}
+
+// DeleteProgress forgets the position of a user in a file.
+func DeleteProgress(userID string, messageID int) error {
+	return database.DB.Where("user_id = ? AND message_id = ?", userID, messageID).Delete(&PlaybackProgress{}).Error
+}
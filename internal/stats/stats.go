@@ -0,0 +1,141 @@
+package stats
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Request describes a single served stream request.
+type Request struct {
+	Route      string // "direct" or "stream"
+	ChannelID  int64
+	MessageID  int
+	FileName   string
+	Bytes      int64
+	UserID     string
+	ClientIP   string
+	StatusCode int
+	Duration   time.Duration
+	View       bool // the request opened the file from the start
+}
+
+// FileStat aggregates the traffic of a single file over a window.
+type FileStat struct {
+	MessageID int    `json:"message_id"`
+	FileName  string `json:"file_name"`
+	Requests  int64  `json:"requests"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// Summary is a snapshot of the traffic recorded since the last reset.
+type Summary struct {
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Requests    int64      `json:"requests"`
+	Errors      int64      `json:"errors"`
+	Bytes       int64      `json:"bytes"`
+	UniqueUsers int        `json:"unique_users"`
+	TopFiles    []FileStat `json:"top_files"`
+}
+
+type collector struct {
+	mu       sync.Mutex
+	from     time.Time
+	requests int64
+	errors   int64
+	bytes    int64
+	users    map[string]struct{}
+	files    map[int]*FileStat
+}
+
+var window = newCollector()
+
+func newCollector() *collector {
+	return &collector{
+		from:  time.Now(),
+		users: make(map[string]struct{}),
+		files: make(map[int]*FileStat),
+	}
+}
+
+// Record adds a served request to the current stats window, to the
+// per-channel bandwidth accounting, to the per-file access counters and to
+// the request history.
+func Record(req Request) {
+	recordHistory(req, time.Now())
+	if req.ChannelID != 0 {
+		recordBandwidth(req.ChannelID, req.Bytes, time.Now())
+		recordAccess(req, time.Now().UTC())
+	}
+
+	window.mu.Lock()
+	defer window.mu.Unlock()
+
+	window.requests++
+	window.bytes += req.Bytes
+	if req.StatusCode >= 400 {
+		window.errors++
+	}
+
+	user := req.UserID
+	if user == "" {
+		user = req.ClientIP
+	}
+	if user != "" {
+		window.users[user] = struct{}{}
+	}
+
+	file, ok := window.files[req.MessageID]
+	if !ok {
+		file = &FileStat{MessageID: req.MessageID}
+		window.files[req.MessageID] = file
+	}
+	if req.FileName != "" {
+		file.FileName = req.FileName
+	}
+	file.Requests++
+	file.Bytes += req.Bytes
+}
+
+// Snapshot summarizes the current window keeping the top N files by bytes
+// served. When reset is true a fresh window is started.
+func Snapshot(topN int, reset bool) Summary {
+	window.mu.Lock()
+	defer window.mu.Unlock()
+
+	now := time.Now()
+	summary := Summary{
+		From:        window.from,
+		To:          now,
+		Requests:    window.requests,
+		Errors:      window.errors,
+		Bytes:       window.bytes,
+		UniqueUsers: len(window.users),
+	}
+
+	files := make([]FileStat, 0, len(window.files))
+	for _, file := range window.files {
+		files = append(files, *file)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Bytes == files[j].Bytes {
+			return files[i].Requests > files[j].Requests
+		}
+		return files[i].Bytes > files[j].Bytes
+	})
+	if topN > 0 && len(files) > topN {
+		files = files[:topN]
+	}
+	summary.TopFiles = files
+
+	if reset {
+		window.from = now
+		window.requests = 0
+		window.errors = 0
+		window.bytes = 0
+		window.users = make(map[string]struct{})
+		window.files = make(map[int]*FileStat)
+	}
+	return summary
+}
@@ -0,0 +1,55 @@
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// throughputWindow is how far back Throughput averages streamed bytes.
+const throughputWindow = 10
+
+// throughput keeps per-second byte counters in a ring so the current
+// bandwidth is known while long streams are still in flight.
+var throughput struct {
+	mu      sync.Mutex
+	buckets [throughputWindow]int64
+	seconds [throughputWindow]int64
+}
+
+// streamedTotal is every byte written to clients since the start.
+var streamedTotal int64
+
+// CountStreamed adds bytes written to a client to the bandwidth meter.
+func CountStreamed(n int64) {
+	atomic.AddInt64(&streamedTotal, n)
+	now := time.Now().Unix()
+	slot := now % throughputWindow
+	throughput.mu.Lock()
+	if throughput.seconds[slot] != now {
+		throughput.seconds[slot] = now
+		throughput.buckets[slot] = 0
+	}
+	throughput.buckets[slot] += n
+	throughput.mu.Unlock()
+}
+
+// Throughput returns the average bytes per second streamed over the last
+// throughputWindow seconds.
+func Throughput() int64 {
+	now := time.Now().Unix()
+	var total int64
+	throughput.mu.Lock()
+	for i, second := range throughput.seconds {
+		if now-second < throughputWindow {
+			total += throughput.buckets[i]
+		}
+	}
+	throughput.mu.Unlock()
+	return total / throughputWindow
+}
+
+// StreamedTotal returns the bytes written to clients since the start.
+func StreamedTotal() int64 {
+	return atomic.LoadInt64(&streamedTotal)
+}
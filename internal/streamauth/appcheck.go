@@ -0,0 +1,276 @@
+package streamauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAppCheckJWKSURL = "https://firebaseappcheck.googleapis.com/v1/jwks"
+	appCheckIssuerPrefix   = "https://firebaseappcheck.googleapis.com/"
+)
+
+// AppCheckClaims identifies the app build an App Check token was minted for.
+type AppCheckClaims struct {
+	AppID         string
+	ProjectNumber string
+}
+
+type appCheckJWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// appCheckVerifier validates Firebase App Check tokens (RS256 JWTs signed
+// with the keys published on the App Check JWKS endpoint).
+type appCheckVerifier struct {
+	projectNumbers map[string]struct{}
+	appIDs         map[string]struct{} // empty accepts every app of the projects
+	jwksURL        string
+	client         *http.Client
+	log            *zap.Logger
+
+	mu          sync.RWMutex
+	publicKeys  map[string]*rsa.PublicKey
+	cacheExpiry time.Time
+}
+
+func newAppCheckVerifier(log *zap.Logger, projectNumbers []string, appIDs []string, jwksURL string) *appCheckVerifier {
+	if jwksURL == "" {
+		jwksURL = defaultAppCheckJWKSURL
+	}
+	return &appCheckVerifier{
+		projectNumbers: toSet(projectNumbers),
+		appIDs:         toSet(appIDs),
+		jwksURL:        jwksURL,
+		client:         &http.Client{Timeout: 5 * time.Second},
+		log:            log.Named("AppCheckVerifier"),
+		publicKeys:     make(map[string]*rsa.PublicKey),
+	}
+}
+
+func toSet(values []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			set[value] = struct{}{}
+		}
+	}
+	return set
+}
+
+func (v *appCheckVerifier) VerifyToken(ctx context.Context, rawToken string) (*AppCheckClaims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid jwt format")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt header: %w", err)
+	}
+	var header firebaseJWTHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("invalid jwt header json: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("unexpected signing algorithm: %s", header.Alg)
+	}
+	if header.Typ != "JWT" {
+		return nil, fmt.Errorf("unexpected token type: %s", header.Typ)
+	}
+	if header.Kid == "" {
+		return nil, fmt.Errorf("missing key id (kid)")
+	}
+
+	publicKey, err := v.getPublicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt signature encoding: %w", err)
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature); err != nil {
+		return nil, fmt.Errorf("invalid jwt signature")
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid jwt payload: %w", err)
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		return nil, fmt.Errorf("invalid jwt payload json: %w", err)
+	}
+
+	exp, err := int64Claim(payload, "exp")
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > exp {
+		return nil, fmt.Errorf("token expired")
+	}
+
+	iss, err := stringClaim(payload, "iss")
+	if err != nil {
+		return nil, err
+	}
+	projectNumber := strings.TrimPrefix(iss, appCheckIssuerPrefix)
+	if projectNumber == iss {
+		return nil, fmt.Errorf("invalid issuer")
+	}
+	if _, ok := v.projectNumbers[projectNumber]; !ok {
+		return nil, fmt.Errorf("invalid issuer")
+	}
+	if !audienceContains(payload["aud"], "projects/"+projectNumber) {
+		return nil, fmt.Errorf("invalid audience")
+	}
+
+	sub, err := stringClaim(payload, "sub")
+	if err != nil {
+		return nil, err
+	}
+	if len(v.appIDs) > 0 {
+		if _, ok := v.appIDs[sub]; !ok {
+			return nil, fmt.Errorf("app %s is not allowed", sub)
+		}
+	}
+
+	return &AppCheckClaims{AppID: sub, ProjectNumber: projectNumber}, nil
+}
+
+// audienceContains handles the aud claim being either a string or an array.
+func audienceContains(aud any, want string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == want
+	case []any:
+		for _, item := range value {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (v *appCheckVerifier) getPublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	v.mu.RLock()
+	key, exists := v.publicKeys[kid]
+	cacheValid := time.Now().Before(v.cacheExpiry)
+	v.mu.RUnlock()
+
+	if exists && cacheValid {
+		return key, nil
+	}
+
+	if err := v.refreshKeys(ctx, !exists); err != nil {
+		// Keep verifying with the last known key if the endpoint is down
+		if exists {
+			v.log.Warn("App Check JWKS refresh failed, using cached key", zap.Error(err))
+			return key, nil
+		}
+		return nil, fmt.Errorf("failed to refresh app check jwks: %w", err)
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, exists = v.publicKeys[kid]
+	if !exists {
+		return nil, fmt.Errorf("app check signing key not found for kid=%s", kid)
+	}
+	return key, nil
+}
+
+func (v *appCheckVerifier) refreshKeys(ctx context.Context, force bool) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if !force && time.Now().Before(v.cacheExpiry) && len(v.publicKeys) > 0 {
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.jwksURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected jwks endpoint status: %s", resp.Status)
+	}
+
+	var jwks struct {
+		Keys []appCheckJWK `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&jwks); err != nil {
+		return err
+	}
+
+	parsedKeys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || jwk.Kid == "" {
+			continue
+		}
+		publicKey, err := parseRSAPublicKeyFromJWK(jwk)
+		if err != nil {
+			return fmt.Errorf("parse jwk %s: %w", jwk.Kid, err)
+		}
+		parsedKeys[jwk.Kid] = publicKey
+	}
+	if len(parsedKeys) == 0 {
+		return fmt.Errorf("empty app check jwks response")
+	}
+
+	// Google recommends caching the JWKS for no longer than 6 hours
+	ttl := parseCacheMaxAge(resp.Header.Get("Cache-Control"))
+	if ttl <= 0 || ttl > 6*time.Hour {
+		ttl = 6 * time.Hour
+	}
+
+	v.publicKeys = parsedKeys
+	v.cacheExpiry = time.Now().Add(ttl)
+	v.log.Debug("App Check JWKS cache refreshed",
+		zap.Int("keyCount", len(parsedKeys)),
+		zap.Duration("ttl", ttl))
+	return nil
+}
+
+func parseRSAPublicKeyFromJWK(jwk appCheckJWK) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exponent: %w", err)
+	}
+	if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid rsa key")
+	}
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
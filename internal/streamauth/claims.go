@@ -0,0 +1,77 @@
+package streamauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+)
+
+// ClaimsHeader carries the signed claims of the authenticated session on
+// requests to downstream systems (webhooks, edges, CDN workers).
+const ClaimsHeader = "X-Fsb-Claims"
+
+type claimsContextKey struct{}
+
+// WithClaims returns a copy of ctx carrying the signed claims token. The
+// token stays on the server: it is never written to the response.
+func WithClaims(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, token)
+}
+
+// ClaimsFrom returns the signed claims token stored by WithClaims, for
+// outgoing requests made on behalf of the request to set in ClaimsHeader.
+func ClaimsFrom(ctx context.Context) string {
+	token, _ := ctx.Value(claimsContextKey{}).(string)
+	return token
+}
+
+// claimsJWTHeader is the fixed, pre-encoded JOSE header of claim tokens.
+var claimsJWTHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// ClaimsSigningEnabled reports whether sessions are forwarded as signed claims.
+func (s *Service) ClaimsSigningEnabled() bool {
+	return s != nil && len(s.claimsSecret) > 0
+}
+
+// SignClaims encodes session as a short-lived HS256 JWT signed with
+// CLAIMS_SIGNING_SECRET, so downstream systems can enforce their own
+// policies without re-verifying Firebase. Selected custom claims are copied
+// as top-level claims; the standard ones always win.
+func (s *Service) SignClaims(session Session) (string, error) {
+	now := time.Now()
+	ttl := s.claimsTTL
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	expiresAt := now.Add(ttl)
+	if !session.ExpiresAt.IsZero() && session.ExpiresAt.Before(expiresAt) {
+		expiresAt = session.ExpiresAt
+	}
+
+	payload := make(map[string]any, len(session.Claims)+6)
+	for name, value := range session.Claims {
+		payload[name] = value
+	}
+	payload["iss"] = "fsb"
+	payload["sub"] = session.UserID
+	payload["iat"] = now.Unix()
+	payload["exp"] = expiresAt.Unix()
+	if session.Email != "" {
+		payload["email"] = session.Email
+	}
+	if session.ProjectID != "" {
+		payload["firebase_project"] = session.ProjectID
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	signingInput := claimsJWTHeader + "." + base64.RawURLEncoding.EncodeToString(payloadBytes)
+	mac := hmac.New(sha256.New, s.claimsSecret)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -14,6 +14,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -21,10 +22,21 @@ import (
 
 const defaultFirebaseCertsURL = "https://www.googleapis.com/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
 
+// After a failed cert fetch the next one waits certsRetryMin, doubling with
+// every failure up to certsRetryMax. certsRetryMin also spaces the fetches
+// forced by unknown key IDs.
+const (
+	certsRetryMin = 5 * time.Second
+	certsRetryMax = 5 * time.Minute
+)
+
 type FirebaseClaims struct {
 	Subject       string
 	Email         string
+	ProjectID     string
 	EmailVerified bool
+	// Payload holds every claim of the token, custom claims included
+	Payload map[string]any
 }
 
 type firebaseJWTHeader struct {
@@ -34,32 +46,55 @@ type firebaseJWTHeader struct {
 }
 
 type firebaseVerifier struct {
-	projectID string
-	issuer    string
-	certsURL  string
-	client    *http.Client
-	log       *zap.Logger
-
-	mu          sync.RWMutex
-	publicKeys  map[string]*rsa.PublicKey
-	cacheExpiry time.Time
+	projectIDs map[string]struct{}
+	certsURL   string
+	client     *http.Client
+	log        *zap.Logger
+
+	// grace is how long expired certs keep verifying tokens while a
+	// background refresh retries, so a Google outage doesn't block logins.
+	grace      time.Duration
+	refreshing atomic.Bool
+
+	// keys is swapped whole after a fetch, so verifications never wait on
+	// one
+	keys atomic.Pointer[firebaseKeys]
+
+	// mu guards the backoff; it is not held while fetching
+	mu       sync.Mutex
+	failures int
+	retryAt  time.Time
 }
 
-func newFirebaseVerifier(log *zap.Logger, projectID string, certsURL string) (*firebaseVerifier, error) {
-	if projectID == "" {
+// firebaseKeys is the result of one cert fetch.
+type firebaseKeys struct {
+	publicKeys map[string]*rsa.PublicKey
+	expiry     time.Time
+	fetchedAt  time.Time
+}
+
+func newFirebaseVerifier(log *zap.Logger, projectIDs []string, certsURL string, grace time.Duration) (*firebaseVerifier, error) {
+	allowed := make(map[string]struct{}, len(projectIDs))
+	for _, projectID := range projectIDs {
+		if projectID = strings.TrimSpace(projectID); projectID != "" {
+			allowed[projectID] = struct{}{}
+		}
+	}
+	if len(allowed) == 0 {
 		return nil, fmt.Errorf("firebase project id is required")
 	}
 	if certsURL == "" {
 		certsURL = defaultFirebaseCertsURL
 	}
 
+	// All Firebase projects sign ID tokens with the same securetoken keys,
+	// so one cert cache serves every configured project.
 	return &firebaseVerifier{
-		projectID:  projectID,
-		issuer:     "https://securetoken.google.com/" + projectID,
+		projectIDs: allowed,
 		certsURL:   certsURL,
+		grace:      grace,
 		client:     &http.Client{Timeout: 5 * time.Second},
 		log:        log.Named("FirebaseVerifier"),
-		publicKeys: make(map[string]*rsa.PublicKey),
 	}, nil
 }
 
@@ -131,7 +166,7 @@ func (v *firebaseVerifier) VerifyToken(ctx context.Context, rawToken string) (*F
 	if err != nil {
 		return nil, err
 	}
-	if aud != v.projectID {
+	if _, ok := v.projectIDs[aud]; !ok {
 		return nil, fmt.Errorf("invalid audience")
 	}
 
@@ -139,7 +174,7 @@ func (v *firebaseVerifier) VerifyToken(ctx context.Context, rawToken string) (*F
 	if err != nil {
 		return nil, err
 	}
-	if iss != v.issuer {
+	if iss != "https://securetoken.google.com/"+aud {
 		return nil, fmt.Errorf("invalid issuer")
 	}
 
@@ -157,20 +192,26 @@ func (v *firebaseVerifier) VerifyToken(ctx context.Context, rawToken string) (*F
 	return &FirebaseClaims{
 		Subject:       sub,
 		Email:         email,
+		ProjectID:     aud,
 		EmailVerified: emailVerified,
+		Payload:       payload,
 	}, nil
 }
 
 func (v *firebaseVerifier) getPublicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
 	now := time.Now()
 
-	v.mu.RLock()
-	key, exists := v.publicKeys[kid]
-	cacheValid := now.Before(v.cacheExpiry) && len(v.publicKeys) > 0
-	v.mu.RUnlock()
-
-	if exists && cacheValid {
-		return key, nil
+	var key *rsa.PublicKey
+	var exists bool
+	if keys := v.keys.Load(); keys != nil {
+		key, exists = keys.publicKeys[kid]
+		if exists && now.Before(keys.expiry) {
+			return key, nil
+		}
+		if exists && now.Before(keys.expiry.Add(v.grace)) {
+			v.refreshInBackground()
+			return key, nil
+		}
 	}
 
 	forceRefresh := !exists
@@ -178,52 +219,107 @@ func (v *firebaseVerifier) getPublicKey(ctx context.Context, kid string) (*rsa.P
 		return nil, fmt.Errorf("failed to refresh firebase certs: %w", err)
 	}
 
-	v.mu.RLock()
-	defer v.mu.RUnlock()
-
-	key, exists = v.publicKeys[kid]
+	if keys := v.keys.Load(); keys != nil {
+		key, exists = keys.publicKeys[kid]
+	}
 	if !exists {
 		return nil, fmt.Errorf("firebase signing key not found for kid=%s", kid)
 	}
 	return key, nil
 }
 
+// refreshInBackground refreshes the certs without blocking the caller,
+// running at most one refresh at a time.
+func (v *firebaseVerifier) refreshInBackground() {
+	if !v.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer v.refreshing.Store(false)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := v.refreshKeys(ctx, false); err != nil {
+			var staleFor time.Duration
+			if keys := v.keys.Load(); keys != nil {
+				staleFor = time.Since(keys.expiry)
+			}
+			v.log.Warn("Firebase cert refresh failed, serving stale certs",
+				zap.Duration("staleFor", staleFor),
+				zap.Duration("grace", v.grace),
+				zap.Error(err))
+		}
+	}()
+}
+
+// refreshKeys fetches the certs unless the cached ones are fresh. force
+// refetches fresh ones too, at most once per certsRetryMin, for key IDs they
+// don't have. Failed fetches back off.
 func (v *firebaseVerifier) refreshKeys(ctx context.Context, force bool) error {
+	now := time.Now()
+	if keys := v.keys.Load(); keys != nil && now.Before(keys.expiry) {
+		if !force || now.Sub(keys.fetchedAt) < certsRetryMin {
+			return nil
+		}
+	}
+
 	v.mu.Lock()
-	defer v.mu.Unlock()
+	retryAt := v.retryAt
+	v.mu.Unlock()
+	if now.Before(retryAt) {
+		return fmt.Errorf("cert endpoint failing, next attempt in %s", retryAt.Sub(now).Round(time.Second))
+	}
 
-	if !force && time.Now().Before(v.cacheExpiry) && len(v.publicKeys) > 0 {
-		return nil
+	keys, err := v.fetchKeys(ctx)
+	v.mu.Lock()
+	if err != nil {
+		v.failures++
+		v.retryAt = time.Now().Add(min(certsRetryMin<<min(v.failures-1, 10), certsRetryMax))
+	} else {
+		v.failures = 0
+		v.retryAt = time.Time{}
+	}
+	v.mu.Unlock()
+	if err != nil {
+		return err
 	}
 
+	v.keys.Store(keys)
+	v.log.Debug("Firebase cert cache refreshed",
+		zap.Int("keyCount", len(keys.publicKeys)),
+		zap.Duration("ttl", keys.expiry.Sub(keys.fetchedAt)))
+	return nil
+}
+
+// fetchKeys downloads and parses the certs.
+func (v *firebaseVerifier) fetchKeys(ctx context.Context) (*firebaseKeys, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.certsURL, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	resp, err := v.client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected cert endpoint status: %s", resp.Status)
+		return nil, fmt.Errorf("unexpected cert endpoint status: %s", resp.Status)
 	}
 
 	var certMap map[string]string
 	if err := json.NewDecoder(resp.Body).Decode(&certMap); err != nil {
-		return err
+		return nil, err
 	}
 	if len(certMap) == 0 {
-		return fmt.Errorf("empty firebase cert response")
+		return nil, fmt.Errorf("empty firebase cert response")
 	}
 
 	parsedKeys := make(map[string]*rsa.PublicKey, len(certMap))
 	for kid, certPEM := range certMap {
 		publicKey, err := parseRSAPublicKeyFromPEM(certPEM)
 		if err != nil {
-			return fmt.Errorf("parse cert %s: %w", kid, err)
+			return nil, fmt.Errorf("parse cert %s: %w", kid, err)
 		}
 		parsedKeys[kid] = publicKey
 	}
@@ -233,12 +329,8 @@ func (v *firebaseVerifier) refreshKeys(ctx context.Context, force bool) error {
 		ttl = time.Hour
 	}
 
-	v.publicKeys = parsedKeys
-	v.cacheExpiry = time.Now().Add(ttl)
-	v.log.Debug("Firebase cert cache refreshed",
-		zap.Int("keyCount", len(parsedKeys)),
-		zap.Duration("ttl", ttl))
-	return nil
+	now := time.Now()
+	return &firebaseKeys{publicKeys: parsedKeys, expiry: now.Add(ttl), fetchedAt: now}, nil
 }
 
 func parseRSAPublicKeyFromPEM(certPEM string) (*rsa.PublicKey, error) {
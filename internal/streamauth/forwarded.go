@@ -0,0 +1,42 @@
+package streamauth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequestIsHTTPS reports whether the client reached us over HTTPS, either
+// directly or, when trustForwarded is set, through a TLS-terminating proxy.
+func RequestIsHTTPS(r *http.Request, trustForwarded bool) bool {
+	if r.TLS != nil {
+		return true
+	}
+	return trustForwarded && strings.EqualFold(forwardedValue(r.Header.Get("X-Forwarded-Proto")), "https")
+}
+
+// RequestBaseURL rebuilds the scheme and host the client used, from
+// X-Forwarded-Proto/Host when trustForwarded is set. It returns "" when the
+// request carries no usable host.
+func RequestBaseURL(r *http.Request, trustForwarded bool) string {
+	host := r.Host
+	if trustForwarded {
+		if forwardedHost := forwardedValue(r.Header.Get("X-Forwarded-Host")); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	if host == "" {
+		return ""
+	}
+	scheme := "http"
+	if RequestIsHTTPS(r, trustForwarded) {
+		scheme = "https"
+	}
+	return scheme + "://" + host
+}
+
+// forwardedValue keeps the first hop of a comma separated X-Forwarded-* value,
+// which is the one set by the proxy closest to the client.
+func forwardedValue(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	return strings.TrimSpace(first)
+}
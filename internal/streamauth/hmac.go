@@ -0,0 +1,58 @@
+package streamauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// LegacyHMACEnabled reports whether pre-Firebase signed links are accepted.
+func (s *Service) LegacyHMACEnabled() bool {
+	return s != nil && s.allowLegacyHMAC && s.legacySecret() != ""
+}
+
+// SetStreamSecret replaces the secret of legacy signed links, e.g. when the
+// config is reloaded. Links signed with the old secret stop working.
+func (s *Service) SetStreamSecret(secret string) {
+	s.secretMu.Lock()
+	s.streamSecret = secret
+	s.secretMu.Unlock()
+}
+
+func (s *Service) legacySecret() string {
+	s.secretMu.RLock()
+	defer s.secretMu.RUnlock()
+	return s.streamSecret
+}
+
+// VerifyLegacyHMAC checks a signed link of the form
+// /direct/<id>?sig=hex(HMAC-SHA256(secret, "<id>:<exp>"))&exp=<unix>, as
+// produced by the old iOS/macOS clients.
+func (s *Service) VerifyLegacyHMAC(messageID int, sig, exp string) bool {
+	if !s.LegacyHMACEnabled() || sig == "" || exp == "" {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return false
+	}
+	expected, err := hex.DecodeString(sig)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(legacyMAC(s.legacySecret(), messageID, exp), expected)
+}
+
+// SignLegacyHMAC returns the sig of a legacy signed link to messageID that
+// expires at expiresAt, for `fsb sign`.
+func SignLegacyHMAC(secret string, messageID int, expiresAt time.Time) string {
+	return hex.EncodeToString(legacyMAC(secret, messageID, strconv.FormatInt(expiresAt.Unix(), 10)))
+}
+
+func legacyMAC(secret string, messageID int, exp string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.Itoa(messageID) + ":" + exp))
+	return mac.Sum(nil)
+}
@@ -2,19 +2,41 @@ package streamauth
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
 )
 
 type ServiceOptions struct {
-	FirebaseProjectID string
-	FirebaseCertsURL  string
-	SessionTTL        time.Duration
-	CleanupInterval   time.Duration
-	CookieName        string
-	CookieSecure      bool
-	CookieDomain      string
+	FirebaseProjectIDs []string
+	FirebaseCertsURL   string
+	CertsGracePeriod   time.Duration // expired certs stay usable this long if Google is unreachable
+	SessionTTL         time.Duration
+	SessionMaxAge      time.Duration // renewals stop at CreatedAt plus this
+	CleanupInterval    time.Duration
+	CookieName         string
+	CookieSecure       bool
+	CookieDomain       string
+	CookieSameSite     string // "lax", "strict" or "none"
+	// TrustForwardedHeaders lets X-Forwarded-Proto mark a request as HTTPS
+	TrustForwardedHeaders bool
+	// AllowLegacyHMAC accepts ?sig=&exp= links signed with StreamSecret
+	AllowLegacyHMAC bool
+	StreamSecret    string
+	// AppCheckProjectNumbers makes the exchange require a Firebase App Check
+	// token issued for one of these projects (and AppCheckAppIDs, when set)
+	AppCheckProjectNumbers []string
+	AppCheckAppIDs         []string
+	AppCheckJWKSURL        string
+	// PassthroughClaims are custom Firebase claims copied into sessions and,
+	// with ClaimsSigningSecret, forwarded downstream as a signed JWT
+	PassthroughClaims   []string
+	ClaimsSigningSecret string
+	ClaimsTTL           time.Duration
 }
 
 type Service struct {
@@ -27,40 +49,85 @@ type Service struct {
 	cookieName   string
 	cookieSecure bool
 	cookieDomain string
+	sameSite     http.SameSite
+
+	trustForwarded bool
+
+	allowLegacyHMAC bool
+	secretMu        sync.RWMutex
+	streamSecret    string
+
+	linkKey []byte
+
+	appCheck *appCheckVerifier
+
+	passthroughClaims []string
+	claimsSecret      []byte
+	claimsTTL         time.Duration
 }
 
 func NewService(log *zap.Logger, opts ServiceOptions) (*Service, error) {
 	svc := &Service{
 		log:          log.Named("StreamAuth"),
-		enabled:      opts.FirebaseProjectID != "",
+		enabled:      len(opts.FirebaseProjectIDs) > 0,
 		cookieName:   opts.CookieName,
 		cookieSecure: opts.CookieSecure,
 		cookieDomain: opts.CookieDomain,
+
+		trustForwarded: opts.TrustForwardedHeaders,
+
+		allowLegacyHMAC: opts.AllowLegacyHMAC,
+		streamSecret:    opts.StreamSecret,
+
+		linkKey: newLinkKey(),
+
+		passthroughClaims: opts.PassthroughClaims,
+		claimsSecret:      []byte(opts.ClaimsSigningSecret),
+		claimsTTL:         opts.ClaimsTTL,
 	}
 
 	if svc.cookieName == "" {
 		svc.cookieName = "fsb_stream_session"
 	}
 
+	sameSite, err := parseSameSite(opts.CookieSameSite)
+	if err != nil {
+		return nil, err
+	}
+	svc.sameSite = sameSite
+
 	if !svc.enabled {
 		svc.log.Info("Firebase stream auth disabled (FIREBASE_PROJECT_ID not set)")
 		return svc, nil
 	}
 
-	verifier, err := newFirebaseVerifier(log, opts.FirebaseProjectID, opts.FirebaseCertsURL)
+	verifier, err := newFirebaseVerifier(log, opts.FirebaseProjectIDs, opts.FirebaseCertsURL, opts.CertsGracePeriod)
 	if err != nil {
 		return nil, err
 	}
 
 	svc.verifier = verifier
-	svc.sessions = newSessionStore(log, opts.SessionTTL, opts.CleanupInterval)
+	if len(toSet(opts.AppCheckProjectNumbers)) > 0 {
+		svc.appCheck = newAppCheckVerifier(log, opts.AppCheckProjectNumbers, opts.AppCheckAppIDs, opts.AppCheckJWKSURL)
+		svc.log.Info("Firebase App Check required on exchange",
+			zap.Strings("projectNumbers", opts.AppCheckProjectNumbers),
+			zap.Strings("appIDs", opts.AppCheckAppIDs))
+	}
+	svc.sessions = newSessionStore(log, opts.SessionTTL, opts.SessionMaxAge, opts.CleanupInterval)
 	svc.log.Info("Firebase stream auth enabled",
-		zap.String("projectID", opts.FirebaseProjectID),
+		zap.Strings("projectIDs", opts.FirebaseProjectIDs),
 		zap.Duration("sessionTTL", opts.SessionTTL))
 
 	return svc, nil
 }
 
+// SetSessionTTL changes the lifetime of the sessions exchanged from now on.
+func (s *Service) SetSessionTTL(ttl time.Duration) {
+	if s.sessions != nil {
+		s.sessions.setTTL(ttl)
+	}
+}
+
 func (s *Service) Enabled() bool {
 	return s != nil && s.enabled
 }
@@ -73,6 +140,31 @@ func (s *Service) CookieSecure() bool {
 	return s.cookieSecure
 }
 
+// CookieSecureFor decides the Secure flag for a cookie set on r: always when
+// STREAM_SESSION_COOKIE_SECURE is on or SameSite is None (browsers drop
+// SameSite=None cookies without it), otherwise whenever the client is on HTTPS.
+func (s *Service) CookieSecureFor(r *http.Request) bool {
+	return s.cookieSecure || s.sameSite == http.SameSiteNoneMode || RequestIsHTTPS(r, s.trustForwarded)
+}
+
+// CookieSameSite returns the SameSite mode of the session cookie.
+func (s *Service) CookieSameSite() http.SameSite {
+	return s.sameSite
+}
+
+func parseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	default:
+		return 0, fmt.Errorf("invalid cookie SameSite %q, expected lax, strict or none", value)
+	}
+}
+
 func (s *Service) CookieDomain() string {
 	return s.cookieDomain
 }
@@ -81,10 +173,40 @@ func (s *Service) VerifyFirebaseToken(ctx context.Context, token string) (*Fireb
 	return s.verifier.VerifyToken(ctx, token)
 }
 
-func (s *Service) CreateSession(userID string, email string) (string, time.Time, error) {
-	return s.sessions.Create(userID, email)
+// AppCheckEnabled reports whether the exchange requires an App Check token.
+func (s *Service) AppCheckEnabled() bool {
+	return s != nil && s.appCheck != nil
+}
+
+func (s *Service) VerifyAppCheckToken(ctx context.Context, token string) (*AppCheckClaims, error) {
+	return s.appCheck.VerifyToken(ctx, token)
+}
+
+func (s *Service) CreateSession(claims *FirebaseClaims) (string, time.Time, error) {
+	session := Session{
+		UserID:    claims.Subject,
+		Email:     claims.Email,
+		ProjectID: claims.ProjectID,
+	}
+	for _, name := range s.passthroughClaims {
+		if value, ok := claims.Payload[name]; ok {
+			if session.Claims == nil {
+				session.Claims = make(map[string]any)
+			}
+			session.Claims[name] = value
+		}
+	}
+	return s.sessions.Create(session)
 }
 
 func (s *Service) ValidateSession(token string) (Session, bool) {
 	return s.sessions.Validate(token)
 }
+
+// RenewSession extends a valid session by the session TTL from now, so
+// players that keep sending heartbeats aren't cut off mid-playback. It is
+// never extended past SessionMaxAge from its creation, after which the
+// user has to exchange a Firebase token again.
+func (s *Service) RenewSession(token string) (Session, bool) {
+	return s.sessions.Renew(token)
+}
@@ -10,9 +10,15 @@ import (
 	"go.uber.org/zap"
 )
 
+// DefaultScopes are the routes a Firebase-exchanged session may access.
+var DefaultScopes = []string{"direct", "thumb"}
+
 type Session struct {
 	UserID    string
 	Email     string
+	ProjectID string // Firebase project the session was exchanged from
+	Scopes    []string
+	Claims    map[string]any // custom Firebase claims selected for passthrough
 	CreatedAt time.Time
 	ExpiresAt time.Time
 }
@@ -20,6 +26,7 @@ type Session struct {
 type sessionStore struct {
 	log             *zap.Logger
 	ttl             time.Duration
+	maxAge          time.Duration
 	cleanupInterval time.Duration
 
 	mu       sync.RWMutex
@@ -27,10 +34,13 @@ type sessionStore struct {
 	stopCh   chan struct{}
 }
 
-func newSessionStore(log *zap.Logger, ttl time.Duration, cleanupInterval time.Duration) *sessionStore {
+func newSessionStore(log *zap.Logger, ttl, maxAge, cleanupInterval time.Duration) *sessionStore {
 	if ttl <= 0 {
 		ttl = 6 * time.Hour
 	}
+	if maxAge <= 0 {
+		maxAge = 24 * time.Hour
+	}
 	if cleanupInterval <= 0 {
 		cleanupInterval = time.Minute
 	}
@@ -38,6 +48,7 @@ func newSessionStore(log *zap.Logger, ttl time.Duration, cleanupInterval time.Du
 	s := &sessionStore{
 		log:             log.Named("SessionStore"),
 		ttl:             ttl,
+		maxAge:          maxAge,
 		cleanupInterval: cleanupInterval,
 		sessions:        make(map[string]Session),
 		stopCh:          make(chan struct{}),
@@ -46,7 +57,8 @@ func newSessionStore(log *zap.Logger, ttl time.Duration, cleanupInterval time.Du
 	return s
 }
 
-func (s *sessionStore) Create(userID string, email string) (string, time.Time, error) {
+// Create stores session under a new random token, stamping its lifetime.
+func (s *sessionStore) Create(session Session) (string, time.Time, error) {
 	tokenBytes := make([]byte, 32)
 	if _, err := rand.Read(tokenBytes); err != nil {
 		return "", time.Time{}, fmt.Errorf("generate session token: %w", err)
@@ -54,21 +66,31 @@ func (s *sessionStore) Create(userID string, email string) (string, time.Time, e
 
 	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
 	now := time.Now()
-	expiresAt := now.Add(s.ttl)
-	session := Session{
-		UserID:    userID,
-		Email:     email,
-		CreatedAt: now,
-		ExpiresAt: expiresAt,
+	if session.Scopes == nil {
+		session.Scopes = DefaultScopes
 	}
 
 	s.mu.Lock()
+	expiresAt := now.Add(s.ttl)
+	session.CreatedAt = now
+	session.ExpiresAt = expiresAt
 	s.sessions[token] = session
 	s.mu.Unlock()
 
 	return token, expiresAt, nil
 }
 
+// setTTL changes the lifetime of the sessions created from now on; existing
+// ones keep theirs.
+func (s *sessionStore) setTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = 6 * time.Hour
+	}
+	s.mu.Lock()
+	s.ttl = ttl
+	s.mu.Unlock()
+}
+
 func (s *sessionStore) Validate(token string) (Session, bool) {
 	if token == "" {
 		return Session{}, false
@@ -91,6 +113,31 @@ func (s *sessionStore) Validate(token string) (Session, bool) {
 	return session, true
 }
 
+// Renew slides the expiry of a valid session to a full TTL from now, up to
+// maxAge after its creation.
+func (s *sessionStore) Renew(token string) (Session, bool) {
+	if token == "" {
+		return Session{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return Session{}, false
+	}
+	expiresAt := time.Now().Add(s.ttl)
+	if limit := session.CreatedAt.Add(s.maxAge); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+	if !expiresAt.After(session.ExpiresAt) {
+		return session, true
+	}
+	session.ExpiresAt = expiresAt
+	s.sessions[token] = session
+	return session, true
+}
+
 func (s *sessionStore) cleanupLoop() {
 	ticker := time.NewTicker(s.cleanupInterval)
 	defer ticker.Stop()
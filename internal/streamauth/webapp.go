@@ -0,0 +1,72 @@
+package streamauth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInitDataSignature = errors.New("invalid init data signature")
+	ErrInitDataExpired   = errors.New("init data expired")
+	ErrInitDataUser      = errors.New("init data has no user")
+)
+
+// WebAppUser is the Telegram user a mini app was opened by.
+type WebAppUser struct {
+	ID           int64  `json:"id"`
+	FirstName    string `json:"first_name"`
+	LastName     string `json:"last_name,omitempty"`
+	Username     string `json:"username,omitempty"`
+	LanguageCode string `json:"language_code,omitempty"`
+}
+
+// ValidateWebAppInitData checks the initData a Telegram mini app received,
+// signed with the token of the bot that opened it, and returns its user.
+// Data older than maxAge is refused; 0 accepts any age.
+// See https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func ValidateWebAppInitData(initData, botToken string, maxAge time.Duration) (WebAppUser, error) {
+	values, err := url.ParseQuery(initData)
+	if err != nil {
+		return WebAppUser{}, ErrInitDataSignature
+	}
+	hash := values.Get("hash")
+	if hash == "" {
+		return WebAppUser{}, ErrInitDataSignature
+	}
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		if key != "hash" {
+			pairs = append(pairs, key+"="+values.Get(key))
+		}
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return WebAppUser{}, ErrInitDataSignature
+	}
+
+	if maxAge > 0 {
+		authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+		if err != nil || time.Since(time.Unix(authDate, 0)) > maxAge {
+			return WebAppUser{}, ErrInitDataExpired
+		}
+	}
+	var user WebAppUser
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil || user.ID == 0 {
+		return WebAppUser{}, ErrInitDataUser
+	}
+	return user, nil
+}
@@ -0,0 +1,233 @@
+// Package transcode pre-generates lower quality renditions of popular videos
+// with ffmpeg so clients on slow links can pick a bitrate from the ladder.
+// Files that haven't been processed are served in their original quality.
+package transcode
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/janitor"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// jobTimeout bounds a single ffmpeg run so a stuck source can't hold a worker.
+const jobTimeout = 2 * time.Hour
+
+// ladder maps a rendition height to its video bitrate.
+var ladder = map[int]string{
+	240:  "400k",
+	360:  "800k",
+	480:  "1400k",
+	720:  "2800k",
+	1080: "5000k",
+}
+
+// Source returns the URL ffmpeg reads the original file from and the extra
+// request headers it must send.
+type Source func(messageID int) (url string, headers string)
+
+type job struct {
+	messageID int
+	height    int
+}
+
+var (
+	log     *zap.Logger
+	source  Source
+	heights []int
+	queue   chan job
+
+	mu       sync.Mutex
+	requests = make(map[int]int)
+	pending  = make(map[job]struct{})
+)
+
+// Enabled reports whether renditions are generated.
+func Enabled() bool {
+	return queue != nil
+}
+
+// Start validates TRANSCODE_RENDITIONS and starts the workers. It is a no-op
+// when no rendition is configured.
+func Start(logger *zap.Logger, src Source) error {
+	if len(config.ValueOf.TranscodeRenditions) == 0 {
+		return nil
+	}
+	log = logger.Named("Transcode")
+	for _, height := range config.ValueOf.TranscodeRenditions {
+		if _, ok := ladder[height]; !ok {
+			return fmt.Errorf("unsupported TRANSCODE_RENDITIONS height %d", height)
+		}
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+	if _, err := exec.LookPath(config.ValueOf.FFmpegPath); err != nil {
+		return fmt.Errorf("ffmpeg not found: %w", err)
+	}
+	if err := os.MkdirAll(config.ValueOf.TranscodeDir, 0o755); err != nil {
+		return err
+	}
+
+	janitor.Register(janitor.Target{
+		Name:            "transcode-tmp",
+		Dir:             config.ValueOf.TranscodeDir,
+		Pattern:         "*.part",
+		MaxAge:          jobTimeout,
+		RemoveOnStartup: true,
+	})
+	janitor.Register(janitor.Target{
+		Name:    "transcode",
+		Dir:     config.ValueOf.TranscodeDir,
+		Pattern: "*.mp4",
+		MaxAge:  time.Duration(config.ValueOf.TranscodeMaxAgeHours) * time.Hour,
+	})
+
+	source = src
+	queue = make(chan job, 64)
+	workers := config.ValueOf.TranscodeWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go work()
+	}
+	log.Info("Transcoding enabled",
+		zap.Ints("renditions", heights),
+		zap.Int("minRequests", config.ValueOf.TranscodeMinRequests),
+		zap.Int("workers", workers))
+	return nil
+}
+
+// NoteRequest counts a play of the original file and queues its missing
+// renditions once it reaches TRANSCODE_MIN_REQUESTS.
+func NoteRequest(messageID int) {
+	if !Enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	requests[messageID]++
+	if requests[messageID] < config.ValueOf.TranscodeMinRequests {
+		return
+	}
+	for _, height := range heights {
+		j := job{messageID: messageID, height: height}
+		if _, queued := pending[j]; queued {
+			continue
+		}
+		if _, ok := Path(messageID, height); ok {
+			continue
+		}
+		select {
+		case queue <- j:
+			pending[j] = struct{}{}
+		default:
+			// Queue full: the next request retries
+			return
+		}
+	}
+}
+
+// Path returns the rendition of messageID at height when it exists.
+func Path(messageID, height int) (string, bool) {
+	if !Enabled() {
+		return "", false
+	}
+	path := renditionPath(messageID, height)
+	if info, err := os.Stat(path); err != nil || info.Size() == 0 {
+		return "", false
+	}
+	return path, true
+}
+
+// Available lists the heights already generated for messageID.
+func Available(messageID int) []int {
+	var out []int
+	for _, height := range heights {
+		if _, ok := Path(messageID, height); ok {
+			out = append(out, height)
+		}
+	}
+	return out
+}
+
+func renditionPath(messageID, height int) string {
+	return filepath.Join(config.ValueOf.TranscodeDir, strconv.Itoa(messageID)+"_"+strconv.Itoa(height)+"p.mp4")
+}
+
+func work() {
+	for j := range queue {
+		err := run(j)
+		if err != nil {
+			log.Warn("Transcode failed",
+				zap.Int("messageID", j.messageID),
+				zap.Int("height", j.height),
+				zap.Error(err))
+		}
+		mu.Lock()
+		delete(pending, j)
+		if err != nil {
+			// Start counting again so a failing file isn't retried on every play
+			delete(requests, j.messageID)
+		}
+		mu.Unlock()
+	}
+}
+
+func run(j job) error {
+	if err := utils.CheckDiskSpace(config.ValueOf.TranscodeDir); err != nil {
+		return err
+	}
+	url, headers := source(j.messageID)
+	out := renditionPath(j.messageID, j.height)
+	tmp := out + ".part"
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+	start := time.Now()
+	args := []string{"-nostdin", "-loglevel", "error", "-y"}
+	if headers != "" {
+		args = append(args, "-headers", headers)
+	}
+	args = append(args,
+		"-i", url,
+		"-map", "0:v:0", "-map", "0:a:0?",
+		// Never upscale sources that are already below the target height
+		"-vf", "scale=-2:'min("+strconv.Itoa(j.height)+",ih)'",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "23",
+		"-maxrate", ladder[j.height], "-bufsize", ladder[j.height],
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		"-f", "mp4", tmp,
+	)
+	output, err := exec.CommandContext(ctx, config.ValueOf.FFmpegPath, args...).CombinedOutput()
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%w: %s", err, lastLine(string(output)))
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	log.Info("Rendition ready",
+		zap.Int("messageID", j.messageID),
+		zap.Int("height", j.height),
+		zap.Duration("took", time.Since(start)))
+	return nil
+}
+
+func lastLine(output string) string {
+	output = strings.TrimSpace(output)
+	return output[strings.LastIndex(output, "\n")+1:]
+}
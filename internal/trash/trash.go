@@ -0,0 +1,242 @@
+// Package trash implements soft deletion of media files: deleted messages are
+// moved to TRASH_CHANNEL_ID for TRASH_DAYS, during which they can be
+// restored, before they are removed for good.
+package trash
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/database"
+	"EverythingSuckz/fsb/internal/retention"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const purgeInterval = time.Hour
+
+var (
+	ErrNotFound   = errors.New("file not found")
+	ErrNotInTrash = errors.New("file is not in the trash")
+	ErrNoDatabase = errors.New("database not initialized")
+)
+
+// Entry maps a deleted message of MEDIA_CHANNEL_ID to its copy in the trash.
+type Entry struct {
+	MessageID      int        `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	TrashMessageID int        `json:"trash_message_id"`
+	FileName       string     `json:"file_name"`
+	Size           int64      `json:"size"`
+	DeletedBy      string     `json:"deleted_by,omitempty"`
+	DeletedAt      time.Time  `json:"deleted_at"`
+	PurgeAt        time.Time  `gorm:"index" json:"purge_at"`
+	RestoredAs     int        `json:"restored_as,omitempty"` // message ID of the restored copy
+	RestoredAt     *time.Time `json:"restored_at,omitempty"`
+}
+
+func (Entry) TableName() string { return "trash_entries" }
+
+func init() {
+	database.RegisterModel(&Entry{})
+}
+
+// Message IDs in the trash, and restored ones mapped to their new ID, so
+// links can be answered without a query.
+var (
+	stateMu sync.RWMutex
+	state   = make(map[int]int)
+	log     = zap.NewNop()
+)
+
+func setState(messageID, restoredAs int) {
+	stateMu.Lock()
+	state[messageID] = restoredAs
+	stateMu.Unlock()
+}
+
+// Enabled reports whether deleted files go to a trash channel.
+func Enabled() bool {
+	return config.ValueOf.TrashChannelID != 0
+}
+
+// Lookup reports whether messageID of MEDIA_CHANNEL_ID was trashed and, if
+// it has been restored since, its new message ID.
+func Lookup(messageID int) (restoredAs int, trashed bool) {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	restoredAs, trashed = state[messageID]
+	return restoredAs, trashed
+}
+
+// Start loads the trash and purges expired entries periodically. It must run
+// after database.Init.
+func Start(l *zap.Logger) {
+	if database.DB == nil {
+		return
+	}
+	log = l.Named("Trash")
+	var entries []Entry
+	if err := database.DB.Find(&entries).Error; err != nil {
+		log.Error("Failed to load trash", zap.Error(err))
+		return
+	}
+	for _, e := range entries {
+		setState(e.MessageID, e.RestoredAs)
+	}
+	if !Enabled() {
+		return
+	}
+	log.Info("Trash enabled",
+		zap.Int64("channelID", config.ValueOf.TrashChannelID),
+		zap.Int("days", config.ValueOf.TrashDays))
+	go func() {
+		for {
+			purge()
+			time.Sleep(purgeInterval)
+		}
+	}()
+}
+
+// Delete removes messageID from MEDIA_CHANNEL_ID. With a trash channel the
+// message is moved there first so it can be restored; otherwise it is gone
+// for good and its links answer 410.
+func Delete(ctx context.Context, messageID int, by string) (*Entry, error) {
+	if Enabled() && database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	if bot.Bot == nil {
+		return nil, errors.New("main bot not started")
+	}
+	if restoredAs, trashed := Lookup(messageID); trashed && restoredAs == 0 {
+		return nil, ErrNotFound
+	}
+	mediaChannel := config.ValueOf.MediaChannelID
+	file, err := utils.FileFromMessageAndChannel(ctx, bot.Bot, mediaChannel, messageID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	now := time.Now()
+
+	if !Enabled() {
+		if err := bot.DeleteChannelMessages(ctx, mediaChannel, messageID); err != nil {
+			return nil, err
+		}
+		err := retention.Record([]retention.Tombstone{{
+			ChannelID: mediaChannel,
+			MessageID: messageID,
+			FileName:  file.FileName,
+			Size:      file.FileSize,
+			DeletedAt: now,
+		}})
+		return nil, err
+	}
+
+	trashID, err := bot.CopyChannelMessage(ctx, mediaChannel, config.ValueOf.TrashChannelID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	entry := &Entry{
+		MessageID:      messageID,
+		TrashMessageID: trashID,
+		FileName:       file.FileName,
+		Size:           file.FileSize,
+		DeletedBy:      by,
+		DeletedAt:      now,
+		PurgeAt:        now.AddDate(0, 0, config.ValueOf.TrashDays),
+	}
+	if err := database.DB.Save(entry).Error; err != nil {
+		// Keep the original rather than lose track of the copy
+		_ = bot.DeleteChannelMessages(ctx, config.ValueOf.TrashChannelID, trashID)
+		return nil, err
+	}
+	if err := bot.DeleteChannelMessages(ctx, mediaChannel, messageID); err != nil {
+		database.DB.Delete(entry)
+		_ = bot.DeleteChannelMessages(ctx, config.ValueOf.TrashChannelID, trashID)
+		return nil, err
+	}
+	setState(messageID, 0)
+	return entry, nil
+}
+
+// Restore copies a trashed file back into MEDIA_CHANNEL_ID. Telegram can't
+// reuse the old message ID, so links to it redirect to the new one.
+func Restore(ctx context.Context, messageID int) (*Entry, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	if !Enabled() {
+		return nil, ErrNotInTrash
+	}
+	var entry Entry
+	if err := database.DB.Limit(1).Find(&entry, "message_id = ?", messageID).Error; err != nil {
+		return nil, err
+	}
+	if entry.MessageID == 0 || entry.RestoredAs != 0 {
+		return nil, ErrNotInTrash
+	}
+	newID, err := bot.CopyChannelMessage(ctx, config.ValueOf.TrashChannelID, config.ValueOf.MediaChannelID, entry.TrashMessageID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry.RestoredAs = newID
+	entry.RestoredAt = &now
+	if err := database.DB.Save(&entry).Error; err != nil {
+		return nil, err
+	}
+	setState(messageID, newID)
+	if err := bot.DeleteChannelMessages(ctx, config.ValueOf.TrashChannelID, entry.TrashMessageID); err != nil {
+		log.Warn("Failed to remove restored file from the trash channel",
+			zap.Int("trashMessageID", entry.TrashMessageID), zap.Error(err))
+	}
+	return &entry, nil
+}
+
+// List returns the files currently in the trash, most recently deleted first.
+func List() ([]Entry, error) {
+	if database.DB == nil {
+		return nil, ErrNoDatabase
+	}
+	var entries []Entry
+	err := database.DB.Where("restored_as = 0").Order("deleted_at DESC").Find(&entries).Error
+	return entries, err
+}
+
+// purge removes the files whose trash window is over. Their links answer
+// 410 from then on.
+func purge() {
+	var expired []Entry
+	if err := database.DB.Where("restored_as = 0 AND purge_at <= ?", time.Now()).Find(&expired).Error; err != nil {
+		log.Error("Failed to query expired trash", zap.Error(err))
+		return
+	}
+	for _, e := range expired {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		err := bot.DeleteChannelMessages(ctx, config.ValueOf.TrashChannelID, e.TrashMessageID)
+		cancel()
+		if err != nil {
+			log.Error("Failed to purge trashed file", zap.Int("messageID", e.MessageID), zap.Error(err))
+			continue
+		}
+		err = retention.Record([]retention.Tombstone{{
+			ChannelID: config.ValueOf.MediaChannelID,
+			MessageID: e.MessageID,
+			FileName:  e.FileName,
+			Size:      e.Size,
+			DeletedAt: time.Now(),
+		}})
+		if err != nil {
+			log.Error("Failed to record purged file", zap.Int("messageID", e.MessageID), zap.Error(err))
+			continue
+		}
+		database.DB.Delete(&e)
+		stateMu.Lock()
+		delete(state, e.MessageID)
+		stateMu.Unlock()
+		log.Info("Purged trashed file", zap.Int("messageID", e.MessageID), zap.String("file", e.FileName))
+	}
+}
@@ -18,6 +18,7 @@ type File struct {
 	FileName string
 	MimeType string
 	ID       int64
+	Date     int // unix time the message was posted or last edited, 0 when unknown
 }
 
 // fileGob is a helper struct for gob encoding/decoding
@@ -29,6 +30,7 @@ type fileGob struct {
 	FileName     string
 	MimeType     string
 	ID           int64
+	Date         int
 }
 
 // GobEncode implements gob.GobEncoder
@@ -41,6 +43,7 @@ func (f *File) GobEncode() ([]byte, error) {
 		FileName: f.FileName,
 		MimeType: f.MimeType,
 		ID:       f.ID,
+		Date:     f.Date,
 	}
 
 	// Encode the Location based on its concrete type
@@ -86,6 +89,7 @@ func (f *File) GobDecode(data []byte) error {
 	f.FileName = fg.FileName
 	f.MimeType = fg.MimeType
 	f.ID = fg.ID
+	f.Date = fg.Date
 
 	// Decode the Location based on the stored type
 	locBuf := bytes.NewBuffer(fg.LocationData)
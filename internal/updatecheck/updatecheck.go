@@ -0,0 +1,231 @@
+// Package updatecheck compares the running version with the GitHub releases
+// of UPDATE_CHECK_REPO and picks out the breaking changes announced in the
+// release notes of every newer version.
+package updatecheck
+
+import (
+	"EverythingSuckz/fsb/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const releasesPerPage = 30
+
+// Release is a published version newer than the running one.
+type Release struct {
+	Version     string    `json:"version"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Breaking    []string  `json:"breaking,omitempty"` // breaking-change notes from the release body
+}
+
+// Status is the outcome of the last check.
+type Status struct {
+	Current         string    `json:"current"`
+	Latest          string    `json:"latest"`
+	UpdateAvailable bool      `json:"update_available"`
+	Breaking        bool      `json:"breaking"` // a newer major version, or notes flagged as breaking
+	Releases        []Release `json:"releases,omitempty"`
+	CheckedAt       time.Time `json:"checked_at"`
+}
+
+// NotifyFunc is called once per newly seen latest version.
+type NotifyFunc func(Status)
+
+var (
+	mu          sync.RWMutex
+	last        *Status
+	subscribers []NotifyFunc
+	client      = &http.Client{Timeout: 30 * time.Second}
+)
+
+// OnNewVersion registers fn to run when a check finds a version that was not
+// reported yet.
+func OnNewVersion(fn NotifyFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	subscribers = append(subscribers, fn)
+}
+
+// Last returns the result of the latest successful check, or nil.
+func Last() *Status {
+	mu.RLock()
+	defer mu.RUnlock()
+	return last
+}
+
+// Start checks for new releases every UPDATE_CHECK_HOURS. A non-positive
+// interval disables it.
+func Start(l *zap.Logger, current string) {
+	log := l.Named("UpdateCheck")
+	interval := time.Duration(config.ValueOf.UpdateCheckHours) * time.Hour
+	if interval <= 0 {
+		return
+	}
+	log.Info("Update check enabled",
+		zap.String("repo", config.ValueOf.UpdateCheckRepo),
+		zap.Duration("interval", interval))
+
+	go func() {
+		notified := ""
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			status, err := Check(ctx, config.ValueOf.UpdateCheckRepo, current)
+			cancel()
+			if err != nil {
+				log.Warn("Failed to check for updates", zap.Error(err))
+			} else {
+				mu.Lock()
+				last = status
+				notify := append([]NotifyFunc{}, subscribers...)
+				mu.Unlock()
+				if status.UpdateAvailable && status.Latest != notified {
+					notified = status.Latest
+					log.Info("New version available",
+						zap.String("current", current),
+						zap.String("latest", status.Latest),
+						zap.Bool("breaking", status.Breaking))
+					for _, fn := range notify {
+						fn(*status)
+					}
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+type githubRelease struct {
+	TagName     string    `json:"tag_name"`
+	HTMLURL     string    `json:"html_url"`
+	Body        string    `json:"body"`
+	Draft       bool      `json:"draft"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+}
+
+// Check fetches the releases of repo ("owner/name") and lists the ones newer
+// than current, newest first.
+func Check(ctx context.Context, repo, current string) (*Status, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=%d", repo, releasesPerPage)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "fsb/"+current)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub answered %s", resp.Status)
+	}
+	var releases []githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, err
+	}
+
+	status := &Status{Current: current, Latest: current, CheckedAt: time.Now()}
+	currentVersion, ok := parseVersion(current)
+	if !ok {
+		return nil, fmt.Errorf("unrecognized running version %q", current)
+	}
+	latestVersion := currentVersion
+	for _, r := range releases {
+		v, ok := parseVersion(r.TagName)
+		if r.Draft || r.Prerelease || !ok || !v.newerThan(currentVersion) {
+			continue
+		}
+		release := Release{
+			Version:     strings.TrimPrefix(r.TagName, "v"),
+			URL:         r.HTMLURL,
+			PublishedAt: r.PublishedAt,
+			Breaking:    BreakingNotes(r.Body),
+		}
+		status.Releases = append(status.Releases, release)
+		if len(release.Breaking) > 0 || v[0] > currentVersion[0] {
+			status.Breaking = true
+		}
+		if v.newerThan(latestVersion) {
+			latestVersion = v
+			status.Latest = release.Version
+		}
+	}
+	status.UpdateAvailable = len(status.Releases) > 0
+	return status, nil
+}
+
+type version [3]int
+
+func (v version) newerThan(o version) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] > o[i]
+		}
+	}
+	return false
+}
+
+// parseVersion reads "v1.2.3" or "1.2", ignoring any "-suffix".
+func parseVersion(s string) (version, bool) {
+	var v version
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	s, _, _ = strings.Cut(s, "-")
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		v[i] = n
+	}
+	return v, true
+}
+
+var (
+	headingPattern  = regexp.MustCompile(`^#{1,6}\s+(.*)$`)
+	breakingPattern = regexp.MustCompile(`(?i)^(?:[-*]\s*)?(?:\*\*)?(?:⚠️\s*)?breaking(?:[ -]changes?)?(?:\*\*)?\s*:\s*(.+)$`)
+	bulletPattern   = regexp.MustCompile(`^\s*(?:[-*+]|\d+\.)\s+(.+)$`)
+)
+
+// BreakingNotes extracts the breaking changes from a release body: the items
+// of a "Breaking changes" section and any line starting with "BREAKING:" or
+// "BREAKING CHANGE:".
+func BreakingNotes(body string) []string {
+	var notes []string
+	inSection := false
+	for _, line := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n") {
+		line = strings.TrimSpace(line)
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			inSection = strings.Contains(strings.ToLower(m[1]), "breaking")
+			continue
+		}
+		if m := breakingPattern.FindStringSubmatch(line); m != nil {
+			notes = append(notes, strings.TrimSpace(m[1]))
+			continue
+		}
+		if !inSection || line == "" {
+			continue
+		}
+		if m := bulletPattern.FindStringSubmatch(line); m != nil {
+			notes = append(notes, strings.TrimSpace(m[1]))
+		} else {
+			notes = append(notes, line)
+		}
+	}
+	return notes
+}
@@ -0,0 +1,242 @@
+package upload
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/webhook"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Step states.
+const (
+	StepPending = "pending"
+	StepRunning = "running"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	StepSkipped = "skipped"
+)
+
+const (
+	stepTimeout    = 10 * time.Minute
+	webhookTimeout = 10 * time.Second
+)
+
+// ErrSkipped is returned by a step that doesn't apply to the file, e.g. a
+// thumbnail for a document Telegram has none for.
+var ErrSkipped = errors.New("step does not apply")
+
+// StepStatus is the outcome of one post-processing step of an upload.
+type StepStatus struct {
+	Name       string         `json:"name"`
+	Status     string         `json:"status"`
+	Error      string         `json:"error,omitempty"`
+	Result     map[string]any `json:"result,omitempty"`
+	DurationMS int64          `json:"duration_ms,omitempty"`
+}
+
+// ThumbnailFunc warms the thumbnail cache for messageID.
+type ThumbnailFunc func(ctx context.Context, messageID int) error
+
+// stepFunc runs a step on a finished upload. The data file is still on disk.
+type stepFunc func(ctx context.Context, u *Upload) (map[string]any, error)
+
+var (
+	steps     = map[string]stepFunc{"probe": probeStep, "checksum": checksumStep, "thumbnail": thumbnailStep, "webhook": webhookStep}
+	pipeline  []string
+	thumbnail ThumbnailFunc
+)
+
+// setupPipeline validates UPLOAD_POST_PROCESS.
+func setupPipeline(thumb ThumbnailFunc) error {
+	pipeline = nil
+	thumbnail = thumb
+	for _, name := range config.ValueOf.UploadPostProcess {
+		if _, ok := steps[name]; !ok {
+			return fmt.Errorf("unknown UPLOAD_POST_PROCESS step %q, expected probe, checksum, thumbnail or webhook", name)
+		}
+		if name == "webhook" && config.ValueOf.UploadWebhookURL == "" {
+			return errors.New("UPLOAD_POST_PROCESS step webhook needs UPLOAD_WEBHOOK_URL")
+		}
+		pipeline = append(pipeline, name)
+	}
+	return nil
+}
+
+// newSteps returns the pending steps of a freshly finished upload.
+func newSteps() []StepStatus {
+	var s []StepStatus
+	for _, name := range pipeline {
+		s = append(s, StepStatus{Name: name, Status: StepPending})
+	}
+	return s
+}
+
+// unfinished reports whether some step of u still has to run.
+func (u *Upload) unfinished() bool {
+	for _, step := range u.Steps {
+		if step.Status == StepPending || step.Status == StepRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// runPipeline runs the remaining steps of an upload in order, recording each
+// result as it goes, and removes the data file at the end. A failed step
+// doesn't stop the ones after it.
+func runPipeline(id string) {
+	defer os.Remove(dataPath(id))
+	for i := 0; ; i++ {
+		u, err := Get(id)
+		if err != nil || i >= len(u.Steps) {
+			return
+		}
+		step := u.Steps[i]
+		if step.Status != StepPending && step.Status != StepRunning {
+			continue
+		}
+		if err := setStep(id, i, StepStatus{Name: step.Name, Status: StepRunning}); err != nil {
+			return
+		}
+
+		started := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+		result, err := steps[step.Name](ctx, u)
+		cancel()
+		step = StepStatus{Name: step.Name, Status: StepDone, Result: result, DurationMS: time.Since(started).Milliseconds()}
+		switch {
+		case errors.Is(err, ErrSkipped):
+			step.Status = StepSkipped
+		case err != nil:
+			log.Warn("Upload post-processing step failed",
+				zap.String("id", id),
+				zap.String("step", step.Name),
+				zap.Error(err))
+			step.Status = StepFailed
+			step.Error = err.Error()
+		}
+		if err := setStep(id, i, step); err != nil {
+			return
+		}
+	}
+}
+
+// setStep records the state of step i, unless the upload was deleted meanwhile.
+func setStep(id string, i int, step StepStatus) error {
+	defer lock(id)()
+	u, err := Get(id)
+	if err != nil {
+		return err
+	}
+	u.Steps[i] = step
+	return save(u)
+}
+
+func probeStep(ctx context.Context, u *Upload) (map[string]any, error) {
+	out, err := exec.CommandContext(ctx, config.ValueOf.FFprobePath,
+		"-v", "error", "-print_format", "json", "-show_format", "-show_streams", dataPath(u.ID)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe: %w", err)
+	}
+	var probe struct {
+		Format struct {
+			FormatName string `json:"format_name"`
+			Duration   string `json:"duration"`
+			BitRate    string `json:"bit_rate"`
+		} `json:"format"`
+		Streams []struct {
+			CodecType string `json:"codec_type"`
+			CodecName string `json:"codec_name"`
+			Width     int    `json:"width,omitempty"`
+			Height    int    `json:"height,omitempty"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return nil, err
+	}
+	duration, _ := strconv.ParseFloat(probe.Format.Duration, 64)
+	bitRate, _ := strconv.ParseInt(probe.Format.BitRate, 10, 64)
+	return map[string]any{
+		"format":   probe.Format.FormatName,
+		"duration": duration,
+		"bit_rate": bitRate,
+		"streams":  probe.Streams,
+	}, nil
+}
+
+func checksumStep(_ context.Context, u *Upload) (map[string]any, error) {
+	f, err := os.Open(dataPath(u.ID))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return map[string]any{"sha256": hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func thumbnailStep(ctx context.Context, u *Upload) (map[string]any, error) {
+	if thumbnail == nil {
+		return nil, ErrSkipped
+	}
+	return nil, thumbnail(ctx, u.MessageID)
+}
+
+// webhookStep posts the upload, with the results of the steps before it, to
+// UPLOAD_WEBHOOK_URL.
+func webhookStep(ctx context.Context, u *Upload) (map[string]any, error) {
+	var finished []StepStatus
+	for _, step := range u.Steps {
+		if step.Status != StepPending && step.Status != StepRunning {
+			finished = append(finished, step)
+		}
+	}
+	body, err := json.Marshal(map[string]any{
+		"event":      "upload.done",
+		"id":         u.ID,
+		"owner":      u.Owner,
+		"file_name":  u.FileName(),
+		"length":     u.Length,
+		"message_id": u.MessageID,
+		"link":       config.ValueOf.LinkBase() + "/direct/" + opaqueid.ID(config.ValueOf.MediaChannelID, u.MessageID),
+		"steps":      finished,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.ValueOf.UploadWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if secret := config.ValueOf.UploadWebhookSecret; secret != "" {
+		req.Header.Set(webhook.SignatureHeader, webhook.Sign(secret, body))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return map[string]any{"status": resp.StatusCode}, nil
+}
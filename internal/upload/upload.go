@@ -0,0 +1,410 @@
+// Package upload stores resumable uploads on disk until they are complete and
+// then moves them into MEDIA_CHANNEL_ID. Each upload is a pair of files:
+// <id>.bin with the bytes received so far and <id>.json with its state, so
+// clients can resume after a dropped connection or a restart.
+package upload
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/bot"
+	"EverythingSuckz/fsb/internal/janitor"
+	"EverythingSuckz/fsb/internal/opaqueid"
+	"EverythingSuckz/fsb/internal/utils"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Upload states.
+const (
+	StatusUploading  = "uploading"
+	StatusProcessing = "processing" // complete, being sent to Telegram
+	StatusDone       = "done"
+	StatusFailed     = "failed"
+)
+
+// processTimeout bounds sending a finished upload to Telegram.
+const processTimeout = 2 * time.Hour
+
+var (
+	ErrNotFound       = errors.New("upload not found")
+	ErrOffsetMismatch = errors.New("upload offset mismatch")
+	ErrTooLarge       = errors.New("upload exceeds its declared length")
+	ErrNotUploading   = errors.New("upload is no longer accepting data")
+	ErrOverMaxSize    = errors.New("upload exceeds UPLOAD_MAX_SIZE_MB")
+	ErrEmpty          = errors.New("upload is empty")
+)
+
+// Upload is the persisted state of one upload.
+type Upload struct {
+	ID        string            `json:"id"`
+	Owner     string            `json:"owner"` // user ID of the stream session that created it
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Status    string            `json:"status"`
+	MessageID int               `json:"message_id,omitempty"`
+	Error     string            `json:"error,omitempty"`
+	Steps     []StepStatus      `json:"steps,omitempty"` // post-processing, once in Telegram
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// FileName returns the file name declared by the client, if any.
+func (u *Upload) FileName() string {
+	if name := u.Metadata["filename"]; name != "" {
+		return filepath.Base(name)
+	}
+	return u.ID
+}
+
+var (
+	log *zap.Logger
+	dir string
+
+	// locks serializes writes to one upload. An entry lives while someone
+	// holds or waits for it, so ended uploads leave nothing behind.
+	locksMu sync.Mutex
+	locks   = make(map[string]*uploadLock)
+)
+
+type uploadLock struct {
+	sync.Mutex
+	refs int
+}
+
+// Enabled reports whether uploads are accepted.
+func Enabled() bool {
+	return dir != ""
+}
+
+// Start prepares UPLOAD_DIR and hands stale uploads to the janitor. thumb
+// backs the thumbnail post-processing step.
+func Start(l *zap.Logger, thumb ThumbnailFunc) error {
+	if !config.ValueOf.UploadEnabled {
+		return nil
+	}
+	if err := setupPipeline(thumb); err != nil {
+		return err
+	}
+	log = l.Named("Upload")
+	if err := os.MkdirAll(config.ValueOf.UploadDir, 0o755); err != nil {
+		return err
+	}
+	dir = config.ValueOf.UploadDir
+
+	expiry := time.Duration(config.ValueOf.UploadExpiryHours) * time.Hour
+	for _, pattern := range []string{"*.bin", "*.json"} {
+		janitor.Register(janitor.Target{
+			Name:    "upload-" + strings.TrimPrefix(pattern, "*."),
+			Dir:     dir,
+			Pattern: pattern,
+			MaxAge:  expiry,
+		})
+	}
+
+	log.Info("Uploads enabled",
+		zap.String("dir", dir),
+		zap.Int64("maxSizeMB", config.ValueOf.UploadMaxSizeMB),
+		zap.Strings("postProcess", pipeline))
+	return nil
+}
+
+// Resume picks up the uploads that were being sent or post-processed when
+// the process stopped. Both need the bots, so it runs once they are started.
+func Resume() {
+	if !Enabled() {
+		return
+	}
+	infos, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	for _, info := range infos {
+		u, err := Get(strings.TrimSuffix(filepath.Base(info), ".json"))
+		switch {
+		case err != nil:
+		case u.Status == StatusProcessing:
+			log.Info("Resuming upload to Telegram", zap.String("id", u.ID))
+			go process(u.ID)
+		case u.Status == StatusDone && u.unfinished():
+			log.Info("Resuming upload post-processing", zap.String("id", u.ID))
+			go runPipeline(u.ID)
+		}
+	}
+}
+
+// MaxSize is the largest upload accepted, in bytes.
+func MaxSize() int64 {
+	return config.ValueOf.UploadMaxSizeMB * 1024 * 1024
+}
+
+func lock(id string) func() {
+	locksMu.Lock()
+	l := locks[id]
+	if l == nil {
+		l = &uploadLock{}
+		locks[id] = l
+	}
+	l.refs++
+	locksMu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		locksMu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(locks, id)
+		}
+		locksMu.Unlock()
+	}
+}
+
+func infoPath(id string) string { return filepath.Join(dir, id+".json") }
+func dataPath(id string) string { return filepath.Join(dir, id+".bin") }
+
+// validID keeps client supplied IDs from escaping UPLOAD_DIR.
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// Create registers a new upload of length bytes for owner.
+func Create(owner string, length int64, metadata map[string]string) (*Upload, error) {
+	if err := utils.CheckDiskSpace(dir); err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	u := &Upload{
+		ID:        hex.EncodeToString(b),
+		Owner:     owner,
+		Length:    length,
+		Metadata:  metadata,
+		Status:    StatusUploading,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(config.ValueOf.UploadExpiryHours) * time.Hour),
+	}
+	f, err := os.OpenFile(dataPath(u.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := save(u); err != nil {
+		os.Remove(dataPath(u.ID))
+		return nil, err
+	}
+	return u, nil
+}
+
+// Get loads an upload, with Offset taken from the bytes actually on disk.
+func Get(id string) (*Upload, error) {
+	if !validID(id) {
+		return nil, ErrNotFound
+	}
+	data, err := os.ReadFile(infoPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	var u Upload
+	if err := json.Unmarshal(data, &u); err != nil {
+		return nil, err
+	}
+	if u.Status == StatusUploading || u.Status == StatusProcessing {
+		info, err := os.Stat(dataPath(id))
+		if err != nil {
+			return nil, ErrNotFound
+		}
+		u.Offset = info.Size()
+	}
+	return &u, nil
+}
+
+func save(u *Upload) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	tmp := infoPath(u.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, infoPath(u.ID))
+}
+
+// Append writes body at offset, which must match the bytes received so far.
+// Bytes written before a broken connection are kept, as tus expects. When the
+// upload is complete it is sent to Telegram in the background.
+func Append(id string, offset int64, body io.Reader) (*Upload, error) {
+	defer lock(id)()
+	u, err := Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.Status != StatusUploading {
+		return nil, ErrNotUploading
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+	if err := utils.CheckDiskSpace(dir); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(dataPath(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	// Read one byte past the declared length to tell overruns apart
+	written, copyErr := io.Copy(f, io.LimitReader(body, u.Length-u.Offset+1))
+	if written > u.Length-u.Offset {
+		f.Truncate(u.Length)
+		written = u.Length - u.Offset
+		copyErr = ErrTooLarge
+	}
+	closeErr := f.Close()
+	u.Offset += written
+	// Keep the state file as fresh as the data for the janitor
+	now := time.Now()
+	os.Chtimes(infoPath(id), now, now)
+	if copyErr == nil {
+		copyErr = closeErr
+	}
+
+	if u.Offset == u.Length {
+		u.Status = StatusProcessing
+		if err := save(u); err != nil {
+			return u, err
+		}
+		go process(id)
+	}
+	return u, copyErr
+}
+
+// Put stores a whole file received in one request and sends it to Telegram
+// before returning, for clients that don't speak tus. Post-processing still
+// runs in the background.
+func Put(owner string, metadata map[string]string, body io.Reader) (*Upload, error) {
+	u, err := Create(owner, 0, metadata)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(dataPath(u.ID), os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		Delete(u.ID)
+		return nil, err
+	}
+	written, err := io.Copy(f, io.LimitReader(body, MaxSize()+1))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && written > MaxSize() {
+		err = ErrOverMaxSize
+	}
+	if err == nil && written == 0 {
+		err = ErrEmpty
+	}
+	if err != nil {
+		Delete(u.ID)
+		return nil, err
+	}
+
+	unlock := lock(u.ID)
+	u.Length, u.Offset, u.Status = written, written, StatusProcessing
+	err = save(u)
+	unlock()
+	if err != nil {
+		Delete(u.ID)
+		return nil, err
+	}
+	process(u.ID)
+	return Get(u.ID)
+}
+
+// List returns the uploads of owner, newest first.
+func List(owner string) ([]*Upload, error) {
+	infos, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var uploads []*Upload
+	for _, info := range infos {
+		u, err := Get(strings.TrimSuffix(filepath.Base(info), ".json"))
+		if err == nil && u.Owner == owner {
+			uploads = append(uploads, u)
+		}
+	}
+	sort.Slice(uploads, func(i, j int) bool {
+		return uploads[i].CreatedAt.After(uploads[j].CreatedAt)
+	})
+	return uploads, nil
+}
+
+// Delete removes an upload and its data.
+func Delete(id string) error {
+	defer lock(id)()
+	if _, err := Get(id); err != nil {
+		return err
+	}
+	os.Remove(dataPath(id))
+	return os.Remove(infoPath(id))
+}
+
+// process sends a complete upload to the media channel, records the
+// resulting message ID and runs the post-processing steps.
+func process(id string) {
+	u, err := Get(id)
+	if err != nil {
+		log.Error("Failed to load finished upload", zap.String("id", id), zap.Error(err))
+		return
+	}
+	reporter := bot.NewProgressReporter(log, u.FileName(), u.Length)
+	ctx, cancel := context.WithTimeout(context.Background(), processTimeout)
+	defer cancel()
+	messageID, err := bot.UploadToMediaChannel(ctx, dataPath(id), u.FileName(), u.Metadata["filetype"], reporter)
+
+	unlock := lock(id)
+	if err != nil {
+		log.Error("Failed to send upload to Telegram", zap.String("id", id), zap.Error(err))
+		reporter.Fail(err)
+		u.Status = StatusFailed
+		u.Error = err.Error()
+	} else {
+		log.Info("Upload sent to Telegram",
+			zap.String("id", id),
+			zap.String("file", u.FileName()),
+			zap.Int("messageID", messageID))
+		reporter.Finish(config.ValueOf.LinkBase() + "/direct/" + opaqueid.ID(config.ValueOf.MediaChannelID, messageID))
+		u.Status = StatusDone
+		u.MessageID = messageID
+		u.Steps = newSteps()
+	}
+	err = save(u)
+	unlock()
+	if err != nil {
+		log.Error("Failed to save upload state", zap.String("id", id), zap.Error(err))
+	}
+	// The data file is kept for the steps, and is useless after a failure
+	if u.Status == StatusDone {
+		go runPipeline(id)
+	} else {
+		os.Remove(dataPath(id))
+	}
+}
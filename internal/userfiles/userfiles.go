@@ -0,0 +1,74 @@
+// Package userfiles remembers which Telegram user sent which file to the bot,
+// so users can browse their files, e.g. from the mini app.
+package userfiles
+
+import (
+	"EverythingSuckz/fsb/internal/database"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNotFound = errors.New("file not found")
+
+// File is a file a user sent, stored as MessageID of LOG_CHANNEL.
+type File struct {
+	MessageID int       `gorm:"primaryKey;autoIncrement:false" json:"message_id"`
+	UserID    int64     `gorm:"index" json:"user_id"`
+	FileName  string    `json:"file_name"`
+	Size      int64     `json:"size"`
+	MimeType  string    `json:"mime_type"`
+	Hash      string    `json:"-"` // full hash, see utils.PackFile
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (File) TableName() string { return "user_files" }
+
+func init() {
+	database.RegisterModel(&File{})
+}
+
+// Record stores a file a user sent. Without a database it does nothing.
+func Record(f File) error {
+	if database.DB == nil {
+		return nil
+	}
+	if f.CreatedAt.IsZero() {
+		f.CreatedAt = time.Now()
+	}
+	return database.DB.Clauses(clause.OnConflict{UpdateAll: true}).Create(&f).Error
+}
+
+// List returns a page of the files of userID, newest first, and how many
+// there are in total.
+func List(userID int64, offset, limit int) ([]File, int64, error) {
+	if database.DB == nil {
+		return nil, 0, nil
+	}
+	var total int64
+	if err := database.DB.Model(&File{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	files := []File{}
+	err := database.DB.Where("user_id = ?", userID).
+		Order("message_id DESC").
+		Offset(offset).
+		Limit(limit).
+		Find(&files).Error
+	return files, total, err
+}
+
+// Get returns the file stored as messageID when userID sent it.
+func Get(userID int64, messageID int) (File, error) {
+	var f File
+	if database.DB == nil {
+		return f, ErrNotFound
+	}
+	err := database.DB.Where("user_id = ? AND message_id = ?", userID, messageID).First(&f).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return f, ErrNotFound
+	}
+	return f, err
+}
@@ -0,0 +1,225 @@
+package utils
+
+import (
+	"EverythingSuckz/fsb/config"
+	"EverythingSuckz/fsb/internal/janitor"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const (
+	chunkFileExt = ".chunk"
+	// chunkTempMaxAge is how long an unfinished chunk write may stay around.
+	chunkTempMaxAge = time.Hour
+)
+
+// chunkCache keeps chunks fetched from Telegram on disk, up to a size cap,
+// evicting the least recently used ones. The index lives in memory and is
+// rebuilt from the directory at startup, ordered by modification time.
+type chunkCache struct {
+	dir   string
+	limit int64
+
+	mu    sync.Mutex
+	size  int64
+	order *list.List // of *chunkEntry, most recently used first
+	index map[string]*list.Element
+}
+
+type chunkEntry struct {
+	name string
+	size int64
+}
+
+var (
+	chunks      *chunkCache
+	chunkHits   int64
+	chunkMisses int64
+)
+
+// InitChunkCache enables the on-disk chunk cache when CHUNK_CACHE_MB is set.
+// It must run before janitor.Recover so interrupted writes are cleaned up.
+func InitChunkCache(l *zap.Logger) error {
+	log := l.Named("ChunkCache")
+	if config.ValueOf.ChunkCacheMB <= 0 {
+		return nil
+	}
+	dir := config.ValueOf.ChunkCacheDir
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	janitor.Register(janitor.Target{
+		Name:            "chunk-tmp",
+		Dir:             dir,
+		Pattern:         "*.tmp",
+		MaxAge:          chunkTempMaxAge,
+		RemoveOnStartup: true,
+	})
+
+	c := &chunkCache{
+		dir:   dir,
+		limit: int64(config.ValueOf.ChunkCacheMB) * 1024 * 1024,
+		order: list.New(),
+		index: make(map[string]*list.Element),
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type existing struct {
+		chunkEntry
+		modTime time.Time
+	}
+	var found []existing
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), chunkFileExt) {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			found = append(found, existing{chunkEntry{e.Name(), info.Size()}, info.ModTime()})
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.After(found[j].modTime) })
+	for _, f := range found {
+		entry := f.chunkEntry
+		c.index[entry.name] = c.order.PushBack(&entry)
+		c.size += entry.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+
+	chunks = c
+	log.Info("Chunk cache enabled",
+		zap.String("dir", dir),
+		zap.Int("maxMB", config.ValueOf.ChunkCacheMB),
+		zap.Int("chunks", c.order.Len()))
+	return nil
+}
+
+func chunkFileName(location tg.InputFileLocationClass, offset, limit int64) (string, bool) {
+	key, ok := chunkKeyFor(location, offset, limit)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%c%d_%s_%d_%d%s", key.kind, key.id, key.thumb, key.offset, key.limit, chunkFileExt), true
+}
+
+// cachedChunk returns the chunk from disk when it's there.
+func cachedChunk(location tg.InputFileLocationClass, offset, limit int64) ([]byte, bool) {
+	c := chunks
+	if c == nil {
+		return nil, false
+	}
+	name, ok := chunkFileName(location, offset, limit)
+	if !ok {
+		return nil, false
+	}
+	c.mu.Lock()
+	elem, ok := c.index[name]
+	if ok {
+		c.order.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		atomic.AddInt64(&chunkMisses, 1)
+		return nil, false
+	}
+	data, err := os.ReadFile(filepath.Join(c.dir, name))
+	if err != nil {
+		c.mu.Lock()
+		c.remove(name)
+		c.mu.Unlock()
+		atomic.AddInt64(&chunkMisses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&chunkHits, 1)
+	return data, true
+}
+
+// storeChunk writes a chunk fetched from Telegram. Failures only cost a later
+// refetch, so they are not reported.
+func storeChunk(location tg.InputFileLocationClass, offset, limit int64, data []byte) {
+	c := chunks
+	if c == nil || len(data) == 0 || int64(len(data)) > c.limit {
+		return
+	}
+	name, ok := chunkFileName(location, offset, limit)
+	if !ok || CheckDiskSpace(c.dir) != nil {
+		return
+	}
+	c.mu.Lock()
+	_, exists := c.index[name]
+	c.mu.Unlock()
+	if exists {
+		return
+	}
+
+	path := filepath.Join(c.dir, name)
+	tmp, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.index[name]; exists {
+		return
+	}
+	c.index[name] = c.order.PushFront(&chunkEntry{name, int64(len(data))})
+	c.size += int64(len(data))
+	c.evict()
+}
+
+// evict removes the least recently used chunks until the cache fits its cap.
+// c.mu must be held.
+func (c *chunkCache) evict() {
+	for c.size > c.limit && c.order.Len() > 0 {
+		entry := c.order.Back().Value.(*chunkEntry)
+		c.remove(entry.name)
+		os.Remove(filepath.Join(c.dir, entry.name))
+	}
+}
+
+// remove drops name from the index. c.mu must be held.
+func (c *chunkCache) remove(name string) {
+	elem, ok := c.index[name]
+	if !ok {
+		return
+	}
+	c.order.Remove(elem)
+	delete(c.index, name)
+	c.size -= elem.Value.(*chunkEntry).size
+}
+
+// ChunkCacheStats returns the disk chunk cache lookups that hit and missed.
+func ChunkCacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&chunkHits), atomic.LoadInt64(&chunkMisses)
+}
+
+// ChunkCacheEnabled reports whether chunks fetched from Telegram are kept on
+// disk.
+func ChunkCacheEnabled() bool {
+	return chunks != nil
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/gotd/td/tg"
+)
+
+// chunkKey identifies a chunk of a file regardless of the bot fetching it:
+// file references differ per bot, the bytes don't.
+type chunkKey struct {
+	kind   byte
+	id     int64
+	thumb  string
+	offset int64
+	limit  int64
+}
+
+type chunkCall struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+var (
+	chunkCallsMu    sync.Mutex
+	chunkCalls      = make(map[chunkKey]*chunkCall)
+	coalescedChunks int64
+)
+
+func chunkKeyFor(location tg.InputFileLocationClass, offset, limit int64) (chunkKey, bool) {
+	switch l := location.(type) {
+	case *tg.InputDocumentFileLocation:
+		return chunkKey{kind: 'd', id: l.ID, thumb: l.ThumbSize, offset: offset, limit: limit}, true
+	case *tg.InputPhotoFileLocation:
+		return chunkKey{kind: 'p', id: l.ID, thumb: l.ThumbSize, offset: offset, limit: limit}, true
+	}
+	return chunkKey{}, false
+}
+
+// coalesceChunk runs fetch once for concurrent requests of the same chunk
+// and hands the result to every caller, so a file shared publicly costs one
+// Telegram fetch per chunk however many clients play it at once. A caller
+// that waited on a failed fetch tries on its own, with its own bot.
+func coalesceChunk(location tg.InputFileLocationClass, offset, limit int64, fetch func() ([]byte, error)) ([]byte, error) {
+	key, ok := chunkKeyFor(location, offset, limit)
+	if !ok {
+		return fetch()
+	}
+
+	chunkCallsMu.Lock()
+	if call, inFlight := chunkCalls[key]; inFlight {
+		chunkCallsMu.Unlock()
+		<-call.done
+		if call.err != nil {
+			return fetch()
+		}
+		atomic.AddInt64(&coalescedChunks, 1)
+		return call.data, nil
+	}
+	call := &chunkCall{done: make(chan struct{})}
+	chunkCalls[key] = call
+	chunkCallsMu.Unlock()
+
+	call.data, call.err = fetch()
+	chunkCallsMu.Lock()
+	delete(chunkCalls, key)
+	chunkCallsMu.Unlock()
+	close(call.done)
+	return call.data, call.err
+}
+
+// CoalescedChunks returns how many chunk fetches were saved by sharing an
+// in-flight fetch of the same chunk.
+func CoalescedChunks() int64 {
+	return atomic.LoadInt64(&coalescedChunks)
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"EverythingSuckz/fsb/config"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrLowDiskSpace is returned when a cache write would eat into the free-space floor.
+var ErrLowDiskSpace = errors.New("free disk space below MIN_FREE_DISK_MB")
+
+var diskGuardSkips int64
+
+// CheckDiskSpace reports ErrLowDiskSpace when the volume holding dir has less
+// free space than MIN_FREE_DISK_MB. Caches call it before writing so a busy
+// server skips caching instead of filling the volume. Failures to query the
+// filesystem are not treated as low space.
+func CheckDiskSpace(dir string) error {
+	floor := int64(config.ValueOf.MinFreeDiskMB) * 1024 * 1024
+	if floor <= 0 {
+		return nil
+	}
+	free, err := freeDiskSpace(dir)
+	if err != nil {
+		return nil
+	}
+	if int64(free) < floor {
+		atomic.AddInt64(&diskGuardSkips, 1)
+		return ErrLowDiskSpace
+	}
+	return nil
+}
+
+// DiskGuardSkips returns how many cache writes were skipped for lack of disk space.
+func DiskGuardSkips() int64 {
+	return atomic.LoadInt64(&diskGuardSkips)
+}
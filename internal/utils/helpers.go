@@ -14,6 +14,7 @@ import (
 	"github.com/celestix/gotgproto/storage"
 	"github.com/gotd/td/constant"
 	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
 	"go.uber.org/zap"
 )
 
@@ -106,6 +107,15 @@ func FileFromMedia(media tg.MessageMediaClass) (*types.File, error) {
 	return nil, fmt.Errorf("unexpected type %T", media)
 }
 
+// messageDate is when the media of message last changed: its edit date,
+// or the date it was posted.
+func messageDate(message *tg.Message) int {
+	if edited, ok := message.GetEditDate(); ok {
+		return max(message.Date, edited)
+	}
+	return message.Date
+}
+
 func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID int) (*types.File, error) {
 	key := fmt.Sprintf("file:%d:%d", messageID, client.Self.ID)
 	log := Logger.Named("GetMessageMedia")
@@ -124,10 +134,11 @@ func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID in
 	if err != nil {
 		return nil, err
 	}
+	file.Date = messageDate(message)
 	err = cache.GetCache().Set(
 		key,
 		file,
-		3600,
+		config.Live().FileCacheTTLSeconds,
 	)
 	if err != nil {
 		log.Warn("Failed to cache file metadata (continuing without cache)", zap.Error(err))
@@ -135,6 +146,11 @@ func FileFromMessage(ctx context.Context, client *gotgproto.Client, messageID in
 	return file, nil
 }
 
+// ForgetMessageFile drops what FileFromMessage cached for a client.
+func ForgetMessageFile(messageID int, clientID int64) error {
+	return cache.GetCache().Delete(fmt.Sprintf("file:%d:%d", messageID, clientID))
+}
+
 // FileFromMessageAndChannel fetches a file from a specific channel and message ID
 // This function is designed for direct streaming without using the internal hash/DB system
 // It retrieves the message from the specified channel and extracts the file information
@@ -186,10 +202,12 @@ func FileFromMessageAndChannel(ctx context.Context, client *gotgproto.Client, ch
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract file from message: %w", err)
 	}
+	file.Date = messageDate(message)
 
-	// Cache for 4 minutes — file_reference lasts ~60 min, so this is safe.
-	// Dramatically reduces Telegram API calls under concurrent access.
-	if cacheErr := cache.GetCache().Set(cacheKey, file, 240); cacheErr != nil {
+	// Cached for DIRECT_CACHE_TTL_SECONDS, 4 minutes by default — file_reference
+	// lasts ~60 min, so this is safe. Dramatically reduces Telegram API calls
+	// under concurrent access.
+	if cacheErr := cache.GetCache().Set(cacheKey, file, config.Live().DirectCacheTTLSeconds); cacheErr != nil {
 		log.Warn("Failed to cache direct file metadata", zap.Error(cacheErr))
 	}
 
@@ -209,13 +227,28 @@ func RefetchFileFromMessageAndChannel(ctx context.Context, client *gotgproto.Cli
 		zap.Int("messageID", messageID))
 
 	// Invalidate cached entry first
-	cacheKey := fmt.Sprintf("direct:%d:%d:%d", channelID, messageID, client.Self.ID)
-	_ = cache.GetCache().Delete(cacheKey)
+	_ = ForgetFileMetadata(channelID, messageID, client.Self.ID)
 
 	// Fetch fresh from Telegram (FileFromMessageAndChannel will re-cache it)
 	return FileFromMessageAndChannel(ctx, client, channelID, messageID)
 }
 
+// ForgetFileMetadata drops what FileFromMessageAndChannel cached for a client.
+func ForgetFileMetadata(channelID int64, messageID int, clientID int64) error {
+	return cache.GetCache().Delete(fmt.Sprintf("direct:%d:%d:%d", channelID, messageID, clientID))
+}
+
+// ErrNoChannelAccess is returned for channels the client was banned or
+// removed from.
+var ErrNoChannelAccess = errors.New("no access to the channel")
+
+// IsNoChannelAccess reports whether err means the client is neither a member
+// nor an admin of the channel. Telegram answers CHANNEL_PRIVATE, or
+// CHANNEL_INVALID to bots that never joined.
+func IsNoChannelAccess(err error) bool {
+	return errors.Is(err, ErrNoChannelAccess) || tgerr.Is(err, "CHANNEL_PRIVATE", "CHANNEL_INVALID")
+}
+
 func GetLogChannelPeer(ctx context.Context, api *tg.Client, peerStorage *storage.PeerStorage) (*tg.InputChannel, error) {
 	return GetChannelPeer(ctx, api, peerStorage, config.ValueOf.LogChannelID)
 }
@@ -257,6 +290,9 @@ func GetChannelPeer(ctx context.Context, api *tg.Client, peerStorage *storage.Pe
 	if len(channels.GetChats()) == 0 {
 		return nil, errors.New("no channels found")
 	}
+	if _, forbidden := channels.GetChats()[0].(*tg.ChannelForbidden); forbidden {
+		return nil, ErrNoChannelAccess
+	}
 	channel, ok := channels.GetChats()[0].(*tg.Channel)
 	if !ok {
 		return nil, errors.New("type assertion to *tg.Channel failed")
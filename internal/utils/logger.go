@@ -2,6 +2,8 @@ package utils
 
 import (
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -52,10 +54,86 @@ func InitLogger(debugMode bool, logLevel string) {
 		}
 	}
 
+	moduleLevels.Store(&loggerLevels{base: consoleLevel, min: consoleLevel})
 	core := zapcore.NewTee(
-		zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), consoleLevel),
+		&moduleLevelCore{Core: zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), zapcore.DebugLevel)},
 		zapcore.NewCore(fileEncoder, fileWriter, zapcore.DebugLevel),
 	)
 
 	Logger = zap.New(core, zap.AddStacktrace(zapcore.FatalLevel))
 }
+
+// loggerLevels are the console levels: base for every logger, overridden by
+// LOG_LEVELS for some of them.
+type loggerLevels struct {
+	base    zapcore.Level
+	modules map[string]zapcore.Level // lowercase logger name -> level
+	min     zapcore.Level            // lowest of all, for Enabled
+}
+
+var moduleLevels atomic.Pointer[loggerLevels]
+
+// SetLogLevels applies LOG_LEVELS, <logger>=<level> entries such as
+// Workers=debug or cache=error, to the console on top of LOG_LEVEL. Names are
+// those passed to Named, matched without case; in a nested logger such as
+// routes.Status the innermost name with a level wins. It can be called again
+// to change them while running.
+func SetLogLevels(entries []string) {
+	current := moduleLevels.Load()
+	if current == nil || Logger == nil {
+		return
+	}
+	levels := &loggerLevels{base: current.base, modules: make(map[string]zapcore.Level), min: current.base}
+	for _, entry := range entries {
+		name, text, found := strings.Cut(strings.TrimSpace(entry), "=")
+		level, err := zapcore.ParseLevel(strings.TrimSpace(text))
+		if name = strings.ToLower(strings.TrimSpace(name)); !found || name == "" || strings.TrimSpace(text) == "" || err != nil {
+			Logger.Sugar().Warnf("Ignoring LOG_LEVELS entry %q, expected <logger>=<debug|info|warn|error>", entry)
+			continue
+		}
+		levels.modules[name] = level
+		levels.min = min(levels.min, level)
+	}
+	moduleLevels.Store(levels)
+	if len(levels.modules) > 0 {
+		Logger.Sugar().Infof("Log levels set for %d loggers", len(levels.modules))
+	}
+}
+
+// levelOf returns the console level of the logger called name.
+func (l *loggerLevels) levelOf(name string) zapcore.Level {
+	if len(l.modules) == 0 || name == "" {
+		return l.base
+	}
+	name = strings.ToLower(name)
+	if level, ok := l.modules[name]; ok {
+		return level
+	}
+	parts := strings.Split(name, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if level, ok := l.modules[parts[i]]; ok {
+			return level
+		}
+	}
+	return l.base
+}
+
+// moduleLevelCore filters a core by the level of each entry's logger.
+type moduleLevelCore struct {
+	zapcore.Core
+}
+
+func (c *moduleLevelCore) Enabled(level zapcore.Level) bool {
+	return level >= moduleLevels.Load().min
+}
+
+func (c *moduleLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &moduleLevelCore{Core: c.Core.With(fields)}
+}
+
+func (c *moduleLevelCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Level < moduleLevels.Load().levelOf(entry.LoggerName) {
+		return checked
+	}
+	return checked.AddCore(entry, c)
+}
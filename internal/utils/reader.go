@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"EverythingSuckz/fsb/internal/flags"
 	"context"
 	"fmt"
 	"io"
@@ -25,7 +26,11 @@ type telegramReader struct {
 	i             int64
 	contentLength int64
 
+	// Share in-flight fetches of the same chunk with other readers
+	coalesce bool
+
 	// Read-ahead: prefetch next chunk while current one is being consumed
+	prefetch     bool
 	prefetchOnce sync.Once
 	prefetchBuf  []byte
 	prefetchErr  error
@@ -54,6 +59,8 @@ func NewTelegramReader(
 		end:           end,
 		chunkSize:     int64(1024 * 1024),
 		contentLength: contentLength,
+		coalesce:      flags.Enabled(flags.CoalesceChunks),
+		prefetch:      flags.Enabled(flags.StreamPrefetch),
 	}
 	r.log.Sugar().Debug("Start")
 	r.next = r.partStream()
@@ -104,16 +111,18 @@ func (r *telegramReader) Read(p []byte) (n int, err error) {
 		r.i = 0
 
 		// Start prefetching the next chunk while this one is being consumed
-		r.prefetchOnce.Do(func() {
-			r.startPrefetch()
-		})
+		if r.prefetch {
+			r.prefetchOnce.Do(func() {
+				r.startPrefetch()
+			})
+		}
 	}
 	n = copy(p, r.buffer[r.i:])
 	r.i += int64(n)
 	r.bytesread += int64(n)
 
 	// If we've consumed most of the current buffer, ensure prefetch is running
-	if r.prefetchDone == nil && r.i >= int64(len(r.buffer))/2 {
+	if r.prefetch && r.prefetchDone == nil && r.i >= int64(len(r.buffer))/2 {
 		r.prefetchOnce.Do(func() {
 			r.startPrefetch()
 		})
@@ -123,6 +132,23 @@ func (r *telegramReader) Read(p []byte) (n int, err error) {
 }
 
 func (r *telegramReader) chunk(offset int64, limit int64) ([]byte, error) {
+	if data, ok := cachedChunk(r.location, offset, limit); ok {
+		return data, nil
+	}
+	fetch := func() ([]byte, error) {
+		data, err := r.fetchChunk(offset, limit)
+		if err == nil {
+			storeChunk(r.location, offset, limit, data)
+		}
+		return data, err
+	}
+	if r.coalesce {
+		return coalesceChunk(r.location, offset, limit, fetch)
+	}
+	return fetch()
+}
+
+func (r *telegramReader) fetchChunk(offset int64, limit int64) ([]byte, error) {
 
 	req := &tg.UploadGetFileRequest{
 		Offset:   offset,
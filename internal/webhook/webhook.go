@@ -0,0 +1,20 @@
+// Package webhook holds what the webhooks posted by fsb (uploads, capacity)
+// have in common.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// SignatureHeader carries "sha256=<hex HMAC of the body>" on webhooks posted
+// with a secret.
+const SignatureHeader = "X-Fsb-Signature"
+
+// Sign returns the SignatureHeader value of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,100 @@
+// This file is a part of EverythingSuckz/TG-FileStreamBot
+// And is licenced under the Affero General Public License.
+// Any distributions of this code MUST be accompanied by a copy of the AGPL
+// with proper attribution to the original author(s).
+
+package qrlogin
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"golang.org/x/term"
+)
+
+// terminalAuth asks for the phone number, login code and 2FA password on
+// the terminal.
+type terminalAuth struct {
+	phone  string
+	reader *bufio.Reader
+}
+
+func (a *terminalAuth) ask(prompt string) (string, error) {
+	fmt.Print(prompt)
+	answer, err := a.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+func (a *terminalAuth) Phone(ctx context.Context) (string, error) {
+	if a.phone != "" {
+		return a.phone, nil
+	}
+	return a.ask("Enter your phone number in international format (e.g. +14155552671): ")
+}
+
+// Password reads the 2FA password without echoing it. Piped input, which
+// has no echo, is read as a line.
+func (a *terminalAuth) Password(ctx context.Context) (string, error) {
+	const prompt = "2FA password is required, enter it: "
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return a.ask(prompt)
+	}
+	fmt.Print(prompt)
+	password, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	return string(password), nil
+}
+
+func (a *terminalAuth) Code(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
+	return a.ask("Enter the login code Telegram sent you: ")
+}
+
+func (a *terminalAuth) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOfService) error {
+	return errors.New("this phone number has no Telegram account, sign up in a Telegram app first")
+}
+
+func (a *terminalAuth) SignUp(ctx context.Context) (auth.UserInfo, error) {
+	return auth.UserInfo{}, errors.New("this phone number has no Telegram account, sign up in a Telegram app first")
+}
+
+// GeneratePhoneSession logs in with a phone number, the code Telegram sends
+// and the 2FA password when one is set, then prints the session string
+// USER_SESSION takes. phone is asked for when empty.
+func GeneratePhoneSession(apiId int, apiHash string, phone string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fmt.Println("Generating phone session...")
+	sessionStorage := &session.StorageMemory{}
+	client := telegram.NewClient(apiId, apiHash, telegram.Options{
+		SessionStorage: sessionStorage,
+		Device: telegram.DeviceConfig{
+			DeviceModel:   "Pyrogram",
+			SystemVersion: runtime.GOOS,
+			AppVersion:    "2.0",
+		},
+	})
+	authenticator := &terminalAuth{phone: strings.TrimSpace(phone), reader: bufio.NewReader(os.Stdin)}
+	return client.Run(ctx, func(ctx context.Context) error {
+		flow := auth.NewFlow(authenticator, auth.SendCodeOptions{})
+		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+			return fmt.Errorf("login failed: %w", err)
+		}
+		return printSession(ctx, client, sessionStorage, apiId)
+	})
+}
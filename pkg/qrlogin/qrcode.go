@@ -65,7 +65,6 @@ func GenerateQRSession(apiId int, apiHash string) error {
 			AppVersion:    "2.0",
 		},
 	})
-	var stringSession string
 	qrWriter := &CustomWriter{}
 	tickerCtx, cancelTicker := context.WithCancel(context.Background())
 	err := client.Run(ctx, func(ctx context.Context) error {
@@ -114,39 +113,45 @@ func GenerateQRSession(apiId int, apiHash string) error {
 			cancel()
 			return errors.New("authorization is nil")
 		}
-		user, err := client.Self(ctx)
-		if err != nil {
-			return err
-		}
-		if user.Username == "" {
-			fmt.Println("Logged in as ", user.FirstName, user.LastName)
-		} else {
-			fmt.Println("Logged in as @", user.Username)
-		}
-		res, _ := sessionStorage.LoadSession(ctx)
-		type jsonDataStruct struct {
-			Version int
-			Data    session.Data
-		}
-		var jsonData jsonDataStruct
-		json.Unmarshal(res, &jsonData)
-		stringSession, err = EncodeToPyrogramSession(&jsonData.Data, int32(apiId))
-		if err != nil {
-			return err
-		}
-		fmt.Println("Your pyrogram session string:", stringSession)
-		client.API().MessagesSendMessage(
-			ctx,
-			&tg.MessagesSendMessageRequest{
-				NoWebpage: true,
-				Peer:      &tg.InputPeerSelf{},
-				Message:   "Your pyrogram session string: " + stringSession,
-			},
-		)
-		return nil
+		return printSession(ctx, client, sessionStorage, apiId)
 	})
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// printSession prints the Pyrogram session string of a logged in client and
+// sends it to the account's Saved Messages.
+func printSession(ctx context.Context, client *telegram.Client, sessionStorage *session.StorageMemory, apiId int) error {
+	user, err := client.Self(ctx)
+	if err != nil {
+		return err
+	}
+	if user.Username == "" {
+		fmt.Println("Logged in as ", user.FirstName, user.LastName)
+	} else {
+		fmt.Println("Logged in as @", user.Username)
+	}
+	res, _ := sessionStorage.LoadSession(ctx)
+	type jsonDataStruct struct {
+		Version int
+		Data    session.Data
+	}
+	var jsonData jsonDataStruct
+	json.Unmarshal(res, &jsonData)
+	stringSession, err := EncodeToPyrogramSession(&jsonData.Data, int32(apiId))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Your pyrogram session string:", stringSession)
+	client.API().MessagesSendMessage(
+		ctx,
+		&tg.MessagesSendMessageRequest{
+			NoWebpage: true,
+			Peer:      &tg.InputPeerSelf{},
+			Message:   "Your pyrogram session string: " + stringSession,
+		},
+	)
+	return nil
+}